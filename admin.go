@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	adminToken = flag.String("adminToken", "", "the bearer token required for /admin endpoints, they're disabled if empty")
+	adminAddr  = flag.String("adminAddr", "", "the address to serve the admin, debug, health and metrics endpoints on, such as localhost:8081, instead of the public listener")
+)
+
+// adminMux serves the admin routes when -adminAddr is set.
+var adminMux = http.NewServeMux()
+
+// adminRoute registers h for pattern on the admin listener if -adminAddr is
+// set, and on the public mux like route otherwise. Admin routes aren't listed
+// by the public / index when they have their own listener.
+func adminRoute(pattern string, h http.HandlerFunc) {
+	if *adminAddr == "" {
+		route(pattern, h)
+		return
+	}
+	authRoute(pattern)
+	if disableRoute(pattern) {
+		h = disabledEndpoint(pattern)
+	}
+	adminMux.HandleFunc(pattern, h)
+}
+
+// serveAdmin serves the admin routes on -adminAddr.
+func serveAdmin() {
+	log.Printf("Serving admin endpoints on %s...", *adminAddr)
+	if err := newHTTPServer(*adminAddr, compressed(authenticated(adminMux))).ListenAndServe(); err != nil {
+		log.Printf("admin: %+v", err)
+	}
+}
+
+// adminOnly restricts f to requests carrying the -adminToken as a bearer
+// token.
+func adminOnly(f http.HandlerFunc) http.HandlerFunc {
+	return handle(func(w http.ResponseWriter, r *http.Request) error {
+		if *adminToken == "" {
+			return statusErrorf(http.StatusForbidden, "admin endpoints are disabled, start with -adminToken")
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+			return statusErrorf(http.StatusUnauthorized, "invalid admin token")
+		}
+		f(w, r)
+		return nil
+	})
+}
+
+// handleReload serves POST /admin/reload, which reloads the index in the
+// background. Requests keep being served from the current index until the new
+// one has finished loading. Progress is reported by /healthz.
+func handleReload(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return statusErrorf(http.StatusMethodNotAllowed, "reload must be a POST")
+	}
+	if !beginLoad() {
+		return statusErrorf(http.StatusConflict, "a load is already in progress")
+	}
+	go loadAll()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return writeJSON(w, r, struct {
+		Status string `json:"status"`
+	}{"reloading"})
+}
+
+// secretFlags are the flags whose values /admin/config never shows.
+var secretFlags = map[string]bool{
+	"adminToken": true,
+	"authToken":  true,
+}
+
+// redacted replaces secrets in /admin/config.
+const redacted = "REDACTED"
+
+type configFlag struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	// Set is whether the flag was given on the command line rather than
+	// left at its default.
+	Set bool `json:"set"`
+}
+
+// redactFlag returns the value of f as /admin/config shows it, with secret
+// flags and the passwords of URLs redacted.
+func redactFlag(f *flag.Flag, value string) string {
+	if value == "" {
+		return ""
+	}
+	if secretFlags[f.Name] {
+		return redacted
+	}
+	if strings.Contains(value, "@") {
+		parts := strings.Split(value, ",")
+		for i, part := range parts {
+			// -wikis is a list of lang=URL pairs.
+			prefix := ""
+			if j := strings.Index(part, "="); j >= 0 && !strings.Contains(part[:j], "/") {
+				prefix, part = part[:j+1], part[j+1:]
+			}
+			if u, err := url.Parse(part); err == nil && u.User != nil {
+				if _, ok := u.User.Password(); ok {
+					u.User = url.UserPassword(u.User.Username(), redacted)
+					part = u.String()
+				}
+			}
+			parts[i] = prefix + part
+		}
+		value = strings.Join(parts, ",")
+	}
+	return value
+}
+
+// effectiveConfig lists every flag with the value in effect, sorted by
+// name.
+func effectiveConfig() []configFlag {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var config []configFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		config = append(config, configFlag{
+			Name:    f.Name,
+			Value:   redactFlag(f, f.Value.String()),
+			Default: redactFlag(f, f.DefValue),
+			Set:     set[f.Name],
+		})
+	})
+	return config
+}
+
+// handleConfig serves /admin/config, listing the value of every flag the
+// server is running with, so operators can check what's in effect without a
+// shell on the host. Secrets are redacted.
+func handleConfig(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, r, effectiveConfig())
+}
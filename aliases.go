@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var aliasFile = flag.String("aliasFile", "", "a file of alias<TAB>target lines, titles that are looked up as their target instead, overriding any article the dump has with the alias's title")
+
+// titleAliases is the -aliasFile, keyed and valued by aliasKey.
+var titleAliases = struct {
+	sync.Mutex
+
+	targets map[string]string
+}{}
+
+// aliasKey normalizes a title the way the wiki treats titles as the same:
+// with underscores as spaces and the first letter capitalized.
+func aliasKey(title string) string {
+	return capitalizeTitle(strings.TrimSpace(strings.Replace(title, "_", " ", -1)), *lang)
+}
+
+// readAliases parses an -aliasFile. Blank lines and lines starting with #
+// are skipped.
+func readAliases(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	targets := map[string]string{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.Errorf("%s:%d: expected alias<TAB>target, got %q", path, n, line)
+		}
+		targets[aliasKey(parts[0])] = aliasKey(parts[1])
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrapf(err, "reading %s", path)
+	}
+	return targets, nil
+}
+
+// loadAliases reads the -aliasFile, if there is one, replacing the aliases
+// in use. They're left as they were if it can't be read.
+func loadAliases() error {
+	if *aliasFile == "" {
+		return nil
+	}
+	targets, err := readAliases(*aliasFile)
+	if err != nil {
+		return err
+	}
+	titleAliases.Lock()
+	titleAliases.targets = targets
+	titleAliases.Unlock()
+	log.Printf("Loaded %d title aliases from %s", len(targets), *aliasFile)
+	return nil
+}
+
+// resolveAlias returns the target of name if it's an alias, and name
+// otherwise. Aliases aren't chained, so an alias of an alias isn't followed
+// further.
+func resolveAlias(name string) string {
+	titleAliases.Lock()
+	defer titleAliases.Unlock()
+
+	if target, ok := titleAliases.targets[aliasKey(name)]; ok {
+		return target
+	}
+	return name
+}
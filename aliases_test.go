@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "President of the United States", "head of state"),
+		testPage(2, "Mercury", "a planet or an element"),
+		testPage(3, "Mercury (planet)", "the planet"),
+	})
+	path := filepath.Join(t.TempDir(), "aliases.tsv")
+	if err := ioutil.WriteFile(path, []byte("# shortcuts\nPOTUS\tPresident_of_the_United_States\n\nmercury\tMercury (planet)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(file string) {
+		*aliasFile = file
+		titleAliases.Lock()
+		titleAliases.targets = nil
+		titleAliases.Unlock()
+	}(*aliasFile)
+	*aliasFile = path
+	if err := loadAliases(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"POTUS", "President of the United States"},
+		{"pOTUS", "President of the United States"},
+		// Aliases override the dump's own titles.
+		{"Mercury", "Mercury (planet)"},
+		{"President of the United States", "President of the United States"},
+	} {
+		p, err := lookupArticle(c.in)
+		if err != nil {
+			t.Errorf("lookupArticle(%q): %v", c.in, err)
+		} else if p.Title != c.want {
+			t.Errorf("lookupArticle(%q) = %q; not %q", c.in, p.Title, c.want)
+		}
+	}
+
+	// A bad file leaves the aliases as they were.
+	if err := ioutil.WriteFile(path, []byte("POTUS President\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadAliases(); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("loadAliases = %v; expected an error on line 1", err)
+	}
+	if got := resolveAlias("POTUS"); got != "President of the United States" {
+		t.Errorf("resolveAlias(POTUS) = %q after a failed reload", got)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// handleArticle serves /article?title=..., returning the decoded page with
+// whatever its options, documented in the spec, change or add. HEAD requests
+// are handled by handleArticleHead.
+func handleArticle(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	if q.Get("langChain") != "" {
+		return handleLangChain(w, r)
+	}
+	if r.Method == http.MethodHead {
+		return handleArticleHead(w, r)
+	}
+	resolve := q.Get("resolve")
+	if resolve != "" && resolve != "options" {
+		return statusErrorf(http.StatusBadRequest, "invalid resolve %q, expected options", resolve)
+	}
+	tables := q.Get("tables")
+	if tables != "" && tables != "json" {
+		return statusErrorf(http.StatusBadRequest, "invalid tables %q, expected json", tables)
+	}
+	p, stats, err := lookupArticleStats(q.Get("title"))
+	if err != nil {
+		return err
+	}
+	setReadStatsHeaders(w, stats)
+	var redirectedFrom, redirectSection string
+	if follow, _ := strconv.ParseBool(q.Get("followRedirect")); follow {
+		from := p.Title
+		if p, redirectSection, err = followRedirect(p); err != nil {
+			return err
+		}
+		if p.Title != from {
+			redirectedFrom = from
+		}
+	}
+	if rev := q.Get("rev"); rev != "" && rev != p.RevisionID {
+		return statusErrorf(http.StatusConflict, "revision mismatch for %q: requested %s, dump has %s", p.Title, rev, p.RevisionID)
+	}
+	if resolve == "options" && p.PageType == pageTypeDisambiguation {
+		return writeJSON(w, r, disambiguation{
+			Title:   p.Title,
+			Options: extractDisambiguationOptions(p.Text),
+		})
+	}
+	resolveMedia, _ := strconv.ParseBool(q.Get("resolveMedia"))
+	if format := q.Get("format"); format != "" {
+		return writeFormat(w, p, format, renderOptions{resolveMedia: resolveMedia})
+	}
+	clean, _ := strconv.ParseBool(q.Get("clean"))
+	article := articleResponse{
+		page:            p,
+		ContentHash:     contentHash(p.Text),
+		CanonicalURL:    canonicalURL(p.Title),
+		RedirectedFrom:  redirectedFrom,
+		RedirectSection: redirectSection,
+	}
+	if resolveMedia {
+		article.Media = mediaRefs(p.Text)
+	}
+	if tables == "json" {
+		article.Tables = extractTables(p.Text)
+	}
+	if includeAgeRank, _ := strconv.ParseBool(q.Get("includeAgeRank")); includeAgeRank {
+		rank := estimatedAgeRank(p.ID)
+		article.EstimatedAgeRank = &rank
+	}
+	if includeAliases, _ := strconv.ParseBool(q.Get("includeAliases")); includeAliases {
+		if aliases, ok := articleAliases(p.Title); ok {
+			article.Aliases = &aliases
+		}
+	}
+	if anchors, _ := strconv.ParseBool(q.Get("anchors")); anchors {
+		sections := extractSections(p.Text)
+		article.Anchors = map[string]string{}
+		for _, s := range sections {
+			if _, ok := article.Anchors[s.Title]; !ok {
+				article.Anchors[s.Title] = s.Anchor
+			}
+		}
+		if !clean {
+			article.Text = injectAnchors(p.Text, sections)
+		}
+	}
+	if footnotes, _ := strconv.ParseBool(q.Get("footnotes")); footnotes {
+		article.Text, article.Footnotes = plainTextFootnotes(resolveMagicWords(p.Text, p))
+	} else if clean {
+		article.Text = plainText(resolveMagicWords(p.Text, p))
+	}
+	var resp interface{} = article
+	if includeTalk, _ := strconv.ParseBool(q.Get("includeTalk")); includeTalk {
+		talk, err := talkPage(p.Title)
+		if err != nil {
+			return err
+		}
+		if article.QualityFlag == "" && talk != nil {
+			article.QualityFlag = detectTalkQualityFlag(talk.Text)
+		}
+		resp = struct {
+			articleResponse
+			Talk *page `json:"talk"`
+		}{article, talk}
+	}
+	resp, err = selectFields(r, resp)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, resp)
+}
+
+// handleArticleHead serves HEAD /article?title=..., checking whether the
+// article exists, and with rev whether it's at that revision, without
+// reading its text. The revision is returned in the X-Revision-ID header and
+// its timestamp as Last-Modified.
+func handleArticleHead(w http.ResponseWriter, r *http.Request) error {
+	m, err := lookupMeta(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	if rev := r.URL.Query().Get("rev"); rev != "" && rev != m.RevisionID {
+		return statusErrorf(http.StatusConflict, "revision mismatch for %q: requested %s, dump has %s", m.Title, rev, m.RevisionID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Revision-ID", m.RevisionID)
+	if t, err := time.Parse(time.RFC3339, m.Timestamp); err == nil {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// disambiguation is what /article?resolve=options returns for a
+// disambiguation page.
+type disambiguation struct {
+	Title   string                 `json:"title"`
+	Options []disambiguationOption `json:"options"`
+}
+
+// articleResponse is a page as returned by /article, with the hash of its
+// text and its URL on the live wiki, and the redirect it was reached by, the
+// anchors of its sections, its footnotes, its media, its aliases and its
+// tables if they were asked for.
+type articleResponse struct {
+	page
+	// ContentHash is of the text in the dump, before any changes asked
+	// for, see contentHash.
+	ContentHash string `json:"contentHash"`
+	// CanonicalURL is the article's URL on the live wiki, see canonicalURL.
+	CanonicalURL string `json:"canonicalURL"`
+	// RedirectedFrom is the title of the redirect followed to the article,
+	// and RedirectSection the section of the article it points to.
+	RedirectedFrom  string            `json:"redirectedFrom,omitempty"`
+	RedirectSection string            `json:"redirectSection,omitempty"`
+	Anchors         map[string]string `json:"anchors,omitempty"`
+	Footnotes       []string          `json:"footnotes,omitempty"`
+	Media           []mediaRef        `json:"media,omitempty"`
+	Tables          []wikiTable       `json:"tables,omitempty"`
+	// EstimatedAgeRank is only set if it was asked for.
+	EstimatedAgeRank *float64 `json:"estimatedAgeRank,omitempty"`
+	// Aliases is nil, rather than empty, if the redirect index isn't
+	// built, so it's left out instead of claiming there are none.
+	Aliases *[]string `json:"aliases,omitempty"`
+}
+
+// estimatedAgeRank guesses how old the page with the given ID is relative to
+// the rest of the dump, from near 0 for the oldest to 1 for the newest. The dump
+// only has each page's latest revision, so it's the ID divided by the
+// highest ID in the index, going by IDs being handed out in order as pages
+// are created. It's a heuristic for rough chronological sorting, not a
+// creation date: IDs aren't evenly spread over time, and pages that were
+// deleted and restored or merged can have IDs much newer or older than they
+// are.
+func estimatedAgeRank(id int) float64 {
+	mu.Lock()
+	maxID := mu.maxID
+	mu.Unlock()
+	if maxID <= 0 || id <= 0 {
+		return 0
+	}
+	if id >= maxID {
+		return 1
+	}
+	return float64(id) / float64(maxID)
+}
+
+// talkPage returns the talk page of the article title, or nil if it doesn't
+// have one in the dump.
+func talkPage(title string) (*page, error) {
+	talk, ok := talkTitle(title)
+	if !ok {
+		return nil, nil
+	}
+	meta, err := fetchArticle(talk)
+	if code, ok := errors.Cause(err).(statusError); ok && code == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	p, err := readArticle(meta)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// handleXML serves /xml?title=..., returning the article's <page> element
+// verbatim from the dump, including any fields that aren't decoded into a
+// page.
+func handleXML(w http.ResponseWriter, r *http.Request) error {
+	meta, err := fetchArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	raw, stats, err := readRawPageStats(meta)
+	if err != nil {
+		return err
+	}
+	setReadStatsHeaders(w, stats)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	_, err = w.Write(raw)
+	return err
+}
+
+// handleRaw serves /raw?title=..., returning just the article's wikitext, or
+// its plain text with clean=true. Pages with other content models, like
+// JavaScript and CSS, are served with their own Content-Type, and clean is
+// ignored for them. Range requests are supported so clients can
+// fetch part of a huge article or resume a download, and the revision
+// timestamp is used as the modification time for conditional requests.
+func handleRaw(w http.ResponseWriter, r *http.Request) error {
+	p, stats, err := lookupArticleStats(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	setReadStatsHeaders(w, stats)
+	text := p.Text
+	contentType := rawContentType(p)
+	if clean, _ := strconv.ParseBool(r.URL.Query().Get("clean")); clean && strings.HasPrefix(contentType, "text/plain") {
+		text = plainText(resolveMagicWords(text, p))
+	}
+	serveRaw(w, r, p, text, contentType)
+	return nil
+}
+
+// serveRaw responds with text, the text of p or something derived from it,
+// supporting range and conditional requests as handleRaw describes.
+func serveRaw(w http.ResponseWriter, r *http.Request, p page, text, contentType string) {
+	modtime, _ := time.Parse(time.RFC3339, p.Timestamp)
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", modtime, strings.NewReader(text))
+}
+
+type articleLength struct {
+	Title     string `json:"title"`
+	Length    int    `json:"length"`
+	WordCount int    `json:"wordCount"`
+}
+
+// handleLength serves /length?title=..., returning just the size of an
+// article's text.
+func handleLength(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, articleLength{
+		Title:     p.Title,
+		Length:    p.Length,
+		WordCount: p.WordCount,
+	})
+}
+
+type revisionInfo struct {
+	Title      string `json:"title"`
+	RevisionID string `json:"revisionID"`
+	Timestamp  string `json:"timestamp"`
+	// Time is Timestamp normalized to RFC 3339 in UTC, or empty if the dump's
+	// timestamp couldn't be parsed.
+	Time   string `json:"time,omitempty"`
+	Model  string `json:"model"`
+	Format string `json:"format"`
+}
+
+// handleRevision serves /revision?title=..., returning the metadata of the
+// revision in the dump without its text, so clients can check freshness
+// before fetching the article. The text isn't read, so it's much cheaper than
+// fetching the article.
+func handleRevision(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupMeta(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	info := revisionInfo{
+		Title:      p.Title,
+		RevisionID: p.RevisionID,
+		Timestamp:  p.Timestamp,
+		Model:      p.Model,
+		Format:     p.Format,
+	}
+	if t, err := time.Parse(time.RFC3339, p.Timestamp); err == nil {
+		info.Time = t.UTC().Format(time.RFC3339)
+	}
+	return writeJSON(w, r, info)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleRawRange(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "0123456789")})
+
+	req := httptest.NewRequest("GET", "/raw?title=Foo", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	handle(handleRaw)(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d; not %d: %s", w.Code, http.StatusPartialContent, w.Body)
+	}
+	if got := w.Body.String(); got != "2345" {
+		t.Errorf("body = %q; not %q", got, "2345")
+	}
+	if got := w.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("Content-Range = %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/raw?title=Foo", nil)
+	req.Header.Set("If-Modified-Since", "Sat, 01 Jan 2022 00:00:00 GMT")
+	w = httptest.NewRecorder()
+	handle(handleRaw)(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d; expected %d for an unchanged revision", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestHandleRawContentType(t *testing.T) {
+	js := testPage(2, "MediaWiki:Common.js", "var x = 1;")
+	js.Model, js.Format = "javascript", "text/javascript"
+	css := testPage(3, "MediaWiki:Common.css", "body {}")
+	css.Model, css.Format = "css", "text/css"
+	data := testPage(4, "Module:Data.json", "{}")
+	data.Model, data.Format = "json", "application/json"
+	lua := testPage(5, "Module:Foo", "return {}")
+	lua.Model, lua.Format = "Scribunto", "text/plain"
+	useTestDump(t, []page{testPage(1, "Foo", "[[Foo]] bar"), js, css, data, lua})
+
+	cases := []struct {
+		title, want, body string
+	}{
+		{"Foo", "text/plain; charset=utf-8", "Foo bar"},
+		{"MediaWiki:Common.js", "application/javascript; charset=utf-8", "var x = 1;"},
+		{"MediaWiki:Common.css", "text/css; charset=utf-8", "body {}"},
+		{"Module:Data.json", "application/json; charset=utf-8", "{}"},
+		{"Module:Foo", "text/plain; charset=utf-8", "return {}"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/raw?clean=true&title="+url.QueryEscape(c.title), nil)
+		w := httptest.NewRecorder()
+		handle(handleRaw)(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d: %s", c.title, w.Code, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != c.want {
+			t.Errorf("%s: Content-Type = %q; not %q", c.title, got, c.want)
+		}
+		if got := w.Body.String(); got != c.body {
+			t.Errorf("%s: body = %q; not %q", c.title, got, c.body)
+		}
+	}
+}
+
+func TestTalkTitle(t *testing.T) {
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"Foo", "Talk:Foo", true},
+		{"Foo: Bar", "Talk:Foo: Bar", true},
+		{"User:Foo", "User talk:Foo", true},
+		{"Image:Foo.jpg", "File talk:Foo.jpg", true},
+		{"Category:Foo", "Category talk:Foo", true},
+		{"Talk:Foo", "", false},
+		{"User talk:Foo", "", false},
+	}
+	for _, c := range cases {
+		got, ok := talkTitle(c.in)
+		if got != c.want || ok != c.ok {
+			t.Errorf("talkTitle(%q) = %q, %v; not %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestHandleArticleIncludeTalk(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Foo", "article"),
+		testPage(2, "Talk:Foo", "discussion\n{{WikiProject Physics|class=GA}}"),
+		testPage(3, "Bar", "lonely"),
+	})
+
+	for _, c := range []struct {
+		title, want string
+	}{
+		{"Foo", `"talk":{"xml":`},
+		{"Foo", `"qualityFlag":"good"`},
+		{"Bar", `"talk":null`},
+	} {
+		req := httptest.NewRequest("GET", "/article?includeTalk=true&title="+c.title, nil)
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", c.title, w.Code, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: expected response to contain %s; got %s", c.title, c.want, w.Body)
+		}
+	}
+}
+
+func TestHandleArticleAnchors(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "Lead.\n== History ==\nOld.\n=== Early [[life]] ===\nYoung.")})
+
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"anchors=true", []string{
+			`"anchors":{"Early life":"Early_life","History":"History"}`,
+			`Lead.\n\u003cspan id=\"History\"\u003e\u003c/span\u003e\n== History ==`,
+		}},
+		{"anchors=true&clean=true", []string{
+			`"anchors":{"Early life":"Early_life","History":"History"}`,
+			`"text":"Lead.\nHistory\nOld.`,
+		}},
+	} {
+		req := httptest.NewRequest("GET", "/article?title=Foo&"+c.query, nil)
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, req)
+		for _, want := range c.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: expected response to contain %s; got %s", c.query, want, w.Body)
+			}
+		}
+	}
+}
+
+func TestHandleArticleResolveOptions(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Mercury", "'''Mercury''' may refer to:\n* [[Mercury (planet)]], a planet\n{{disambiguation}}"),
+		testPage(2, "Venus", "'''Venus''' is a planet."),
+	})
+
+	for _, c := range []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"title=Mercury&resolve=options", http.StatusOK, `{"title":"Mercury","options":[{"title":"Mercury (planet)","description":"a planet"}]}`},
+		{"title=Venus&resolve=options", http.StatusOK, `"text":"'''Venus''' is a planet."`},
+		{"title=Mercury&resolve=bogus", http.StatusBadRequest, "invalid resolve"},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, httptest.NewRequest("GET", "/article?"+c.query, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: got %d %s; expected %d containing %s", c.query, w.Code, w.Body, c.code, c.want)
+		}
+	}
+}
+
+func TestHandleArticleHead(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "0123456789")})
+
+	for _, c := range []struct {
+		query string
+		code  int
+	}{
+		{"title=Foo", http.StatusOK},
+		{"title=Foo&rev=1000Foo", http.StatusOK},
+		{"title=Foo&rev=1", http.StatusConflict},
+		{"title=Missing", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, httptest.NewRequest("HEAD", "/article?"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("HEAD %s: status = %d; not %d", c.query, w.Code, c.code)
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("X-Revision-ID"); got != "1000Foo" {
+			t.Errorf("HEAD %s: X-Revision-ID = %q", c.query, got)
+		}
+		if got := w.Header().Get("Last-Modified"); got != "Sat, 01 Jan 2022 00:00:00 GMT" {
+			t.Errorf("HEAD %s: Last-Modified = %q", c.query, got)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("HEAD %s: body = %q; expected none", c.query, w.Body)
+		}
+	}
+}
+
+func TestHandleArticleIncludeAliases(t *testing.T) {
+	redirectPage := func(id int, title, target string) page {
+		p := testPage(id, title, "#REDIRECT [["+target+"]]")
+		p.Redirect = []redirect{{Title: target}}
+		return p
+	}
+	useTestDump(t, []page{
+		testPage(1, "Albert Einstein", "physicist"),
+		redirectPage(2, "Einstein", "Albert Einstein"),
+		redirectPage(3, "A. Einstein", "Albert Einstein#Life"),
+		testPage(4, "Lonely", "no redirects"),
+	})
+
+	get := func(title string) string {
+		req := httptest.NewRequest("GET", "/article?includeAliases=true&title="+url.QueryEscape(title), nil)
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", title, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	if body := get("Albert Einstein"); strings.Contains(body, `"aliases"`) {
+		t.Errorf("aliases returned without the redirect index: %s", body)
+	}
+
+	if err := buildRedirectIndex(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		redirectIndex.Lock()
+		redirectIndex.built, redirectIndex.aliases = false, nil
+		redirectIndex.Unlock()
+	}()
+	for _, c := range []struct {
+		title, want string
+	}{
+		{"Albert Einstein", `"aliases":["A. Einstein","Einstein"]`},
+		{"Lonely", `"aliases":[]`},
+	} {
+		if body := get(c.title); !strings.Contains(body, c.want) {
+			t.Errorf("%s: expected response to contain %s; got %s", c.title, c.want, body)
+		}
+	}
+}
+
+func TestHandleArticleFollowRedirect(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Albert Einstein", "physicist"),
+		testPage(2, "Einstein", "#REDIRECT [[Albert Einstein]]"),
+		testPage(3, "Early life of Einstein", "#REDIRECT [[Albert Einstein#Early life]]"),
+		testPage(4, "Dangling", "#REDIRECT [[Nowhere]]"),
+		testPage(5, "Double", "#REDIRECT [[Einstein]]"),
+	})
+
+	for _, c := range []struct {
+		title, query string
+		want, absent []string
+	}{
+		{"Einstein", "", []string{`"title":"Einstein"`}, []string{`"redirectedFrom"`}},
+		{"Einstein", "&followRedirect=true", []string{`"title":"Albert Einstein"`, `"redirectedFrom":"Einstein"`}, []string{`"redirectSection"`}},
+		{"Early life of Einstein", "&followRedirect=true", []string{`"title":"Albert Einstein"`, `"redirectedFrom":"Early life of Einstein"`, `"redirectSection":"Early life"`}, nil},
+		{"Albert Einstein", "&followRedirect=true", []string{`"title":"Albert Einstein"`}, []string{`"redirectedFrom"`}},
+		{"Dangling", "&followRedirect=true", []string{`"title":"Dangling"`}, []string{`"redirectedFrom"`}},
+		{"Double", "&followRedirect=true", []string{`"title":"Einstein"`, `"redirectedFrom":"Double"`}, nil},
+	} {
+		req := httptest.NewRequest("GET", "/article?title="+url.QueryEscape(c.title)+c.query, nil)
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s%s: status = %d: %s", c.title, c.query, w.Code, w.Body)
+			continue
+		}
+		body := w.Body.String()
+		for _, want := range c.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s%s: expected response to contain %s; got %s", c.title, c.query, want, body)
+			}
+		}
+		for _, absent := range c.absent {
+			if strings.Contains(body, absent) {
+				t.Errorf("%s%s: expected no %s; got %s", c.title, c.query, absent, body)
+			}
+		}
+	}
+}
+
+func TestHandleArticleIncludeAgeRank(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(10, "Old", "old"),
+		testPage(40, "New", "new"),
+	})
+
+	for _, c := range []struct {
+		title, query, want string
+	}{
+		{"Old", "&includeAgeRank=true", `"estimatedAgeRank":0.25`},
+		{"New", "&includeAgeRank=true", `"estimatedAgeRank":1`},
+		{"Old", "", ""},
+	} {
+		req := httptest.NewRequest("GET", "/article?title="+c.title+c.query, nil)
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, req)
+		body := w.Body.String()
+		if c.want == "" {
+			if strings.Contains(body, "estimatedAgeRank") {
+				t.Errorf("%s%s: expected no estimatedAgeRank; got %s", c.title, c.query, body)
+			}
+		} else if !strings.Contains(body, c.want) {
+			t.Errorf("%s%s: expected response to contain %s; got %s", c.title, c.query, c.want, body)
+		}
+	}
+}
+
+func TestReadStatsHeaders(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "foo"), testPage(2, "Bar", "bar"), testPage(3, "Baz", "baz")})
+	defer func(d bool) { *debug = d }(*debug)
+
+	for _, enabled := range []bool{false, true} {
+		*debug = enabled
+		for path, handler := range map[string]func(http.ResponseWriter, *http.Request) error{
+			"/article": handleArticle,
+			"/raw":     handleRaw,
+			"/xml":     handleXML,
+		} {
+			req := httptest.NewRequest("GET", path+"?title=Baz", nil)
+			w := httptest.NewRecorder()
+			handle(handler)(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: status = %d: %s", path, w.Code, w.Body)
+			}
+			scanned, bytes := w.Header().Get("X-Pages-Scanned"), w.Header().Get("X-Block-Bytes")
+			if !enabled {
+				if scanned != "" || bytes != "" || w.Header().Get("X-Decode-Ms") != "" {
+					t.Errorf("%s: read stats headers set without -debug", path)
+				}
+				continue
+			}
+			if scanned != "3" {
+				t.Errorf("%s: X-Pages-Scanned = %q; not 3", path, scanned)
+			}
+			if n, err := strconv.Atoi(bytes); err != nil || n <= 0 {
+				t.Errorf("%s: X-Block-Bytes = %q", path, bytes)
+			}
+			if _, err := strconv.ParseFloat(w.Header().Get("X-Decode-Ms"), 64); err != nil {
+				t.Errorf("%s: X-Decode-Ms = %q", path, w.Header().Get("X-Decode-Ms"))
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"net/http"
+	"strings"
+)
+
+var (
+	authToken     = flag.String("authToken", "", "the token clients must send to use the -authEndpoints, as a bearer token or in the -authHeader; empty serves every endpoint without one")
+	authHeader    = flag.String("authHeader", "X-API-Key", "the header clients may send the -authToken in instead of as a bearer token, empty only accepts bearer tokens")
+	authEndpoints = flag.String("authEndpoints", "", "the comma separated endpoints that require the -authToken, named like -disableEndpoints, such as admin,export; empty requires it for every endpoint")
+)
+
+// authEndpointNames is the parsed -authEndpoints, set by run.
+var authEndpointNames []string
+
+// usedAuthEndpoints is the authEndpointNames that an endpoint has been
+// registered under.
+var usedAuthEndpoints = map[string]bool{}
+
+// authRoute records the -authEndpoints that name the endpoint being
+// registered at pattern as used.
+func authRoute(pattern string) {
+	for _, name := range endpointsNamed(authEndpointNames, pattern) {
+		usedAuthEndpoints[name] = true
+	}
+}
+
+// unusedAuthEndpoints returns the -authEndpoints that didn't match any
+// registered endpoint, which are probably typos.
+func unusedAuthEndpoints() []string {
+	var unused []string
+	for _, name := range authEndpointNames {
+		if !usedAuthEndpoints[name] {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// authRequired reports whether requests for path must carry the -authToken:
+// every request if -authEndpoints is empty, and otherwise those for the
+// endpoints it names.
+func authRequired(path string) bool {
+	if *authToken == "" {
+		return false
+	}
+	return len(authEndpointNames) == 0 || len(endpointsNamed(authEndpointNames, path)) > 0
+}
+
+// authorized reports whether r carries the -authToken, as a bearer token or
+// in the -authHeader. The -adminToken is accepted too, so admin requests on
+// the public listener can send it alone.
+func authorized(r *http.Request) bool {
+	var tokens []string
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		tokens = append(tokens, strings.TrimPrefix(auth, "Bearer "))
+	}
+	if *authHeader != "" {
+		tokens = append(tokens, r.Header.Get(*authHeader))
+	}
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(*authToken)) == 1 ||
+			(*adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) == 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticated rejects requests to h for the endpoints that require the
+// -authToken with a 401 unless they carry it, see authRequired. It wraps a
+// whole mux, so it applies to every endpoint, whichever handlers it's
+// composed with.
+func authenticated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authRequired(r.URL.Path) || authorized(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="wikigopher"`)
+		handle(func(w http.ResponseWriter, r *http.Request) error {
+			return statusErrorf(http.StatusUnauthorized, "missing or invalid token")
+		})(w, r)
+	})
+}
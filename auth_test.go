@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAuthenticated(t *testing.T) {
+	defer func(token, header, admin string, names []string, used map[string]bool) {
+		*authToken, *authHeader, *adminToken = token, header, admin
+		authEndpointNames, usedAuthEndpoints = names, used
+	}(*authToken, *authHeader, *adminToken, authEndpointNames, usedAuthEndpoints)
+	*authHeader, *adminToken = "X-API-Key", "admin"
+	usedAuthEndpoints = map[string]bool{}
+
+	h := authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cases := []struct {
+		token, endpoints    string
+		path, header, value string
+		want                int
+	}{
+		{"", "", "/article", "", "", http.StatusOK},
+		{"secret", "", "/article", "", "", http.StatusUnauthorized},
+		{"secret", "", "/", "", "", http.StatusUnauthorized},
+		{"secret", "", "/article", "Authorization", "Bearer secret", http.StatusOK},
+		{"secret", "", "/article", "Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "", "/article", "Authorization", "secret", http.StatusUnauthorized},
+		{"secret", "", "/article", "X-API-Key", "secret", http.StatusOK},
+		{"secret", "", "/article", "X-API-Key", "", http.StatusUnauthorized},
+		{"secret", "", "/admin/reload", "Authorization", "Bearer admin", http.StatusOK},
+		{"secret", "admin,export", "/article", "", "", http.StatusOK},
+		{"secret", "admin,export", "/export/titles", "", "", http.StatusUnauthorized},
+		{"secret", "admin,export", "/exporter", "", "", http.StatusOK},
+		{"secret", "admin,export", "/export/titles", "X-API-Key", "secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		*authToken = c.token
+		authEndpointNames = parseEndpointNames(c.endpoints)
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s with %s %q, -authToken %q and -authEndpoints %q: status = %d; not %d",
+				c.path, c.header, c.value, c.token, c.endpoints, w.Code, c.want)
+		}
+		if c.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header with the 401", c.path)
+		}
+	}
+
+	authEndpointNames = parseEndpointNames("export,nope")
+	authRoute("/export/titles")
+	authRoute("/article")
+	if unused := unusedAuthEndpoints(); !reflect.DeepEqual(unused, []string{"nope"}) {
+		t.Errorf("unusedAuthEndpoints() = %q; expected nope", unused)
+	}
+}
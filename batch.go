@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var batchConcurrency = flag.Int("batchConcurrency", runtime.NumCPU(), "the maximum number of articles read at once by batch endpoints, across all requests")
+
+// maxBatchTitles is the most articles a single batch request can ask for.
+const maxBatchTitles = 100
+
+// batchSlots limits how many batch items run at once. It's recreated with
+// the configured size by run.
+var batchSlots = make(chan struct{}, *batchConcurrency)
+
+// batchInFlight is the number of batch items currently running.
+var batchInFlight int64
+
+// runBatch calls fn for each i in [0, n) and waits for them all to finish.
+// At most -batchConcurrency calls run at once, shared between every batch
+// request, so a burst of batches can't saturate the disk.
+func runBatch(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			withBatchSlot(func() { fn(i) })
+		}(i)
+	}
+	wg.Wait()
+}
+
+// withBatchSlot calls fn once fewer than -batchConcurrency batch items are
+// running, counting it as one until it returns.
+func withBatchSlot(fn func()) {
+	batchSlots <- struct{}{}
+	atomic.AddInt64(&batchInFlight, 1)
+	defer func() {
+		atomic.AddInt64(&batchInFlight, -1)
+		<-batchSlots
+	}()
+	fn()
+}
+
+type batchRequest struct {
+	Titles []string `json:"titles"`
+}
+
+// batchArticle is one result of a batch request. Exactly one of Article and
+// Error is set.
+type batchArticle struct {
+	Title   string `json:"title"`
+	Article *page  `json:"article,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Status  int    `json:"status"`
+	// Preview is the start of the article's text, with preview=N.
+	Preview string `json:"preview,omitempty"`
+}
+
+// handleBatchArticles serves POST /batch/articles with a body of
+// {"titles":[...]}, returning the articles in the same order. A title that
+// can't be loaded doesn't fail the batch; its error and status are reported
+// in its place instead. preview=N adds the first N characters of each
+// article's plain text as "preview".
+func handleBatchArticles(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return statusErrorf(http.StatusMethodNotAllowed, "use POST")
+	}
+	var req batchRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		return err
+	}
+	if len(req.Titles) == 0 || len(req.Titles) > maxBatchTitles {
+		return statusErrorf(http.StatusBadRequest, "titles must have between 1 and %d titles, got %d", maxBatchTitles, len(req.Titles))
+	}
+	preview, err := previewParam(r)
+	if err != nil {
+		return err
+	}
+
+	results := make([]batchArticle, len(req.Titles))
+	runBatch(len(req.Titles), func(i int) {
+		results[i].Title = req.Titles[i]
+		p, err := lookupArticle(req.Titles[i])
+		if err != nil {
+			results[i].Error = err.Error()
+			results[i].Status = errorStatus(err)
+			return
+		}
+		results[i].Article = &p
+		results[i].Status = http.StatusOK
+		if preview > 0 {
+			results[i].Preview = textPreview(p.Text, preview)
+		}
+	})
+	return writeJSON(w, r, results)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleBatchArticles(t *testing.T) {
+	block := denseBlock(5, 100)
+	useTestDump(t, block)
+
+	body := `{"titles":["Page 3","Missing","Page 0","Page 3"]}`
+	req := httptest.NewRequest("POST", "/batch/articles", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handle(handleBatchArticles)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var results []batchArticle
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		title  string
+		status int
+	}{
+		{"Page 3", http.StatusOK},
+		{"Missing", http.StatusNotFound},
+		{"Page 0", http.StatusOK},
+		{"Page 3", http.StatusOK},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results; not %d", len(results), len(want))
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Title != w.title || got.Status != w.status {
+			t.Errorf("results[%d] = %q %d; not %q %d", i, got.Title, got.Status, w.title, w.status)
+		}
+		if (got.Article != nil) != (w.status == http.StatusOK) || (got.Article != nil && got.Article.Title != w.title) {
+			t.Errorf("results[%d] = %+v", i, got)
+		}
+	}
+
+	for _, body := range []string{`{"titles":[]}`, `not json`} {
+		req := httptest.NewRequest("POST", "/batch/articles", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handle(handleBatchArticles)(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d; not 400", body, w.Code)
+		}
+	}
+}
+
+func TestHandleBatchArticlesBodyLimit(t *testing.T) {
+	useTestDump(t, denseBlock(1, 10))
+
+	// A full batch of the longest titles fits in the smallest limit allowed.
+	defer func(max int64) { *maxBodyBytes = max }(*maxBodyBytes)
+	*maxBodyBytes = minBodyBytes
+	titles := make([]string, maxBatchTitles)
+	for i := range titles {
+		titles[i] = strings.Repeat("x", maxTitleBytes)
+	}
+	full, err := json.Marshal(batchRequest{Titles: titles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"full batch", string(full), http.StatusOK},
+		{"oversized", `{"titles":["` + strings.Repeat("x", minBodyBytes) + `"]}`, http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest("POST", "/batch/articles", strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+		handle(handleBatchArticles)(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status = %d; not %d: %.200s", c.name, w.Code, c.status, w.Body)
+		}
+	}
+}
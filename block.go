@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// maxBlockPages is the most pages /block returns.
+const maxBlockPages = 1000
+
+type blockPage struct {
+	Title string `json:"title"`
+	ID    int    `json:"id"`
+	NS    int    `json:"ns"`
+	Text  string `json:"text,omitempty"`
+}
+
+type blockContents struct {
+	Seek int `json:"seek"`
+	// Indexed is the number of pages the index says are in the block.
+	Indexed   int         `json:"indexed"`
+	Pages     []blockPage `json:"pages"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// handleBlock serves /block?seek=N&includeText=false, decoding every page in
+// the block at offset N, up to maxBlockPages, so the index can be checked
+// against the dump. It's only available with -debug.
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) error {
+	if !*debug {
+		return statusErrorf(http.StatusForbidden, "/block is only available with -debug")
+	}
+	q := r.URL.Query()
+	seek, err := strconv.Atoi(q.Get("seek"))
+	if err != nil {
+		return statusErrorf(http.StatusBadRequest, "invalid seek %q", q.Get("seek"))
+	}
+	includeText := true
+	if raw := q.Get("includeText"); raw != "" {
+		if includeText, err = strconv.ParseBool(raw); err != nil {
+			return statusErrorf(http.StatusBadRequest, "invalid includeText %q", raw)
+		}
+	}
+
+	s.mu.Lock()
+	blocks := s.currentBlocks()
+	s.mu.Unlock()
+	i := sort.SearchInts(blocks.seeks, seek)
+	if i == len(blocks.seeks) || blocks.seeks[i] != seek {
+		return statusErrorf(http.StatusNotFound, "no block at %d", seek)
+	}
+	resp := blockContents{
+		Seek:    seek,
+		Indexed: blocks.ends[i],
+		Pages:   []blockPage{},
+	}
+	if i > 0 {
+		resp.Indexed -= blocks.ends[i-1]
+	}
+
+	in, f, err := seekBlock(seek, blocks.lengths[i])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = decodeBlock(in, func(p page) error {
+		if len(resp.Pages) == maxBlockPages {
+			resp.Truncated = true
+			return errStopped
+		}
+		bp := blockPage{Title: p.Title, ID: p.ID, NS: p.NS}
+		if includeText {
+			bp.Text = p.Text
+		}
+		resp.Pages = append(resp.Pages, bp)
+		return nil
+	})
+	if err != nil && errors.Cause(err) != errStopped {
+		return err
+	}
+	return writeJSON(w, r, resp)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleBlock(t *testing.T) {
+	defer func(old bool) { *debug = old }(*debug)
+	*debug = true
+	block := denseBlock(5, 100)
+	useTestDump(t, block[:2], block[2:])
+	meta, err := fetchArticle(block[2].Title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(1)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/block?seek=%d&includeText=false", meta.seek), nil)
+	w := httptest.NewRecorder()
+	handle(s.handleBlock)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var got blockContents
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Indexed != 3 || len(got.Pages) != 3 {
+		t.Fatalf("got %d pages, %d indexed; expected 3 of each", len(got.Pages), got.Indexed)
+	}
+	for i, p := range got.Pages {
+		if want := block[2+i]; p.Title != want.Title || p.ID != want.ID || p.Text != "" {
+			t.Errorf("pages[%d] = %+v; expected %q without text", i, p, want.Title)
+		}
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/block?seek=%d", meta.seek+1), nil)
+	w = httptest.NewRecorder()
+	handle(s.handleBlock)(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status for a seek that isn't a block = %d; not 404", w.Code)
+	}
+}
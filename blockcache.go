@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/xml"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var cacheSize = flag.Int("cacheSize", 0, "the megabytes of decompressed blocks to cache, 0 disables the block cache")
+
+// decodedBlocks is recreated with the configured size by run, and is nil if
+// the block cache is disabled.
+var decodedBlocks *blockCache
+
+type blockKey struct {
+	path string
+	seek int
+}
+
+// cachedBlock is the decompressed XML at the start of a block, up to the end
+// of its pages'th page.
+type cachedBlock struct {
+	key   blockKey
+	data  []byte
+	pages int
+	// indexed is the number of pages the index says are in the block, which
+	// can be fewer than were read.
+	indexed int
+	// complete is set if the dump ended within the block, so there are no
+	// more pages to read.
+	complete bool
+}
+
+// blockCache keeps the most recently used decompressed blocks, up to a total
+// of maxBytes, so reading another article from the same block doesn't have
+// to decompress it again. It is safe for concurrent use.
+type blockCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	indexed  int
+	ll       *list.List
+	items    map[blockKey]*list.Element
+
+	hits, misses, evictions int64
+}
+
+func newBlockCache(maxBytes int) *blockCache {
+	return &blockCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[blockKey]*list.Element{},
+	}
+}
+
+// block returns the decompressed block at seek with at least its first pages
+// pages, unless the dump ends sooner. Blocks are read up to the number of
+// pages the index says they have plus -findPageMargin, so a lookup for any
+// page in the block can be served from the cache.
+func (c *blockCache) block(seek, pages int) ([]byte, error) {
+	key := blockKey{path: *articlesFile, seek: seek}
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		b := e.Value.(*cachedBlock)
+		if b.pages >= pages || b.complete {
+			c.ll.MoveToFront(e)
+			c.mu.Unlock()
+			atomic.AddInt64(&c.hits, 1)
+			return b.data, nil
+		}
+	}
+	c.mu.Unlock()
+	atomic.AddInt64(&c.misses, 1)
+
+	mu.Lock()
+	indexed := mu.offsetSize[seek]
+	mu.Unlock()
+	if n := indexed + *findPageMargin; n > pages {
+		pages = n
+	}
+
+	b, err := readBlock(seek, pages)
+	if err != nil {
+		return nil, err
+	}
+	b.key = key
+	b.indexed = indexed
+	c.add(b)
+	return b.data, nil
+}
+
+func (c *blockCache) add(b *cachedBlock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(b.data) > c.maxBytes {
+		return
+	}
+	if e, ok := c.items[b.key]; ok {
+		c.remove(e)
+	}
+	c.items[b.key] = c.ll.PushFront(b)
+	c.bytes += len(b.data)
+	c.indexed += b.indexed
+	for c.bytes > c.maxBytes {
+		c.remove(c.ll.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+}
+
+// remove drops e from the cache. c.mu must be held.
+func (c *blockCache) remove(e *list.Element) {
+	b := e.Value.(*cachedBlock)
+	c.ll.Remove(e)
+	delete(c.items, b.key)
+	c.bytes -= len(b.data)
+	c.indexed -= b.indexed
+}
+
+// readBlock decompresses the block at seek up to the end of its pages'th
+// page, or the end of the dump if that comes first.
+func readBlock(seek, pages int) (*cachedBlock, error) {
+	in, f, err := seekBlock(seek, blockLengths(seek))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := utf8Reader(*articlesFile, in)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	d := xml.NewDecoder(io.TeeReader(r, &buf))
+	b := &cachedBlock{}
+	for b.pages < pages {
+		tok, err := d.Token()
+		if err == io.EOF {
+			b.complete = true
+			break
+		} else if err, ok := err.(*xml.SyntaxError); ok && strings.Contains(err.Msg, "</mediawiki>") {
+			// Reached the end of the dump.
+			b.complete = true
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "page" {
+			if err := d.Skip(); err != nil {
+				return nil, err
+			}
+			b.pages++
+		}
+	}
+	b.data = buf.Bytes()[:d.InputOffset()]
+	return b, nil
+}
+
+type blockCacheStats struct {
+	Entries   int     `json:"entries"`
+	Bytes     int     `json:"bytes"`
+	MaxBytes  int     `json:"maxBytes"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRatio  float64 `json:"hitRatio"`
+	// PagesPerBlock is the average number of pages the index has in each
+	// cached block, which is how many articles each decompression can serve.
+	PagesPerBlock float64 `json:"pagesPerBlock"`
+}
+
+func (c *blockCache) stats() blockCacheStats {
+	c.mu.Lock()
+	s := blockCacheStats{
+		Entries:  c.ll.Len(),
+		Bytes:    c.bytes,
+		MaxBytes: c.maxBytes,
+	}
+	if s.Entries > 0 {
+		s.PagesPerBlock = float64(c.indexed) / float64(s.Entries)
+	}
+	c.mu.Unlock()
+
+	s.Hits = atomic.LoadInt64(&c.hits)
+	s.Misses = atomic.LoadInt64(&c.misses)
+	s.Evictions = atomic.LoadInt64(&c.evictions)
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+	}
+	return s
+}
+
+// handleCacheStats serves /debug/cache, describing how effective the block
+// cache is.
+func handleCacheStats(w http.ResponseWriter, r *http.Request) error {
+	if decodedBlocks == nil {
+		return statusErrorf(http.StatusNotFound, "the block cache is disabled, start with -cacheSize")
+	}
+	return writeJSON(w, r, decodedBlocks.stats())
+}
+
+// blockCacheMetric returns the value of one of the block cache's stats, or 0
+// if it's disabled.
+func blockCacheMetric(f func(blockCacheStats) float64) func() float64 {
+	return func() float64 {
+		if decodedBlocks == nil {
+			return 0
+		}
+		return f(decodedBlocks.stats())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBlockCache(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "Foo", "foo text"), testPage(2, "Bar", "bar text")},
+		[]page{testPage(3, "Baz", "baz text")},
+	)
+	defer func() { decodedBlocks = nil }()
+	decodedBlocks = newBlockCache(1 << 20)
+
+	for _, c := range []struct {
+		title, text string
+	}{
+		{"Foo", "foo text"},
+		{"Bar", "bar text"},
+		{"Baz", "baz text"},
+		{"Foo", "foo text"},
+	} {
+		p, err := lookupArticle(c.title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Text != c.text {
+			t.Errorf("%s text = %q; not %q", c.title, p.Text, c.text)
+		}
+	}
+
+	s := decodedBlocks.stats()
+	if s.Entries != 2 || s.Hits != 2 || s.Misses != 2 || s.Evictions != 0 {
+		t.Errorf("stats = %+v; expected 2 entries, 2 hits and 2 misses", s)
+	}
+	if s.HitRatio != 0.5 || s.PagesPerBlock != 1.5 {
+		t.Errorf("hit ratio = %v, pages per block = %v; not 0.5 and 1.5", s.HitRatio, s.PagesPerBlock)
+	}
+
+	// Only one block fits, so reading the other evicts it.
+	decodedBlocks = newBlockCache(s.Bytes - 1)
+	for _, title := range []string{"Foo", "Baz"} {
+		if _, err := lookupArticle(title); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := decodedBlocks.stats(); s.Entries != 1 || s.Evictions != 1 || s.Bytes > s.MaxBytes {
+		t.Errorf("stats = %+v; expected 1 entry after 1 eviction", s)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	breakerThreshold = flag.Int("breakerThreshold", 5, "the consecutive failed reads of the articles file after which reads fail fast with a 503 for -breakerCooldown, 0 disables the circuit breaker")
+	breakerCooldown  = flag.Duration("breakerCooldown", 30*time.Second, "how long reads of the articles file fail fast once -breakerThreshold reads in a row have failed, before one is let through to see if it's recovered")
+)
+
+// breakerState is the state of the circuit breaker on reads of the articles
+// file, in order of how unhealthy it is.
+type breakerState int
+
+const (
+	// breakerClosed lets every read through.
+	breakerClosed breakerState = iota
+	// breakerHalfOpen lets a single trial read through once the cooldown is
+	// over, failing the rest fast until it's done.
+	breakerHalfOpen
+	// breakerOpen fails every read fast until the cooldown is over.
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// decodeBreaker is the circuit breaker on reads of the articles file, so a
+// failing disk or network mount isn't made worse by every request retrying
+// it.
+var decodeBreaker = struct {
+	sync.Mutex
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// trial is whether the half-open trial read is in flight.
+	trial bool
+	// opens is the number of times the breaker has opened.
+	opens int64
+}{}
+
+// breakerAllow returns a 503 error if reads of the articles file are
+// failing fast, and nil if this one may go ahead, in which case breakerRecord
+// must be called with its result.
+func breakerAllow() error {
+	if *breakerThreshold == 0 {
+		return nil
+	}
+	decodeBreaker.Lock()
+	defer decodeBreaker.Unlock()
+
+	switch decodeBreaker.state {
+	case breakerOpen:
+		remaining := *breakerCooldown - time.Since(decodeBreaker.openedAt)
+		if remaining > 0 {
+			return statusErrorf(http.StatusServiceUnavailable, "articles file is failing, retrying in %s", remaining.Round(time.Second))
+		}
+		decodeBreaker.state = breakerHalfOpen
+		decodeBreaker.trial = true
+		return nil
+	case breakerHalfOpen:
+		if decodeBreaker.trial {
+			return statusErrorf(http.StatusServiceUnavailable, "articles file is failing, checking if it's recovered")
+		}
+		decodeBreaker.trial = true
+	}
+	return nil
+}
+
+// breakerRecord records the result of a read breakerAllow let through. A
+// page missing from its block means the file was read fine, so only other
+// errors count as failures.
+func breakerRecord(err error) {
+	if *breakerThreshold == 0 {
+		return
+	}
+	if _, ok := errors.Cause(err).(pageNotInBlock); ok {
+		err = nil
+	}
+	decodeBreaker.Lock()
+	defer decodeBreaker.Unlock()
+
+	halfOpen := decodeBreaker.state == breakerHalfOpen
+	decodeBreaker.trial = false
+	if err == nil {
+		if halfOpen {
+			log.Printf("Articles file recovered, closing the circuit breaker")
+		}
+		decodeBreaker.state = breakerClosed
+		decodeBreaker.failures = 0
+		return
+	}
+	decodeBreaker.failures++
+	if halfOpen || (decodeBreaker.state == breakerClosed && decodeBreaker.failures >= *breakerThreshold) {
+		log.Printf("Opening the circuit breaker for %s after %d failed reads of the articles file, the last: %s", *breakerCooldown, decodeBreaker.failures, err)
+		decodeBreaker.state = breakerOpen
+		decodeBreaker.openedAt = time.Now()
+		decodeBreaker.opens++
+	}
+}
+
+// currentBreakerState returns the circuit breaker's state, which is only
+// half-open once a read has been let through to test the file.
+func currentBreakerState() breakerState {
+	decodeBreaker.Lock()
+	defer decodeBreaker.Unlock()
+	return decodeBreaker.state
+}
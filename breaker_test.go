@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDecodeBreaker(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Fox", "brown")})
+	defer func(threshold int, cooldown time.Duration, path string) {
+		*breakerThreshold, *breakerCooldown, *articlesFile = threshold, cooldown, path
+		decodeBreaker.Lock()
+		decodeBreaker.state, decodeBreaker.failures, decodeBreaker.trial = breakerClosed, 0, false
+		decodeBreaker.Unlock()
+	}(*breakerThreshold, *breakerCooldown, *articlesFile)
+	*breakerThreshold, *breakerCooldown = 2, time.Minute
+	path := *articlesFile
+	fox := indexEntry{id: 1, seek: blockSeeks()[0]}
+
+	read := func() int {
+		_, err := readArticle(fox)
+		if err == nil {
+			return http.StatusOK
+		}
+		if code, ok := errors.Cause(err).(statusError); ok {
+			return int(code)
+		}
+		return http.StatusInternalServerError
+	}
+	expect := func(step string, code int, state breakerState) {
+		t.Helper()
+		if got := read(); got != code {
+			t.Errorf("%s: read = %d; expected %d", step, got, code)
+		}
+		if got := currentBreakerState(); got != state {
+			t.Errorf("%s: breaker %s; expected %s", step, got, state)
+		}
+	}
+
+	// A page that isn't in its block doesn't count as a failed read.
+	for i := 0; i < 3; i++ {
+		if _, err := readArticle(indexEntry{id: 1000, seek: fox.seek}); err == nil {
+			t.Fatal("expected reading a missing page to fail")
+		}
+	}
+	expect("missing pages", http.StatusOK, breakerClosed)
+
+	*articlesFile = path + ".missing"
+	expect("first failure", http.StatusServiceUnavailable, breakerClosed)
+	expect("second failure", http.StatusServiceUnavailable, breakerOpen)
+	*articlesFile = path
+	expect("cooling down", http.StatusServiceUnavailable, breakerOpen)
+
+	// A failed trial read reopens it for another cooldown.
+	decodeBreaker.Lock()
+	decodeBreaker.openedAt = time.Now().Add(-*breakerCooldown)
+	decodeBreaker.Unlock()
+	*articlesFile = path + ".missing"
+	expect("failed trial", http.StatusServiceUnavailable, breakerOpen)
+	*articlesFile = path
+	expect("cooling down again", http.StatusServiceUnavailable, breakerOpen)
+
+	// Only one trial read is let through at a time.
+	decodeBreaker.Lock()
+	decodeBreaker.openedAt = time.Now().Add(-*breakerCooldown)
+	decodeBreaker.Unlock()
+	if err := breakerAllow(); err != nil {
+		t.Fatalf("trial read not let through: %v", err)
+	}
+	expect("trial in flight", http.StatusServiceUnavailable, breakerHalfOpen)
+	breakerRecord(nil)
+	expect("recovered", http.StatusOK, breakerClosed)
+
+	*breakerThreshold = 0
+	*articlesFile = path + ".missing"
+	for i := 0; i < 3; i++ {
+		read()
+	}
+	*articlesFile = path
+	expect("disabled", http.StatusOK, breakerClosed)
+}
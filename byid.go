@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"time"
+)
+
+var retainIDs = flag.Bool("ids", false, "whether to keep a map from page ID to title in memory, needed for /articlesByID")
+
+type idBatchRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// idBatchResponse is the result of a /articlesByID request. Articles is in
+// the order of the requested IDs, with null for any in Errors.
+type idBatchResponse struct {
+	Articles []*page        `json:"articles"`
+	Errors   map[int]string `json:"errors,omitempty"`
+}
+
+// lookupID finds the index entry of the page with the given ID. If more than
+// one page has the ID, it's always the first in the dump.
+func lookupID(id int) (indexEntry, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	hash, ok := mu.idToHash[id]
+	if !ok {
+		return indexEntry{}, articleNotFound("page ID %d not found", id)
+	}
+	entry, ok := currentOffsets().lookup(hash)
+	if !ok {
+		entry, ok = mu.found[hash]
+	}
+	if !ok || entry.id != id {
+		// A later page with the same title replaced it in the index.
+		return indexEntry{}, articleNotFound("page ID %d is shadowed by another page with the same title", id)
+	}
+	return entry, nil
+}
+
+// handleArticlesByID serves POST /articlesByID with a body of {"ids":[...]},
+// returning the articles with those page IDs in the same order, for clients
+// that store IDs rather than titles, which change on renames. IDs that can't
+// be loaded are reported in errors rather than failing the batch. An ID
+// repeated in the request is only read once.
+func handleArticlesByID(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return statusErrorf(http.StatusMethodNotAllowed, "use POST")
+	}
+	if !*retainIDs {
+		return statusErrorf(http.StatusNotImplemented, "/articlesByID requires -ids")
+	}
+	var req idBatchRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		return err
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBatchTitles {
+		return statusErrorf(http.StatusBadRequest, "ids must have between 1 and %d IDs, got %d", maxBatchTitles, len(req.IDs))
+	}
+
+	var unique []int
+	seen := map[int]bool{}
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	articles := make([]*page, len(unique))
+	errs := make([]error, len(unique))
+	runBatch(len(unique), func(i int) {
+		entry, err := lookupID(unique[i])
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		p, err := readArticle(entry)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		articles[i] = &p
+	})
+
+	resp := idBatchResponse{Articles: make([]*page, len(req.IDs))}
+	byID := map[int]int{}
+	for i, id := range unique {
+		byID[id] = i
+		if errs[i] != nil {
+			if resp.Errors == nil {
+				resp.Errors = map[int]string{}
+			}
+			resp.Errors[id] = errs[i].Error()
+		}
+	}
+	for i, id := range req.IDs {
+		resp.Articles[i] = articles[byID[id]]
+	}
+	return writeJSON(w, r, resp)
+}
+
+// streamWindow is how many lines of a /stream/articlesByID body are read
+// ahead of the response, which bounds the memory a request uses however
+// long its body is.
+const streamWindow = 64
+
+// maxStreamLineBytes is the longest line a /stream/articlesByID body may
+// have.
+const maxStreamLineBytes = 4 << 10
+
+// streamedIDError is the line /stream/articlesByID responds with in place of
+// an article that couldn't be read. ID is missing if the line wasn't valid.
+// Line is the request body's line number, counting from 1.
+type streamedIDError struct {
+	ID     *int   `json:"id,omitempty"`
+	Line   int    `json:"line"`
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// readStreamedID returns the article with the given ID, or the
+// streamedIDError for the line asking for it if it can't be read.
+func readStreamedID(id, line int) interface{} {
+	entry, err := lookupID(id)
+	if err == nil {
+		var p page
+		if p, err = readArticle(entry); err == nil {
+			return p
+		}
+	}
+	return streamedIDError{ID: &id, Line: line, Error: err.Error(), Status: errorStatus(err)}
+}
+
+// extendDeadlines pushes the connection's read and write deadlines another
+// -readTimeout and -writeTimeout into the future, so they limit how long a
+// stream stalls rather than how long it runs. It's best effort, since not
+// every ResponseWriter supports deadlines.
+func extendDeadlines(rc *http.ResponseController) {
+	if *readTimeout > 0 {
+		rc.SetReadDeadline(time.Now().Add(*readTimeout))
+	}
+	if *writeTimeout > 0 {
+		rc.SetWriteDeadline(time.Now().Add(*writeTimeout))
+	}
+}
+
+// handleStreamArticlesByID serves POST /stream/articlesByID with an NDJSON
+// body of {"id":N} lines, streaming back an NDJSON line for each in the same
+// order: the article, or a streamedIDError if it can't be read or the line
+// isn't valid, without failing the stream. It's /articlesByID for any
+// number of IDs: lines are read as they arrive and responded to as soon as
+// the articles before them have been, at most streamWindow ahead, with the
+// reads sharing the -batchConcurrency slots. The body isn't limited by
+// -maxBodyBytes, and the timeouts apply to each stall rather than the whole
+// request.
+func handleStreamArticlesByID(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return statusErrorf(http.StatusMethodNotAllowed, "use POST")
+	}
+	if !*retainIDs {
+		return statusErrorf(http.StatusNotImplemented, "/stream/articlesByID requires -ids")
+	}
+	rc := http.NewResponseController(w)
+	// HTTP/1 handlers can't read the body once they've started responding
+	// unless they ask to.
+	rc.EnableFullDuplex()
+	extendDeadlines(rc)
+
+	results := make(chan chan interface{}, streamWindow)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(results)
+		send := func(result chan interface{}) bool {
+			select {
+			case results <- result:
+				return true
+			case <-stop:
+				return false
+			}
+		}
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, maxStreamLineBytes)
+		line := 0
+		for scanner.Scan() {
+			line++
+			raw := bytes.TrimSpace(scanner.Bytes())
+			if len(raw) == 0 {
+				continue
+			}
+			result := make(chan interface{}, 1)
+			if !send(result) {
+				return
+			}
+			var req struct {
+				ID *int `json:"id"`
+			}
+			if err := json.Unmarshal(raw, &req); err != nil || req.ID == nil {
+				result <- streamedIDError{Line: line, Error: `invalid line, expected {"id":N}`, Status: http.StatusBadRequest}
+				continue
+			}
+			id, line := *req.ID, line
+			go withBatchSlot(func() { result <- readStreamedID(id, line) })
+		}
+		if err := scanner.Err(); err != nil {
+			result := make(chan interface{}, 1)
+			result <- streamedIDError{Line: line + 1, Error: "reading request body: " + err.Error(), Status: http.StatusBadRequest}
+			send(result)
+		}
+	}()
+	// The body mustn't be read once the handler has returned.
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	nw := newNDJSONWriter(w)
+	for result := range results {
+		var v interface{}
+		select {
+		case v = <-result:
+		default:
+			// Send what's ready before waiting on the next article.
+			if err := nw.flush(); err != nil {
+				return err
+			}
+			v = <-result
+		}
+		if err := nw.encode(v); err != nil {
+			return err
+		}
+	}
+	return nw.flush()
+}
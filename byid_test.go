@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleArticlesByID(t *testing.T) {
+	old := *retainIDs
+	*retainIDs = true
+	defer func() { *retainIDs = old }()
+
+	block := denseBlock(5, 100)
+	// ID 2 is duplicated, and ID 5 is shadowed by a later "Page 4".
+	useTestDump(t, block, []page{testPage(2, "Copy", "copy"), testPage(9, "Page 4", "newer")})
+
+	body := `{"ids":[3,2,99,3,5,1]}`
+	req := httptest.NewRequest("POST", "/articlesByID", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handle(handleArticlesByID)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	var resp idBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Page 2", "Page 1", "", "Page 2", "", "Page 0"}
+	if len(resp.Articles) != len(want) {
+		t.Fatalf("got %d articles; not %d", len(resp.Articles), len(want))
+	}
+	for i, title := range want {
+		got := resp.Articles[i]
+		if (got == nil) != (title == "") || (got != nil && got.Title != title) {
+			t.Errorf("articles[%d] = %+v; not %q", i, got, title)
+		}
+	}
+	if len(resp.Errors) != 2 || resp.Errors[99] == "" || resp.Errors[5] == "" {
+		t.Errorf("errors = %v; want 99 and 5", resp.Errors)
+	}
+
+	for _, body := range []string{`{"ids":[]}`, `not json`} {
+		req := httptest.NewRequest("POST", "/articlesByID", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handle(handleArticlesByID)(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d; not 400", body, w.Code)
+		}
+	}
+}
+
+func TestHandleStreamArticlesByID(t *testing.T) {
+	old := *retainIDs
+	*retainIDs = true
+	defer func() { *retainIDs = old }()
+	useTestDump(t, denseBlock(5, 100))
+
+	body := "{\"id\":3}\n\n{\"id\":99}\nnot json\n{\"id\":1}\n{}\n{\"id\":3}"
+	req := httptest.NewRequest("POST", "/stream/articlesByID", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handle(handleStreamArticlesByID)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	type line struct {
+		Title  string `json:"title"`
+		ID     *int   `json:"id"`
+		Line   int    `json:"line"`
+		Error  string `json:"error"`
+		Status int    `json:"status"`
+	}
+	var got []line
+	dec := json.NewDecoder(w.Body)
+	for dec.More() {
+		var l line
+		if err := dec.Decode(&l); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, l)
+	}
+	want := []struct {
+		title  string
+		line   int
+		status int
+	}{
+		{"Page 2", 0, 0},
+		{"", 3, http.StatusNotFound},
+		{"", 4, http.StatusBadRequest},
+		{"Page 0", 0, 0},
+		{"", 6, http.StatusBadRequest},
+		{"Page 2", 0, 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines; not %d: %+v", len(got), len(want), got)
+	}
+	for i, l := range got {
+		if l.Title != want[i].title || l.Line != want[i].line || l.Status != want[i].status {
+			t.Errorf("line %d = %+v; expected title %q, line %d and status %d", i, l, want[i].title, want[i].line, want[i].status)
+		}
+		if l.Error != "" && (l.ID != nil) != (want[i].status == http.StatusNotFound) {
+			t.Errorf("line %d = %+v; only the unknown ID's error should have its id", i, l)
+		}
+	}
+}
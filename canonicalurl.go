@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// wikiSite is where the loaded dump's wiki is served, as its scheme and host,
+// taken from the siteinfo's base URL. It's empty until the siteinfo is read,
+// and for dumps without one.
+var wikiSite = struct {
+	sync.Mutex
+
+	origin string
+}{}
+
+// setWikiBase sets the wiki's origin from base, the URL of its main page as
+// given in the siteinfo, like https://en.wikipedia.org/wiki/Main_Page.
+func setWikiBase(base string) {
+	origin := ""
+	if u, err := url.Parse(base); err == nil && u.Scheme != "" && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	wikiSite.Lock()
+	wikiSite.origin = origin
+	wikiSite.Unlock()
+}
+
+// wikiOrigin returns the scheme and host of the wiki, from the siteinfo if it
+// has one and otherwise the -lang Wikipedia.
+func wikiOrigin() string {
+	wikiSite.Lock()
+	defer wikiSite.Unlock()
+	if wikiSite.origin != "" {
+		return wikiSite.origin
+	}
+	return "https://" + *lang + ".wikipedia.org"
+}
+
+// encodeTitlePath encodes a title for the path of a /wiki/ URL the way
+// MediaWiki does: spaces become underscores, and every byte but letters,
+// digits and the punctuation MediaWiki leaves alone is percent-encoded, so
+// "AC/DC" stays as it is but "Q&A" becomes "Q%26A".
+func encodeTitlePath(title string) string {
+	title = strings.Replace(title, " ", "_", -1)
+	var b strings.Builder
+	for i := 0; i < len(title); i++ {
+		c := title[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~:;@$!*(),/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalURL returns the URL of the article title on the live wiki. The
+// title is normalized first, as in MediaWiki's canonical URLs.
+func canonicalURL(title string) string {
+	title = capitalizeTitle(strings.Join(strings.Fields(strings.Replace(title, "_", " ", -1)), " "), *lang)
+	return wikiOrigin() + "/wiki/" + encodeTitlePath(title)
+}
+
+type articleURL struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// handleURL serves /url?title=..., returning the URL of the article on the
+// live wiki. It's built from the title alone, so the article doesn't have to
+// be in the dump.
+func handleURL(w http.ResponseWriter, r *http.Request) error {
+	title, err := validateTitle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, articleURL{Title: title, URL: canonicalURL(title)})
+}
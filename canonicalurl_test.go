@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	defer setWikiBase("")
+	cases := []struct {
+		base, title, want string
+	}{
+		{"", "Albert Einstein", "https://en.wikipedia.org/wiki/Albert_Einstein"},
+		{"", "albert_einstein", "https://en.wikipedia.org/wiki/Albert_einstein"},
+		{"", "  New   York  City ", "https://en.wikipedia.org/wiki/New_York_City"},
+		{"", "AC/DC", "https://en.wikipedia.org/wiki/AC/DC"},
+		{"", "Q&A", "https://en.wikipedia.org/wiki/Q%26A"},
+		{"", "C++", "https://en.wikipedia.org/wiki/C%2B%2B"},
+		{"", "100% (song)?", "https://en.wikipedia.org/wiki/100%25_(song)%3F"},
+		{"", "Talk:Foo, bar!", "https://en.wikipedia.org/wiki/Talk:Foo,_bar!"},
+		{"", "Zürich", "https://en.wikipedia.org/wiki/Z%C3%BCrich"},
+		{"", "東京", "https://en.wikipedia.org/wiki/%E6%9D%B1%E4%BA%AC"},
+		{"https://de.wikipedia.org/wiki/Wikipedia:Hauptseite", "Straße", "https://de.wikipedia.org/wiki/Stra%C3%9Fe"},
+		{"http://localhost:8000/index.php/Main_Page", "Foo", "http://localhost:8000/wiki/Foo"},
+		{"not a url", "Foo", "https://en.wikipedia.org/wiki/Foo"},
+	}
+	for _, c := range cases {
+		setWikiBase(c.base)
+		if got := canonicalURL(c.title); got != c.want {
+			t.Errorf("canonicalURL(%q) with base %q = %q; not %q", c.title, c.base, got, c.want)
+		}
+	}
+}
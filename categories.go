@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/creachadair/cityhash"
+)
+
+var categories = flag.Bool("categories", false, "whether or not to build the category index, requires decoding every article")
+
+// catIndex maps normalized category names to the hashes of the titles in
+// them. It is only populated when running with -categories since building it
+// requires decoding every article in the dump.
+var catIndex = struct {
+	sync.Mutex
+
+	built   bool
+	members map[string][]uint64
+	titles  map[uint64]string
+}{}
+
+func buildCategoryIndex() error {
+	log.Printf("Building category index...")
+	members := map[string][]uint64{}
+	titles := map[uint64]string{}
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		cats := extractCategories(p.Text)
+		if len(cats) == 0 {
+			return nil
+		}
+		hash := cityhash.Hash64([]byte(p.Title))
+		titles[hash] = p.Title
+		for _, cat := range cats {
+			members[cat] = append(members[cat], hash)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Sort members by title so cursors are stable across requests.
+	for _, hashes := range members {
+		sort.Slice(hashes, func(i, j int) bool {
+			return titles[hashes[i]] < titles[hashes[j]]
+		})
+	}
+
+	catIndex.Lock()
+	catIndex.built = true
+	catIndex.members = members
+	catIndex.titles = titles
+	catIndex.Unlock()
+
+	log.Printf("Done building category index! %d categories", len(members))
+	return nil
+}
+
+type categoryPage struct {
+	Category string   `json:"category"`
+	Titles   []string `json:"titles"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// handleInCategory serves /incategory?category=...&limit=N&cursor=... and
+// returns the titles of the articles in a category. The cursor is the value
+// of "next" from the previous page.
+func handleInCategory(w http.ResponseWriter, r *http.Request) error {
+	if !*categories {
+		return statusErrorf(http.StatusServiceUnavailable, "category index disabled, start with -categories")
+	}
+	q := r.URL.Query()
+	category := normalizeCategory(q.Get("category"))
+	if category == "" {
+		return statusErrorf(http.StatusBadRequest, "category parameter is required")
+	}
+	limit, err := intParam(r, "limit", 50, 1, 500)
+	if err != nil {
+		return err
+	}
+	start := 0
+	if cursor := q.Get("cursor"); cursor != "" {
+		start, err = strconv.Atoi(cursor)
+		if err != nil || start < 0 {
+			return statusErrorf(http.StatusBadRequest, "invalid cursor %q", cursor)
+		}
+	}
+
+	resp, err := categoryMembers(category, start, limit)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, resp)
+}
+
+func categoryMembers(category string, start, limit int) (categoryPage, error) {
+	catIndex.Lock()
+	defer catIndex.Unlock()
+
+	if !catIndex.built {
+		return categoryPage{}, statusErrorf(http.StatusServiceUnavailable, "category index is still being built")
+	}
+	hashes, ok := catIndex.members[category]
+	if !ok {
+		return categoryPage{}, statusErrorf(http.StatusNotFound, "category not found: %q", category)
+	}
+
+	resp := categoryPage{
+		Category: category,
+		Titles:   []string{},
+	}
+	for i := start; i < len(hashes) && len(resp.Titles) < limit; i++ {
+		resp.Titles = append(resp.Titles, catIndex.titles[hashes[i]])
+	}
+	if end := start + len(resp.Titles); end < len(hashes) {
+		resp.Next = strconv.Itoa(end)
+	}
+	return resp, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+type textChunk struct {
+	Index int    `json:"index"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// chunkText splits text into chunks of at most size bytes where consecutive
+// chunks share roughly overlap bytes. Chunks end on a paragraph or sentence
+// boundary when one falls in the second half of the window, otherwise on the
+// last whitespace, and only split mid-word when there is no whitespace at all.
+// Start and End are byte offsets into text.
+func chunkText(text string, size, overlap int) []textChunk {
+	chunks := []textChunk{}
+	start := skipSpace(text, 0)
+	for start < len(text) {
+		end := len(text)
+		if start+size < len(text) {
+			end = chunkBoundary(text, start, start+size)
+		}
+		trimmed := end
+		for trimmed > start && isSpace(text[trimmed-1]) {
+			trimmed--
+		}
+		chunks = append(chunks, textChunk{
+			Index: len(chunks),
+			Start: start,
+			End:   trimmed,
+			Text:  text[start:trimmed],
+		})
+		if end >= len(text) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = start + 1
+		}
+		// Move forward to the start of a word so the overlap doesn't begin
+		// mid-word.
+		for next < end && !isSpace(text[next-1]) {
+			next++
+		}
+		start = skipSpace(text, next)
+	}
+	return chunks
+}
+
+// chunkBoundary picks where a chunk starting at start should end, given that
+// it can't extend past max.
+func chunkBoundary(text string, start, max int) int {
+	window := text[start:max]
+	half := len(window) / 2
+	if i := strings.LastIndex(window, "\n\n"); i >= half {
+		return start + i
+	}
+	best := -1
+	for _, sep := range []string{". ", "! ", "? ", ".\n"} {
+		if i := strings.LastIndex(window, sep); i >= 0 && i+1 > best {
+			best = i + 1
+		}
+	}
+	if best >= half {
+		return start + best
+	}
+	if i := strings.LastIndexAny(window, " \t\n"); i > 0 {
+		return start + i
+	}
+	for max > start+1 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return max
+}
+
+func skipSpace(text string, i int) int {
+	for i < len(text) && isSpace(text[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r'
+}
+
+// handleChunks serves /chunks?title=...&size=N&overlap=M, returning the plain
+// text of an article split into overlapping chunks for embedding.
+func handleChunks(w http.ResponseWriter, r *http.Request) error {
+	size, err := intParam(r, "size", 1000, 100, 100000)
+	if err != nil {
+		return err
+	}
+	overlap, err := intParam(r, "overlap", 200, 0, size-1)
+	if err != nil {
+		return err
+	}
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, chunkText(plainText(p.Text), size, overlap))
+}
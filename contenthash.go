@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// contentHash returns a hash of text for detecting changed articles across
+// dumps: the hex SHA-256 of the text with line endings normalized to \n,
+// trailing whitespace removed from every line and leading and trailing blank
+// lines removed. Nothing else is normalized, so any other edit changes it.
+func contentHash(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	text = strings.Trim(strings.Join(lines, "\n"), "\n")
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+type articleHash struct {
+	Title       string `json:"title"`
+	RevisionID  string `json:"revisionID"`
+	ContentHash string `json:"contentHash"`
+}
+
+// handleHash serves /hash?title=..., returning just the article's
+// contentHash, for clients checking whether it changed without fetching it.
+func handleHash(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, articleHash{
+		Title:       p.Title,
+		RevisionID:  p.RevisionID,
+		ContentHash: contentHash(p.Text),
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	base := contentHash("Foo\nbar")
+	cases := []struct {
+		text string
+		same bool
+	}{
+		{"Foo\nbar", true},
+		{"Foo\r\nbar\r\n", true},
+		{"\n\nFoo  \nbar\t\n\n", true},
+		{"Foo\n\nbar", false},
+		{"foo\nbar", false},
+		{" Foo\nbar", false},
+	}
+	for _, c := range cases {
+		if got := contentHash(c.text) == base; got != c.same {
+			t.Errorf("contentHash(%q) == contentHash(%q) is %v; expected %v", c.text, "Foo\nbar", got, c.same)
+		}
+	}
+	// The hash is plain SHA-256 so it can be reproduced without wikigopher.
+	if got, want := contentHash("abc"), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("contentHash(abc) = %s; not %s", got, want)
+	}
+}
+
+func TestHandleHash(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "Some text")})
+
+	w := httptest.NewRecorder()
+	handle(handleHash)(w, httptest.NewRequest("GET", "/hash?title=Foo", nil))
+	var got articleHash
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (articleHash{Title: "Foo", RevisionID: "1000Foo", ContentHash: contentHash("Some text")}); got != want {
+		t.Errorf("/hash = %+v; not %+v", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Foo&clean=true", nil))
+	var article articleResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &article); err != nil {
+		t.Fatal(err)
+	}
+	if article.ContentHash != got.ContentHash {
+		t.Errorf("/article contentHash = %q; not %q", article.ContentHash, got.ContentHash)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// coordRegexp matches {{coord|...}} templates, capturing their parameters.
+var coordRegexp = regexp.MustCompile(`(?i)\{\{\s*coord\s*\|([^{}]*)\}\}`)
+
+// extractCoordinates returns the coordinates of the first {{coord}} template
+// in text, preferring one shown by the title with display=title since that's
+// the article's own location rather than something it mentions. Coordinates
+// can be decimal, as in {{coord|12.3|-45.6}} or {{coord|12.3|N|45.6|W}}, or in
+// degrees, minutes and optionally seconds, as in {{coord|12|18|N|45|36|E}}.
+// ok is false if there's no template with valid coordinates.
+func extractCoordinates(text string) (lat, lon float64, ok bool) {
+	for _, m := range coordRegexp.FindAllStringSubmatch(text, -1) {
+		var positional []string
+		title := false
+		for _, param := range strings.Split(m[1], "|") {
+			param = strings.TrimSpace(param)
+			if i := strings.Index(param, "="); i >= 0 {
+				if strings.TrimSpace(param[:i]) == "display" && strings.Contains(param[i+1:], "title") {
+					title = true
+				}
+				continue
+			}
+			positional = append(positional, param)
+		}
+		plat, plon, pok := parseCoordParams(positional)
+		if !pok {
+			continue
+		}
+		if !ok || title {
+			lat, lon, ok = plat, plon, true
+		}
+		if title {
+			break
+		}
+	}
+	return lat, lon, ok
+}
+
+// parseCoordParams parses a {{coord}} template's positional parameters.
+// Without hemispheres they're a decimal latitude and longitude. With them,
+// each of the latitude and longitude is up to three numbers of degrees,
+// minutes and seconds followed by N or S and E or W. Anything after the
+// longitude, like {{coord}}'s coordinate parameters, is ignored.
+func parseCoordParams(params []string) (lat, lon float64, ok bool) {
+	hasHemisphere := false
+	for _, p := range params {
+		if isHemisphere(p) {
+			hasHemisphere = true
+		}
+	}
+	if !hasHemisphere {
+		if len(params) < 2 {
+			return 0, 0, false
+		}
+		var err1, err2 error
+		lat, err1 = strconv.ParseFloat(params[0], 64)
+		lon, err2 = strconv.ParseFloat(params[1], 64)
+		return lat, lon, err1 == nil && err2 == nil && validCoordinates(lat, lon)
+	}
+
+	lat, rest, ok := parseDMS(params, "N", "S")
+	if !ok {
+		return 0, 0, false
+	}
+	lon, _, ok = parseDMS(rest, "E", "W")
+	return lat, lon, ok && validCoordinates(lat, lon)
+}
+
+// parseDMS parses degrees, minutes and seconds up to a hemisphere of pos or
+// neg, returning the decimal degrees, negative for neg, and the parameters
+// after the hemisphere.
+func parseDMS(params []string, pos, neg string) (float64, []string, bool) {
+	var value float64
+	scale := 1.0
+	for i := 0; i < len(params) && i <= 3; i++ {
+		switch strings.ToUpper(params[i]) {
+		case pos:
+			return value, params[i+1:], i > 0
+		case neg:
+			return -value, params[i+1:], i > 0
+		}
+		if i == 3 {
+			break
+		}
+		n, err := strconv.ParseFloat(params[i], 64)
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, nil, false
+		}
+		value += n / scale
+		scale *= 60
+	}
+	return 0, nil, false
+}
+
+func isHemisphere(p string) bool {
+	switch strings.ToUpper(p) {
+	case "N", "S", "E", "W":
+		return true
+	}
+	return false
+}
+
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+type coordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// handleCoords serves /coords?title=..., returning the article's coordinates,
+// see extractCoordinates, or a 204 if it has none.
+func handleCoords(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	lat, lon, ok := extractCoordinates(p.Text)
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return writeJSON(w, r, coordinates{Lat: lat, Lon: lon})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtractCoordinates(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		lat, lon float64
+		ok       bool
+	}{
+		{"decimal", "{{coord|12.3|45.6}}", 12.3, 45.6, true},
+		{"negative decimal", "{{Coord|-33.8688|151.2093|display=inline,title}}", -33.8688, 151.2093, true},
+		{"decimal hemispheres", "{{coord|12.3|S|45.6|W}}", -12.3, -45.6, true},
+		{"dm", "{{coord|12|18|N|45|36|E}}", 12.3, 45.6, true},
+		{"dms", "{{coord|51|30|26|N|0|7|39|W|region:GB_type:city}}", 51.50722, -0.1275, true},
+		{"spaces", "{{ coord | 12 | 18 | N | 45 | 36 | E | type:landmark }}", 12.3, 45.6, true},
+		{"title preferred", "Near {{coord|1|2}}.\n{{coord|3|4|display=title}}", 3, 4, true},
+		{"first otherwise", "{{coord|1|2}} and {{coord|3|4}}", 1, 2, true},
+		{"skips invalid", "{{coord|95|200}} {{coord|5|6}}", 5, 6, true},
+		{"minutes out of range", "{{coord|12|75|N|45|36|E}}", 0, 0, false},
+		{"missing longitude hemisphere", "{{coord|12|18|N|45|36}}", 0, 0, false},
+		{"too few", "{{coord|12.3}}", 0, 0, false},
+		{"none", "'''Foo''' is a [[bar]].", 0, 0, false},
+		{"similar template", "{{coordinates missing}}", 0, 0, false},
+	}
+
+	for _, c := range cases {
+		lat, lon, ok := extractCoordinates(c.text)
+		if ok != c.ok || math.Abs(lat-c.lat) > 1e-4 || math.Abs(lon-c.lon) > 1e-4 {
+			t.Errorf("%s: extractCoordinates = %v, %v, %v; not %v, %v, %v", c.name, lat, lon, ok, c.lat, c.lon, c.ok)
+		}
+	}
+}
+
+func TestHandleCoords(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "London", "{{coord|51.5|-0.12|display=title}}"),
+		testPage(2, "Nowhere", "No location."),
+	})
+
+	for _, c := range []struct {
+		title string
+		code  int
+		want  string
+	}{
+		{"London", http.StatusOK, `{"lat":51.5,"lon":-0.12}`},
+		{"Nowhere", http.StatusNoContent, ""},
+		{"Missing", http.StatusNotFound, "not found"},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleCoords)(w, httptest.NewRequest("GET", "/coords?title="+c.title, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: got %d %s; expected %d containing %s", c.title, w.Code, w.Body, c.code, c.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pageNotInBlock is the error for a page that wasn't in the pages read of its
+// block, given how many were.
+type pageNotInBlock int
+
+func (e pageNotInBlock) Error() string {
+	return fmt.Sprintf("failed to find page after %d tries", int(e))
+}
+
+// pageScanner reads the pages of a block one at a time.
+type pageScanner struct {
+	d *xml.Decoder
+	// rec records the raw XML of the pages if it's set.
+	rec   *recordingReader
+	tries int
+}
+
+// next advances to the next page and reads its children up to and including
+// its <id>, returning the page's offset in the stream along with its title,
+// namespace and ID. It reports false at the end of the stream. The rest of
+// the page is left for the caller to read or skip.
+func (s *pageScanner) next() (int64, pageMeta, bool, error) {
+	for {
+		start := s.d.InputOffset()
+		tok, err := s.d.Token()
+		if err == io.EOF {
+			return 0, pageMeta{}, false, nil
+		} else if err, ok := err.(*xml.SyntaxError); ok && strings.Contains(err.Msg, "</mediawiki>") {
+			// Reached the end of the dump.
+			return 0, pageMeta{}, false, nil
+		} else if err != nil {
+			return 0, pageMeta{}, false, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "page" {
+			continue
+		}
+		s.tries++
+		if s.rec != nil {
+			s.rec.discardBefore(start)
+		}
+		head, err := readPageHead(s.d)
+		return start, head, err == nil, err
+	}
+}
+
+// findPage reads the pages from r until match accepts one, given its 1-based
+// position in r and its ID, giving up after maxTries pages or at the end of
+// the stream. It returns the page's raw XML along with how many pages were
+// read to find it. Only the <id> of each page is parsed, so the
+// multi-megabyte text of the other pages in the block is never unmarshaled.
+func findPage(r io.Reader, match func(n, id int) bool, maxTries int) ([]byte, int, error) {
+	rec := &recordingReader{r: r}
+	s := &pageScanner{d: xml.NewDecoder(rec), rec: rec}
+	for s.tries < maxTries {
+		start, head, ok, err := s.next()
+		if err != nil {
+			return nil, s.tries, err
+		} else if !ok {
+			break
+		}
+		if err := s.d.Skip(); err != nil {
+			return nil, s.tries, err
+		}
+		if match(s.tries, head.ID) {
+			return rec.slice(start, s.d.InputOffset()), s.tries, nil
+		}
+	}
+	return nil, s.tries, errors.WithStack(pageNotInBlock(s.tries))
+}
+
+// pageMeta is what findPageMeta reads of a page: everything /revision needs,
+// but not its text.
+type pageMeta struct {
+	Title      string
+	NS         int
+	ID         int
+	Redirect   string
+	RevisionID string
+	Timestamp  string
+	Model      string
+	Format     string
+	// Length is the size of the text in bytes.
+	Length      int
+	TextDeleted bool
+}
+
+// findPageMeta is findPage for when only the matched page's metadata is
+// needed. The page is only read as far as the start of its <text>, whose
+// length comes from its bytes attribute, so the text is never copied or
+// unmarshaled. The stream is left in the middle of the page, so nothing can
+// be read from r after it.
+func findPageMeta(r io.Reader, match func(n, id int) bool, maxTries int) (pageMeta, int, error) {
+	s := &pageScanner{d: xml.NewDecoder(r)}
+	for s.tries < maxTries {
+		_, head, ok, err := s.next()
+		if err != nil {
+			return pageMeta{}, s.tries, err
+		} else if !ok {
+			break
+		}
+		if !match(s.tries, head.ID) {
+			if err := s.d.Skip(); err != nil {
+				return pageMeta{}, s.tries, err
+			}
+			continue
+		}
+		err = readPageMeta(s.d, &head)
+		return head, s.tries, err
+	}
+	return pageMeta{}, s.tries, errors.WithStack(pageNotInBlock(s.tries))
+}
+
+// readPageHead consumes the children of a <page> element up to and including
+// its <id>, keeping the title and namespace before it and skipping anything
+// else.
+func readPageHead(d *xml.Decoder) (pageMeta, error) {
+	var m pageMeta
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return m, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var dst interface{}
+			switch tok.Name.Local {
+			case "title":
+				dst = &m.Title
+			case "ns":
+				dst = &m.NS
+			case "id":
+				dst = &m.ID
+			default:
+				if err := d.Skip(); err != nil {
+					return m, err
+				}
+				continue
+			}
+			if err := d.DecodeElement(dst, &tok); err != nil {
+				return m, err
+			}
+			if tok.Name.Local == "id" {
+				return m, nil
+			}
+		case xml.EndElement:
+			return m, errors.Errorf("page has no id")
+		}
+	}
+}
+
+// readPageMeta reads the rest of a page's metadata into m, after
+// readPageHead, stopping at the start of its revision's <text>. Only if the
+// <text> has no bytes attribute is it read to find its length.
+func readPageMeta(d *xml.Decoder, m *pageMeta) error {
+	inRevision := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var dst *string
+			switch {
+			case tok.Name.Local == "redirect":
+				for _, a := range tok.Attr {
+					if a.Name.Local == "title" {
+						m.Redirect = a.Value
+					}
+				}
+			case tok.Name.Local == "revision":
+				inRevision = true
+				continue
+			case !inRevision:
+			case tok.Name.Local == "id":
+				dst = &m.RevisionID
+			case tok.Name.Local == "timestamp":
+				dst = &m.Timestamp
+			case tok.Name.Local == "model":
+				dst = &m.Model
+			case tok.Name.Local == "format":
+				dst = &m.Format
+			case tok.Name.Local == "text":
+				return readTextLength(d, tok, m)
+			}
+			if dst != nil {
+				if err := d.DecodeElement(dst, &tok); err != nil {
+					return err
+				}
+			} else if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			// The page or its revision ended without any text.
+			if tok.Name.Local == "page" {
+				return nil
+			}
+			inRevision = false
+		}
+	}
+}
+
+// readTextLength sets m's text length and whether it was deleted from the
+// <text> start element, reading the text only if it doesn't say its length.
+func readTextLength(d *xml.Decoder, text xml.StartElement, m *pageMeta) error {
+	length := -1
+	for _, a := range text.Attr {
+		switch a.Name.Local {
+		case "deleted":
+			m.TextDeleted = true
+		case "bytes":
+			if n, err := strconv.Atoi(a.Value); err == nil {
+				length = n
+			}
+		}
+	}
+	if m.TextDeleted {
+		// Deleted text isn't in the dump, whatever its size was.
+		return nil
+	}
+	if length >= 0 {
+		m.Length = length
+		return nil
+	}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			m.Length += len(tok)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// recordingReader keeps a copy of everything read through it, starting from
+// the last offset passed to discardBefore, so that the raw bytes of an
+// element can be recovered after the decoder has consumed them.
+type recordingReader struct {
+	r    io.Reader
+	buf  []byte
+	base int64
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.buf = append(rr.buf, p[:n]...)
+	return n, err
+}
+
+// discardBefore drops the recorded bytes before the stream offset off.
+func (rr *recordingReader) discardBefore(off int64) {
+	drop := int(off - rr.base)
+	n := copy(rr.buf, rr.buf[drop:])
+	rr.buf = rr.buf[:n]
+	rr.base = off
+}
+
+// slice returns the recorded bytes between the stream offsets start and end.
+func (rr *recordingReader) slice(start, end int64) []byte {
+	return rr.buf[start-rr.base : end-rr.base]
+}
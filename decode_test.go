@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/d4l3k/go-pbzip2"
+)
+
+func denseBlock(n, textSize int) []page {
+	var block []page
+	for i := 0; i < n; i++ {
+		block = append(block, testPage(i+1, fmt.Sprintf("Page %d", i), strings.Repeat("lorem ipsum ", textSize/12)))
+	}
+	return block
+}
+
+func TestReadArticle(t *testing.T) {
+	block := denseBlock(5, 100)
+	block[2].Text = "The '''third''' page.\u00a0Ünïcode\tword"
+	useTestDump(t, block[:1], block[1:])
+
+	for _, want := range block {
+		meta, err := fetchArticle(want.Title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readArticle(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != want.ID || got.Title != want.Title || got.Text != want.Text || got.RevisionID != want.RevisionID {
+			t.Errorf("readArticle(%q) = %+v; not %+v", want.Title, got, want)
+		}
+		if got.Length != len(want.Text) {
+			t.Errorf("readArticle(%q).Length = %d; not %d", want.Title, got.Length, len(want.Text))
+		}
+	}
+}
+
+func TestReadArticleDeclaredEncoding(t *testing.T) {
+	// "Café" and "Zürich" in ISO-8859-1, which isn't valid UTF-8.
+	header := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<mediawiki>\n"
+	body := "  <page>\n    <title>Caf\xe9</title>\n    <id>7</id>\n" +
+		"    <revision>\n      <text>Z\xfcrich</text>\n    </revision>\n  </page>\n"
+	idx := newOffsetIndex()
+	idx.add("Café", indexEntry{id: 7, seek: len(header)})
+	installTestDump(t, []byte(header+body+"</mediawiki>\n"), idx)
+
+	meta, err := fetchArticle("Café")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readArticle(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Café" || got.Text != "Zürich" {
+		t.Errorf("readArticle = %q, %q; not %q, %q", got.Title, got.Text, "Café", "Zürich")
+	}
+}
+
+func TestReadRawPage(t *testing.T) {
+	header := "<mediawiki>\n"
+	raw := "<page>\n    <title>Foo</title>\n    <ns>0</ns>\n    <id>3</id>\n" +
+		"    <restrictions>edit=sysop</restrictions>\n    <revision><text>Bar</text></revision>\n  </page>"
+	idx := newOffsetIndex()
+	idx.add("Foo", indexEntry{id: 3, seek: len(header)})
+	installTestDump(t, []byte(header+raw+"\n</mediawiki>\n"), idx)
+
+	meta, err := fetchArticle("Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRawPage(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != raw {
+		t.Errorf("readRawPage = %q; not %q", got, raw)
+	}
+}
+
+func TestReadArticleUndercountedBlock(t *testing.T) {
+	block := denseBlock(4, 100)
+	useTestDump(t, block)
+	last := block[len(block)-1]
+	meta, err := fetchArticle(last.Title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	mu.offsetSize[meta.seek] = 2
+	mu.Unlock()
+
+	got, err := readArticle(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != last.Title {
+		t.Errorf("readArticle = %q; not %q", got.Title, last.Title)
+	}
+
+	if _, err := readArticle(indexEntry{id: 1000, seek: meta.seek}); err == nil || !strings.Contains(err.Error(), "failed to find page") {
+		t.Errorf("expected missing page to not be found at the end of the dump; got %v", err)
+	}
+}
+
+func TestFindPageMeta(t *testing.T) {
+	block := `<page>
+    <title>First</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision><id>10</id><timestamp>2022-01-01T00:00:00Z</timestamp><text bytes="5">first</text></revision>
+  </page>
+  <page>
+    <title>Second &amp; more</title>
+    <ns>4</ns>
+    <id>2</id>
+    <redirect title="Target" />
+    <revision>
+      <id>20</id>
+      <parentid>19</parentid>
+      <timestamp>2022-02-02T00:00:00Z</timestamp>
+      <contributor><username>Someone</username><id>5</id></contributor>
+      <model>wikitext</model>
+      <format>text/x-wiki</format>
+      <text bytes="1234" xml:space="preserve">#REDIRECT [[Target]]`
+	cases := []struct {
+		xml  string
+		id   int
+		want pageMeta
+	}{
+		{block + "</text></revision></page>", 2, pageMeta{
+			Title: "Second & more", NS: 4, ID: 2, Redirect: "Target", RevisionID: "20",
+			Timestamp: "2022-02-02T00:00:00Z", Model: "wikitext", Format: "text/x-wiki", Length: 1234,
+		}},
+		// The text after the <text> tag is never read, so a truncated or huge
+		// one doesn't matter.
+		{block, 2, pageMeta{
+			Title: "Second & more", NS: 4, ID: 2, Redirect: "Target", RevisionID: "20",
+			Timestamp: "2022-02-02T00:00:00Z", Model: "wikitext", Format: "text/x-wiki", Length: 1234,
+		}},
+		{block, 1, pageMeta{Title: "First", ID: 1, RevisionID: "10", Timestamp: "2022-01-01T00:00:00Z", Length: 5}},
+		{`<page><title>Gone</title><ns>0</ns><id>3</id><revision><id>30</id><text bytes="99" deleted="deleted" /></revision></page>`, 3,
+			pageMeta{Title: "Gone", ID: 3, RevisionID: "30", TextDeleted: true}},
+		{`<page><title>Old</title><ns>0</ns><id>4</id><revision><id>40</id><text>caf&#233; &amp;</text></revision></page>`, 4,
+			pageMeta{Title: "Old", ID: 4, RevisionID: "40", Length: len("café &")}},
+	}
+	for _, c := range cases {
+		got, _, err := findPageMeta(strings.NewReader(c.xml), func(n, id int) bool { return id == c.id }, 10)
+		if err != nil {
+			t.Errorf("page %d: %v", c.id, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("page %d: got %+v; not %+v", c.id, got, c.want)
+		}
+	}
+}
+
+func TestReadMeta(t *testing.T) {
+	block := denseBlock(5, 100)
+	block[3].Model, block[3].Format = "css", "text/css"
+	useTestDump(t, block)
+
+	for _, want := range block {
+		meta, err := fetchArticle(want.Title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readMeta(meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != want.Title || got.ID != want.ID || got.RevisionID != want.RevisionID ||
+			got.Timestamp != want.Timestamp || got.Model != want.Model || got.Format != want.Format || got.Length != len(want.Text) {
+			t.Errorf("readMeta(%q) = %+v", want.Title, got)
+		}
+	}
+}
+
+func BenchmarkReadArticleDenseBlock(b *testing.B) {
+	block := denseBlock(100, 50000)
+	useTestDump(b, block)
+	meta, err := fetchArticle(block[len(block)-1].Title)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readArticle(meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadMetaDenseBlock is BenchmarkReadArticleDenseBlock reading only
+// the last page's metadata.
+func BenchmarkReadMetaDenseBlock(b *testing.B) {
+	block := denseBlock(100, 50000)
+	useTestDump(b, block)
+	meta, err := fetchArticle(block[len(block)-1].Title)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readMeta(meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFullDecodeDenseBlock measures fully unmarshaling every page in the
+// block, which is what readArticle did before it skipped non-matching pages.
+func BenchmarkFullDecodeDenseBlock(b *testing.B) {
+	block := denseBlock(100, 50000)
+	useTestDump(b, block)
+	meta, err := fetchArticle(block[len(block)-1].Title)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(*articlesFile)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := f.Seek(int64(meta.seek), 0); err != nil {
+			b.Fatal(err)
+		}
+		d := xml.NewDecoder(f)
+		for j := 0; j < len(block); j++ {
+			var p page
+			if err := d.Decode(&p); err != nil {
+				b.Fatal(err)
+			}
+			if p.ID == meta.id {
+				break
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestReadArticleDeletedText(t *testing.T) {
+	header := "<mediawiki>\n"
+	body := "<page>\n    <title>Suppressed</title>\n    <ns>0</ns>\n    <id>4</id>\n" +
+		"    <revision>\n      <id>99</id>\n      <contributor deleted=\"deleted\" />\n" +
+		"      <text bytes=\"1234\" deleted=\"deleted\" />\n    </revision>\n  </page>\n" +
+		"  <page>\n    <title>Kept</title>\n    <ns>0</ns>\n    <id>5</id>\n" +
+		"    <revision>\n      <text bytes=\"22\">&lt;text deleted=\"x\"&gt;</text>\n    </revision>\n  </page>\n"
+	idx := newOffsetIndex()
+	idx.add("Suppressed", indexEntry{id: 4, seek: len(header)})
+	idx.add("Kept", indexEntry{id: 5, seek: len(header)})
+	installTestDump(t, []byte(header+body+"</mediawiki>\n"), idx)
+
+	for _, c := range []struct {
+		title, text string
+		deleted     bool
+	}{
+		{"Suppressed", "", true},
+		{"Kept", `<text deleted="x">`, false},
+	} {
+		got, err := lookupArticle(c.title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.TextDeleted != c.deleted || got.Text != c.text {
+			t.Errorf("%s: textDeleted = %v, text = %q; not %v, %q", c.title, got.TextDeleted, got.Text, c.deleted, c.text)
+		}
+	}
+}
+
+// BenchmarkBlockDecompress compares decompressing a single multistream block
+// with compress/bzip2, as articleReader does, and with pbzip2, as the index
+// is read. It needs the bzip2 command to compress the blocks.
+func BenchmarkBlockDecompress(b *testing.B) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		b.Skip("bzip2 isn't installed")
+	}
+	for _, size := range []struct {
+		name     string
+		textSize int
+	}{
+		{"Small", 1000},
+		{"Large", 50000},
+	} {
+		var raw bytes.Buffer
+		for _, p := range denseBlock(100, size.textSize) {
+			body, err := xml.Marshal(p)
+			if err != nil {
+				b.Fatal(err)
+			}
+			raw.Write(body)
+		}
+		cmd := exec.Command("bzip2", "-c")
+		cmd.Stdin = bytes.NewReader(raw.Bytes())
+		compressed, err := cmd.Output()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(size.name+"/bzip2", func(b *testing.B) {
+			b.SetBytes(int64(raw.Len()))
+			for i := 0; i < b.N; i++ {
+				if _, err := io.Copy(ioutil.Discard, bzip2.NewReader(bytes.NewReader(compressed))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(size.name+"/pbzip2", func(b *testing.B) {
+			b.SetBytes(int64(raw.Len()))
+			for i := 0; i < b.N; i++ {
+				r, err := pbzip2.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
+
+// BenchmarkIndexDecompress decompresses an index with pbzip2 at a few values
+// of -decompressThreads. It needs the bzip2 command to compress the index.
+func BenchmarkIndexDecompress(b *testing.B) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		b.Skip("bzip2 isn't installed")
+	}
+	var raw bytes.Buffer
+	for i := 0; i < 500000; i++ {
+		fmt.Fprintf(&raw, "%d:%d:Page %d\n", i/100*4096, i+1, i)
+	}
+	cmd := exec.Command("bzip2", "-c")
+	cmd.Stdin = bytes.NewReader(raw.Bytes())
+	compressed, err := cmd.Output()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			b.SetBytes(int64(raw.Len()))
+			for i := 0; i < b.N; i++ {
+				r, err := pbzip2.NewReader(bytes.NewReader(compressed), pbzip2.ReaderConcurrency(threads))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
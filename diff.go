@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var linkCacheSize = flag.Int("linkCacheSize", 1000, "the number of articles to cache extracted links for")
+
+// linkCache is recreated with the configured size by run.
+var linkCache = newLRUCache(*linkCacheSize)
+
+// articleLinks returns the outgoing links of the named article. Link sets are
+// cached by page ID.
+func articleLinks(title string) ([]string, error) {
+	meta, err := fetchArticle(title)
+	if err != nil {
+		return nil, err
+	}
+	if links, ok := linkCache.get(meta.id); ok {
+		return links.([]string), nil
+	}
+	p, err := readArticle(meta)
+	if err != nil {
+		return nil, err
+	}
+	links := extractLinks(p.Text)
+	linkCache.add(meta.id, links)
+	return links, nil
+}
+
+type linkDiff struct {
+	OnlyA  []string          `json:"onlyA"`
+	OnlyB  []string          `json:"onlyB"`
+	Shared []string          `json:"shared"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// diffLinks compares two link sets. The results are sorted.
+func diffLinks(a, b []string) linkDiff {
+	inB := map[string]bool{}
+	for _, link := range b {
+		inB[link] = true
+	}
+	diff := linkDiff{
+		OnlyA:  []string{},
+		OnlyB:  []string{},
+		Shared: []string{},
+	}
+	inA := map[string]bool{}
+	for _, link := range a {
+		inA[link] = true
+		if inB[link] {
+			diff.Shared = append(diff.Shared, link)
+		} else {
+			diff.OnlyA = append(diff.OnlyA, link)
+		}
+	}
+	for _, link := range b {
+		if !inA[link] {
+			diff.OnlyB = append(diff.OnlyB, link)
+		}
+	}
+	sort.Strings(diff.OnlyA)
+	sort.Strings(diff.OnlyB)
+	sort.Strings(diff.Shared)
+	return diff
+}
+
+// handleDiff serves /diff?a=...&b=..., comparing the outgoing links of two
+// articles. If either article can't be loaded the response has the status of
+// the worse failure, a 500 for one that isn't an HTTP error, and reports
+// each side's error under "errors".
+func handleDiff(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	titles := [2]string{q.Get("a"), q.Get("b")}
+	var links [2][]string
+	var errs [2]error
+
+	var wg sync.WaitGroup
+	for i := range titles {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			links[i], errs[i] = articleLinks(titles[i])
+		}(i)
+	}
+	wg.Wait()
+
+	if errs[0] != nil || errs[1] != nil {
+		diff := linkDiff{Errors: map[string]string{}}
+		status := 0
+		for i, side := range []string{"a", "b"} {
+			if errs[i] == nil {
+				continue
+			}
+			diff.Errors[side] = errs[i].Error()
+			code := http.StatusInternalServerError
+			if err, ok := errors.Cause(errs[i]).(statusError); ok {
+				code = int(err)
+			}
+			if code > status {
+				status = code
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		return writeJSON(w, r, diff)
+	}
+	return writeJSON(w, r, diffLinks(links[0], links[1]))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDiffErrorStatus(t *testing.T) {
+	useTestDump(t, []page{testPage(7001, "Diff unreadable", "[[Fox]]")})
+	diff := func(query string) (int, linkDiff) {
+		w := httptest.NewRecorder()
+		handle(handleDiff)(w, httptest.NewRequest("GET", "/diff?"+query, nil))
+		var d linkDiff
+		if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, d
+	}
+	queries := []string{"a=Diff+missing&b=Diff+unreadable", "a=Diff+unreadable&b=Diff+missing"}
+
+	// The article is in the offsets index but its block isn't a page, which
+	// isn't an HTTP error.
+	if err := ioutil.WriteFile(*articlesFile, []byte("not a dump"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries {
+		code, d := diff(query)
+		if code != http.StatusInternalServerError {
+			t.Errorf("%s: status = %d; expected the read failure's 500 over the missing article's 404", query, code)
+		}
+		if len(d.Errors) != 2 {
+			t.Errorf("%s: errors = %v; expected both sides'", query, d.Errors)
+		}
+	}
+
+	if err := os.Remove(*articlesFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries {
+		if code, _ := diff(query); code != http.StatusServiceUnavailable {
+			t.Errorf("%s: status = %d; expected the missing file's 503 over the missing article's 404", query, code)
+		}
+	}
+}
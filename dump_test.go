@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func testPage(id int, title, text string) page {
+	return page{
+		Title:      title,
+		ID:         id,
+		RevisionID: "1000" + title,
+		Timestamp:  "2022-01-01T00:00:00Z",
+		Model:      "wikitext",
+		Format:     "text/x-wiki",
+		Text:       text,
+	}
+}
+
+// useTestDump writes a synthetic uncompressed articles dump where each slice
+// of pages is one block, and installs it along with a matching index. The
+// previous -articles and index are restored when the test finishes.
+func useTestDump(tb testing.TB, blocks ...[]page) {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString("<mediawiki>\n  <siteinfo>\n    <sitename>Wikipedia</sitename>\n  </siteinfo>\n")
+	idx := newOffsetIndex()
+	for _, block := range blocks {
+		seek := buf.Len()
+		for _, p := range block {
+			body, err := xml.MarshalIndent(p, "  ", "  ")
+			if err != nil {
+				tb.Fatal(err)
+			}
+			buf.Write(body)
+			buf.WriteString("\n")
+			idx.add(p.Title, indexEntry{id: p.ID, seek: seek})
+		}
+	}
+	buf.WriteString("</mediawiki>\n")
+	installTestDump(tb, buf.Bytes(), idx)
+}
+
+// installTestDump writes data as the articles file and installs idx as the
+// index until the test finishes.
+func installTestDump(tb testing.TB, data []byte, idx *offsetIndex) {
+	tb.Helper()
+
+	path := filepath.Join(tb.TempDir(), "articles.xml")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	offsets, err := idx.finish()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	duplicates, err := findDuplicates(idx, offsets)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	oldArticles := *articlesFile
+	*articlesFile = path
+	mu.Lock()
+	oldOffsets := setOffsets(offsets).offsets
+	oldOffsetSize, oldTitles, oldDuplicates, oldFound, oldIDs, oldEnd, oldMaxID := mu.offsetSize, mu.titles, mu.duplicates, mu.found, mu.idToHash, mu.end, mu.maxID
+	mu.offsetSize, mu.titles, mu.duplicates, mu.found, mu.idToHash, mu.end, mu.maxID = idx.offsetSize, idx.titles, duplicates, mapStore{}, idx.idToHash, idx.end, idx.maxID
+	oldFoundEntries := atomic.SwapInt64(&foundEntries, 0)
+	mu.generation++
+	mu.Unlock()
+
+	tb.Cleanup(func() {
+		*articlesFile = oldArticles
+		mu.Lock()
+		setOffsets(oldOffsets)
+		mu.offsetSize, mu.titles, mu.duplicates, mu.found, mu.idToHash, mu.end, mu.maxID = oldOffsetSize, oldTitles, oldDuplicates, oldFound, oldIDs, oldEnd, oldMaxID
+		atomic.StoreInt64(&foundEntries, oldFoundEntries)
+		mu.generation++
+		mu.Unlock()
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+)
+
+// idOccurrence is one of the pages in the dump with a duplicated page ID.
+type idOccurrence struct {
+	Title string `json:"title"`
+	Seek  int    `json:"seek"`
+}
+
+// duplicateID is a page ID shared by more than one page, with the pages in
+// the order they're in the dump.
+type duplicateID struct {
+	ID          int            `json:"id"`
+	Occurrences []idOccurrence `json:"occurrences"`
+}
+
+// idSet is a bitset of the page IDs seen while loading the index. Page IDs
+// are dense, so this costs about one bit per page ever created on the wiki.
+type idSet []uint64
+
+// add adds id to the set, reporting false if it was already there.
+func (s *idSet) add(id int) bool {
+	i, bit := id/64, uint64(1)<<uint(id%64)
+	for len(*s) <= i {
+		*s = append(*s, 0)
+	}
+	if (*s)[i]&bit != 0 {
+		return false
+	}
+	(*s)[i] |= bit
+	return true
+}
+
+// addDuplicate records a page whose ID was already added to the index.
+func (idx *offsetIndex) addDuplicate(title string, entry indexEntry) {
+	if idx.duplicates == nil {
+		idx.duplicates = map[int][]idOccurrence{}
+	}
+	idx.duplicates[entry.id] = append(idx.duplicates[entry.id], idOccurrence{Title: title, Seek: entry.seek})
+}
+
+// findDuplicates lists the duplicate page IDs found loading idx, whose
+// entries are in offsets. Only the pages after the first with each ID are
+// known by title; the first is found by elimination from the entries with
+// the ID, and its title is left for duplicatesWithTitles to read from the
+// dump.
+func findDuplicates(idx *offsetIndex, offsets offsetStore) ([]duplicateID, error) {
+	if len(idx.duplicates) == 0 {
+		return nil, nil
+	}
+	seeks := map[int][]int{}
+	err := offsets.each(func(hash uint64, entry indexEntry) error {
+		if _, ok := idx.duplicates[entry.id]; ok {
+			seeks[entry.id] = append(seeks[entry.id], entry.seek)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dups []duplicateID
+	for id, later := range idx.duplicates {
+		d := duplicateID{ID: id}
+		remaining := seeks[id]
+		for _, o := range later {
+			for i, seek := range remaining {
+				if seek == o.Seek {
+					remaining = append(remaining[:i], remaining[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(remaining) > 0 {
+			// The first page's entry is missing if it was replaced by a
+			// later page with the same title.
+			d.Occurrences = append(d.Occurrences, idOccurrence{Seek: remaining[0]})
+		}
+		d.Occurrences = append(d.Occurrences, later...)
+		dups = append(dups, d)
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].ID < dups[j].ID })
+	log.Printf("Found %d duplicate page IDs in the index, see /debug/duplicates", len(dups))
+	return dups, nil
+}
+
+// duplicatesWithTitles returns the duplicate page IDs in the current index,
+// filling in the titles of the first pages with them from the dump.
+func duplicatesWithTitles() ([]duplicateID, error) {
+	mu.Lock()
+	dups := make([]duplicateID, len(mu.duplicates))
+	copy(dups, mu.duplicates)
+	mu.Unlock()
+
+	for i, d := range dups {
+		occurrences := append([]idOccurrence(nil), d.Occurrences...)
+		for j, o := range occurrences {
+			if o.Title != "" {
+				continue
+			}
+			mu.Lock()
+			maxTries := mu.offsetSize[o.Seek] + *findPageMargin
+			mu.Unlock()
+			raw, _, err := readBlockPage(o.Seek, maxTries, func(n, id int) bool {
+				return id == d.ID
+			})
+			if err != nil {
+				return nil, articlesUnavailable(err)
+			}
+			occurrences[j].Title = rawTitle(raw)
+		}
+		dups[i].Occurrences = occurrences
+	}
+	return dups, nil
+}
+
+// handleDuplicates serves /debug/duplicates, listing the page IDs that more
+// than one page in the dump has. Every page is kept in the index under its
+// own title, but anything keyed by page ID, like finding a page in its block
+// or the link cache, can mix them up, so a dump with duplicates may be
+// corrupt.
+func handleDuplicates(w http.ResponseWriter, r *http.Request) error {
+	dups, err := duplicatesWithTitles()
+	if err != nil {
+		return err
+	}
+	if dups == nil {
+		dups = []duplicateID{}
+	}
+	return writeJSON(w, r, dups)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHandleDuplicates(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "Foo", ""), testPage(2, "Bar", ""), testPage(1, "Foo copy", "")},
+		[]page{testPage(3, "Baz", ""), testPage(2, "Bar again", ""), testPage(2, "Bar thrice", "")},
+	)
+	var seeks []int
+	for _, title := range []string{"Foo", "Baz"} {
+		meta, err := fetchArticle(title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeks = append(seeks, meta.seek)
+	}
+
+	w := httptest.NewRecorder()
+	handle(handleDuplicates)(w, httptest.NewRequest("GET", "/debug/duplicates", nil))
+	var got []duplicateID
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%s: %s", err, w.Body)
+	}
+	want := []duplicateID{
+		{ID: 1, Occurrences: []idOccurrence{{"Foo", seeks[0]}, {"Foo copy", seeks[0]}}},
+		{ID: 2, Occurrences: []idOccurrence{{"Bar", seeks[0]}, {"Bar again", seeks[1]}, {"Bar thrice", seeks[1]}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("duplicates = %+v; not %+v", got, want)
+	}
+
+	useTestDump(t, []page{testPage(1, "Foo", ""), testPage(2, "Bar", "")})
+	w = httptest.NewRecorder()
+	handle(handleDuplicates)(w, httptest.NewRequest("GET", "/debug/duplicates", nil))
+	if w.Body.String() != "[]" {
+		t.Errorf("got %s; expected no duplicates", w.Body)
+	}
+}
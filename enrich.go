@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// enrichment is everything derived from an article's text that a client
+// needs to render a knowledge panel. Sections that were turned off or are
+// empty are omitted.
+type enrichment struct {
+	Title      string            `json:"title"`
+	Summary    string            `json:"summary,omitempty"`
+	Categories []string          `json:"categories,omitempty"`
+	Links      []string          `json:"links,omitempty"`
+	Infobox    map[string]string `json:"infobox,omitempty"`
+}
+
+// enrichSection reports whether the section of /enrich named key was asked
+// for. Sections are included unless turned off with key=false.
+func enrichSection(r *http.Request, key string) (bool, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return true, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, statusErrorf(http.StatusBadRequest, "invalid %s %q", key, raw)
+	}
+	return v, nil
+}
+
+// handleEnrich serves /enrich?title=..., returning the article's summary,
+// categories, links and infobox from a single decode of it, since decoding
+// dominates the cost of each. Any section can be left out with, for example,
+// links=false.
+func handleEnrich(w http.ResponseWriter, r *http.Request) error {
+	sections := map[string]bool{}
+	for _, key := range []string{"summary", "categories", "links", "infobox"} {
+		on, err := enrichSection(r, key)
+		if err != nil {
+			return err
+		}
+		sections[key] = on
+	}
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	e := enrichment{Title: p.Title}
+	if sections["summary"] {
+		e.Summary = extractSummary(p.Text)
+	}
+	if sections["categories"] {
+		e.Categories = extractCategories(p.Text)
+	}
+	if sections["links"] {
+		e.Links = extractLinks(p.Text)
+	}
+	if sections["infobox"] {
+		e.Infobox = extractInfobox(p.Text)
+	}
+	return writeJSON(w, r, e)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// exportFlushEvery is the number of NDJSON lines written between flushes.
+const exportFlushEvery = 1000
+
+type exportedTitle struct {
+	Title string `json:"title"`
+	ID    int    `json:"id"`
+}
+
+// handleExportTitles serves /export/titles?ns=N, streaming every title in the
+// index as NDJSON followed by a {"count":N} summary line. Only available with
+// -titles.
+func handleExportTitles(w http.ResponseWriter, r *http.Request) error {
+	if !*retainTitles {
+		return statusErrorf(http.StatusServiceUnavailable, "titles aren't retained, start with -titles")
+	}
+	ns := -1
+	if raw := r.URL.Query().Get("ns"); raw != "" {
+		var err error
+		ns, err = strconv.Atoi(raw)
+		if err != nil {
+			return statusErrorf(http.StatusBadRequest, "invalid ns %q", raw)
+		}
+	}
+
+	mu.Lock()
+	titles := mu.titles
+	mu.Unlock()
+
+	nw := newNDJSONWriter(w)
+	count := 0
+	for _, t := range titles {
+		if ns >= 0 && namespaceForTitle(t.title) != ns {
+			continue
+		}
+		if err := nw.encode(exportedTitle{Title: t.title, ID: t.id}); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := nw.encode(struct {
+		Count int `json:"count"`
+	}{count}); err != nil {
+		return err
+	}
+	return nw.flush()
+}
+
+// handleExportBlocks serves /export/blocks.csv, streaming a seek,articleCount
+// row for every block in the index in offset order, to show how articles are
+// spread across blocks. The number of rows is sent first as X-Record-Count,
+// so readers can tell if the export was cut short.
+func handleExportBlocks(w http.ResponseWriter, r *http.Request) error {
+	mu.Lock()
+	seeks := make([]int, 0, len(mu.offsetSize))
+	for seek := range mu.offsetSize {
+		seeks = append(seeks, seek)
+	}
+	counts := make(map[int]int, len(mu.offsetSize))
+	for seek, n := range mu.offsetSize {
+		counts[seek] = n
+	}
+	mu.Unlock()
+	sort.Ints(seeks)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("X-Record-Count", strconv.Itoa(len(seeks)))
+	flusher, _ := w.(http.Flusher)
+	rc := http.NewResponseController(w)
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"seek", "articleCount"}); err != nil {
+		return err
+	}
+	for i, seek := range seeks {
+		if err := cw.Write([]string{strconv.Itoa(seek), strconv.Itoa(counts[seek])}); err != nil {
+			return err
+		}
+		if (i+1)%exportFlushEvery == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			extendDeadlines(rc)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sortedOffsets returns the entries of snapshot sorted by hash in an on disk
+// index, built a bucket at a time so they're never all in memory at once.
+// It must be closed once it's been read.
+func sortedOffsets(snapshot *indexSnapshot) (*diskStore, error) {
+	dw, err := newDiskStoreWriter()
+	if err != nil {
+		return nil, err
+	}
+	err = snapshot.each(dw.add)
+	// finish cleans up the writer's buckets either way.
+	sorted, finishErr := dw.finish(nil)
+	if err == nil {
+		return sorted, finishErr
+	}
+	if finishErr == nil {
+		sorted.close()
+	}
+	return nil, err
+}
+
+// handleExportOffsets serves /export/offsets.bin, streaming every entry of
+// the index as 24 byte records sorted by hash, for other programs to look
+// titles up in without parsing the index themselves. Each record is the
+// cityhash64 of the title, the page ID and the offset of its block in the
+// articles file, as little endian 64 bit integers, the same as an on disk
+// index. Hashes are unique, so a title is found by binary search. The number
+// of records is sent as X-Record-Count along with the Content-Length, so
+// readers can tell if the export was cut short. The deadlines are extended
+// once the records are sorted, which takes a while for a full index, and with
+// every flush.
+func handleExportOffsets(w http.ResponseWriter, r *http.Request) error {
+	snapshot := snapshotIndex()
+	sorted, err := sortedOffsets(snapshot)
+	snapshot.release()
+	if err != nil {
+		return err
+	}
+	defer sorted.close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(sorted.count*diskRecordBytes))
+	w.Header().Set("X-Record-Count", strconv.Itoa(sorted.count))
+	flusher, _ := w.(http.Flusher)
+	rc := http.NewResponseController(w)
+	extendDeadlines(rc)
+	in := io.NewSectionReader(sorted.f, 0, int64(sorted.count)*diskRecordBytes)
+	buf := make([]byte, exportFlushEvery*diskRecordBytes)
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			extendDeadlines(rc)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+type exportedArticle struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Cursor resumes the export after this article.
+	Cursor string `json:"cursor"`
+}
+
+// exportCursor is a position in a full dump export: the offset of a block and
+// the number of its pages already seen, whether or not they were exported.
+type exportCursor struct {
+	seek, page int
+}
+
+func (c exportCursor) String() string {
+	return fmt.Sprintf("%d:%d", c.seek, c.page)
+}
+
+func parseExportCursor(raw string) (exportCursor, error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) == 2 {
+		seek, err1 := strconv.Atoi(parts[0])
+		page, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && seek >= 0 && page >= 0 {
+			return exportCursor{seek, page}, nil
+		}
+	}
+	return exportCursor{}, statusErrorf(http.StatusBadRequest, "invalid cursor %q", raw)
+}
+
+// exportTransforms maps the transform names /export/articles takes that
+// aren't format names to the formats they mean.
+var exportTransforms = map[string]string{"plaintext": "plain"}
+
+// handleExportArticles serves /export/articles?transform=plain&ns=N, streaming
+// every article in the dump rendered in one of the formats as NDJSON,
+// followed by a {"count":N} summary line. Redirects are left out. The whole
+// dump is read with IterateArticles, so it takes as long as a full scan, and
+// it stops when the client goes away. The deadlines are extended with every
+// block, so -writeTimeout only limits how long one block takes. Every line
+// has the cursor to pass as cursor=... to resume after that article, for when
+// the connection drops.
+func handleExportArticles(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	name := q.Get("transform")
+	if name == "" {
+		name = "plain"
+	} else if alias, ok := exportTransforms[name]; ok {
+		name = alias
+	}
+	format, ok := formats[name]
+	if !ok {
+		return statusErrorf(http.StatusBadRequest, "unknown transform %q, expected one of %s", name, formatNames())
+	}
+	ns := -1
+	if raw := q.Get("ns"); raw != "" {
+		var err error
+		ns, err = strconv.Atoi(raw)
+		if err != nil {
+			return statusErrorf(http.StatusBadRequest, "invalid ns %q", raw)
+		}
+	}
+	var from exportCursor
+	if raw := q.Get("cursor"); raw != "" {
+		var err error
+		if from, err = parseExportCursor(raw); err != nil {
+			return err
+		}
+	}
+
+	nw := newNDJSONWriter(w)
+	count := 0
+	at := exportCursor{seek: -1}
+	if err := IterateArticles(r.Context(), from.seek, func(seek int, p page) error {
+		if seek != at.seek {
+			// Flush each block as it's finished, since a thousand articles
+			// can be a long wait, which also extends the deadlines even if
+			// none of the block's articles were exported.
+			if at.seek >= 0 {
+				if err := nw.flush(); err != nil {
+					return err
+				}
+			}
+			at = exportCursor{seek: seek}
+		}
+		at.page++
+		if seek == from.seek && at.page <= from.page {
+			return nil
+		}
+		if ns >= 0 && p.NS != ns {
+			return nil
+		}
+		if _, _, ok := redirectTarget(p); ok {
+			return nil
+		}
+		count++
+		return nw.encode(exportedArticle{
+			Title:  p.Title,
+			Text:   format.render(p, renderOptions{}),
+			Cursor: at.String(),
+		})
+	}); err != nil {
+		return err
+	}
+	if err := nw.encode(struct {
+		Count int `json:"count"`
+	}{count}); err != nil {
+		return err
+	}
+	return nw.flush()
+}
+
+// ndjsonWriter streams newline delimited JSON, flushing to the client every
+// exportFlushEvery lines so long exports make steady progress. Each flush
+// extends the connection's deadlines, so the timeouts limit how long a
+// stream stalls rather than how long it runs.
+type ndjsonWriter struct {
+	bw      *bufio.Writer
+	enc     *json.Encoder
+	flusher http.Flusher
+	rc      *http.ResponseController
+	lines   int
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{
+		bw:      bw,
+		enc:     json.NewEncoder(bw),
+		flusher: flusher,
+		rc:      http.NewResponseController(w),
+	}
+}
+
+func (nw *ndjsonWriter) encode(v interface{}) error {
+	v, err := restyleJSON(v)
+	if err != nil {
+		return err
+	}
+	if err := nw.enc.Encode(v); err != nil {
+		return err
+	}
+	nw.lines++
+	if nw.lines%exportFlushEvery == 0 {
+		return nw.flush()
+	}
+	return nil
+}
+
+func (nw *ndjsonWriter) flush() error {
+	if err := nw.bw.Flush(); err != nil {
+		return err
+	}
+	if nw.flusher != nil {
+		nw.flusher.Flush()
+	}
+	extendDeadlines(nw.rc)
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/creachadair/cityhash"
+)
+
+func TestHandleExportBlocks(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "A", ""), testPage(2, "B", "")},
+		[]page{testPage(3, "C", "")},
+	)
+	seeks := blockSeeks()
+
+	w := httptest.NewRecorder()
+	handle(handleExportBlocks)(w, httptest.NewRequest("GET", "/export/blocks.csv", nil))
+	if got := w.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get("X-Record-Count"); got != "2" {
+		t.Errorf("X-Record-Count = %q; not 2", got)
+	}
+	want := fmt.Sprintf("seek,articleCount\n%d,2\n%d,1\n", seeks[0], seeks[1])
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q; not %q", got, want)
+	}
+}
+
+// lookupExportedOffset looks hash up in the records of /export/offsets.bin,
+// as an example of reading the format without anything from this package.
+func lookupExportedOffset(data []byte, hash uint64) (id, seek int64, ok bool) {
+	const size = 24
+	n := len(data) / size
+	i := sort.Search(n, func(i int) bool {
+		return binary.LittleEndian.Uint64(data[i*size:]) >= hash
+	})
+	if i == n || binary.LittleEndian.Uint64(data[i*size:]) != hash {
+		return 0, 0, false
+	}
+	record := data[i*size : (i+1)*size]
+	return int64(binary.LittleEndian.Uint64(record[8:])), int64(binary.LittleEndian.Uint64(record[16:])), true
+}
+
+func TestHandleExportOffsets(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "A", ""), testPage(2, "B", "")},
+		[]page{testPage(3, "C", "")},
+	)
+	seeks := blockSeeks()
+	mu.Lock()
+	mu.found[cityhash.Hash64([]byte("D"))] = indexEntry{id: 4, seek: seeks[1]}
+	mu.Unlock()
+
+	w := httptest.NewRecorder()
+	handle(handleExportOffsets)(w, httptest.NewRequest("GET", "/export/offsets.bin", nil))
+	data := w.Body.Bytes()
+	if len(data) != 4*24 || w.Header().Get("Content-Length") != strconv.Itoa(len(data)) {
+		t.Fatalf("exported %d bytes, Content-Length %s; expected 4 records", len(data), w.Header().Get("Content-Length"))
+	}
+	if got := w.Header().Get("X-Record-Count"); got != "4" {
+		t.Errorf("X-Record-Count = %q; not 4", got)
+	}
+	for i := 24; i < len(data); i += 24 {
+		if binary.LittleEndian.Uint64(data[i-24:]) >= binary.LittleEndian.Uint64(data[i:]) {
+			t.Errorf("record %d isn't sorted by hash", i/24)
+		}
+	}
+	for _, c := range []struct {
+		title    string
+		id, seek int64
+	}{
+		{"A", 1, int64(seeks[0])},
+		{"B", 2, int64(seeks[0])},
+		{"C", 3, int64(seeks[1])},
+		{"D", 4, int64(seeks[1])},
+	} {
+		id, seek, ok := lookupExportedOffset(data, cityhash.Hash64([]byte(c.title)))
+		if !ok || id != c.id || seek != c.seek {
+			t.Errorf("%s = %d, %d, %v; expected ID %d at %d", c.title, id, seek, ok, c.id, c.seek)
+		}
+	}
+	if _, _, ok := lookupExportedOffset(data, cityhash.Hash64([]byte("Missing"))); ok {
+		t.Error("found a title that isn't in the index")
+	}
+}
+
+func TestHandleExportArticles(t *testing.T) {
+	talk := testPage(2, "Talk:B", "talk")
+	talk.NS = 1
+	redirect := testPage(3, "R", "#REDIRECT [[A]]")
+	useTestDump(t,
+		[]page{testPage(1, "A", "'''A''' is [[x|one]]."), talk, redirect},
+		[]page{testPage(4, "C", "see")},
+	)
+	seeks := blockSeeks()
+
+	for _, c := range []struct {
+		query  string
+		status int
+		want   []exportedArticle
+	}{
+		{"", 200, []exportedArticle{
+			{"A", "A is one.", fmt.Sprintf("%d:1", seeks[0])},
+			{"Talk:B", "talk", fmt.Sprintf("%d:2", seeks[0])},
+			{"C", "see", fmt.Sprintf("%d:1", seeks[1])},
+		}},
+		{"?transform=plaintext&ns=0", 200, []exportedArticle{
+			{"A", "A is one.", fmt.Sprintf("%d:1", seeks[0])},
+			{"C", "see", fmt.Sprintf("%d:1", seeks[1])},
+		}},
+		{"?transform=wikitext&ns=1", 200, []exportedArticle{
+			{"Talk:B", "talk", fmt.Sprintf("%d:2", seeks[0])},
+		}},
+		{fmt.Sprintf("?cursor=%d:1", seeks[0]), 200, []exportedArticle{
+			{"Talk:B", "talk", fmt.Sprintf("%d:2", seeks[0])},
+			{"C", "see", fmt.Sprintf("%d:1", seeks[1])},
+		}},
+		{fmt.Sprintf("?cursor=%d:1", seeks[1]), 200, nil},
+		{"?cursor=abc", 400, nil},
+		{"?transform=pdf", 400, nil},
+		{"?ns=x", 400, nil},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleExportArticles)(w, httptest.NewRequest("GET", "/export/articles"+c.query, nil))
+		if w.Code != c.status {
+			t.Errorf("%q: status = %d; not %d: %s", c.query, w.Code, c.status, w.Body)
+			continue
+		}
+		if c.status != 200 {
+			continue
+		}
+		dec := json.NewDecoder(w.Body)
+		var got []exportedArticle
+		for range c.want {
+			var a exportedArticle
+			if err := dec.Decode(&a); err != nil {
+				t.Fatalf("%q: %v", c.query, err)
+			}
+			got = append(got, a)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: exported %+v; not %+v", c.query, got, c.want)
+		}
+		var summary struct{ Count int }
+		if err := dec.Decode(&summary); err != nil || summary.Count != len(c.want) {
+			t.Errorf("%q: summary = %+v, %v; not a count of %d", c.query, summary, err, len(c.want))
+		}
+	}
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var categoryRegexp = regexp.MustCompile(`(?i)\[\[\s*category\s*:\s*([^\]|]+?)\s*(?:\|[^\]]*)?\]\]`)
+
+// extractCategories returns the normalized names of the categories an article
+// is tagged with, in the order they first appear.
+func extractCategories(text string) []string {
+	var cats []string
+	seen := map[string]bool{}
+	for _, m := range categoryRegexp.FindAllStringSubmatch(text, -1) {
+		name := normalizeCategory(m[1])
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		cats = append(cats, name)
+	}
+	return cats
+}
+
+// normalizeCategory converts a category name into the canonical form used as
+// a key in the category index: no "Category:" prefix, underscores as spaces,
+// collapsed whitespace and an upper case first letter.
+func normalizeCategory(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.IndexByte(name, ':'); i >= 0 && strings.EqualFold(strings.TrimSpace(name[:i]), "category") {
+		name = name[i+1:]
+	}
+	name = strings.Join(strings.Fields(strings.Replace(name, "_", " ", -1)), " ")
+	return upperFirst(name)
+}
+
+// upperFirst upper cases the first letter of s, which is how MediaWiki
+// canonicalizes titles.
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// extractLinks returns the normalized targets of the wiki links in text, in
+// the order they first appear. File, category and interlanguage links are
+// skipped, as are section anchors within the target.
+func extractLinks(text string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for rest := text; ; {
+		start := strings.Index(rest, "[[")
+		if start < 0 {
+			break
+		}
+		rest = rest[start+2:]
+		end := strings.IndexAny(rest, "|]")
+		if end < 0 {
+			break
+		}
+		target := rest[:end]
+		if strings.Contains(target, "[[") || isNonProseLink(target) {
+			continue
+		}
+		if i := strings.IndexByte(target, '#'); i >= 0 {
+			target = target[:i]
+		}
+		target = normalizeLinkTarget(target)
+		if target == "" || seen[target] {
+			continue
+		}
+		seen[target] = true
+		links = append(links, target)
+	}
+	return links
+}
+
+// normalizeLinkTarget converts a link target into its canonical title form.
+func normalizeLinkTarget(target string) string {
+	target = strings.TrimPrefix(strings.TrimSpace(target), ":")
+	target = strings.Join(strings.Fields(strings.Replace(target, "_", " ", -1)), " ")
+	return upperFirst(target)
+}
+
+var langLinkRegexp = regexp.MustCompile(`\[\[\s*([a-z][a-z-]*)\s*:\s*([^\[\]|]+?)\s*(?:\|[^\[\]]*)?\]\]`)
+
+// extractLangLinks returns the interlanguage links in text, like [[de:Titel]],
+// as a map from language code to the title on that wiki. Only the first link
+// to each language counts, as in MediaWiki. Links with a leading colon, like
+// [[:de:Titel]], are inline links rather than interlanguage links and are
+// skipped.
+func extractLangLinks(text string) map[string]string {
+	links := map[string]string{}
+	for _, m := range langLinkRegexp.FindAllStringSubmatchIndex(text, -1) {
+		code, title := text[m[2]:m[3]], normalizeLinkTarget(text[m[4]:m[5]])
+		if !isLangCode(code) || code == *lang || title == "" {
+			continue
+		}
+		if _, ok := links[code]; !ok {
+			links[code] = title
+		}
+	}
+	return links
+}
+
+var mediaRegexp = regexp.MustCompile(`(?i)\[\[\s*(?:file|image)\s*:\s*([^|\]]+)`)
+
+// extractMedia returns the names of the files embedded in text with
+// [[File:...]] or the legacy [[Image:...]] syntax, without the namespace
+// prefix or any options and caption after the first pipe.
+func extractMedia(text string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, m := range mediaRegexp.FindAllStringSubmatch(text, -1) {
+		name := normalizeLinkTarget(m[1])
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		files = append(files, name)
+	}
+	return files
+}
+
+var (
+	nowikiRegexp       = regexp.MustCompile(`(?is)<nowiki\s*/>|<nowiki\s*>.*?</nowiki\s*>`)
+	bracketedURLRegexp = regexp.MustCompile(`\[((?:https?:)?//[^\s\]]+)[^\]]*\]`)
+	bareURLRegexp      = regexp.MustCompile(`https?://[^\s<>\[\]{}|"]+`)
+	urlTrailingPunct   = ",;.:!?'\")"
+)
+
+// extractExternalLinks returns the URLs linked to from text, both bracketed
+// [http://... label] links and bare URLs, in the order they first appear.
+// Links in comments and <nowiki> are ignored, as is anything that doesn't
+// parse as an absolute or protocol relative URL.
+func extractExternalLinks(text string) []string {
+	text = commentRegexp.ReplaceAllString(text, "")
+	text = nowikiRegexp.ReplaceAllString(text, "")
+
+	links := []string{}
+	seen := map[string]bool{}
+	addLink := func(raw string) {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || seen[raw] {
+			return
+		}
+		seen[raw] = true
+		links = append(links, raw)
+	}
+	// Bracketed links are removed once found so their URLs aren't matched
+	// again as bare URLs with the trailing punctuation trimmed.
+	text = bracketedURLRegexp.ReplaceAllStringFunc(text, func(m string) string {
+		addLink(bracketedURLRegexp.FindStringSubmatch(m)[1])
+		return " "
+	})
+	for _, raw := range bareURLRegexp.FindAllString(text, -1) {
+		addLink(trimURLPunctuation(raw))
+	}
+	return links
+}
+
+// trimURLPunctuation drops trailing punctuation from a bare URL, like
+// MediaWiki does, since it's more likely to end the sentence than the URL. A
+// closing parenthesis is kept if the URL has a matching opening one.
+func trimURLPunctuation(raw string) string {
+	for len(raw) > 0 {
+		last := raw[len(raw)-1]
+		if !strings.ContainsRune(urlTrailingPunct, rune(last)) {
+			break
+		}
+		if last == ')' && strings.Count(raw, "(") >= strings.Count(raw, ")") {
+			break
+		}
+		raw = raw[:len(raw)-1]
+	}
+	return raw
+}
+
+const (
+	pageTypeArticle        = "article"
+	pageTypeRedirect       = "redirect"
+	pageTypeSoftRedirect   = "soft-redirect"
+	pageTypeDisambiguation = "disambiguation"
+	pageTypeSetIndex       = "set-index"
+)
+
+// pageTypeTemplates maps the templates that mark a page as something other
+// than a regular article to its type. They're checked in order, since a
+// disambiguation page can also transclude set index templates.
+var pageTypeTemplates = []struct {
+	pageType string
+	re       *regexp.Regexp
+}{
+	{pageTypeSoftRedirect, templateRegexp("soft redirect", "wiktionary redirect", "wikispecies redirect")},
+	{pageTypeDisambiguation, templateRegexp("disambiguation", "disambig", "dab", "disamb", "hndis", "geodis", "numberdis")},
+	{pageTypeSetIndex, templateRegexp("set index article", "set index", "sia", "surname", "given name", "ship index", "mountain index")},
+}
+
+// templateRegexp matches a transclusion of any of the named templates,
+// ignoring case and treating underscores as spaces.
+func templateRegexp(names ...string) *regexp.Regexp {
+	var alts []string
+	for _, name := range names {
+		alts = append(alts, strings.Replace(regexp.QuoteMeta(name), " ", "[ _]+", -1))
+	}
+	return regexp.MustCompile(`(?i)\{\{\s*(?:` + strings.Join(alts, "|") + `)\s*[|}]`)
+}
+
+// classifyPage returns what kind of page p is: a hard redirect, a soft
+// redirect, a disambiguation or set index page, or otherwise an article.
+func classifyPage(p page) string {
+	if _, _, ok := redirectTarget(p); ok {
+		return pageTypeRedirect
+	}
+	for _, t := range pageTypeTemplates {
+		if t.re.MatchString(p.Text) {
+			return t.pageType
+		}
+	}
+	return pageTypeArticle
+}
+
+// extractSummary returns the first paragraph of the lead section of an
+// article as plain text, or "" if the lead has no prose.
+func extractSummary(text string) string {
+	if loc := headingRegexp.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	for _, para := range strings.Split(plainText(text), "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			return para
+		}
+	}
+	return ""
+}
+
+// shortDescriptionRegexp matches the start of a {{Short description|...}}
+// template or the {{SHORTDESC:...}} magic word it expands to, up to the
+// description.
+var shortDescriptionRegexp = regexp.MustCompile(`(?i)\{\{\s*(?:short[ _]+description\s*\||SHORTDESC\s*:)`)
+
+// extractShortDescription returns the short description editors give an
+// article with {{Short description|...}}, a one line description of its
+// subject, as plain text. It's "" if the article doesn't have one or it's
+// {{Short description|none}}, which marks articles whose title says enough.
+// Options like noreplace are ignored.
+func extractShortDescription(text string) string {
+	loc := shortDescriptionRegexp.FindStringIndex(text)
+	if loc == nil {
+		return ""
+	}
+	rest := text[loc[1]:]
+	depth := 0
+	for i := 0; i < len(rest); i++ {
+		switch {
+		case strings.HasPrefix(rest[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(rest[i:], "}}"):
+			if depth == 0 {
+				desc := strings.TrimSpace(splitTemplateParams(rest[:i])[0])
+				desc = strings.TrimSpace(strings.TrimPrefix(desc, "1="))
+				if strings.EqualFold(desc, "none") {
+					return ""
+				}
+				return plainText(desc)
+			}
+			depth--
+			i++
+		}
+	}
+	return ""
+}
+
+var infoboxRegexp = regexp.MustCompile(`(?i)\{\{\s*infobox[ _]`)
+
+// extractInfobox returns the named parameters of the first infobox in text,
+// with their values as trimmed wikitext, or nil if there isn't one.
+// Positional parameters and empty values are skipped.
+func extractInfobox(text string) map[string]string {
+	loc := infoboxRegexp.FindStringIndex(text)
+	if loc == nil {
+		return nil
+	}
+	// Split the template's body on the pipes that aren't inside a nested
+	// template or link, stopping at the "}}" that closes it.
+	// An unterminated infobox runs to the end of text.
+	var params []string
+	start := loc[0] + 2
+	end := len(text)
+	depth := 0
+	for i := start; i < end; i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "{{"), strings.HasPrefix(text[i:], "[["):
+			depth++
+			i++
+		case depth == 0 && strings.HasPrefix(text[i:], "}}"):
+			end = i
+		case strings.HasPrefix(text[i:], "}}"), strings.HasPrefix(text[i:], "]]"):
+			depth--
+			i++
+		case depth == 0 && text[i] == '|':
+			params = append(params, text[start:i])
+			start = i + 1
+		}
+	}
+	params = append(params, text[start:end])
+
+	infobox := map[string]string{}
+	// The first part is the template name.
+	for _, param := range params[1:] {
+		i := strings.IndexByte(param, '=')
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(param[:i])
+		value := strings.TrimSpace(commentRegexp.ReplaceAllString(param[i+1:], ""))
+		if key != "" && value != "" {
+			infobox[key] = value
+		}
+	}
+	return infobox
+}
+
+type section struct {
+	Level int    `json:"level"`
+	Title string `json:"title"`
+	// Anchor is the fragment that links to the section, as in
+	// /wiki/Foo#Anchor.
+	Anchor string `json:"anchor"`
+	// Offset is the byte offset of the heading's line in the text.
+	Offset int `json:"offset"`
+}
+
+// extractSections returns the headings in text in order. Titles have their
+// markup stripped. Repeated titles get "_2", "_3" and so on appended to
+// their anchors like MediaWiki does, so every anchor is unique.
+func extractSections(text string) []section {
+	var sections []section
+	seen := map[string]int{}
+	for _, m := range headingRegexp.FindAllStringSubmatchIndex(text, -1) {
+		level := m[3] - m[2]
+		if n := m[7] - m[6]; n < level {
+			level = n
+		}
+		title := plainText(text[m[4]:m[5]])
+		anchor := sectionAnchor(title)
+		seen[anchor]++
+		if n := seen[anchor]; n > 1 {
+			anchor += "_" + strconv.Itoa(n)
+		}
+		sections = append(sections, section{
+			Level:  level,
+			Title:  title,
+			Anchor: anchor,
+			Offset: m[0],
+		})
+	}
+	return sections
+}
+
+// sectionAnchor encodes a section title as a URL fragment the way MediaWiki
+// does: whitespace becomes underscores and anything but letters, digits and
+// the punctuation MediaWiki leaves alone is percent-encoded.
+func sectionAnchor(title string) string {
+	title = strings.Join(strings.Fields(title), "_")
+	var b strings.Builder
+	for i := 0; i < len(title); i++ {
+		c := title[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~:;@$!*(),/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// injectAnchors inserts an empty <span id="..."> with each section's anchor
+// on its own line before its heading, so the text can be linked into once
+// rendered. The heading has to stay at the start of its line to still be a
+// heading.
+func injectAnchors(text string, sections []section) string {
+	var b strings.Builder
+	last := 0
+	for _, s := range sections {
+		b.WriteString(text[last:s.Offset])
+		fmt.Fprintf(&b, "<span id=\"%s\"></span>\n", html.EscapeString(s.Anchor))
+		last = s.Offset
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+type disambiguationOption struct {
+	Title string `json:"title"`
+	// Description is the text after the link in the list item, such as "a
+	// 2001 film".
+	Description string `json:"description"`
+}
+
+// extractDisambiguationOptions returns the articles a disambiguation page
+// lists: the first link of each bulleted item, along with the text that
+// follows it. Items without a link are skipped.
+func extractDisambiguationOptions(text string) []disambiguationOption {
+	options := []disambiguationOption{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "*") {
+			continue
+		}
+		item := strings.TrimLeft(line, "*: ")
+		start := strings.Index(item, "[[")
+		if start < 0 {
+			continue
+		}
+		end := matchingClose(item, start)
+		if end < 0 {
+			continue
+		}
+		target := item[start+2 : end]
+		if i := strings.IndexByte(target, '|'); i >= 0 {
+			target = target[:i]
+		}
+		if isNonProseLink(target) {
+			continue
+		}
+		if i := strings.IndexByte(target, '#'); i >= 0 {
+			target = target[:i]
+		}
+		title := normalizeLinkTarget(target)
+		if title == "" || seen[title] {
+			continue
+		}
+		seen[title] = true
+		options = append(options, disambiguationOption{
+			Title:       title,
+			Description: strings.TrimLeft(plainText(item[end+2:]), ",;:–—- "),
+		})
+	}
+	return options
+}
+
+var (
+	// wikidataTemplateRegexp matches templates that take a QID as their first
+	// positional parameter, like {{Wikidata|Q42}} and {{Wikidata entity
+	// link|Q42}}.
+	wikidataTemplateRegexp = regexp.MustCompile(`(?i)\{\{\s*wikidata[^|{}]*\|\s*(Q[1-9][0-9]*)\s*[|}]`)
+	// wikidataParamRegexp matches template parameters that hold the
+	// article's QID, as in {{Authority control|wikidata=Q42}},
+	// {{Taxonbar|from=Q42}} and infoboxes' qid=Q42.
+	wikidataParamRegexp = regexp.MustCompile(`(?i)\|\s*(?:wikidata|qid|from)\s*=\s*(Q[1-9][0-9]*)\s*[|}]`)
+)
+
+// extractWikidataID returns the Wikidata QID text refers to in a template,
+// or "" if it doesn't. Dumps don't include page properties, where the
+// article's QID is really kept, so this is best effort: most articles don't
+// name their QID in their wikitext, and one that does may be the QID of
+// something else.
+func extractWikidataID(text string) string {
+	for _, re := range []*regexp.Regexp{wikidataTemplateRegexp, wikidataParamRegexp} {
+		if m := re.FindStringSubmatch(text); m != nil {
+			return strings.ToUpper(m[1])
+		}
+	}
+	return ""
+}
+
+var (
+	// templatePrefixes are the modifiers a template name may start with,
+	// which don't change which template is used.
+	templatePrefixes = []string{"subst:", "safesubst:", "msgnw:", "msg:", "raw:"}
+	// parserFunctions are the variables and parser functions without a #
+	// that look like templates, like {{PAGENAME}} and {{lc:...}}.
+	parserFunctions = map[string]bool{
+		"PAGENAME": true, "FULLPAGENAME": true, "BASEPAGENAME": true, "SUBPAGENAME": true,
+		"ROOTPAGENAME": true, "TALKPAGENAME": true, "NAMESPACE": true, "PAGEID": true,
+		"SITENAME": true, "SERVER": true, "CURRENTYEAR": true, "CURRENTMONTH": true,
+		"CURRENTDAY": true, "CURRENTTIMESTAMP": true, "REVISIONID": true, "!": true,
+		"=": true, "DISPLAYTITLE": true, "DEFAULTSORT": true, "LC": true, "UC": true,
+		"LCFIRST": true, "UCFIRST": true, "URLENCODE": true, "ANCHORENCODE": true,
+		"FULLURL": true, "LOCALURL": true, "FORMATNUM": true, "PADLEFT": true,
+		"PADRIGHT": true, "INT": true, "NS": true, "PLURAL": true, "GRAMMAR": true,
+		"GENDER": true, "FILEPATH": true, "TAG": true,
+	}
+)
+
+// extractTemplates returns the names of the templates text uses, nested ones
+// included, in the order they're first used and normalized like page titles
+// without their Template: prefix. subst: and the like are stripped, and
+// parser functions like {{#if:...}}, variables like {{PAGENAME}} and template
+// parameters like {{{1}}} aren't templates so they're skipped.
+func extractTemplates(text string) []string {
+	templates := []string{}
+	seen := map[string]bool{}
+	for i := 0; i < len(text); i++ {
+		if strings.HasPrefix(text[i:], "{{{") {
+			// A parameter, though a template may start right after it.
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(text[i:], "{{") {
+			continue
+		}
+		i += 2
+		end := strings.IndexAny(text[i:], "|{}")
+		if end < 0 {
+			break
+		}
+		name := strings.TrimSpace(text[i : i+end])
+		for stripped := true; stripped; {
+			stripped = false
+			for _, prefix := range templatePrefixes {
+				if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+					name, stripped = strings.TrimSpace(name[len(prefix):]), true
+				}
+			}
+		}
+		if name == "" || strings.HasPrefix(name, "#") || parserFunctions[strings.ToUpper(strings.SplitN(name, ":", 2)[0])] {
+			continue
+		}
+		name = normalizeTemplateName(name)
+		if !seen[name] {
+			seen[name] = true
+			templates = append(templates, name)
+		}
+		i += end - 1
+	}
+	return templates
+}
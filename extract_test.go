@@ -0,0 +1,300 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyPage(t *testing.T) {
+	cases := []struct {
+		name string
+		p    page
+		want string
+	}{
+		{"article", page{Text: "'''Foo''' is a [[bar]].\n{{Infobox thing|name=Foo}}"}, pageTypeArticle},
+		{"redirect", page{Redirect: []redirect{{Title: "Bar"}}, Text: "#REDIRECT [[Bar]]"}, pageTypeRedirect},
+		{"redirect without element", page{Text: "#redirect [[Bar]]"}, pageTypeRedirect},
+		{"soft redirect", page{Text: "{{Soft redirect|wikt:foo}}"}, pageTypeSoftRedirect},
+		{"wiktionary redirect", page{Text: "{{wiktionary redirect}}"}, pageTypeSoftRedirect},
+		{"disambiguation", page{Text: "'''Foo''' may refer to:\n* [[Foo (band)]]\n{{disambiguation}}"}, pageTypeDisambiguation},
+		{"disambiguation parameters", page{Text: "{{Disambiguation|geo|surname}}"}, pageTypeDisambiguation},
+		{"human name disambiguation", page{Text: "{{hndis|Smith, John}}"}, pageTypeDisambiguation},
+		{"set index", page{Text: "{{Set index article}}"}, pageTypeSetIndex},
+		{"set index underscores", page{Text: "{{ set_index_article }}"}, pageTypeSetIndex},
+		{"surname", page{Text: "'''Smith''' is a surname.\n{{surname|Smith}}"}, pageTypeSetIndex},
+		{"ship index", page{Text: "{{shipindex}} {{Ship index}}"}, pageTypeSetIndex},
+		{"similar template name", page{Text: "{{Disambiguation needed}} {{dablink}}"}, pageTypeArticle},
+		{"disambiguation beats set index", page{Text: "{{surname}}\n{{dab}}"}, pageTypeDisambiguation},
+	}
+
+	for _, c := range cases {
+		if got := classifyPage(c.p); got != c.want {
+			t.Errorf("%s: classifyPage = %q; not %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	cases := []struct {
+		name    string
+		p       page
+		want    string
+		section string
+		wantOK  bool
+	}{
+		{"element", page{Redirect: []redirect{{Title: "Foo bar"}}, Text: "#REDIRECT [[Foo bar]]"}, "Foo bar", "", true},
+		{"element wins", page{Redirect: []redirect{{Title: "Foo"}}, Text: "#REDIRECT [[Bar]]"}, "Foo", "", true},
+		{"element section", page{Redirect: []redirect{{Title: "Foo#History"}}}, "Foo", "History", true},
+		{"empty element", page{Redirect: []redirect{{}}, Text: "#REDIRECT [[Bar]]"}, "Bar", "", true},
+		{"text", page{Text: "#REDIRECT [[foo_bar]]\n{{R from move}}"}, "Foo bar", "", true},
+		{"text lowercase", page{Text: "#redirect[[Foo]]"}, "Foo", "", true},
+		{"text colon", page{Text: "  #REDIRECT: [[Foo|label]]"}, "Foo", "", true},
+		{"text section", page{Text: "#REDIRECT [[Foo#Bar]]"}, "Foo", "Bar", true},
+		{"text section spaces", page{Text: "#REDIRECT [[foo # Early life|x]]"}, "Foo", "Early life", true},
+		{"localized", page{Text: "#WEITERLEITUNG [[Ziel]]"}, "Ziel", "", true},
+		{"localized lowercase", page{Text: "#перенаправление [[Цель]]"}, "Цель", "", true},
+		{"not at start", page{Text: "See #REDIRECT [[Foo]]"}, "", "", false},
+		{"article", page{Text: "Foo is a [[bar]]."}, "", "", false},
+	}
+	for _, c := range cases {
+		got, section, ok := redirectTarget(c.p)
+		if got != c.want || section != c.section || ok != c.wantOK {
+			t.Errorf("%s: redirectTarget = %q, %q, %t; not %q, %q, %t", c.name, got, section, ok, c.want, c.section, c.wantOK)
+		}
+	}
+}
+func TestExtractExternalLinks(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"no links here", []string{}},
+		{"[http://example.com Example] and [https://example.org/a?b=c]", []string{"http://example.com", "https://example.org/a?b=c"}},
+		{"protocol relative [//example.com/x label]", []string{"//example.com/x"}},
+		{"See http://example.com/page. Or https://example.org/x, too", []string{"http://example.com/page", "https://example.org/x"}},
+		{"(see http://example.com/wiki/Foo_(bar)) and (http://example.com/baz)", []string{"http://example.com/wiki/Foo_(bar)", "http://example.com/baz"}},
+		{"{{cite web|url=https://example.com/ref|title=Ref}}", []string{"https://example.com/ref"}},
+		{"[http://example.com/end.] then http://example.com/end.", []string{"http://example.com/end.", "http://example.com/end"}},
+		{"dupe http://example.com http://example.com [http://example.com x]", []string{"http://example.com"}},
+		{"<!-- http://hidden.example.com --> <nowiki>http://literal.example.com</nowiki> http://shown.example.com", []string{"http://shown.example.com"}},
+		{"[[Internal link]] and [not a link] and http:// alone", []string{}},
+	}
+
+	for _, c := range cases {
+		got := extractExternalLinks(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("extractExternalLinks(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExtractSummary(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"{{Infobox person|name=Foo}}\n'''Foo''' is a [[bar|baz]].<ref>x</ref>\n\nMore lead.\n== History ==\nLater.", "Foo is a baz."},
+		{"{{short description|x}}\n\n\nFirst.\n\nSecond.", "First."},
+		{"== Only ==\nSections.", ""},
+	}
+	for _, c := range cases {
+		if got := extractSummary(c.in); got != c.want {
+			t.Errorf("extractSummary(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExtractInfobox(t *testing.T) {
+	cases := []struct {
+		in   string
+		want map[string]string
+	}{
+		{"no infobox {{cite|a=b}}", nil},
+		{"{{Infobox person\n| name = Foo\n| birth_date = {{birth date|1900|1|2}}\n| spouse = [[Bar|Baz]]\n| empty =\n| note = <!-- hidden -->\n| positional\n}} after", map[string]string{
+			"name":       "Foo",
+			"birth_date": "{{birth date|1900|1|2}}",
+			"spouse":     "[[Bar|Baz]]",
+		}},
+		{"{{infobox_settlement|name=X|url=a=b}}", map[string]string{"name": "X", "url": "a=b"}},
+		{"{{Infobox country|name=Unterminated", map[string]string{"name": "Unterminated"}},
+	}
+	for _, c := range cases {
+		if got := extractInfobox(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("extractInfobox(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestExtractSections(t *testing.T) {
+	text := "Lead\n== History ==\n=== 20th century ===\ntext\n== History ==\n==Q&A: 100% ==\n== [[Foo|Bar]] baz ==\n"
+	want := []section{
+		{2, "History", "History", 5},
+		{3, "20th century", "20th_century", 19},
+		{2, "History", "History_2", 45},
+		{2, "Q&A: 100%", "Q%26A:_100%25", 59},
+		{2, "Bar baz", "Bar_baz", 74},
+	}
+	if got := extractSections(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("extractSections = %+v; not %+v", got, want)
+	}
+
+	if got, want := sectionAnchor("Café au lait"), "Caf%C3%A9_au_lait"; got != want {
+		t.Errorf("sectionAnchor = %q; not %q", got, want)
+	}
+	if got, want := injectAnchors("a\n== B ==\n", extractSections("a\n== B ==\n")), "a\n<span id=\"B\"></span>\n== B ==\n"; got != want {
+		t.Errorf("injectAnchors = %q; not %q", got, want)
+	}
+}
+
+func TestExtractDisambiguationOptions(t *testing.T) {
+	text := "'''Mercury''' may refer to:\n" +
+		"== Science ==\n" +
+		"* [[Mercury (planet)]], the closest planet to the Sun\n" +
+		"* [[Mercury (element)|Mercury]] (Hg), a chemical element\n" +
+		"** ''[[Mercury (film)|Mercury]]'' – a 2001 film\n" +
+		"* [[mercury_(element)#Uses|Mercury uses]], a repeat\n" +
+		"* Freddie Mercury, not linked\n" +
+		"* [[File:Mercury.jpg|thumb]] [[Mercury (band)]]\n" +
+		"See also [[Hermes]]\n{{disambiguation}}"
+	want := []disambiguationOption{
+		{"Mercury (planet)", "the closest planet to the Sun"},
+		{"Mercury (element)", "(Hg), a chemical element"},
+		{"Mercury (film)", "a 2001 film"},
+	}
+	if got := extractDisambiguationOptions(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("extractDisambiguationOptions = %+v; not %+v", got, want)
+	}
+}
+
+func TestExtractWikidataID(t *testing.T) {
+	cases := []struct {
+		text, want string
+	}{
+		{"No QID here.", ""},
+		{"See {{Wikidata|Q42}}.", "Q42"},
+		{"{{wikidata entity link|q1339 }}", "Q1339"},
+		{"{{Authority control|wikidata=Q937|VIAF=75121530}}", "Q937"},
+		{"{{Taxonbar|from=Q140}}", "Q140"},
+		{"{{Infobox person\n| name = Ada\n| qid = Q7259\n}}", "Q7259"},
+		{"{{Wikidata|Q0}} and [[Q42]]", ""},
+		{"{{Infobox|qid=Q1}} then {{Wikidata|Q2}}", "Q2"},
+	}
+	for _, c := range cases {
+		if got := extractWikidataID(c.text); got != c.want {
+			t.Errorf("extractWikidataID(%q) = %q; not %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestDetectQualityFlag(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		talk bool
+		want string
+	}{
+		{"plain", "'''Foo''' is a [[bar]].", false, ""},
+		{"featured", "'''Foo''' is a [[bar]].\n{{Featured article}}", false, qualityFeatured},
+		{"featured lower case", "{{ featured_article }}", false, qualityFeatured},
+		{"good", "{{good article}}\n'''Foo'''", false, qualityGood},
+		{"featured beats good", "{{Good article}} {{Featured article}}", false, qualityFeatured},
+		{"similar template name", "{{Featured article candidates}} {{Good article nominee}}", false, ""},
+		{"ga banner", "{{GA|12:00, 1 January 2022 (UTC)|topic=Physics}}", true, qualityGood},
+		{"article history", "{{Article history\n|action1=FAC\n|currentstatus=FA\n}}", true, qualityFeatured},
+		{"wikiproject class", "{{WikiProject Physics|class=GA|importance=high}}", true, qualityGood},
+		{"wikiproject other class", "{{WikiProject Physics|class=B}}", true, ""},
+		{"class ignored in article", "{{WikiProject Physics|class=FA}}", false, ""},
+	}
+
+	for _, c := range cases {
+		detect := detectQualityFlag
+		if c.talk {
+			detect = detectTalkQualityFlag
+		}
+		if got := detect(c.text); got != c.want {
+			t.Errorf("%s: quality flag = %q; not %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDetectQualityFlagTemplates(t *testing.T) {
+	defer func(featured, good string) { *featuredTemplates, *goodTemplates = featured, good }(*featuredTemplates, *goodTemplates)
+	*featuredTemplates, *goodTemplates = "Exzellent", "Lesenswert"
+
+	if got := detectQualityFlag("{{Exzellent|1. Januar 2022|123}}"); got != qualityFeatured {
+		t.Errorf("Exzellent = %q; not %q", got, qualityFeatured)
+	}
+	if got := detectQualityFlag("{{Lesenswert}}"); got != qualityGood {
+		t.Errorf("Lesenswert = %q; not %q", got, qualityGood)
+	}
+	if got := detectQualityFlag("{{Featured article}}"); got != "" {
+		t.Errorf("Featured article = %q; not empty", got)
+	}
+}
+
+func TestExtractTemplates(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"none", "'''Foo''' is a [[bar]].", []string{}},
+		{"simple", "{{Short description|A thing}}\n{{stub}}", []string{"Short description", "Stub"}},
+		{"nested", "{{Infobox person\n| name = {{PAGENAME}}\n| birth_date = {{birth date|1879|3|14}}\n}}", []string{"Infobox person", "Birth date"}},
+		{"deduplicated", "{{cite web|url=a}} {{Cite_web |url=b}} {{Template:cite web}}", []string{"Cite web"}},
+		{"modifiers", "{{subst:Unsigned|Foo}} {{ safesubst: Welcome }} {{msg:Note}}", []string{"Unsigned", "Welcome", "Note"}},
+		{"parser functions", "{{#if:{{{1|}}}|{{Yes}}|no}} {{lc:FOO}} {{DISPLAYTITLE:x}} {{!}}", []string{"Yes"}},
+		{"parameters", "{{{1}}} {{{name|{{Default}}}}}", []string{"Default"}},
+		{"unterminated", "{{Foo|bar}} {{Bar", []string{"Foo"}},
+	}
+
+	for _, c := range cases {
+		if got := extractTemplates(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: extractTemplates = %q; not %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestExtractLangLinks(t *testing.T) {
+	text := "'''Albert Einstein''' was a [[physicist]]. See [[:fr:Relativité]].\n" +
+		"[[Category:Physicists]]\n[[wikt:genius]]\n" +
+		"[[de:Albert Einstein]]\n[[fr: Albert_Einstein ]]\n[[zh-yue:愛因斯坦]]\n[[simple:Albert Einstein]]\n" +
+		"[[de:Einstein]]\n[[en:Albert Einstein]]\n[[es:Albert Einstein|label]]\n"
+	want := map[string]string{
+		"de":     "Albert Einstein",
+		"fr":     "Albert Einstein",
+		"zh-yue": "愛因斯坦",
+		"simple": "Albert Einstein",
+		"es":     "Albert Einstein",
+	}
+	if got := extractLangLinks(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("extractLangLinks = %q; not %q", got, want)
+	}
+	if got := extractLangLinks("Modern dumps have none. [[Foo]]"); len(got) != 0 || got == nil {
+		t.Errorf("extractLangLinks without links = %#v; expected an empty map", got)
+	}
+}
+
+func TestExtractShortDescription(t *testing.T) {
+	cases := []struct {
+		name, text, want string
+	}{
+		{"template", "{{Short description|English writer and humorist}}\n'''Douglas Adams''' was...", "English writer and humorist"},
+		{"lowercase", "{{short description| Species of fox }}", "Species of fox"},
+		{"underscore", "{{Short_description|A thing}}", "A thing"},
+		{"none", "{{Short description|none}}\n'''Foo''' is...", ""},
+		{"none case", "{{Short description| None }}", ""},
+		{"noreplace", "{{Short description|A thing|noreplace}}", "A thing"},
+		{"numbered", "{{Short description|1=A thing}}", "A thing"},
+		{"markup", "{{Short description|[[Fox|Vulpine]] ''animal''}}", "Vulpine animal"},
+		{"nested", "{{Short description|Year {{circa|1900}} event}}", "Year event"},
+		{"magic word", "{{SHORTDESC:A thing}}", "A thing"},
+		{"missing", "'''Foo''' is a thing.{{Infobox person|name=Foo}}", ""},
+		{"unterminated", "{{Short description|A thing", ""},
+	}
+	for _, c := range cases {
+		if got := extractShortDescription(c.text); got != c.want {
+			t.Errorf("%s: extractShortDescription(%q) = %q; not %q", c.name, c.text, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/creachadair/cityhash"
+	"github.com/pkg/errors"
+)
+
+var (
+	fullScanFallback = flag.Bool("fullScanFallback", false,
+		"whether to scan the whole articles dump for titles missing from the index, very slow")
+	fullScanInterval = flag.Duration("fullScanInterval", 10*time.Minute, "the minimum time between fallback full scans")
+)
+
+var errFound = errors.New("found")
+
+// fullScan rate limits fullScanLookup so that a stream of misses can't keep
+// the disk busy decoding the whole dump.
+var fullScan = struct {
+	sync.Mutex
+
+	running bool
+	last    time.Time
+}{}
+
+// fullScanLookup is the last resort for titles that are in the articles dump
+// but missing from the index. It decodes the entire dump looking for a page
+// with a matching title and records any hit in the index so later lookups are
+// fast. Scans run one at a time and at most once per -fullScanInterval, a miss
+// is reported as not found while a scan isn't allowed.
+func fullScanLookup(name string) (indexEntry, bool, error) {
+	fullScan.Lock()
+	if fullScan.running || time.Since(fullScan.last) < *fullScanInterval {
+		fullScan.Unlock()
+		log.Printf("full scan for %q skipped, rate limited", name)
+		return indexEntry{}, false, nil
+	}
+	fullScan.running = true
+	fullScan.Unlock()
+
+	defer func() {
+		fullScan.Lock()
+		fullScan.running = false
+		fullScan.last = time.Now()
+		fullScan.Unlock()
+	}()
+
+	variants := titleVariants(name)
+	log.Printf("full scan for %q starting", name)
+	start := time.Now()
+
+	var found page
+	var foundSeek int
+	err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		for _, variant := range variants {
+			if p.Title == variant {
+				found, foundSeek = p, seek
+				return errFound
+			}
+		}
+		return nil
+	})
+	if errors.Cause(err) != errFound {
+		if err != nil {
+			return indexEntry{}, false, err
+		}
+		log.Printf("full scan for %q found nothing in %s", name, time.Since(start))
+		return indexEntry{}, false, nil
+	}
+	log.Printf("full scan for %q found %q in block %d in %s", name, found.Title, foundSeek, time.Since(start))
+
+	entry := indexEntry{
+		id:   found.ID,
+		seek: foundSeek,
+	}
+	mu.Lock()
+	mu.found[cityhash.Hash64([]byte(found.Title))] = entry
+	mu.found[cityhash.Hash64([]byte(name))] = entry
+	atomic.StoreInt64(&foundEntries, int64(len(mu.found)))
+	mu.offsetSize[foundSeek]++
+	mu.generation++
+	if *retainTitles {
+		mu.titles = append(mu.titles, titleRecord{title: found.Title, id: found.ID})
+	}
+	if _, ok := mu.idToHash[found.ID]; *retainIDs && !ok {
+		mu.idToHash[found.ID] = cityhash.Hash64([]byte(found.Title))
+	}
+	mu.Unlock()
+
+	return entry, true, nil
+}
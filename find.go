@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+)
+
+// findContext is roughly how many bytes of text either side of a match are
+// included in its snippet.
+const findContext = 40
+
+type findMatch struct {
+	// Offset is the byte offset of the match in the article's plain text, as
+	// returned by /article?clean=true.
+	Offset  int    `json:"offset"`
+	Snippet string `json:"snippet"`
+}
+
+// findInText returns up to limit case-insensitive matches of query in text
+// with the text surrounding each one.
+func findInText(text, query string, limit int) []findMatch {
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+	matches := []findMatch{}
+	for _, loc := range re.FindAllStringIndex(text, limit) {
+		start, end := loc[0]-findContext, loc[1]+findContext
+		if start < 0 {
+			start = 0
+		}
+		if end > len(text) {
+			end = len(text)
+		}
+		// Don't split a multi-byte character at either end.
+		for start > 0 && !utf8.RuneStart(text[start]) {
+			start--
+		}
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+		matches = append(matches, findMatch{Offset: loc[0], Snippet: text[start:end]})
+	}
+	return matches
+}
+
+// handleFind serves /find?title=...&q=...&limit=N, returning where q appears
+// in the article's plain text, ignoring case, so clients can link to a
+// specific mention.
+func handleFind(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	query := q.Get("q")
+	if query == "" {
+		return statusErrorf(http.StatusBadRequest, "q is required")
+	}
+	limit, err := intParam(r, "limit", 20, 1, 100)
+	if err != nil {
+		return err
+	}
+	p, err := lookupArticle(q.Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, findInText(plainText(p.Text), query, limit))
+}
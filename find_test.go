@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindInText(t *testing.T) {
+	long := strings.Repeat("x", 50) + " Paris " + strings.Repeat("y", 50)
+	cases := []struct {
+		text, query string
+		limit       int
+		want        []findMatch
+	}{
+		{"", "foo", 10, []findMatch{}},
+		{"Paris is in France. PARIS, paris.", "paris", 10, []findMatch{
+			{0, "Paris is in France. PARIS, paris."},
+			{20, "Paris is in France. PARIS, paris."},
+			{27, "Paris is in France. PARIS, paris."},
+		}},
+		{"a.b a+b", "a+b", 10, []findMatch{{4, "a.b a+b"}}},
+		{"foo foo foo", "foo", 2, []findMatch{{0, "foo foo foo"}, {4, "foo foo foo"}}},
+		{long, "paris", 10, []findMatch{{51, strings.Repeat("x", 39) + " Paris " + strings.Repeat("y", 39)}}},
+		{"ÉCOLE école", "école", 10, []findMatch{{0, "ÉCOLE école"}, {7, "ÉCOLE école"}}},
+		// The snippet is widened rather than splitting é.
+		{strings.Repeat("é", 30) + "x", "x", 10, []findMatch{{60, strings.Repeat("é", 20) + "x"}}},
+	}
+	for _, c := range cases {
+		if got := findInText(c.text, c.query, c.limit); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("findInText(%q, %q, %d) = %+v; not %+v", c.text, c.query, c.limit, got, c.want)
+		}
+	}
+}
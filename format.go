@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var renderCacheSize = flag.Int("renderCacheSize", 100, "the number of rendered articles to cache by revision, 0 disables the cache")
+
+// renderCache is recreated with the configured size by run.
+var renderCache = newLRUCache(*renderCacheSize)
+
+// renderKey identifies a rendering in the renderCache. The year is part of
+// it since {{CURRENTYEAR}} renders as the year it's rendered in.
+type renderKey struct {
+	format   string
+	id       int
+	revision string
+	opts     renderOptions
+	year     int
+}
+
+// textFormat is a way of rendering an article for /article?format=....
+type textFormat struct {
+	contentType string
+	render      func(p page, opts renderOptions) string
+}
+
+// renderOptions are the options of a request that change how formats render
+// an article, which formats they don't apply to ignore.
+type renderOptions struct {
+	// resolveMedia links files to their Commons URLs rather than dropping
+	// them.
+	resolveMedia bool
+}
+
+// formats are the renderings an article can be fetched in, by name.
+var formats = map[string]textFormat{
+	"wikitext": {"text/plain; charset=utf-8", func(p page, opts renderOptions) string { return p.Text }},
+	"plain": {"text/plain; charset=utf-8", func(p page, opts renderOptions) string {
+		return plainText(resolveMagicWords(p.Text, p))
+	}},
+	// parsoid-html is a subset of Parsoid's HTML, see parsoidHTML.
+	"parsoid-html": {"text/html; charset=utf-8", parsoidHTML},
+	// html is parsoid-html by a shorter name.
+	"html": {"text/html; charset=utf-8", parsoidHTML},
+}
+
+// formatNames returns the names of the formats in order, for errors.
+func formatNames() string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// modelContentTypes are the Content-Types of the raw text of pages with
+// content models other than wikitext, mostly MediaWiki namespace pages.
+var modelContentTypes = map[string]string{
+	"javascript":    "application/javascript; charset=utf-8",
+	"css":           "text/css; charset=utf-8",
+	"sanitized-css": "text/css; charset=utf-8",
+	"json":          "application/json; charset=utf-8",
+}
+
+// formatContentTypes is the same by revision format, for pages with an
+// unknown model.
+var formatContentTypes = map[string]string{
+	"text/javascript":  modelContentTypes["javascript"],
+	"text/css":         modelContentTypes["css"],
+	"application/json": modelContentTypes["json"],
+}
+
+// rawContentType returns the Content-Type of p's raw text going by its
+// revision's content model and format, which is text/plain for wikitext and
+// anything unknown.
+func rawContentType(p page) string {
+	if t, ok := modelContentTypes[strings.ToLower(p.Model)]; ok {
+		return t
+	}
+	if t, ok := formatContentTypes[strings.ToLower(p.Format)]; ok {
+		return t
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// lookupFormat returns the named format, or a 400 if there's none.
+func lookupFormat(name string) (textFormat, error) {
+	f, ok := formats[name]
+	if !ok {
+		return textFormat{}, statusErrorf(http.StatusBadRequest, "unknown format %q, expected one of %s", name, formatNames())
+	}
+	return f, nil
+}
+
+// renderFormat returns p rendered in f, from the renderCache if the same
+// revision has been rendered the same way since it was filled. Pages without
+// a revision ID aren't cached, since they can't be told apart from an edited
+// version of themselves.
+func renderFormat(p page, name string, f textFormat, opts renderOptions) string {
+	if *renderCacheSize == 0 || p.RevisionID == "" {
+		return f.render(p, opts)
+	}
+	key := renderKey{name, p.ID, p.RevisionID, opts, time.Now().Year()}
+	if text, ok := renderCache.get(key); ok {
+		return text.(string)
+	}
+	text := f.render(p, opts)
+	renderCache.add(key, text)
+	return text
+}
+
+// writeFormat responds with p rendered in the named format.
+func writeFormat(w http.ResponseWriter, p page, name string, opts renderOptions) error {
+	f, err := lookupFormat(name)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	_, err = w.Write([]byte(renderFormat(p, name, f, opts)))
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestRenderFormatCache(t *testing.T) {
+	defer func(cache *lruCache, size int) { renderCache, *renderCacheSize = cache, size }(renderCache, *renderCacheSize)
+	renderCache, *renderCacheSize = newLRUCache(10), 10
+
+	renders := 0
+	f := textFormat{"text/plain", func(p page, opts renderOptions) string {
+		renders++
+		return p.Text
+	}}
+	p := testPage(1, "Foo", "old text")
+	cases := []struct {
+		p       page
+		opts    renderOptions
+		want    string
+		renders int
+	}{
+		{p, renderOptions{}, "old text", 1},
+		// The same revision is rendered once.
+		{p, renderOptions{}, "old text", 1},
+		{p, renderOptions{resolveMedia: true}, "old text", 2},
+		{page{ID: 1, Title: "Foo", RevisionID: "1001", Text: "new text"}, renderOptions{}, "new text", 3},
+		// Pages without revisions aren't cached.
+		{page{ID: 2, Title: "Bar", Text: "text"}, renderOptions{}, "text", 4},
+		{page{ID: 2, Title: "Bar", Text: "text"}, renderOptions{}, "text", 5},
+	}
+	for i, c := range cases {
+		if got := renderFormat(c.p, "test", f, c.opts); got != c.want {
+			t.Errorf("%d: renderFormat = %q; not %q", i, got, c.want)
+		}
+		if renders != c.renders {
+			t.Errorf("%d: rendered %d times; not %d", i, renders, c.renders)
+		}
+	}
+
+	*renderCacheSize = 0
+	renderFormat(p, "test", f, renderOptions{})
+	if renders != 6 {
+		t.Errorf("rendered %d times with the cache disabled; not 6", renders)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// maxFulltextOffset is the deepest /fulltext pages, since bleve ranks every
+// hit before the requested page.
+const maxFulltextOffset = 10000
+
+// snippetChars is about how many characters of text are around the first
+// match in a /fulltext snippet.
+const snippetChars = 200
+
+type fulltextHit struct {
+	Title string  `json:"title"`
+	ID    int     `json:"id"`
+	Score float64 `json:"score"`
+	// Snippet is the plain text around the first match in the article, or
+	// its start if the match was only in the title.
+	Snippet string `json:"snippet"`
+}
+
+// fulltextQuery returns the query for the articles in filter's namespace
+// containing any of the words of q, in the text or the title. Articles with
+// more of the words, rarer ones or ones in the title rank higher.
+func fulltextQuery(idx bleve.Index, q string, filter searchFilter) query.Query {
+	title := bleve.NewMatchQuery(q)
+	title.SetField("title")
+	title.SetBoost(2)
+	if phraseField(idx) == "title" {
+		return filter.apply(title)
+	}
+	text := bleve.NewMatchQuery(q)
+	text.SetField("text")
+	return filter.apply(bleve.NewDisjunctionQuery(title, text))
+}
+
+// fulltextSearch returns the size hits after the first from for q, best
+// first, without their IDs or snippets. bleve can't drop hits below
+// filter's minScore itself, so with one every hit up to the page is fetched
+// and the page is taken from those that are left.
+func fulltextSearch(idx bleve.Index, q string, from, size int, filter searchFilter) ([]fulltextHit, error) {
+	req := bleve.NewSearchRequestOptions(fulltextQuery(idx, q, filter), size, from, false)
+	if filter.minScore > 0 {
+		req = bleve.NewSearchRequestOptions(req.Query, from+size, 0, false)
+	}
+	req.Fields = []string{"title"}
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	hits := []fulltextHit{}
+	for _, h := range res.Hits {
+		if h.Score < filter.minScore {
+			continue
+		}
+		title, _ := h.Fields["title"].(string)
+		hits = append(hits, fulltextHit{Title: title, Score: h.Score})
+	}
+	if filter.minScore > 0 {
+		if from >= len(hits) {
+			return []fulltextHit{}, nil
+		}
+		hits = hits[from:]
+		if len(hits) > size {
+			hits = hits[:size]
+		}
+	}
+	return hits, nil
+}
+
+// textSnippet returns about n characters of text's plain text around the
+// first word analyzer finds one of terms in, cut at spaces with "…" where
+// anything was cut, or its start if there's none.
+func textSnippet(text string, terms map[string]bool, analyzer *analysis.Analyzer, n int) string {
+	plain := strings.Join(strings.Fields(plainText(text)), " ")
+	start := -1
+	if analyzer != nil {
+		for _, token := range analyzer.Analyze([]byte(plain)) {
+			if terms[string(token.Term)] {
+				start = token.Start
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return textPreview(text, n)
+	}
+
+	// Start a third of the way before the match, so it has some context.
+	from := start
+	for back := 0; from > 0 && back < n/3; back++ {
+		_, size := utf8.DecodeLastRuneInString(plain[:from])
+		from -= size
+	}
+	if from > 0 && plain[from-1] != ' ' {
+		if i := strings.IndexByte(plain[from:start], ' '); i >= 0 {
+			from += i + 1
+		}
+	}
+	to := from
+	for count := 0; to < len(plain) && count < n; count++ {
+		_, size := utf8.DecodeRuneInString(plain[to:])
+		to += size
+	}
+	if to < len(plain) {
+		if i := strings.LastIndexByte(plain[start:to], ' '); i > 0 {
+			to = start + i
+		}
+	}
+
+	snippet := plain[from:to]
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(plain) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// fieldAnalyzer returns the analyzer idx indexes field with, or nil if it
+// has none.
+func fieldAnalyzer(idx bleve.Index, field string) *analysis.Analyzer {
+	m := idx.Mapping()
+	return m.AnalyzerNamed(m.AnalyzerNameForPath(field))
+}
+
+// handleFulltext serves /fulltext?q=...&page=N&size=M&ns=0&minScore=0.5,
+// ranking the articles containing any of the words of q, where
+// /search/phrase needs all of them in order. Each hit has the plain text
+// around its first match, which means reading every hit on the page, so
+// pages are at most 100 hits and can't start past maxFulltextOffset.
+func handleFulltext(w http.ResponseWriter, r *http.Request) error {
+	q, err := phraseParam(r)
+	if err != nil {
+		return err
+	}
+	size, err := intParam(r, "size", 20, 1, 100)
+	if err != nil {
+		return err
+	}
+	pageNum, err := intParam(r, "page", 1, 1, maxFulltextOffset)
+	if err != nil {
+		return err
+	}
+	from := (pageNum - 1) * size
+	if from > maxFulltextOffset {
+		return statusErrorf(http.StatusBadRequest, "page %d of %d hits starts past the first %d hits", pageNum, size, maxFulltextOffset)
+	}
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		return err
+	}
+
+	searchMu.RLock()
+	if index == nil {
+		searchMu.RUnlock()
+		return statusErrorf(http.StatusServiceUnavailable, "search index is still being built")
+	}
+	hits, err := fulltextSearch(index, q, from, size, filter)
+	analyzer := fieldAnalyzer(index, phraseField(index))
+	searchMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	terms := map[string]bool{}
+	if analyzer != nil {
+		for _, token := range analyzer.Analyze([]byte(q)) {
+			terms[string(token.Term)] = true
+		}
+	}
+	found := make([]bool, len(hits))
+	runBatch(len(hits), func(i int) {
+		// Reading a hit isn't a view of it, so it's not counted as trending.
+		entry, err := fetchArticle(hits[i].Title)
+		if err != nil {
+			// The search index is older than the offsets index.
+			return
+		}
+		p, err := readArticle(entry)
+		if err != nil {
+			return
+		}
+		hits[i].ID = p.ID
+		hits[i].Snippet = textSnippet(p.Text, terms, analyzer, snippetChars)
+		found[i] = true
+	})
+	results := []fulltextHit{}
+	for i, hit := range hits {
+		if found[i] {
+			results = append(results, hit)
+		}
+	}
+	return writeJSON(w, r, results)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestTextSnippet(t *testing.T) {
+	analyzer := fieldAnalyzer(testSearchIndex(t), "text")
+	long := strings.Repeat("filler ", 100) + "the brown fox ran " + strings.Repeat("more ", 100)
+	cases := []struct {
+		text, term string
+		n          int
+		want       string
+	}{
+		{"The quick brown fox.", "fox", 200, "The quick brown fox."},
+		{"The '''quick''' [[brown fox]].", "brown", 200, "The quick brown fox."},
+		{"Nothing matches here.", "fox", 10, "Nothing ma…"},
+		{long, "fox", 30, "…the brown fox ran more more…"},
+	}
+	for _, c := range cases {
+		terms := map[string]bool{}
+		for _, token := range analyzer.Analyze([]byte(c.term)) {
+			terms[string(token.Term)] = true
+		}
+		if got := textSnippet(c.text, terms, analyzer, c.n); got != c.want {
+			t.Errorf("textSnippet(%.30q, %q) = %q; not %q", c.text, c.term, got, c.want)
+		}
+	}
+}
+
+func TestHandleFulltext(t *testing.T) {
+	pages := []page{
+		testPage(1, "Red fox", "The red fox is a fox of the northern hemisphere."),
+		testPage(2, "Arctic fox", "A small fox of the Arctic."),
+		testPage(3, "Bread", "Bread is baked from flour."),
+		testPage(4, "Fox hunting", "Hunting with hounds."),
+	}
+	useTestDump(t, pages)
+	idx := testSearchIndex(t)
+	for _, p := range pages {
+		if err := idx.Index(searchDocID(p.Title), searchDoc{Title: p.Title, Text: p.Text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// In the search index but no longer in the dump.
+	if err := idx.Index(searchDocID("Gone fox"), searchDoc{Title: "Gone fox", Text: "fox"}); err != nil {
+		t.Fatal(err)
+	}
+	defer func(s bool) { *search = s }(*search)
+	*search = true
+	searchMu.Lock()
+	old := index
+	index = idx
+	searchMu.Unlock()
+	defer func() {
+		searchMu.Lock()
+		index = old
+		searchMu.Unlock()
+	}()
+
+	get := func(query string) ([]fulltextHit, int, string) {
+		w := httptest.NewRecorder()
+		handle(handleFulltext)(w, httptest.NewRequest("GET", "/fulltext?"+query, nil))
+		var hits []fulltextHit
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &hits); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return hits, w.Code, w.Body.String()
+	}
+
+	defer func(c *trendingCounter) { trending = c }(trending)
+	trending = newTrendingCounter(time.Hour, 10)
+	hits, code, body := get("q=fox")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	if top := trending.top(10, time.Now()); len(top) != 0 {
+		t.Errorf("reading the hits for their snippets made %+v trending", top)
+	}
+	titles := map[string]fulltextHit{}
+	for i, hit := range hits {
+		titles[hit.Title] = hit
+		if i > 0 && hit.Score > hits[i-1].Score {
+			t.Errorf("hits aren't ranked by score: %+v", hits)
+		}
+	}
+	if len(hits) != 3 || titles["Bread"].Title != "" || titles["Gone fox"].Title != "" {
+		t.Fatalf("hits = %+v; expected the three fox articles still in the dump", hits)
+	}
+	if hit := titles["Red fox"]; hit.ID != 1 || hit.Snippet != "The red fox is a fox of the northern hemisphere." {
+		t.Errorf("Red fox hit = %+v", hit)
+	}
+	if hit := titles["Fox hunting"]; hit.ID != 4 || hit.Snippet != "Hunting with hounds." {
+		t.Errorf("a title only match should have the start of the text as its snippet, got %+v", hit)
+	}
+
+	// Gone fox is left out of whichever page it's on.
+	seen := map[string]bool{}
+	for page := 1; page <= 3; page++ {
+		hits, _, _ := get("q=fox&size=2&page=" + strconv.Itoa(page))
+		for _, hit := range hits {
+			if seen[hit.Title] {
+				t.Errorf("page %d repeats %q", page, hit.Title)
+			}
+			seen[hit.Title] = true
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("pages had %v; expected the three fox articles", seen)
+	}
+	if hits, _, _ := get("q=flour+baked"); len(hits) != 1 || hits[0].Title != "Bread" {
+		t.Errorf("q=flour baked: hits = %+v; expected Bread", hits)
+	}
+
+	// With a minScore the pages are of the hits that are left.
+	all, err := fulltextSearch(idx, "fox", 0, 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := searchFilter{minScore: all[1].Score}
+	for _, c := range []struct{ from, size, want int }{{0, 10, 2}, {1, 2, 1}, {2, 2, 0}} {
+		hits, err := fulltextSearch(idx, "fox", c.from, c.size, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != c.want || (c.want > 0 && hits[0].Title != all[c.from].Title) {
+			t.Errorf("from %d size %d with minScore: hits = %+v; expected %d from %s", c.from, c.size, hits, c.want, all[c.from].Title)
+		}
+	}
+
+	for _, query := range []string{"q=", "q=fox&size=0", "q=fox&size=101", "q=fox&page=0", "q=fox&size=100&page=102"} {
+		if _, code, body := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d; not 400: %s", query, code, body)
+		}
+	}
+}
+
+func TestFulltextTitleOnlyIndex(t *testing.T) {
+	defer func(f searchFields) { searchIndexFields = f }(searchIndexFields)
+	searchIndexFields = searchFields{}
+	idx, err := bleve.NewMemOnly(searchMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	for _, title := range []string{"Red fox", "Bread"} {
+		if err := idx.Index(searchDocID(title), searchDoc{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hits, err := fulltextSearch(idx, "fox", 0, 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Red fox" {
+		t.Errorf("hits = %+v; expected Red fox", hits)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"flag"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	geo      = flag.Bool("geo", false, "whether or not to build the spatial index of article coordinates for /nearby, requires decoding every article")
+	geoCache = flag.String("geoCache", "", "the file to cache the spatial index in, so later starts with -geo can read it instead of decoding every article again, empty disables the cache")
+)
+
+const (
+	// earthRadius is the mean radius of the Earth in metres.
+	earthRadius = 6371000
+	// maxNearbyRadius is the largest radius /nearby searches, in metres.
+	maxNearbyRadius = 1000000
+	// maxNearby is the most articles /nearby returns.
+	maxNearby = 500
+	// geoCacheVersion is incremented whenever the cache's format changes.
+	geoCacheVersion = 1
+)
+
+type geoEntry struct {
+	Title    string
+	Lat, Lon float64
+}
+
+// geoIndex holds the coordinates of every geotagged article as a k-d tree,
+// see buildKDTree. It is only populated when running with -geo since
+// building it requires decoding every article in the dump, unless it's read
+// from the -geoCache.
+var geoIndex = struct {
+	sync.Mutex
+
+	built bool
+	tree  []geoEntry
+}{}
+
+func buildGeoIndex() error {
+	if *geoCache != "" {
+		tree, ok, err := readGeoCache()
+		if err != nil {
+			log.Printf("reading geo cache: %+v", err)
+		} else if ok {
+			setGeoIndex(tree)
+			return nil
+		}
+	}
+
+	log.Printf("Building spatial index...")
+	var entries []geoEntry
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		if namespaceForTitle(p.Title) != 0 {
+			return nil
+		}
+		if lat, lon, ok := extractCoordinates(p.Text); ok {
+			entries = append(entries, geoEntry{Title: p.Title, Lat: lat, Lon: lon})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	buildKDTree(entries, 0)
+	setGeoIndex(entries)
+	log.Printf("Done building spatial index! %d geotagged articles", len(entries))
+
+	if *geoCache != "" {
+		if err := writeGeoCache(entries); err != nil {
+			log.Printf("writing geo cache: %+v", err)
+		}
+	}
+	return nil
+}
+
+func setGeoIndex(tree []geoEntry) {
+	geoIndex.Lock()
+	geoIndex.built = true
+	geoIndex.tree = tree
+	geoIndex.Unlock()
+}
+
+// buildKDTree sorts entries in place into an implicit k-d tree: the median by
+// latitude, at even depths, or longitude, at odd ones, is in the middle, with
+// the entries before and after it the subtrees either side of it.
+func buildKDTree(entries []geoEntry, depth int) {
+	if len(entries) <= 1 {
+		return
+	}
+	if depth%2 == 0 {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Lat < entries[j].Lat })
+	} else {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Lon < entries[j].Lon })
+	}
+	m := len(entries) / 2
+	buildKDTree(entries[:m], depth+1)
+	buildKDTree(entries[m+1:], depth+1)
+}
+
+// geoBox is a range of latitudes and longitudes, in degrees.
+type geoBox struct {
+	minLat, maxLat, minLon, maxLon float64
+}
+
+func (b geoBox) contains(e geoEntry) bool {
+	return e.Lat >= b.minLat && e.Lat <= b.maxLat && e.Lon >= b.minLon && e.Lon <= b.maxLon
+}
+
+// inBox calls fn with every entry of the k-d tree in b.
+func inBox(tree []geoEntry, b geoBox, depth int, fn func(e geoEntry)) {
+	if len(tree) == 0 {
+		return
+	}
+	m := len(tree) / 2
+	e := tree[m]
+	if b.contains(e) {
+		fn(e)
+	}
+	split, lo, hi := e.Lat, b.minLat, b.maxLat
+	if depth%2 == 1 {
+		split, lo, hi = e.Lon, b.minLon, b.maxLon
+	}
+	if lo <= split {
+		inBox(tree[:m], b, depth+1, fn)
+	}
+	if hi >= split {
+		inBox(tree[m+1:], b, depth+1, fn)
+	}
+}
+
+// boundingBoxes returns the boxes that hold every point within radius metres
+// of lat, lon. It's two boxes if the circle crosses the antimeridian, and
+// covers every longitude if it includes a pole.
+func boundingBoxes(lat, lon, radius float64) []geoBox {
+	angle := radius / earthRadius
+	dLat := angle * 180 / math.Pi
+	b := geoBox{minLat: lat - dLat, maxLat: lat + dLat, minLon: -180, maxLon: 180}
+	if b.minLat <= -90 || b.maxLat >= 90 || angle >= math.Pi/2 {
+		b.minLat, b.maxLat = math.Max(b.minLat, -90), math.Min(b.maxLat, 90)
+		return []geoBox{b}
+	}
+	dLon := math.Asin(math.Sin(angle)/math.Cos(lat*math.Pi/180)) * 180 / math.Pi
+	b.minLon, b.maxLon = lon-dLon, lon+dLon
+	switch {
+	case b.minLon < -180:
+		wrapped := b
+		wrapped.minLon, wrapped.maxLon = b.minLon+360, 180
+		b.minLon = -180
+		return []geoBox{b, wrapped}
+	case b.maxLon > 180:
+		wrapped := b
+		wrapped.minLon, wrapped.maxLon = -180, b.maxLon-360
+		b.maxLon = 180
+		return []geoBox{b, wrapped}
+	}
+	return []geoBox{b}
+}
+
+// haversine returns the great circle distance between two points in metres.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*toRad, (lon2-lon1)*toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+type nearbyArticle struct {
+	Title string  `json:"title"`
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	// Distance is how far the article is from the searched point in metres.
+	Distance float64 `json:"distance"`
+}
+
+// nearby returns up to limit articles in the k-d tree within radius metres
+// of lat, lon, closest first.
+func nearby(tree []geoEntry, lat, lon, radius float64, limit int) []nearbyArticle {
+	found := []nearbyArticle{}
+	for _, b := range boundingBoxes(lat, lon, radius) {
+		inBox(tree, b, 0, func(e geoEntry) {
+			if d := haversine(lat, lon, e.Lat, e.Lon); d <= radius {
+				found = append(found, nearbyArticle{Title: e.Title, Lat: e.Lat, Lon: e.Lon, Distance: math.Round(d)})
+			}
+		})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Distance != found[j].Distance {
+			return found[i].Distance < found[j].Distance
+		}
+		return found[i].Title < found[j].Title
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+// parseRadius parses a distance like 50km or 500m into metres. Without a
+// unit it's in metres.
+func parseRadius(raw string) (float64, error) {
+	scale := 1.0
+	num := raw
+	if strings.HasSuffix(raw, "km") {
+		scale, num = 1000, strings.TrimSuffix(raw, "km")
+	} else {
+		num = strings.TrimSuffix(raw, "m")
+	}
+	r, err := strconv.ParseFloat(num, 64)
+	if err != nil || r <= 0 || math.IsInf(r, 0) {
+		return 0, statusErrorf(http.StatusBadRequest, "invalid radius %q, expected a distance like 500m or 50km", raw)
+	}
+	r *= scale
+	if r > maxNearbyRadius {
+		return 0, statusErrorf(http.StatusBadRequest, "radius can be at most %dkm, got %q", maxNearbyRadius/1000, raw)
+	}
+	return r, nil
+}
+
+// handleNearby serves /nearby?lat=...&lon=...&radius=50km&limit=20,
+// returning the geotagged articles within radius of the point, closest
+// first.
+func handleNearby(w http.ResponseWriter, r *http.Request) error {
+	if !*geo {
+		return statusErrorf(http.StatusServiceUnavailable, "spatial index disabled, start with -geo")
+	}
+	lat, err := floatParam(r, "lat", -90, 90)
+	if err != nil {
+		return err
+	}
+	lon, err := floatParam(r, "lon", -180, 180)
+	if err != nil {
+		return err
+	}
+	radius := 10000.0
+	if raw := r.URL.Query().Get("radius"); raw != "" {
+		if radius, err = parseRadius(raw); err != nil {
+			return err
+		}
+	}
+	limit, err := intParam(r, "limit", 20, 1, maxNearby)
+	if err != nil {
+		return err
+	}
+
+	geoIndex.Lock()
+	built, tree := geoIndex.built, geoIndex.tree
+	geoIndex.Unlock()
+	if !built {
+		return statusErrorf(http.StatusServiceUnavailable, "spatial index is still being built")
+	}
+	// tree is replaced rather than modified, so it's safe to read without the
+	// lock.
+	return writeJSON(w, r, nearby(tree, lat, lon, radius, limit))
+}
+
+// geoCacheHeader starts the -geoCache, saying which dump it's of.
+type geoCacheHeader struct {
+	Version  int
+	Articles fileStamp
+}
+
+// readGeoCache reads the k-d tree from the -geoCache, reporting false if
+// there's no cache or it's not of the current articles file.
+func readGeoCache() ([]geoEntry, bool, error) {
+	f, err := os.Open(*geoCache)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	want, err := stampFile(*articlesFile)
+	if err != nil {
+		return nil, false, err
+	}
+
+	start := time.Now()
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	var h geoCacheHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, false, errors.Wrap(err, "reading geo cache header")
+	}
+	if h.Version != geoCacheVersion || !h.Articles.same(want) {
+		log.Printf("Geo cache %s is stale, rebuilding it", *geoCache)
+		return nil, false, nil
+	}
+	var tree []geoEntry
+	if err := dec.Decode(&tree); err != nil {
+		return nil, false, errors.Wrap(err, "reading geo cache")
+	}
+	log.Printf("Read geo cache %s in %s, %d geotagged articles", *geoCache, time.Since(start), len(tree))
+	return tree, true, nil
+}
+
+// writeGeoCache writes the k-d tree to the -geoCache, replacing it only once
+// it's complete.
+func writeGeoCache(tree []geoEntry) error {
+	h := geoCacheHeader{Version: geoCacheVersion}
+	var err error
+	if h.Articles, err = stampFile(*articlesFile); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(*geoCache), filepath.Base(*geoCache)+".tmp")
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(f)
+	enc := gob.NewEncoder(buf)
+	err = enc.Encode(h)
+	if err == nil {
+		err = enc.Encode(tree)
+	}
+	if err == nil {
+		err = buf.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), *geoCache)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	log.Printf("Wrote geo cache %s", *geoCache)
+	return nil
+}
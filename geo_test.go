@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestNearbyMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var entries []geoEntry
+	for i := 0; i < 2000; i++ {
+		entries = append(entries, geoEntry{
+			Title: string(rune('A'+i%26)) + strings.Repeat("x", i/26),
+			Lat:   rng.Float64()*180 - 90,
+			Lon:   rng.Float64()*360 - 180,
+		})
+	}
+	all := append([]geoEntry(nil), entries...)
+	buildKDTree(entries, 0)
+
+	cases := []struct {
+		name             string
+		lat, lon, radius float64
+	}{
+		{"equator", 0, 0, 1000000},
+		{"antimeridian", 10, 179.9, 1000000},
+		{"antimeridian west", -10, -179.9, 1000000},
+		{"north pole", 89.5, 30, 500000},
+		{"south pole", -89.9, -100, 1000000},
+		{"small", 45, 45, 1000},
+	}
+	for _, c := range cases {
+		var want []string
+		for _, e := range all {
+			if haversine(c.lat, c.lon, e.Lat, e.Lon) <= c.radius {
+				want = append(want, e.Title)
+			}
+		}
+		var got []string
+		for _, a := range nearby(entries, c.lat, c.lon, c.radius, len(all)) {
+			got = append(got, a.Title)
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: found %d articles; brute force found %d", c.name, len(got), len(want))
+		}
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	// London to Paris is about 344km.
+	if d := haversine(51.5074, -0.1278, 48.8566, 2.3522); math.Abs(d-343500) > 1000 {
+		t.Errorf("London to Paris = %.0fm; expected about 343500m", d)
+	}
+	if d := haversine(0, 179.5, 0, -179.5); math.Abs(d-111195) > 10 {
+		t.Errorf("across the antimeridian = %.0fm; expected about 111195m", d)
+	}
+}
+
+func TestParseRadius(t *testing.T) {
+	cases := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"50km", 50000, true},
+		{"500m", 500, true},
+		{"1500", 1500, true},
+		{"0.5km", 500, true},
+		{"1001km", 0, false},
+		{"-5km", 0, false},
+		{"0", 0, false},
+		{"far", 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseRadius(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("parseRadius(%q) = %v, %v; not %v, ok %v", c.in, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func TestHandleNearby(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "London", "{{coord|51.5074|-0.1278|display=title}}"),
+		testPage(2, "Greenwich", "{{coord|51|28|N|0|0|W}}"),
+		testPage(3, "Paris", "{{coord|48.8566|2.3522}}"),
+		testPage(4, "Talk:London", "{{coord|51.5074|-0.1278}}"),
+		testPage(5, "Nowhere", "No location."),
+	})
+	defer func(old bool, cache string) { *geo, *geoCache = old, cache }(*geo, *geoCache)
+	*geo = true
+	*geoCache = filepath.Join(t.TempDir(), "geo.cache")
+	if err := buildGeoIndex(); err != nil {
+		t.Fatal(err)
+	}
+	defer setGeoIndex(nil)
+
+	for _, c := range []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"lat=51.5&lon=-0.12&radius=50km", http.StatusOK, `[{"title":"London","lat":51.5074,"lon":-0.1278,"distance":`},
+		{"lat=51.5&lon=-0.12&radius=50km", http.StatusOK, `"title":"Greenwich"`},
+		{"lat=51.5&lon=-0.12&radius=50km&limit=1", http.StatusOK, `"distance":984}]`},
+		{"lat=51.5&lon=-0.12&radius=500km", http.StatusOK, `"title":"Paris"`},
+		{"lat=0&lon=0", http.StatusOK, `[]`},
+		{"lon=0", http.StatusBadRequest, "lat is required"},
+		{"lat=91&lon=0", http.StatusBadRequest, "lat must be between"},
+		{"lat=0&lon=0&radius=5000km", http.StatusBadRequest, "radius can be at most"},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleNearby)(w, httptest.NewRequest("GET", "/nearby?"+c.query, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: got %d %s; expected %d containing %s", c.query, w.Code, w.Body, c.code, c.want)
+		}
+	}
+
+	// The index was saved to the -geoCache for the next start.
+	setGeoIndex(nil)
+	tree, ok, err := readGeoCache()
+	if err != nil || !ok || len(tree) != 3 {
+		t.Fatalf("readGeoCache = %d entries, %v, %v; expected 3 entries", len(tree), ok, err)
+	}
+}
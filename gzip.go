@@ -0,0 +1,142 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	gzipLevel = flag.Int("gzipLevel", 6, "the gzip compression level for responses, 1-9. "+
+		"A 100KB article compresses to 30% of its size at 130MB/s with 1, 27% at 65MB/s with 6 and 26% at 14MB/s with 9")
+	brotliQuality = flag.Int("brotliQuality", 5, "the Brotli compression quality for responses to clients that prefer it over gzip, 0-11. "+
+		"A 100KB article compresses to 29% of its size at 100MB/s with 1, 26% at 24MB/s with 5 and 23% at 0.4MB/s with 11")
+)
+
+// gzipWriters pools writers at -gzipLevel since each one allocates several
+// hundred KB of compression state.
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(ioutil.Discard, *gzipLevel)
+		return w
+	},
+}
+
+// brotliWriters pools writers at -brotliQuality, like gzipWriters.
+var brotliWriters = sync.Pool{
+	New: func() interface{} {
+		return brotli.NewWriterLevel(ioutil.Discard, *brotliQuality)
+	},
+}
+
+// encoder is a compressing writer that responses are written through.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+
+	enc encoder
+}
+
+func (w *compressedResponseWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressedResponseWriter) Write(b []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	return w.enc.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *compressedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush flushes the compressed data written so far so streaming responses
+// still stream.
+func (w *compressedResponseWriter) Flush() {
+	w.enc.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressed compresses the responses of h with Brotli or gzip, whichever the
+// client prefers, see acceptedEncoding. Range requests are passed through
+// uncompressed since the ranges refer to the uncompressed body.
+func compressed(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		var enc encoder
+		switch encoding {
+		case "br":
+			br := brotliWriters.Get().(*brotli.Writer)
+			defer brotliWriters.Put(br)
+			br.Reset(w)
+			enc = br
+		default:
+			gz := gzipWriters.Get().(*gzip.Writer)
+			defer gzipWriters.Put(gz)
+			gz.Reset(w)
+			enc = gz
+		}
+		defer enc.Close()
+
+		w.Header().Set("Content-Encoding", encoding)
+		h.ServeHTTP(&compressedResponseWriter{ResponseWriter: w, enc: enc}, r)
+	})
+}
+
+// acceptedEncoding returns the encoding to compress a response with given
+// the request's Accept-Encoding: "br" if the client takes Brotli at least
+// as readily as gzip, otherwise "gzip" if it takes that, and otherwise "" to
+// leave it uncompressed. Encodings with q=0 are refused, and * stands for
+// any that aren't listed.
+func acceptedEncoding(header string) string {
+	weights := map[string]float64{}
+	for _, enc := range strings.Split(header, ",") {
+		name, weight := enc, 1.0
+		if i := strings.IndexByte(enc, ';'); i >= 0 {
+			name = enc[:i]
+			if param := strings.TrimSpace(enc[i+1:]); strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					weight = q
+				}
+			}
+		}
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			weights[name] = weight
+		}
+	}
+	weight := func(enc string) float64 {
+		if w, ok := weights[enc]; ok {
+			return w
+		}
+		return weights["*"]
+	}
+	br, gz := weight("br"), weight("gzip")
+	switch {
+	case br > 0 && br >= gz:
+		return "br"
+	case gz > 0:
+		return "gzip"
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressed(t *testing.T) {
+	body := strings.Repeat("compressible ", 100)
+	h := compressed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+
+	for _, c := range []struct {
+		acceptEncoding, rangeHeader string
+		encoding                    string
+	}{
+		{"gzip, deflate", "", "gzip"},
+		{"deflate, gzip;q=0.5", "", "gzip"},
+		{"", "", ""},
+		{"gzip;q=0", "", ""},
+		{"gzip", "bytes=0-10", ""},
+		{"gzip, deflate, br", "", "br"},
+		{"br;q=0.5, gzip", "", "gzip"},
+		{"br, gzip;q=0.8", "", "br"},
+		{"br;q=0, gzip", "", "gzip"},
+		{"br;q=0", "", ""},
+		{"BR", "", "br"},
+		{"*", "", "br"},
+		{"gzip, *;q=0.1", "", "gzip"},
+		{"br", "bytes=0-10", ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+		if c.rangeHeader != "" {
+			req.Header.Set("Range", c.rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		got := w.Body.Bytes()
+		if encoding := w.Header().Get("Content-Encoding"); encoding != c.encoding {
+			t.Errorf("Accept-Encoding %q, Range %q: Content-Encoding = %q; not %q", c.acceptEncoding, c.rangeHeader, encoding, c.encoding)
+			continue
+		}
+		var r io.Reader
+		switch c.encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(bytes.NewReader(got))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gz
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(got))
+		}
+		if r != nil {
+			var err error
+			if got, err = ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(got) != body {
+			t.Errorf("Accept-Encoding %q: body = %q", c.acceptEncoding, got)
+		}
+	}
+}
+
+// wikitextSample generates size bytes of text resembling an article, with
+// links, templates and references between runs of prose.
+func wikitextSample(size int) string {
+	rng := rand.New(rand.NewSource(1))
+	words := strings.Fields("the of and in a to was is for on as by with he that at from his it an were are which this also be has or had first one their its new after but who not they have her she two been other when there all during into school time may years more most only over city some world would where later up such used many can state about national out known university united then made")
+	var b strings.Builder
+	for b.Len() < size {
+		switch rng.Intn(20) {
+		case 0:
+			fmt.Fprintf(&b, "[[%s %s|%s]] ", words[rng.Intn(len(words))], words[rng.Intn(len(words))], words[rng.Intn(len(words))])
+		case 1:
+			fmt.Fprintf(&b, "<ref>{{cite web|url=https://example.com/%d|title=%s|access-date=2021-%02d-%02d}}</ref> ", rng.Int(), words[rng.Intn(len(words))], rng.Intn(12)+1, rng.Intn(28)+1)
+		case 2:
+			b.WriteString(".\n\n== Section ==\n")
+		default:
+			b.WriteString(words[rng.Intn(len(words))])
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// BenchmarkGzipLevel compresses a 100KB article at a few levels. The ratio
+// metric is the compressed size as a fraction of the original.
+func BenchmarkGzipLevel(b *testing.B) {
+	text := []byte(wikitextSample(100 << 10))
+	for _, level := range []int{1, 3, 6, 9} {
+		b.Run(fmt.Sprintf("level%d", level), func(b *testing.B) {
+			var buf bytes.Buffer
+			gz, _ := gzip.NewWriterLevel(&buf, level)
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				gz.Reset(&buf)
+				gz.Write(text)
+				gz.Close()
+			}
+			b.ReportMetric(float64(buf.Len())/float64(len(text)), "ratio")
+		})
+	}
+}
+
+// BenchmarkBrotliQuality compresses the same article as BenchmarkGzipLevel at
+// a few qualities, to compare the two.
+func BenchmarkBrotliQuality(b *testing.B) {
+	text := []byte(wikitextSample(100 << 10))
+	for _, quality := range []int{1, 5, 6, 11} {
+		b.Run(fmt.Sprintf("quality%d", quality), func(b *testing.B) {
+			var buf bytes.Buffer
+			br := brotli.NewWriterLevel(&buf, quality)
+			b.SetBytes(int64(len(text)))
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				br.Reset(&buf)
+				br.Write(text)
+				br.Close()
+			}
+			b.ReportMetric(float64(buf.Len())/float64(len(text)), "ratio")
+		})
+	}
+}
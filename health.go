@@ -0,0 +1,374 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	healthCheckTitle = flag.String("healthCheckTitle", "", "the article /healthz/deep decodes to check the articles file is readable, by default the first page of the first block")
+	healthCheckTTL   = flag.Duration("healthCheckTTL", 10*time.Second, "how long /healthz/deep reuses the result of decoding the sample article")
+)
+
+// loadState tracks the initial index load and any reloads.
+var loadState = struct {
+	sync.Mutex
+
+	loading  bool
+	loaded   bool
+	started  time.Time
+	finished time.Time
+	err      error
+}{}
+
+// indexLinesRead is the number of index lines read by the current load.
+var indexLinesRead int64
+
+// indexBytesRead is how much of the file being indexed the current load has
+// read, out of indexBytesTotal. For compressed files both count compressed
+// bytes.
+var indexBytesRead, indexBytesTotal int64
+
+// progressReader counts the bytes read through it in indexBytesRead.
+type progressReader struct {
+	r io.Reader
+}
+
+func (p progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	atomic.AddInt64(&indexBytesRead, int64(n))
+	return n, err
+}
+
+// trackProgress records f's size as the total to read in indexBytesTotal and
+// returns a reader of f that counts towards indexBytesRead.
+func trackProgress(f *os.File) (io.Reader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreInt64(&indexBytesTotal, stat.Size())
+	return progressReader{f}, nil
+}
+
+// beginLoad marks a load as started, returning false if one is already in
+// progress.
+func beginLoad() bool {
+	loadState.Lock()
+	defer loadState.Unlock()
+
+	if loadState.loading {
+		return false
+	}
+	loadState.loading = true
+	loadState.started = time.Now()
+	atomic.StoreInt64(&indexLinesRead, 0)
+	atomic.StoreInt64(&indexBytesRead, 0)
+	atomic.StoreInt64(&indexBytesTotal, 0)
+	return true
+}
+
+func endLoad(err error) {
+	loadState.Lock()
+	defer loadState.Unlock()
+
+	loadState.loading = false
+	loadState.finished = time.Now()
+	loadState.err = err
+	if err == nil {
+		loadState.loaded = true
+	}
+}
+
+// indexLoadError returns a 500 error describing why the index failed to
+// load, if no index has been loaded yet and the last attempt failed. It
+// distinguishes a misconfiguration from an article that doesn't exist.
+func indexLoadError() error {
+	loadState.Lock()
+	defer loadState.Unlock()
+
+	if loadState.loaded || loadState.err == nil {
+		return nil
+	}
+	return statusErrorf(http.StatusInternalServerError, "index failed to load: %s", loadState.err)
+}
+
+// articlesUnavailableLogInterval is how often a missing articles file is
+// logged, so a deleted or unmounted dump doesn't log on every request.
+const articlesUnavailableLogInterval = time.Minute
+
+var articlesUnavailableLogged = struct {
+	sync.Mutex
+
+	at time.Time
+}{}
+
+// articlesUnavailable returns a 503 error if err is because the articles file
+// no longer exists, such as when it was deleted or unmounted after startup,
+// and err otherwise. It distinguishes the dump going away from a page that
+// can't be found or decoded.
+func articlesUnavailable(err error) error {
+	if !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	now := time.Now()
+	articlesUnavailableLogged.Lock()
+	if now.Sub(articlesUnavailableLogged.at) >= articlesUnavailableLogInterval {
+		articlesUnavailableLogged.at = now
+		log.Printf("articles file unavailable: %s", err)
+	}
+	articlesUnavailableLogged.Unlock()
+	return statusErrorf(http.StatusServiceUnavailable, "articles file unavailable")
+}
+
+// loadAll loads the index followed by whichever derived indexes are enabled.
+// beginLoad must have been called first.
+func loadAll() {
+	if err := loadAliases(); err != nil {
+		log.Printf("%+v\n", err)
+	}
+	if *indexServer != "" {
+		// Frontends look titles up on the index server, so there's nothing
+		// to load.
+		endLoad(nil)
+		return
+	}
+	err := loadIndex()
+	if err == nil {
+		if *categories && !endpointsDisabled("/incategory") {
+			if err := buildCategoryIndex(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *links && !endpointsDisabled("/top", "/path") {
+			if err := buildLinkIndex(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *articles2 != "" && !endpointsDisabled("/versiondiff") {
+			if err := loadSecondDump(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *redirects {
+			if err := buildRedirectIndex(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *timestamps && !endpointsDisabled("/since") {
+			if err := buildTimestampIndex(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *geo && !endpointsDisabled("/nearby") {
+			if err := buildGeoIndex(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *suggest || *disambiguators {
+			buildSuggestIndex()
+		}
+		if !endpointsDisabled("/stats/size") {
+			if err := measureCompressionRatio(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+		if *statsSample > 0 && !endpointsDisabled("/stats") {
+			if err := buildSizeHistogram(); err != nil {
+				log.Printf("%+v\n", err)
+			}
+		}
+	} else {
+		log.Printf("%+v\n", err)
+	}
+	endLoad(err)
+}
+
+type health struct {
+	Ready     bool   `json:"ready"`
+	Loading   bool   `json:"loading"`
+	Entries   int    `json:"entries"`
+	LinesRead int64  `json:"linesRead"`
+	LoadError string `json:"loadError,omitempty"`
+	// Breaker is the state of the circuit breaker on reads of the articles
+	// file: closed, open or half-open.
+	Breaker string `json:"breaker"`
+}
+
+// handlePing serves /ping, a liveness check that responds "pong" without
+// looking at the index or taking any locks, so it keeps responding while the
+// index is loading or the server is busy. /healthz is the readiness check.
+func handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, "pong")
+}
+
+// handleHealthz serves /healthz, which is 200 once an index has been loaded
+// and 503 before then. While a load or reload is running, linesRead reports
+// its progress.
+func handleHealthz(w http.ResponseWriter, r *http.Request) error {
+	mu.Lock()
+	entries := indexLen()
+	mu.Unlock()
+
+	loadState.Lock()
+	h := health{
+		Ready:     loadState.loaded,
+		Loading:   loadState.loading,
+		Entries:   entries,
+		LinesRead: atomic.LoadInt64(&indexLinesRead),
+	}
+	if loadState.err != nil {
+		h.LoadError = loadState.err.Error()
+	}
+	loadState.Unlock()
+	h.Breaker = currentBreakerState().String()
+
+	if !h.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return writeJSON(w, r, h)
+}
+
+type deepHealth struct {
+	health
+	// Article is the title of the article decoded to check the articles
+	// file, and ArticleError why it couldn't be.
+	Article      string `json:"article,omitempty"`
+	ArticleError string `json:"articleError,omitempty"`
+}
+
+// deepHealthCheck is the result of the last sample article decode, reused
+// for -healthCheckTTL.
+var deepHealthCheck = struct {
+	sync.Mutex
+
+	at      time.Time
+	article string
+	err     error
+}{}
+
+// decodeSampleArticle reads and decodes the -healthCheckTitle article, or the
+// first page in the dump, returning its title.
+func decodeSampleArticle() (string, error) {
+	if *healthCheckTitle != "" {
+		meta, err := fetchArticle(*healthCheckTitle)
+		if err != nil {
+			return *healthCheckTitle, err
+		}
+		p, err := readArticle(meta)
+		return p.Title, err
+	}
+	seeks := blockSeeks()
+	if len(seeks) == 0 {
+		return "", errors.Errorf("no blocks in the index")
+	}
+	raw, _, err := readBlockPage(seeks[0], 1, func(n, id int) bool { return true })
+	if err != nil {
+		return "", err
+	}
+	p, err := decodePage(raw)
+	return p.Title, err
+}
+
+// checkSampleArticle returns the result of decodeSampleArticle, decoding it
+// again only once the last result is older than -healthCheckTTL.
+func checkSampleArticle() (string, error) {
+	deepHealthCheck.Lock()
+	defer deepHealthCheck.Unlock()
+
+	if deepHealthCheck.at.IsZero() || time.Since(deepHealthCheck.at) >= *healthCheckTTL {
+		deepHealthCheck.article, deepHealthCheck.err = decodeSampleArticle()
+		deepHealthCheck.at = time.Now()
+	}
+	return deepHealthCheck.article, deepHealthCheck.err
+}
+
+// handleDeepHealthz serves /healthz/deep, which is /healthz that also reads
+// and decodes a sample article, see decodeSampleArticle, and is 503 if it
+// can't be. That catches a missing, truncated or corrupt articles file that
+// the index alone doesn't show. The result is reused for -healthCheckTTL so
+// frequent probes don't each decode the article.
+func handleDeepHealthz(w http.ResponseWriter, r *http.Request) error {
+	mu.Lock()
+	entries := indexLen()
+	mu.Unlock()
+
+	loadState.Lock()
+	h := deepHealth{health: health{
+		Ready:     loadState.loaded,
+		Loading:   loadState.loading,
+		Entries:   entries,
+		LinesRead: atomic.LoadInt64(&indexLinesRead),
+	}}
+	if loadState.err != nil {
+		h.LoadError = loadState.err.Error()
+	}
+	loadState.Unlock()
+
+	if h.Ready {
+		var err error
+		if h.Article, err = checkSampleArticle(); err != nil {
+			h.Ready = false
+			h.ArticleError = err.Error()
+		}
+	}
+	if !h.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return writeJSON(w, r, h)
+}
+
+type loadProgress struct {
+	Loading    bool    `json:"loading"`
+	LinesRead  int64   `json:"linesRead"`
+	BytesRead  int64   `json:"bytesRead"`
+	BytesTotal int64   `json:"bytesTotal"`
+	Fraction   float64 `json:"fraction"`
+	// Elapsed is the number of seconds the load has been running, or took
+	// if it's finished.
+	Elapsed float64 `json:"elapsedSeconds"`
+	// ETA estimates the seconds left assuming the rest of the file is read
+	// as fast as what's been read so far. It's only set while loading.
+	ETA *float64 `json:"etaSeconds,omitempty"`
+}
+
+// handleProgress serves /debug/progress, reporting how far the current or
+// last index load got and, while it's running, when it should finish. It
+// only covers reading the index, not building the derived indexes after it.
+func handleProgress(w http.ResponseWriter, r *http.Request) error {
+	loadState.Lock()
+	p := loadProgress{Loading: loadState.loading}
+	started, finished := loadState.started, loadState.finished
+	loadState.Unlock()
+
+	p.LinesRead = atomic.LoadInt64(&indexLinesRead)
+	p.BytesRead = atomic.LoadInt64(&indexBytesRead)
+	p.BytesTotal = atomic.LoadInt64(&indexBytesTotal)
+	if p.BytesTotal > 0 {
+		p.Fraction = float64(p.BytesRead) / float64(p.BytesTotal)
+	}
+	if !started.IsZero() {
+		end := time.Now()
+		if !p.Loading {
+			end = finished
+		}
+		p.Elapsed = end.Sub(started).Seconds()
+	}
+	if p.Loading && p.BytesRead > 0 && p.BytesTotal > 0 {
+		eta := p.Elapsed * float64(p.BytesTotal-p.BytesRead) / float64(p.BytesRead)
+		p.ETA = &eta
+	}
+	return writeJSON(w, r, p)
+}
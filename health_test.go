@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.txt")
+	if err := ioutil.WriteFile(path, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	loadState.Lock()
+	oldState := loadState.loading
+	loadState.loading = true
+	loadState.started = time.Now().Add(-10 * time.Second)
+	loadState.Unlock()
+	defer func() {
+		loadState.Lock()
+		loadState.loading = oldState
+		loadState.Unlock()
+	}()
+	defer func(read, total int64) { indexBytesRead, indexBytesTotal = read, total }(indexBytesRead, indexBytesTotal)
+	indexBytesRead = 0
+
+	r, err := trackProgress(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 250)); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handle(handleProgress)(w, httptest.NewRequest("GET", "/debug/progress", nil))
+	var p loadProgress
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Loading || p.BytesRead != 250 || p.BytesTotal != 1000 || p.Fraction != 0.25 {
+		t.Errorf("progress = %+v; expected 250 of 1000 bytes read", p)
+	}
+	// A quarter of the file took 10 seconds, so the rest should take 30.
+	if p.ETA == nil || *p.ETA < 29 || *p.ETA > 31 {
+		t.Errorf("ETA = %v; expected about 30s", p.ETA)
+	}
+}
+
+func TestHandlePing(t *testing.T) {
+	// Ping must respond even while the index is locked, as it is during a
+	// reload's swap.
+	mu.Lock()
+	defer mu.Unlock()
+	loadState.Lock()
+	defer loadState.Unlock()
+
+	w := httptest.NewRecorder()
+	handlePing(w, httptest.NewRequest("GET", "/ping", nil))
+	if w.Code != 200 || w.Body.String() != "pong" {
+		t.Errorf("/ping = %d %q; not 200 pong", w.Code, w.Body)
+	}
+}
+
+func TestHandleDeepHealthz(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "A", "a"), testPage(2, "B", "b")})
+	loadState.Lock()
+	oldLoaded := loadState.loaded
+	loadState.loaded = true
+	loadState.Unlock()
+	defer func() {
+		loadState.Lock()
+		loadState.loaded = oldLoaded
+		loadState.Unlock()
+	}()
+	defer func(title string) { *healthCheckTitle = title }(*healthCheckTitle)
+	path := *articlesFile
+
+	for _, c := range []struct {
+		name, title string
+		removed     bool
+		status      int
+		article     string
+	}{
+		{"first page", "", false, 200, "A"},
+		{"configured title", "B", false, 200, "B"},
+		{"missing title", "Nope", false, 503, "Nope"},
+		{"missing articles file", "", true, 503, ""},
+	} {
+		*healthCheckTitle = c.title
+		if c.removed {
+			*articlesFile = path + ".missing"
+		}
+		deepHealthCheck.Lock()
+		deepHealthCheck.at = time.Time{}
+		deepHealthCheck.Unlock()
+
+		w := httptest.NewRecorder()
+		handle(handleDeepHealthz)(w, httptest.NewRequest("GET", "/healthz/deep", nil))
+		*articlesFile = path
+		var h deepHealth
+		if err := json.Unmarshal(w.Body.Bytes(), &h); err != nil {
+			t.Fatalf("%s: %v: %s", c.name, err, w.Body)
+		}
+		if w.Code != c.status || h.Article != c.article || h.Ready != (c.status == 200) || (h.ArticleError != "") == (c.status == 200) {
+			t.Errorf("%s: %d %+v; expected %d for %q", c.name, w.Code, h, c.status, c.article)
+		}
+	}
+
+	// The result is reused until it's older than -healthCheckTTL.
+	*healthCheckTitle = ""
+	deepHealthCheck.Lock()
+	deepHealthCheck.at = time.Time{}
+	deepHealthCheck.Unlock()
+	if _, err := checkSampleArticle(); err != nil {
+		t.Fatal(err)
+	}
+	*articlesFile = path + ".missing"
+	_, err := checkSampleArticle()
+	*articlesFile = path
+	if err != nil {
+		t.Errorf("checkSampleArticle decoded again within -healthCheckTTL: %v", err)
+	}
+}
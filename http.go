@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	jsonEnvelope = flag.Bool("jsonEnvelope", false, `whether to wrap JSON responses as {"data":...,"meta":{"cached":false,"tookMs":N}}`)
+	readTimeout  = flag.Duration("readTimeout", 30*time.Second, "the longest a client may take to send a request, 0 for no limit")
+	writeTimeout = flag.Duration("writeTimeout", 2*time.Minute, "the longest a response may take to write, or for streams the longest between flushes, 0 for no limit")
+	idleTimeout  = flag.Duration("idleTimeout", 2*time.Minute, "how long an idle keep-alive connection is kept open")
+	maxBodyBytes = flag.Int64("maxBodyBytes", 1<<20, "the largest request body POST endpoints accept, larger ones are rejected with a 413")
+
+	disableEndpoints = flag.String("disableEndpoints", "", "the comma separated endpoints to disable, named by their path without the leading slash, such as path,export/articles; a name also disables the endpoints under it, so export disables every /export endpoint")
+)
+
+// maxArticleBytes is the largest an article's text can be, MediaWiki's
+// default $wgMaxArticleSize.
+const maxArticleBytes = 2 << 20
+
+// slowClientBytesPerSecond is the slowest rate a legitimate client is assumed
+// to download at. A -writeTimeout shorter than it takes to send the largest
+// article at this rate would cut off real responses.
+const slowClientBytesPerSecond = 32 << 10
+
+// minWriteTimeout is the shortest -writeTimeout that won't cut off the
+// largest articles for slow clients.
+const minWriteTimeout = maxArticleBytes / slowClientBytesPerSecond * time.Second
+
+// minBodyBytes is the smallest -maxBodyBytes that fits a batch of
+// maxBatchTitles titles of the longest length, quoted and comma separated,
+// with room to spare for the rest of the request.
+const minBodyBytes = maxBatchTitles*(maxTitleBytes+3) + 1<<10
+
+// decodeBody decodes r's JSON body into v, failing with a 413 if it's longer
+// than -maxBodyBytes, so a huge body can't use up memory, and a 400 if it's
+// not valid JSON.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, *maxBodyBytes)).Decode(v); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			return statusErrorf(http.StatusRequestEntityTooLarge, "request body is larger than %d bytes", *maxBodyBytes)
+		}
+		return statusErrorf(http.StatusBadRequest, "invalid request body: %s", err)
+	}
+	return nil
+}
+
+// newHTTPServer returns a server for h on addr with the configured timeouts,
+// so slow or idle clients can't hold connections open indefinitely.
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: *readTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+}
+
+type contextKey int
+
+const startTimeKey contextKey = iota
+
+// withStartTime records when handling r started, unless that's already been
+// recorded by an outer handler.
+func withStartTime(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(startTimeKey).(time.Time); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), startTimeKey, time.Now()))
+}
+
+// routes is every path registered with route, listed by the / index.
+var routes []string
+
+// route registers h for pattern on the default mux, or a 404 if it's one of
+// the -disableEndpoints.
+func route(pattern string, h http.HandlerFunc) {
+	authRoute(pattern)
+	if disableRoute(pattern) {
+		http.HandleFunc(pattern, disabledEndpoint(pattern))
+		return
+	}
+	routes = append(routes, pattern)
+	http.HandleFunc(pattern, h)
+}
+
+// disabledEndpoints is the parsed -disableEndpoints, set by run.
+var disabledEndpoints []string
+
+// usedDisabledEndpoints is the disabledEndpoints that an endpoint has been
+// registered under.
+var usedDisabledEndpoints = map[string]bool{}
+
+// parseEndpointNames parses a comma separated list of endpoint names, like
+// -disableEndpoints.
+func parseEndpointNames(raw string) []string {
+	var names []string
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.Trim(strings.TrimSpace(name), "/"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// endpointsNamed returns the names that name the endpoint at pattern: its
+// path without the leading slash, or any path above it.
+func endpointsNamed(names []string, pattern string) []string {
+	name := strings.TrimPrefix(pattern, "/")
+	var by []string
+	for _, n := range names {
+		if name == n || strings.HasPrefix(name, n+"/") {
+			by = append(by, n)
+		}
+	}
+	return by
+}
+
+// disabledBy returns the disabledEndpoints that disable the endpoint at
+// pattern.
+func disabledBy(pattern string) []string {
+	return endpointsNamed(disabledEndpoints, pattern)
+}
+
+// endpointDisabled reports whether the endpoint at pattern is disabled by
+// -disableEndpoints.
+func endpointDisabled(pattern string) bool {
+	return len(disabledBy(pattern)) > 0
+}
+
+// disableRoute reports whether the endpoint being registered at pattern is
+// disabled, recording the names that disable it as used.
+func disableRoute(pattern string) bool {
+	by := disabledBy(pattern)
+	for _, d := range by {
+		usedDisabledEndpoints[d] = true
+	}
+	return len(by) > 0
+}
+
+// endpointsDisabled reports whether every one of patterns is disabled, so
+// the indexes only they use needn't be built.
+func endpointsDisabled(patterns ...string) bool {
+	for _, pattern := range patterns {
+		if !endpointDisabled(pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+// unusedDisabledEndpoints returns the -disableEndpoints that didn't match any
+// registered endpoint, which are probably typos.
+func unusedDisabledEndpoints() []string {
+	var unused []string
+	for _, name := range disabledEndpoints {
+		if !usedDisabledEndpoints[name] {
+			unused = append(unused, name)
+		}
+	}
+	return unused
+}
+
+// disabledEndpoint responds to a disabled endpoint with a 404.
+func disabledEndpoint(pattern string) http.HandlerFunc {
+	return handle(func(w http.ResponseWriter, r *http.Request) error {
+		return statusErrorf(http.StatusNotFound, "%s is disabled on this server", pattern)
+	})
+}
+
+// handle adapts a handler that returns an error into an http.HandlerFunc.
+// Errors wrapping a statusError are reported with that status code, anything
+// else is a 500.
+func handle(f func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = withStartTime(r)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if err := f(w, r); err != nil {
+			status := errorStatus(err)
+			if _, ok := errors.Cause(err).(statusError); !ok {
+				log.Printf("%s %s: %+v", r.Method, r.URL, err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(struct {
+				Error       string   `json:"error"`
+				Suggestions []string `json:"suggestions,omitempty"`
+			}{err.Error(), suggestionsOf(err)})
+		}
+	}
+}
+
+type responseMeta struct {
+	Cached bool  `json:"cached"`
+	TookMs int64 `json:"tookMs"`
+}
+
+// envelope wraps responses when running with -jsonEnvelope. Errors are never
+// wrapped.
+type envelope struct {
+	Data interface{}  `json:"data"`
+	Meta responseMeta `json:"meta"`
+}
+
+// errorStatus returns the HTTP status for err: the code of the statusError it
+// wraps, or 500.
+func errorStatus(err error) int {
+	if code, ok := errors.Cause(err).(statusError); ok {
+		return int(code)
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON marshals v and writes it as the response body, indented if the
+// request has ?pretty=true.
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return writeJSONMeta(w, r, v, false)
+}
+
+// writeJSONMeta is writeJSON for a response that may have come from a cache.
+func writeJSONMeta(w http.ResponseWriter, r *http.Request, v interface{}, cached bool) error {
+	if *jsonEnvelope {
+		meta := responseMeta{Cached: cached}
+		if start, ok := r.Context().Value(startTimeKey).(time.Time); ok {
+			meta.TookMs = time.Since(start).Milliseconds()
+		}
+		v = envelope{Data: v, Meta: meta}
+	}
+	v, err := restyleJSON(v)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		body, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		body, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(body)
+	return err
+}
+
+// intParam parses the query parameter key as an int, returning def when it
+// isn't set and a 400 when it isn't a number in [min, max].
+func intParam(r *http.Request, key string, def, min, max int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, statusErrorf(http.StatusBadRequest, "invalid %s %q", key, raw)
+	}
+	if v < min || v > max {
+		return 0, statusErrorf(http.StatusBadRequest, "%s must be between %d and %d, got %d", key, min, max, v)
+	}
+	return v, nil
+}
+
+// floatParam parses the required float query parameter key, which must be
+// between min and max.
+func floatParam(r *http.Request, key string, min, max float64) (float64, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return 0, statusErrorf(http.StatusBadRequest, "%s is required", key)
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, statusErrorf(http.StatusBadRequest, "invalid %s %q", key, raw)
+	}
+	if v < min || v > max {
+		return 0, statusErrorf(http.StatusBadRequest, "%s must be between %g and %g, got %g", key, min, max, v)
+	}
+	return v, nil
+}
+
+// selectFields projects v down to the comma separated JSON field names in the
+// fields query parameter, returning v unchanged if it isn't set and a 400 if
+// it names a field v's type doesn't have. Fields that are left out of this v
+// because they're empty, like an article's qualityFlag, are null. Fields are
+// named in the -jsonKeyStyle.
+func selectFields(r *http.Request, v interface{}) (interface{}, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return v, nil
+	}
+	known := knownFields(v)
+	v, err := restyleJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(body, &all); err != nil {
+		return nil, err
+	}
+	for k := range all {
+		known[k] = true
+	}
+	selected := map[string]interface{}{}
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !known[field] {
+			names := make([]string, 0, len(known))
+			for k := range known {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return nil, statusErrorf(http.StatusBadRequest, "unknown field %q, expected one of %s", field, strings.Join(names, ", "))
+		}
+		selected[field] = all[field]
+	}
+	return selected, nil
+}
+
+// knownFields returns the JSON keys of v's struct type in the -jsonKeyStyle,
+// whether or not they're empty in v, or none if v isn't a struct.
+func knownFields(v interface{}) map[string]bool {
+	known := map[string]bool{}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return known
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return known
+	}
+	fields := map[string]reflect.Value{}
+	jsonFields(val, fields)
+	for name := range fields {
+		if *jsonKeyStyle != "" {
+			name = restyleKey(name, *jsonKeyStyle)
+		}
+		known[name] = true
+	}
+	return known
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSelectFields(t *testing.T) {
+	p := testPage(1, "Foo", "Bar")
+
+	r := httptest.NewRequest("GET", "/article?title=Foo&fields=title,%20id,timestamp", nil)
+	got, err := selectFields(r, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"title": "Foo", "id": float64(1), "timestamp": p.Timestamp}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectFields = %#v; not %#v", got, want)
+	}
+
+	r = httptest.NewRequest("GET", "/article?title=Foo", nil)
+	if got, err := selectFields(r, p); err != nil || !reflect.DeepEqual(got, p) {
+		t.Errorf("selectFields without fields = %#v, %v; expected the page unchanged", got, err)
+	}
+
+	for _, fields := range []string{"title,bogus", "Username"} {
+		r = httptest.NewRequest("GET", "/article?title=Foo&fields="+fields, nil)
+		_, err := selectFields(r, p)
+		if code, ok := errors.Cause(err).(statusError); !ok || code != http.StatusBadRequest {
+			t.Errorf("selectFields(%q) = %v; expected a 400", fields, err)
+		}
+	}
+}
+
+func TestSelectEmptyFields(t *testing.T) {
+	defer func(old string) { *jsonKeyStyle = old }(*jsonKeyStyle)
+	article := articleResponse{page: testPage(1, "Foo", "Bar")}
+	for _, c := range []struct {
+		style, fields string
+		want          map[string]interface{}
+	}{
+		{"", "title,qualityFlag,shortDescription,redirectedFrom,aliases", map[string]interface{}{
+			"title": "Foo", "qualityFlag": nil, "shortDescription": nil, "redirectedFrom": nil, "aliases": nil,
+		}},
+		{keyStyleSnake, "title,redirected_from", map[string]interface{}{"title": "Foo", "redirected_from": nil}},
+	} {
+		*jsonKeyStyle = c.style
+		r := httptest.NewRequest("GET", "/article?title=Foo&fields="+c.fields, nil)
+		got, err := selectFields(r, article)
+		if err != nil {
+			t.Errorf("%s: %v; expected the empty fields to be null", c.fields, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: selectFields = %#v; not %#v", c.fields, got, c.want)
+		}
+	}
+
+	*jsonKeyStyle = keyStyleSnake
+	r := httptest.NewRequest("GET", "/article?title=Foo&fields=redirectedFrom", nil)
+	if _, err := selectFields(r, article); err == nil {
+		t.Error("expected a field named in another key style to be a 400")
+	}
+}
+
+func TestJSONEnvelope(t *testing.T) {
+	defer func(old bool) { *jsonEnvelope = old }(*jsonEnvelope)
+
+	write := func(h http.HandlerFunc, key string) string {
+		r := httptest.NewRequest("GET", "/thing", nil)
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Body.String()
+	}
+	h := idempotent(handle(func(w http.ResponseWriter, r *http.Request) error {
+		return writeJSON(w, r, map[string]int{"a": 1})
+	}))
+
+	*jsonEnvelope = false
+	if got, want := write(h, "bare"), `{"a":1}`; got != want {
+		t.Errorf("bare response = %s; not %s", got, want)
+	}
+
+	*jsonEnvelope = true
+	want := `{"data":{"a":1},"meta":{"cached":false,"tookMs":`
+	if got := write(h, "wrapped"); !strings.HasPrefix(got, want) {
+		t.Errorf("wrapped response = %s; expected it to start with %s", got, want)
+	}
+	want = `{"data":{"a":1},"meta":{"cached":true,"tookMs":`
+	if got := write(h, "wrapped"); !strings.HasPrefix(got, want) {
+		t.Errorf("replayed response = %s; expected it to start with %s", got, want)
+	}
+}
+
+func TestIdempotentReplayEncoding(t *testing.T) {
+	h := compressed(idempotent(handle(func(w http.ResponseWriter, r *http.Request) error {
+		return writeJSON(w, r, map[string]int{"a": 1})
+	})))
+	get := func(encoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/thing", nil)
+		r.Header.Set("Idempotency-Key", "encoding")
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get("gzip"); w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("first response Content-Encoding = %q; not gzip", w.Header().Get("Content-Encoding"))
+	}
+	w := get("")
+	if got := w.Header().Get("X-Idempotency-Cache"); got != "hit" {
+		t.Fatalf("retry X-Idempotency-Cache = %q; not hit", got)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("identity retry Content-Encoding = %q; expected none", got)
+	}
+	if got, want := w.Body.String(), `{"a":1}`; got != want {
+		t.Errorf("identity retry body = %q; not %s", got, want)
+	}
+	if got := w.Header()["Vary"]; len(got) != 1 {
+		t.Errorf("identity retry Vary = %q; expected Accept-Encoding once", got)
+	}
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	s := newHTTPServer(":0", http.NotFoundHandler())
+	if s.ReadTimeout != *readTimeout || s.WriteTimeout != *writeTimeout || s.IdleTimeout != *idleTimeout {
+		t.Errorf("server timeouts = %s, %s, %s; not the flag values", s.ReadTimeout, s.WriteTimeout, s.IdleTimeout)
+	}
+	if *writeTimeout < minWriteTimeout {
+		t.Errorf("default -writeTimeout %s is shorter than the minimum %s", *writeTimeout, minWriteTimeout)
+	}
+}
+
+func TestStreamOutlastsWriteTimeout(t *testing.T) {
+	defer func(d time.Duration) { *writeTimeout = d }(*writeTimeout)
+	*writeTimeout = 200 * time.Millisecond
+
+	const lines = 6
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newHTTPServer("", compressed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nw := newNDJSONWriter(w)
+		for i := 0; i < lines; i++ {
+			if err := nw.encode(i); err != nil {
+				return
+			}
+			if err := nw.flush(); err != nil {
+				return
+			}
+			time.Sleep(*writeTimeout / 2)
+		}
+	})))
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if n := strings.Count(string(body), "\n"); err != nil || n != lines {
+		t.Errorf("read %d lines, %v; expected all %d, the stream taking longer than -writeTimeout but flushing more often", n, err, lines)
+	}
+}
+
+func TestDisableEndpoints(t *testing.T) {
+	defer func(disabled []string, used map[string]bool) {
+		disabledEndpoints, usedDisabledEndpoints = disabled, used
+	}(disabledEndpoints, usedDisabledEndpoints)
+	disabledEndpoints = parseEndpointNames(" path, /export ,search/phrase,,nope")
+	usedDisabledEndpoints = map[string]bool{}
+	if want := []string{"path", "export", "search/phrase", "nope"}; !reflect.DeepEqual(disabledEndpoints, want) {
+		t.Fatalf("parseEndpointNames = %q; not %q", disabledEndpoints, want)
+	}
+
+	for _, c := range []struct {
+		pattern  string
+		disabled bool
+	}{
+		{"/path", true},
+		{"/pathological", false},
+		{"/export/articles", true},
+		{"/export/offsets.bin", true},
+		{"/search/phrase", true},
+		{"/search/count", false},
+		{"/search", false},
+		{"/article", false},
+	} {
+		if got := disableRoute(c.pattern); got != c.disabled {
+			t.Errorf("disableRoute(%q) = %v; not %v", c.pattern, got, c.disabled)
+		}
+	}
+	if unused := unusedDisabledEndpoints(); !reflect.DeepEqual(unused, []string{"nope"}) {
+		t.Errorf("unusedDisabledEndpoints() = %q; expected nope", unused)
+	}
+	if !endpointsDisabled("/path", "/export/titles") || endpointsDisabled("/path", "/top") {
+		t.Error("endpointsDisabled should only be true if every endpoint is disabled")
+	}
+
+	w := httptest.NewRecorder()
+	disabledEndpoint("/path")(w, httptest.NewRequest("GET", "/path?from=A&to=B", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "/path is disabled") {
+		t.Errorf("disabled endpoint = %d: %s; expected a 404 saying it's disabled", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handle(handleSpec)(w, httptest.NewRequest("GET", "/api/spec", nil))
+	if strings.Contains(w.Body.String(), `"/path"`) || !strings.Contains(w.Body.String(), `"/search/count"`) {
+		t.Error("/api/spec should list every endpoint but the disabled ones")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"time"
+)
+
+var (
+	idempotencyTTL       = flag.Duration("idempotencyTTL", 5*time.Minute, "how long responses are kept for replay by Idempotency-Key")
+	idempotencyCacheSize = flag.Int("idempotencyCacheSize", 1000, "the maximum number of responses kept for replay by Idempotency-Key")
+)
+
+// idempotencyCache is recreated with the configured size by run.
+var idempotencyCache = newLRUCache(*idempotencyCacheSize)
+
+// negotiatedHeaders are set by the layers around a handler for each request,
+// like compressed's Content-Encoding, so they're left out of cached responses
+// and set again for the replay's own request.
+var negotiatedHeaders = []string{"Content-Encoding", "Content-Length", "Vary"}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// responseRecorder passes writes through to the underlying ResponseWriter
+// while keeping a copy of the status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent wraps an expensive handler so that a client retrying a request
+// with the same Idempotency-Key header gets the original response replayed
+// instead of the work being redone. Replayed responses have the
+// X-Idempotency-Cache: hit header set. Server errors aren't kept so they can
+// be retried.
+func idempotent(f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			f(w, r)
+			return
+		}
+		r = withStartTime(r)
+		cacheKey := r.Method + " " + r.URL.String() + " " + key
+		if v, ok := idempotencyCache.get(cacheKey); ok {
+			resp := v.(cachedResponse)
+			if time.Now().Before(resp.expires) {
+				for k, v := range resp.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("X-Idempotency-Cache", "hit")
+				replay(w, r, resp)
+				return
+			}
+		}
+
+		w.Header().Set("X-Idempotency-Cache", "miss")
+		rec := &responseRecorder{ResponseWriter: w}
+		f(rec, r)
+		if rec.status == 0 || rec.status >= 500 {
+			return
+		}
+		header := w.Header().Clone()
+		for _, k := range negotiatedHeaders {
+			header.Del(k)
+		}
+		idempotencyCache.add(cacheKey, cachedResponse{
+			status:  rec.status,
+			header:  header,
+			body:    rec.body.Bytes(),
+			expires: time.Now().Add(*idempotencyTTL),
+		})
+	}
+}
+
+// replay writes a cached response. With -jsonEnvelope, successful responses
+// are rewrapped so the metadata describes the replay rather than the
+// original request.
+func replay(w http.ResponseWriter, r *http.Request, resp cachedResponse) {
+	if *jsonEnvelope && resp.status == http.StatusOK {
+		var original struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(resp.body, &original); err == nil && original.Data != nil {
+			writeJSONMeta(w, r, original.Data, true)
+			return
+		}
+	}
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
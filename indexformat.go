@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	indexFormat = flag.String("indexFormat", "seek:id:title",
+		"the columns of each index line separated by colons or commas, must include seek, id and title, use - to ignore a column")
+	indexDelim = flag.String("indexDelim", ":", "the delimiter between columns of an index line")
+)
+
+// indexLayout describes which column of an index line holds which field.
+type indexLayout struct {
+	delim           string
+	seek, id, title int
+	columns         int
+}
+
+var defaultIndexLayout = indexLayout{delim: ":", seek: 0, id: 1, title: 2, columns: 3}
+
+// layout is the parsed -indexFormat, set by run.
+var layout = defaultIndexLayout
+
+// parseIndexFormat parses a format such as "seek:id:title" into a layout.
+func parseIndexFormat(format, delim string) (indexLayout, error) {
+	if delim == "" {
+		return indexLayout{}, errors.Errorf("index delimiter must not be empty")
+	}
+	columns := strings.FieldsFunc(format, func(r rune) bool {
+		return r == ':' || r == ','
+	})
+	l := indexLayout{delim: delim, seek: -1, id: -1, title: -1, columns: len(columns)}
+	for i, col := range columns {
+		var field *int
+		switch strings.TrimSpace(col) {
+		case "seek":
+			field = &l.seek
+		case "id":
+			field = &l.id
+		case "title":
+			field = &l.title
+		case "-":
+			continue
+		default:
+			return indexLayout{}, errors.Errorf("unknown index column %q in format %q", col, format)
+		}
+		if *field >= 0 {
+			return indexLayout{}, errors.Errorf("index column %q appears more than once in format %q", col, format)
+		}
+		*field = i
+	}
+	for name, i := range map[string]int{"seek": l.seek, "id": l.id, "title": l.title} {
+		if i < 0 {
+			return indexLayout{}, errors.Errorf("index format %q is missing the %s column", format, name)
+		}
+	}
+	return l, nil
+}
+
+// parseLine splits an index line into its fields. Titles may contain the
+// delimiter, so the title is everything between the columns before and after
+// it.
+func (l indexLayout) parseLine(line string) (seek, id int, title string, err error) {
+	parts := strings.Split(line, l.delim)
+	if len(parts) < l.columns {
+		return 0, 0, "", errors.Errorf("expected at least %d parts, got: %#v", l.columns, parts)
+	}
+	after := l.columns - l.title - 1
+	title = strings.Join(parts[l.title:len(parts)-after], l.delim)
+	column := func(i int) string {
+		if i > l.title {
+			return parts[len(parts)-(l.columns-i)]
+		}
+		return parts[i]
+	}
+	seek, err = strconv.Atoi(column(l.seek))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	id, err = strconv.Atoi(column(l.id))
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return seek, id, title, nil
+}
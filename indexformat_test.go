@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestIndexLayout(t *testing.T) {
+	cases := []struct {
+		format, delim, line string
+		seek, id            int
+		title               string
+	}{
+		{"seek:id:title", ":", "10:1:Foo", 10, 1, "Foo"},
+		{"seek:id:title", ":", "10:1:Foo: Bar", 10, 1, "Foo: Bar"},
+		{"id,seek,title", "\t", "1\t10\tFoo\tBar", 10, 1, "Foo\tBar"},
+		{"title:-:id:seek", "|", "Foo|Bar|x|1|10", 10, 1, "Foo|Bar"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.format+"/"+c.line, func(t *testing.T) {
+			l, err := parseIndexFormat(c.format, c.delim)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seek, id, title, err := l.parseLine(c.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seek != c.seek || id != c.id || title != c.title {
+				t.Errorf("parseLine(%q) = %d, %d, %q; not %d, %d, %q", c.line, seek, id, title, c.seek, c.id, c.title)
+			}
+		})
+	}
+}
+
+func TestParseIndexFormatErrors(t *testing.T) {
+	for _, format := range []string{"seek:id", "seek:id:title:id", "seek:id:name", ""} {
+		if _, err := parseIndexFormat(format, ":"); err == nil {
+			t.Errorf("parseIndexFormat(%q) should fail", format)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var jsonKeyStyle = flag.String("jsonKeyStyle", "", "rename the keys of JSON responses to camel (revisionId) or snake (revision_id) case, by default they're left as they are (revisionID)")
+
+const (
+	keyStyleCamel = "camel"
+	keyStyleSnake = "snake"
+)
+
+func validKeyStyle(style string) bool {
+	return style == "" || style == keyStyleCamel || style == keyStyleSnake
+}
+
+// keyWords splits a key into its words at underscores, hyphens and changes of
+// case, keeping initialisms together, so revisionID is revision and ID, and
+// XMLName is XML and Name.
+func keyWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := 0
+	for i, c := range runes {
+		if c == '_' || c == '-' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(c) {
+			continue
+		}
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if !unicode.IsUpper(prev) || nextLower {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// restyleKey renames key to style.
+func restyleKey(key, style string) string {
+	words := keyWords(key)
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if style == keyStyleCamel && i > 0 {
+			w = upperFirst(w)
+		}
+		words[i] = w
+	}
+	if style == keyStyleSnake {
+		return strings.Join(words, "_")
+	}
+	return strings.Join(words, "")
+}
+
+// restyleJSON returns v with the keys of its structs renamed to the
+// -jsonKeyStyle, or v itself if it isn't set. It's remarshaled through
+// encoding/json so the result is exactly what v marshals to but for the keys.
+// Map keys are data, like titles and section names, so they're left alone.
+func restyleJSON(v interface{}) (interface{}, error) {
+	if *jsonKeyStyle == "" {
+		return v, nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return restyleTree(reflect.ValueOf(v), tree, *jsonKeyStyle), nil
+}
+
+// restyleTree renames the keys of tree, the decoded JSON of val, that came
+// from val's struct fields. val tells struct fields from map keys.
+func restyleTree(val reflect.Value, tree interface{}, style string) interface{} {
+	for val.IsValid() && (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface) {
+		if val.IsNil() {
+			return tree
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() {
+		return tree
+	}
+
+	switch tree := tree.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tree))
+		switch val.Kind() {
+		case reflect.Struct:
+			fields := map[string]reflect.Value{}
+			jsonFields(val, fields)
+			for k, sub := range tree {
+				if f, ok := fields[k]; ok {
+					out[restyleKey(k, style)] = restyleTree(f, sub, style)
+				} else {
+					out[k] = sub
+				}
+			}
+		case reflect.Map:
+			elems := map[string]reflect.Value{}
+			iter := val.MapRange()
+			for iter.Next() {
+				elems[jsonMapKey(iter.Key())] = iter.Value()
+			}
+			for k, sub := range tree {
+				out[k] = restyleTree(elems[k], sub, style)
+			}
+		default:
+			return tree
+		}
+		return out
+	case []interface{}:
+		if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+			return tree
+		}
+		out := make([]interface{}, len(tree))
+		for i, sub := range tree {
+			if i < val.Len() {
+				sub = restyleTree(val.Index(i), sub, style)
+			}
+			out[i] = sub
+		}
+		return out
+	}
+	return tree
+}
+
+// jsonFields adds the fields of the struct val to fields by their JSON keys,
+// including those promoted from embedded structs. Shallower fields win, as
+// with encoding/json.
+func jsonFields(val reflect.Value, fields map[string]reflect.Value) {
+	t := val.Type()
+	var embedded []reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			embedded = append(embedded, val.Field(i))
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = val.Field(i)
+		}
+	}
+	for _, e := range embedded {
+		for e.Kind() == reflect.Ptr && !e.IsNil() {
+			e = e.Elem()
+		}
+		if e.Kind() == reflect.Struct {
+			promoted := map[string]reflect.Value{}
+			jsonFields(e, promoted)
+			for name, f := range promoted {
+				if _, ok := fields[name]; !ok {
+					fields[name] = f
+				}
+			}
+		}
+	}
+}
+
+// jsonMapKey formats a map key the way encoding/json does.
+func jsonMapKey(k reflect.Value) string {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	if m, ok := k.Interface().(interface{ MarshalText() ([]byte, error) }); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestyleKey(t *testing.T) {
+	cases := []struct {
+		in, camel, snake string
+	}{
+		{"revisionID", "revisionId", "revision_id"},
+		{"ns", "ns", "ns"},
+		{"pageType", "pageType", "page_type"},
+		{"XMLName", "xmlName", "xml_name"},
+		{"elapsedSeconds", "elapsedSeconds", "elapsed_seconds"},
+		{"page_type", "pageType", "page_type"},
+		{"ID", "id", "id"},
+		{"onlyA", "onlyA", "only_a"},
+	}
+	for _, c := range cases {
+		if got := restyleKey(c.in, keyStyleCamel); got != c.camel {
+			t.Errorf("restyleKey(%q, camel) = %q; not %q", c.in, got, c.camel)
+		}
+		if got := restyleKey(c.in, keyStyleSnake); got != c.snake {
+			t.Errorf("restyleKey(%q, snake) = %q; not %q", c.in, got, c.snake)
+		}
+	}
+}
+
+func TestRestyleJSON(t *testing.T) {
+	defer func(old string) { *jsonKeyStyle = old }(*jsonKeyStyle)
+
+	type inner struct {
+		WordCount int `json:"wordCount"`
+	}
+	type outer struct {
+		inner
+		RevisionID string            `json:"revisionID"`
+		Anchors    map[string]string `json:"anchors"`
+		Errors     map[int]string    `json:"errors"`
+		Nested     []*inner          `json:"nested"`
+		Any        interface{}       `json:"any"`
+		Skipped    string            `json:"-"`
+	}
+	v := outer{
+		inner:      inner{WordCount: 2},
+		RevisionID: "12",
+		Anchors:    map[string]string{"Early life": "Early_life"},
+		Errors:     map[int]string{3: "not found"},
+		Nested:     []*inner{{WordCount: 1}, nil},
+		Any:        map[string]inner{"someKey": {WordCount: 4}},
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	for _, c := range []struct {
+		style, want string
+	}{
+		{"", `{"wordCount":2,"revisionID":"12","anchors":{"Early life":"Early_life"},"errors":{"3":"not found"},"nested":[{"wordCount":1},null],"any":{"someKey":{"wordCount":4}}}`},
+		{keyStyleCamel, `{"anchors":{"Early life":"Early_life"},"any":{"someKey":{"wordCount":4}},"errors":{"3":"not found"},"nested":[{"wordCount":1},null],"revisionId":"12","wordCount":2}`},
+		{keyStyleSnake, `{"anchors":{"Early life":"Early_life"},"any":{"someKey":{"word_count":4}},"errors":{"3":"not found"},"nested":[{"word_count":1},null],"revision_id":"12","word_count":2}`},
+	} {
+		*jsonKeyStyle = c.style
+		w := httptest.NewRecorder()
+		if err := writeJSON(w, r, v); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Body.String(); got != c.want {
+			t.Errorf("%q: got %s; not %s", c.style, got, c.want)
+		}
+	}
+}
+
+func TestRestyleJSONSelectFields(t *testing.T) {
+	defer func(old string) { *jsonKeyStyle = old }(*jsonKeyStyle)
+	*jsonKeyStyle = keyStyleSnake
+
+	r := httptest.NewRequest("GET", "/?fields=title,revision_id", nil)
+	got, err := selectFields(r, testPage(1, "Foo", "text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := writeJSON(w, r, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"revision_id":"1000Foo","title":"Foo"}`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got %s; not %s", w.Body, want)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/creachadair/cityhash"
+)
+
+var links = flag.Bool("links", false, "whether or not to build the link graph index, requires decoding every article")
+
+// maxTopLinked is the number of most linked to articles kept precomputed.
+const maxTopLinked = 1000
+
+type linkCount struct {
+	Title    string `json:"title"`
+	InDegree int    `json:"inDegree"`
+}
+
+// linkIndex holds the wiki link graph between articles, keyed by title hash.
+// It is only populated when running with -links since building it requires
+// decoding every article in the dump.
+var linkIndex = struct {
+	sync.Mutex
+
+	built bool
+	// generation is incremented whenever the index is rebuilt.
+	generation int
+	titles     map[uint64]string
+	outgoing   map[uint64][]uint64
+	incoming   map[uint64][]uint64
+	top        []linkCount
+}{}
+
+func buildLinkIndex() error {
+	log.Printf("Building link index...")
+	titles := map[uint64]string{}
+	outgoing := map[uint64][]uint64{}
+	incoming := map[uint64][]uint64{}
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		hash := cityhash.Hash64([]byte(p.Title))
+		titles[hash] = p.Title
+		for _, link := range extractLinks(p.Text) {
+			target := cityhash.Hash64([]byte(link))
+			outgoing[hash] = append(outgoing[hash], target)
+			incoming[target] = append(incoming[target], hash)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Only articles that exist in the dump are ranked, links to missing pages
+	// are dropped.
+	var top []linkCount
+	for hash, sources := range incoming {
+		title, ok := titles[hash]
+		if !ok {
+			continue
+		}
+		top = append(top, linkCount{Title: title, InDegree: len(sources)})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].InDegree != top[j].InDegree {
+			return top[i].InDegree > top[j].InDegree
+		}
+		return top[i].Title < top[j].Title
+	})
+	if len(top) > maxTopLinked {
+		top = top[:maxTopLinked]
+	}
+
+	linkIndex.Lock()
+	linkIndex.built = true
+	linkIndex.generation++
+	linkIndex.titles = titles
+	linkIndex.outgoing = outgoing
+	linkIndex.incoming = incoming
+	linkIndex.top = top
+	linkIndex.Unlock()
+
+	log.Printf("Done building link index! %d articles", len(titles))
+	return nil
+}
+
+// handleTop serves /top?limit=N, returning the articles with the most incoming
+// links.
+func handleTop(w http.ResponseWriter, r *http.Request) error {
+	if !*links {
+		return statusErrorf(http.StatusServiceUnavailable, "link index disabled, start with -links")
+	}
+	limit, err := intParam(r, "limit", 50, 1, maxTopLinked)
+	if err != nil {
+		return err
+	}
+
+	linkIndex.Lock()
+	built, top := linkIndex.built, linkIndex.top
+	linkIndex.Unlock()
+
+	if !built {
+		return statusErrorf(http.StatusServiceUnavailable, "link index is still being built")
+	}
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return writeJSON(w, r, top)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/creachadair/cityhash"
+	"golang.org/x/text/unicode/norm"
+)
+
+// lookupAttempt is one title tried against the index.
+type lookupAttempt struct {
+	// Form names the variant, see titleVariants, and NFC whether it's of
+	// the query's NFC normalized form, which lookups don't try.
+	Form  string `json:"form"`
+	NFC   bool   `json:"nfc,omitempty"`
+	Title string `json:"title"`
+	// Hash is the title's cityhash as a decimal string, since JSON numbers
+	// can't hold every uint64.
+	Hash string `json:"hash"`
+	// Hit is "offsets" or "found" for a hit in the index or in the titles
+	// found by -fullScanFallback, and empty for a miss.
+	Hit  string `json:"hit,omitempty"`
+	Seek *int   `json:"seek,omitempty"`
+	ID   *int   `json:"id,omitempty"`
+}
+
+type lookupTrace struct {
+	Query string `json:"query"`
+	// Error is why the query was rejected before any lookup.
+	Error string `json:"error,omitempty"`
+	// Alias is the -aliasFile target the query was looked up as.
+	Alias    string          `json:"alias,omitempty"`
+	Attempts []lookupAttempt `json:"attempts"`
+	// Found is whether a lookup would find the title in the index. A
+	// -fullScanFallback might still find it in the dump if not.
+	Found bool `json:"found"`
+}
+
+// variantForms name the titleVariants in order.
+var variantForms = []string{"as given", "capitalized", "title case"}
+
+// traceVariants tries each of titleVariants(name) against the index, as
+// lookupTitle does, but without stopping at the first hit.
+func traceVariants(name string, nfc bool) []lookupAttempt {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var attempts []lookupAttempt
+	for i, variant := range titleVariants(name) {
+		hash := cityhash.Hash64([]byte(variant))
+		a := lookupAttempt{Form: variantForms[i], NFC: nfc, Title: variant, Hash: strconv.FormatUint(hash, 10)}
+		entry, ok := currentOffsets().lookup(hash)
+		if ok {
+			a.Hit = "offsets"
+		} else if entry, ok = mu.found[hash]; ok {
+			a.Hit = "found"
+		}
+		if ok {
+			a.Seek, a.ID = &entry.seek, &entry.id
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts
+}
+
+// handleLookupTrace serves /debug/lookup-trace?title=..., showing how a title
+// is looked up: whether it's valid, the alias it's resolved to if any, and
+// each variant tried with its hash and whether it's in the index, for
+// finding out why an article isn't found. If the query isn't NFC normalized
+// the variants of its NFC form are listed too, since dumps' titles are NFC
+// but lookups take the query as it is. It's only available with -debug, and
+// always traces the local index, even with -indexServer.
+func handleLookupTrace(w http.ResponseWriter, r *http.Request) error {
+	if !*debug {
+		return statusErrorf(http.StatusForbidden, "/debug/lookup-trace is only available with -debug")
+	}
+	trace := lookupTrace{Query: r.URL.Query().Get("title"), Attempts: []lookupAttempt{}}
+	name, err := validateTitle(trace.Query)
+	if err != nil {
+		trace.Error = err.Error()
+		return writeJSON(w, r, trace)
+	}
+	if target := resolveAlias(name); target != name {
+		trace.Alias, name = target, target
+	}
+	trace.Attempts = traceVariants(name, false)
+	for _, a := range trace.Attempts {
+		if a.Hit != "" {
+			trace.Found = true
+		}
+	}
+	if nfc := norm.NFC.String(name); nfc != name {
+		trace.Attempts = append(trace.Attempts, traceVariants(nfc, true)...)
+	}
+	return writeJSON(w, r, trace)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHandleLookupTrace(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Café", "coffee"), testPage(2, "Rock Music", "music")})
+	defer func(d bool) { *debug = d }(*debug)
+
+	get := func(title string) (int, lookupTrace) {
+		w := httptest.NewRecorder()
+		handle(handleLookupTrace)(w, httptest.NewRequest("GET", "/debug/lookup-trace?title="+url.QueryEscape(title), nil))
+		var trace lookupTrace
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &trace); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, trace
+	}
+
+	*debug = false
+	if code, _ := get("Café"); code != http.StatusForbidden {
+		t.Errorf("status without -debug = %d; not 403", code)
+	}
+	*debug = true
+
+	for _, c := range []struct {
+		title string
+		found bool
+		// hits is the Hit of each attempt.
+		hits []string
+	}{
+		{"Café", true, []string{"offsets", "offsets", "offsets"}},
+		{"rock music", true, []string{"", "", "offsets"}},
+		{"Nope", false, []string{"", "", ""}},
+		// An e followed by a combining acute accent, which is Café once
+		// NFC normalized.
+		{"Café", false, []string{"", "", "", "offsets", "offsets", "offsets"}},
+		{"", false, nil},
+	} {
+		code, trace := get(c.title)
+		if code != http.StatusOK {
+			t.Errorf("%q: status = %d", c.title, code)
+			continue
+		}
+		if trace.Found != c.found || len(trace.Attempts) != len(c.hits) {
+			t.Errorf("%q: trace = %+v; expected found %v with %d attempts", c.title, trace, c.found, len(c.hits))
+			continue
+		}
+		for i, a := range trace.Attempts {
+			if a.Hit != c.hits[i] || a.Hash == "" || (a.Hit != "" && (a.Seek == nil || a.ID == nil)) {
+				t.Errorf("%q: attempt %d = %+v; expected hit %q", c.title, i, a, c.hits[i])
+			}
+		}
+	}
+}
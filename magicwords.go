@@ -0,0 +1,42 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// magicWordRegexp matches the variable magic words resolveMagicWords
+// substitutes. Variables are case sensitive, and one with an argument, like
+// {{PAGENAME:Foo}}, is a parser function that's left alone.
+var magicWordRegexp = regexp.MustCompile(`\{\{\s*(PAGENAME|FULLPAGENAME|NAMESPACE|PAGEID|REVISIONID|CURRENTYEAR)\s*\}\}`)
+
+// resolveMagicWords substitutes the variable magic words in text, the text
+// of p, that only depend on p or the date: {{PAGENAME}}, {{FULLPAGENAME}},
+// {{NAMESPACE}}, {{PAGEID}}, {{REVISIONID}} and {{CURRENTYEAR}}, which is the
+// year the text is rendered in, as it is on the wiki. Anything else in
+// braces is left for the templates to be stripped with.
+func resolveMagicWords(text string, p page) string {
+	namespace, name := "", p.Title
+	if namespaceForTitle(p.Title) != 0 {
+		i := strings.IndexByte(p.Title, ':')
+		namespace, name = p.Title[:i], p.Title[i+1:]
+	}
+	return magicWordRegexp.ReplaceAllStringFunc(text, func(m string) string {
+		switch magicWordRegexp.FindStringSubmatch(m)[1] {
+		case "PAGENAME":
+			return name
+		case "FULLPAGENAME":
+			return p.Title
+		case "NAMESPACE":
+			return namespace
+		case "PAGEID":
+			return strconv.Itoa(p.ID)
+		case "REVISIONID":
+			return p.RevisionID
+		default:
+			return strconv.Itoa(time.Now().UTC().Year())
+		}
+	})
+}
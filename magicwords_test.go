@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResolveMagicWords(t *testing.T) {
+	p := testPage(42, "Help:Editing", "")
+	year := strconv.Itoa(time.Now().UTC().Year())
+	cases := []struct {
+		text, want string
+	}{
+		{"{{PAGENAME}} is a page", "Editing is a page"},
+		{"{{ FULLPAGENAME }} in {{NAMESPACE}}", "Help:Editing in Help"},
+		{"id {{PAGEID}}, revision {{REVISIONID}}", "id 42, revision 1000Help:Editing"},
+		{"(c) {{CURRENTYEAR}}", "(c) " + year},
+		{"{{pagename}} {{PAGENAME:Foo}} {{#if:x|y}}", "{{pagename}} {{PAGENAME:Foo}} {{#if:x|y}}"},
+		{"{{Infobox|name={{PAGENAME}}}}", "{{Infobox|name=Editing}}"},
+	}
+	for _, c := range cases {
+		if got := resolveMagicWords(c.text, p); got != c.want {
+			t.Errorf("resolveMagicWords(%q) = %q; not %q", c.text, got, c.want)
+		}
+	}
+
+	main := testPage(1, "Albert Einstein", "'''{{PAGENAME}}''' was a physicist.{{Cite web|title={{PAGENAME}}}}\n__NOTOC__\n__NOINDEX__")
+	if got, want := formats["plain"].render(main, renderOptions{}), "Albert Einstein was a physicist."; got != want {
+		t.Errorf("plain = %q; not %q", got, want)
+	}
+	if got := resolveMagicWords("{{NAMESPACE}}", main); got != "" {
+		t.Errorf("{{NAMESPACE}} in the main namespace = %q; expected empty", got)
+	}
+}
@@ -2,96 +2,441 @@ package main
 
 import (
 	"bufio"
-	"compress/bzip2"
-	"encoding/json"
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
 	"flag"
 	"fmt"
+	"github.com/andybalholm/brotli"
 	"github.com/blevesearch/bleve"
 	"github.com/creachadair/cityhash"
 	"github.com/d4l3k/go-pbzip2"
 	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
-	_ "net/http/pprof"
 	"os"
+	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
 	indexFile = flag.String("index", "/home/user/enwiki-20220101-pages-articles-multistream-index.txt.bz2",
-		"the index file to load")
+		"the index file to load, may be uncompressed if it doesn't end in .bz2, leave empty to index an uncompressed articles file directly")
 	articlesFile = flag.String("articles", "/home/user/enwiki-20220101-pages-articles-multistream.xml.bz2",
-		"the article dump file to load")
-	search          = flag.Bool("search", false, "whether or not to build a search index")
-	searchIndexFile = flag.String("searchIndex", "/home/user/index.bleve", "the search index file")
-	httpAddr        = flag.String("http", ":8080", "the address to bind HTTP to")
+		"the article dump file to load, treated as uncompressed XML if it doesn't end in .bz2")
+	search            = flag.Bool("search", false, "whether or not to build a search index")
+	searchIndexFile   = flag.String("searchIndex", "/home/user/index.bleve", "the search index file")
+	httpAddr          = flag.String("http", ":8080", "the address to bind HTTP to")
+	retainTitles      = flag.Bool("titles", false, "whether to keep every title in memory, needed for title exports and suggestions")
+	maxLineBytes      = flag.Int("maxLineBytes", 4<<20, "the maximum length of an index line, longer lines are skipped")
+	findPageMargin    = flag.Int("findPageMargin", 5, "how many pages past the end of a block, as counted by the index, to look for an article in")
+	decompressThreads = flag.Int("decompressThreads", runtime.NumCPU(), "the number of goroutines decompressing a bzip2 index while it loads")
+	indexLimit        = flag.Int("indexLimit", 0, "stop loading the index after about this many entries, rounded up to the end of a block, to quickly test against part of a dump; 0 loads all of it")
 )
 
 type indexEntry struct {
 	id, seek int
 }
 
+// titleRecord is a title kept in memory when running with -titles.
+type titleRecord struct {
+	title string
+	id    int
+}
+
 var mu = struct {
 	sync.Mutex
 
-	offsets    map[uint64]indexEntry
 	offsetSize map[int]int
+	// titles is only populated with -titles. It's only ever appended to, so
+	// a copy of the slice can be iterated without holding the lock.
+	titles []titleRecord
+	// found is the entries found by -fullScanFallback since the current
+	// offsets were loaded, see setOffsets. The offsets themselves are never
+	// modified so that a snapshot of them can be iterated without holding mu.
+	found mapStore
+	// duplicates is the page IDs more than one page has, see
+	// handleDuplicates.
+	duplicates []duplicateID
+	// idToHash maps page IDs to their title hashes, and is only populated
+	// with -ids.
+	idToHash map[int]uint64
+	// generation is incremented whenever offsetSize changes, so anything
+	// derived from it knows when to rebuild.
+	generation int
+	// end is where the index stopped if it was cut short by -indexLimit,
+	// and 0 if it covers the whole articles file.
+	end int
+	// skippedLines is the number of index lines that were too long or had
+	// titles that aren't valid UTF-8, and so were left out.
+	skippedLines int
+	// maxID is the highest page ID in the index, see estimatedAgeRank.
+	maxID int
 }{
-	offsets:    map[uint64]indexEntry{},
 	offsetSize: map[int]int{},
+	found:      mapStore{},
+	idToHash:   map[int]uint64{},
+}
+
+// offsetIndex is an index being loaded, before it's swapped into mu.
+type offsetIndex struct {
+	offsets mapStore
+	// spill is where entries are added once offsets outgrows
+	// -maxIndexMemory, and err the first error adding to it.
+	spill      *diskStoreWriter
+	err        error
+	offsetSize map[int]int
+	titles     []titleRecord
+	// ids is every page ID added, and duplicates the pages added after the
+	// first with the same ID.
+	ids        idSet
+	duplicates map[int][]idOccurrence
+	// idToHash is only populated with -ids, with the first page of any
+	// duplicated ID.
+	idToHash map[int]uint64
+	// cache is where entries are written for the -offsetCache, if it's
+	// being rebuilt.
+	cache *offsetCacheWriter
+	// untracked is set for indexes other than the dump's own, like
+	// -index2's, so reading them doesn't count towards /debug/progress.
+	untracked bool
+	// search indexes each title added, if the search index is being built.
+	search *titleIndexer
+	// limit is how many entries to stop reading at, rounded up to the end
+	// of a block, or 0 for all of them. end is the offset of the first block
+	// left out if it stopped early.
+	limit, end int
+	// skipped is the number of index lines left out for being too long or
+	// not valid UTF-8.
+	skipped int
+	maxID   int
+}
+
+func newOffsetIndex() *offsetIndex {
+	return &offsetIndex{
+		offsets:    mapStore{},
+		offsetSize: map[int]int{},
+		idToHash:   map[int]uint64{},
+	}
+}
+
+func (idx *offsetIndex) add(title string, entry indexEntry) {
+	hash := cityhash.Hash64([]byte(title))
+	idx.addHash(hash, title, entry)
+	if idx.search != nil {
+		idx.search.add(hash, title)
+	}
+}
+
+// addHash is add for a title whose hash is already known. title is only
+// needed with -titles or if entry's ID is a duplicate.
+func (idx *offsetIndex) addHash(hash uint64, title string, entry indexEntry) {
+	switch {
+	case idx.err != nil:
+	case idx.spill != nil:
+		idx.err = idx.spill.add(hash, entry)
+	default:
+		idx.offsets[hash] = entry
+		if *maxIndexMemory > 0 && len(idx.offsets)*mapEntryBytes > *maxIndexMemory<<20 {
+			log.Printf("Index has outgrown -maxIndexMemory after %d entries, building the rest on disk...", len(idx.offsets))
+			idx.spill, idx.err = newDiskStoreWriter()
+		}
+	}
+	idx.offsetSize[entry.seek]++
+	if entry.id > idx.maxID {
+		idx.maxID = entry.id
+	}
+	duplicate := entry.id >= 0 && !idx.ids.add(entry.id)
+	if duplicate {
+		idx.addDuplicate(title, entry)
+	} else if *retainIDs && entry.id >= 0 {
+		idx.idToHash[entry.id] = hash
+	}
+	if idx.cache != nil {
+		rec := offsetCacheRecord{Hash: hash, ID: entry.id, Seek: entry.seek}
+		if *retainTitles || duplicate {
+			rec.Title = title
+		}
+		idx.cache.add(rec)
+	}
+	if *retainTitles {
+		idx.titles = append(idx.titles, titleRecord{title: title, id: entry.id})
+	}
+}
+
+// finish returns the store of the loaded offsets, or the first error adding
+// to them.
+func (idx *offsetIndex) finish() (offsetStore, error) {
+	if idx.err != nil {
+		return nil, idx.err
+	}
+	if idx.spill == nil {
+		return idx.offsets, nil
+	}
+	disk, err := idx.spill.finish(idx.offsets)
+	if err != nil {
+		return nil, err
+	}
+	return &spilledStore{mem: idx.offsets, disk: disk}, nil
 }
+
+var searchMu sync.RWMutex
 var index bleve.Index
 
+// loadIndex reads the index into a new offsetIndex and only swaps it into mu
+// once it's complete, so lookups made while an index is reloading keep using
+// the previous one. With -search the search index is rebuilt too, its titles
+// as the offsets are read and then, with text in -indexFields, the text of
+// every article from the dump. Without it
+// nothing is written to -searchIndex, so title only servers don't leave an
+// empty index behind and a -searchReadOnly one is served as it is. Nor is it
+// if the endpoints that search it are disabled. With -searchReuse, a search
+// index built from the same dump is kept rather than rebuilt.
 func loadIndex() error {
-	mapping := bleve.NewIndexMapping()
-	os.RemoveAll(*searchIndexFile)
-	var err error
-	index, err = bleve.New(*searchIndexFile, mapping)
+	if !*search || endpointsDisabled("/search/phrase", "/search/count", "/similar", "/suggest", "/fulltext") {
+		return loadOffsets(nil)
+	}
+	build, err := currentSearchBuild()
 	if err != nil {
 		return err
 	}
-	f, err := os.Open(*indexFile)
+	if *searchReuse {
+		reused, err := reuseSearchIndex(build)
+		if err != nil {
+			log.Printf("Failed to reuse the search index, rebuilding it: %+v", err)
+		}
+		if reused {
+			return loadOffsets(nil)
+		}
+	}
+	loadingPath := *searchIndexFile + ".loading"
+	os.RemoveAll(loadingPath)
+	newIndex, err := newSearchIndex(loadingPath)
+	if err != nil {
+		return err
+	}
+	titles := newTitleIndexer(newIndex)
+	err = loadOffsets(titles)
+	if titlesErr := titles.finish(); err == nil {
+		err = titlesErr
+	}
+	if err != nil {
+		newIndex.Close()
+		return err
+	}
+	if searchIndexFields.text {
+		if err := indexArticles(newIndex); err != nil {
+			newIndex.Close()
+			return err
+		}
+	}
+	if err := newIndex.SetInternal(searchBuiltKey, build); err != nil {
+		newIndex.Close()
+		return err
+	}
+	return swapSearchIndex(newIndex, loadingPath)
+}
+
+// loadOffsets reads the index of title offsets and swaps it into mu, adding
+// the titles to titles if it isn't nil.
+func loadOffsets(titles *titleIndexer) error {
+	idx, err := readOffsets(titles)
+	var offsets offsetStore
+	if err == nil {
+		offsets, err = idx.finish()
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Done reading! %d entries in %s", offsets.len(), offsets.mode())
+	if idx.cache != nil {
+		if err := idx.cache.commit(); err != nil {
+			log.Printf("Failed to write the offset cache: %+v", err)
+		}
+	}
+	duplicates, err := findDuplicates(idx, offsets)
+	if err != nil {
+		offsets.close()
+		return err
+	}
+
+	mu.Lock()
+	old := setOffsets(offsets)
+	mu.found = mapStore{}
+	atomic.StoreInt64(&foundEntries, 0)
+	mu.offsetSize = idx.offsetSize
+	mu.titles = idx.titles
+	mu.duplicates = duplicates
+	mu.idToHash = idx.idToHash
+	mu.end = idx.end
+	mu.skippedLines = idx.skipped
+	mu.maxID = idx.maxID
+	mu.generation++
+	mu.Unlock()
+	old.release()
+	return nil
+}
+
+// swapSearchIndex replaces the current bleve index with newIndex, built at
+// path. Both are closed before newIndex is moved to -searchIndex, since
+// stores like scorch open their files by path, and it's reopened there
+// before it's served. If the swap fails there's no index to serve until the
+// next reload, rather than one whose files have moved.
+func swapSearchIndex(newIndex bleve.Index, path string) error {
+	if err := newIndex.Close(); err != nil {
+		return err
+	}
+
+	searchMu.Lock()
+	defer searchMu.Unlock()
+	if index != nil {
+		err := index.Close()
+		index = nil
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(*searchIndexFile); err != nil {
+		return err
+	}
+	if err := os.Rename(path, *searchIndexFile); err != nil {
+		return err
+	}
+	idx, err := bleve.Open(*searchIndexFile)
+	if err != nil {
+		return errors.Wrapf(err, "opening search index %s", *searchIndexFile)
+	}
+	index = idx
+	return nil
+}
+
+// readOffsets reads the index into a new offsetIndex, from the -offsetCache
+// if it has a cache of the current index. Otherwise the cache is rebuilt as
+// the index is read, and must be committed once it's finished. With titles,
+// the titles read are added to it, so the cache, which doesn't keep them, is
+// rebuilt rather than read.
+func readOffsets(titles *titleIndexer) (*offsetIndex, error) {
+	idx := newOffsetIndex()
+	idx.limit = *indexLimit
+	idx.search = titles
+	var header offsetCacheHeader
+	if *offsetCache != "" && *indexLimit > 0 {
+		log.Printf("Not using the offset cache with -indexLimit")
+	} else if *offsetCache != "" {
+		var err error
+		if header, err = currentOffsetCacheHeader(); err != nil {
+			return nil, err
+		}
+		if titles == nil {
+			ok, err := readOffsetCache(idx, header)
+			if ok {
+				return idx, nil
+			}
+			if err != nil {
+				log.Printf("Failed to read the offset cache, rebuilding it: %+v", err)
+			}
+		}
+		idx = newOffsetIndex()
+		idx.search = titles
+		if idx.cache, err = newOffsetCacheWriter(header); err != nil {
+			log.Printf("Failed to create the offset cache: %+v", err)
+		}
+	}
+
+	var err error
+	if *indexFile == "" && !isCompressed(*articlesFile) {
+		err = indexPlainArticles(idx)
+	} else {
+		err = readIndexFile(*indexFile, idx)
+	}
+	if err != nil && idx.cache != nil {
+		idx.cache.abort()
+	}
+	return idx, err
+}
+
+// readIndexFile reads the index file at path into idx.
+func readIndexFile(path string, idx *offsetIndex) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r, err := pbzip2.NewReader(f)
+	var in io.Reader = f
+	if !idx.untracked {
+		if in, err = trackProgress(f); err != nil {
+			return err
+		}
+	}
+	if !isCompressed(path) {
+		return readIndex(in, idx)
+	}
+	// The index is one long stream that's read to the end, which is what
+	// pbzip2 decompresses in parallel. See articleReader for why blocks
+	// aren't.
+	r, err := pbzip2.NewReader(in, pbzip2.ReaderConcurrency(*decompressThreads))
 	if err != nil {
 		return err
 	}
 	defer r.Close()
+	return readIndex(r, idx)
+}
 
+// maxLoggedInvalidLines is the most index lines with invalid titles that are
+// logged individually, so a badly corrupted index doesn't flood the log.
+const maxLoggedInvalidLines = 10
+
+// readIndex parses the lines of a multistream index file, each of the form
+// seek:id:title, into idx.
+func readIndex(r io.Reader, idx *offsetIndex) error {
+	splitter := &lineSplitter{max: *maxLineBytes}
 	scanner := bufio.NewScanner(r)
+	initial := 64 * 1024
+	if initial > *maxLineBytes {
+		initial = *maxLineBytes
+	}
+	scanner.Buffer(make([]byte, 0, initial), *maxLineBytes)
+	scanner.Split(splitter.split)
 
 	log.Printf("Reading index file...")
-	i := 0
+	i, last, invalid := 0, -1, 0
 	for scanner.Scan() {
-		parts := strings.Split(scanner.Text(), ":")
-		if len(parts) < 3 {
-			return errors.Errorf("expected at least 3 parts, got: %#v", parts)
-		}
-		seek, err := strconv.Atoi(parts[0])
+		seek, id, title, err := layout.parseLine(scanner.Text())
 		if err != nil {
 			return err
 		}
-		id, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return err
+		// A title that isn't valid UTF-8 could never be looked up, since
+		// requests are validated.
+		if !utf8.ValidString(title) {
+			invalid++
+			if invalid <= maxLoggedInvalidLines {
+				log.Printf("skipping the index line of page %d, its title %q isn't valid UTF-8", id, title)
+			}
+			continue
+		}
+		if idx.limit > 0 && i >= idx.limit && seek != last {
+			idx.end = seek
+			log.Printf("Stopped reading the index at -indexLimit=%d, after %d entries", idx.limit, i)
+			break
 		}
-		title := strings.Join(parts[2:], ":")
+		last = seek
 		entry := indexEntry{
 			id:   id,
 			seek: seek,
 		}
-		titleHash := cityhash.Hash64([]byte(title))
-
-		mu.Lock()
-		mu.offsets[titleHash] = entry
-		mu.offsetSize[entry.seek]++
-		mu.Unlock()
+		idx.add(title, entry)
+		if !idx.untracked {
+			atomic.AddInt64(&indexLinesRead, 1)
+		}
 
 		i++
 		if i%100000 == 0 {
@@ -101,14 +446,44 @@ func loadIndex() error {
 	if err := scanner.Err(); err != nil {
 		return err
 	}
-	log.Printf("Done reading!")
-
-	if !*search {
-		return nil
+	if splitter.skipped > 0 {
+		log.Printf("skipped %d index lines longer than %d bytes", splitter.skipped, splitter.max)
+	}
+	if invalid > 0 {
+		log.Printf("skipped %d index lines with titles that aren't valid UTF-8", invalid)
 	}
+	idx.skipped += splitter.skipped + invalid
 	return nil
 }
 
+// lineSplitter is a bufio.SplitFunc like bufio.ScanLines, except that lines
+// longer than max are dropped instead of aborting the scan with
+// bufio.ErrTooLong.
+type lineSplitter struct {
+	max      int
+	skipping bool
+	skipped  int
+}
+
+func (s *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	if s.skipping {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return len(data), nil, nil
+		}
+		s.skipping = false
+		return i + 1, nil, nil
+	}
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= s.max {
+		s.skipping = true
+		s.skipped++
+		log.Printf("skipping index line longer than %d bytes: %.64q...", s.max, data)
+		return len(data), nil, nil
+	}
+	return advance, token, err
+}
+
 type redirect struct {
 	Title string `xml:"title,attr"`
 }
@@ -126,76 +501,341 @@ type page struct {
 	Model      string     `xml:"revision>model" json:"model"`
 	Format     string     `xml:"revision>format" json:"format"`
 	Text       string     `xml:"revision>text" json:"text"`
+
+	// Length is the size of Text in bytes and WordCount the number of
+	// whitespace separated words in it, both set by readArticle.
+	Length    int `xml:"-" json:"length"`
+	WordCount int `xml:"-" json:"wordCount"`
+	// PageType is the classifyPage classification, set by readArticle.
+	PageType string `xml:"-" json:"pageType"`
+	// QualityFlag is "featured" or "good" for featured and good articles,
+	// see detectQualityFlag, set by readArticle.
+	QualityFlag string `xml:"-" json:"qualityFlag,omitempty"`
+	// ShortDescription is the one line description of the article's subject
+	// its editors give it, see extractShortDescription, set by readArticle.
+	ShortDescription string `xml:"-" json:"shortDescription,omitempty"`
+	// TextDeleted is set when the revision's text was deleted or suppressed,
+	// in which case the dump has no text for it.
+	TextDeleted bool `xml:"-" json:"textDeleted,omitempty"`
 }
 
-func readArticle(meta indexEntry) (page, error) {
-	f, err := os.Open(*articlesFile)
+// textDeletedRegexp matches a <text> element carrying the deleted attribute
+// that dumps use for deleted and suppressed revisions. A "<text" in the text
+// itself is always escaped, so it can't match.
+var textDeletedRegexp = regexp.MustCompile(`<text\b[^>]*\sdeleted=`)
+
+// readRawPage returns the <page> element for meta exactly as it appears in
+// the dump, transcoded to UTF-8 if the dump uses another encoding.
+func readRawPage(meta indexEntry) ([]byte, error) {
+	raw, _, err := readRawPageStats(meta)
+	return raw, err
+}
+
+// readStats is what reading a page from the dump cost, which -debug reports
+// in response headers, see setReadStatsHeaders.
+type readStats struct {
+	// Decode is how long finding and decoding the page took.
+	Decode time.Duration
+	// BlockBytes is the number of decompressed bytes read from the page's
+	// block, including any the XML decoder read past the page.
+	BlockBytes int64
+	// PagesScanned is the number of pages of the block read to find it.
+	PagesScanned int
+}
+
+// readRawPageStats is readRawPage, also returning what reading the page
+// cost.
+func readRawPageStats(meta indexEntry) ([]byte, readStats, error) {
+	if err := breakerAllow(); err != nil {
+		return nil, readStats{}, err
+	}
+	start := time.Now()
+	maxTries := blockPages(meta.seek)
+	r, closer, err := openBlock(meta.seek, maxTries+*findPageMargin)
 	if err != nil {
-		return page{}, err
+		breakerRecord(err)
+		return nil, readStats{}, articlesUnavailable(err)
 	}
-	defer f.Close()
+	defer closer.Close()
+	counter := &countingReader{r: r}
+	raw, tries, err := findPage(counter, func(n, id int) bool {
+		return id == meta.id
+	}, maxTries+*findPageMargin)
+	breakerRecord(err)
+	if err != nil {
+		return nil, readStats{}, articlesUnavailable(err)
+	}
+	logMiscount(meta, tries, maxTries)
+	return raw, readStats{Decode: time.Since(start), BlockBytes: counter.n, PagesScanned: tries}, nil
+}
+
+// setReadStatsHeaders reports s in the X-Decode-Ms, X-Block-Bytes and
+// X-Pages-Scanned headers of w if running with -debug, so the cost of slow
+// reads can be seen per request.
+func setReadStatsHeaders(w http.ResponseWriter, s readStats) {
+	if !*debug {
+		return
+	}
+	w.Header().Set("X-Decode-Ms", strconv.FormatFloat(float64(s.Decode)/float64(time.Millisecond), 'f', 3, 64))
+	w.Header().Set("X-Block-Bytes", strconv.FormatInt(s.BlockBytes, 10))
+	w.Header().Set("X-Pages-Scanned", strconv.Itoa(s.PagesScanned))
+}
 
+// readMeta returns the metadata of the page for meta without reading its
+// text, see findPageMeta.
+func readMeta(meta indexEntry) (pageMeta, error) {
+	if err := breakerAllow(); err != nil {
+		return pageMeta{}, err
+	}
+	maxTries := blockPages(meta.seek)
+	r, closer, err := openBlock(meta.seek, maxTries+*findPageMargin)
+	if err != nil {
+		breakerRecord(err)
+		return pageMeta{}, articlesUnavailable(err)
+	}
+	defer closer.Close()
+	m, tries, err := findPageMeta(r, func(n, id int) bool {
+		return id == meta.id
+	}, maxTries+*findPageMargin)
+	breakerRecord(err)
+	if err != nil {
+		return pageMeta{}, articlesUnavailable(err)
+	}
+	logMiscount(meta, tries, maxTries)
+	return m, nil
+}
+
+// blockPages returns the number of pages the index has in the block at seek.
+func blockPages(seek int) int {
 	mu.Lock()
-	maxTries := mu.offsetSize[meta.seek]
-	mu.Unlock()
+	defer mu.Unlock()
+	return mu.offsetSize[seek]
+}
 
-	r := bzip2.NewReader(f)
+// logMiscount logs if the page for meta was found further into its block
+// than the index says the block goes.
+func logMiscount(meta indexEntry, tries, maxTries int) {
+	if tries > maxTries {
+		log.Printf("found page %d at position %d in block %d, which the index says has %d pages", meta.id, tries, meta.seek, maxTries)
+	}
+}
 
-	if _, err := f.Seek(int64(meta.seek), 0); err != nil {
-		return page{}, err
+// readBlockPage returns the raw XML of the first of the pages in the block at
+// seek that match accepts, given its 1-based position in the block and its
+// ID, along with how many pages were read.
+func readBlockPage(seek, maxTries int, match func(n, id int) bool) ([]byte, int, error) {
+	r, closer, err := openBlock(seek, maxTries)
+	if err != nil {
+		return nil, 0, err
 	}
+	defer closer.Close()
+	return findPage(r, match, maxTries)
+}
 
-	d := xml.NewDecoder(r)
+// blockLengths returns the number of bytes in the block at seek, or -1 if it
+// isn't known, so reads of a block stop at its end rather than decompressing
+// into the next. It's the running Server's blockLength, and unknown until
+// there is one.
+var blockLengths = func(seek int) int { return -1 }
 
-	var p page
-	for i := 0; i < maxTries; i++ {
-		if err := d.Decode(&p); err != nil {
-			return page{}, err
-		}
-		if p.ID == meta.id {
-			return p, nil
+// seekBlock opens the articles file at the block at seek, bounded to length
+// bytes unless it's -1. The handle counts against -maxOpenFiles until it's
+// closed.
+func seekBlock(seek, length int) (io.Reader, io.Closer, error) {
+	f, err := openArticles()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Seek(int64(seek), 0); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if length >= 0 {
+		return io.LimitReader(f, int64(length)), f, nil
+	}
+	return f, f, nil
+}
+
+// openBlock returns a reader of the XML of the block at seek, from the block
+// cache if there is one, which must be closed once it's been read. maxTries
+// is the most pages that will be read from it.
+func openBlock(seek, maxTries int) (io.Reader, io.Closer, error) {
+	if decodedBlocks != nil {
+		data, err := decodedBlocks.block(seek, maxTries)
+		if err != nil {
+			return nil, nil, err
 		}
+		rc := ioutil.NopCloser(bytes.NewReader(data))
+		return rc, rc, nil
 	}
 
-	return page{}, errors.Errorf("failed to find page after %d tries", maxTries)
+	in, f, err := seekBlock(seek, blockLengths(seek))
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := utf8Reader(*articlesFile, in)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
 }
 
+func readArticle(meta indexEntry) (page, error) {
+	p, _, err := readArticleStats(meta)
+	return p, err
+}
+
+// readArticleStats is readArticle, also returning what reading the page cost,
+// decoding it included.
+func readArticleStats(meta indexEntry) (page, readStats, error) {
+	start := time.Now()
+	raw, stats, err := readRawPageStats(meta)
+	if err != nil {
+		return page{}, readStats{}, err
+	}
+	p, err := decodePage(raw)
+	stats.Decode = time.Since(start)
+	return p, stats, err
+}
+
+// decodePage unmarshals the raw XML of a page and fills in the fields derived
+// from its text.
+func decodePage(raw []byte) (page, error) {
+	var p page
+	if err := xml.Unmarshal(raw, &p); err != nil {
+		return page{}, err
+	}
+	if textDeletedRegexp.Match(raw) {
+		p.TextDeleted = true
+		p.Text = ""
+	}
+	p.Length = len(p.Text)
+	p.WordCount = countWords(p.Text)
+	p.PageType = classifyPage(p)
+	p.QualityFlag = detectQualityFlag(p.Text)
+	p.ShortDescription = extractShortDescription(p.Text)
+	return p, nil
+}
+
+// countWords counts the words in text, splitting on any Unicode whitespace.
+func countWords(text string) int {
+	n := 0
+	inWord := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			n++
+		}
+	}
+	return n
+}
+
+// fetchArticle validates name and finds where it is in the articles file,
+// asking the -indexServer if there is one. Names in the -aliasFile are
+// looked up as their targets instead.
 func fetchArticle(name string) (indexEntry, error) {
-	mu.Lock()
-	defer mu.Unlock()
+	name, err := validateTitle(name)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	name = resolveAlias(name)
+	if *indexServer != "" {
+		return remoteLookup(name)
+	}
+	return fetchLocalArticle(name)
+}
 
-	articleMeta, ok := mu.offsets[cityhash.Hash64([]byte(name))]
-	if ok {
+func fetchLocalArticle(name string) (indexEntry, error) {
+	if articleMeta, ok := lookupTitle(name); ok {
 		return articleMeta, nil
 	}
-	articleMeta, ok = mu.offsets[cityhash.Hash64([]byte(strings.Title(strings.ToLower(name))))]
-	if ok {
-		return articleMeta, nil
+	if *fullScanFallback {
+		articleMeta, ok, err := fullScanLookup(name)
+		if err != nil {
+			return indexEntry{}, err
+		}
+		if ok {
+			return articleMeta, nil
+		}
+	}
+	if err := indexLoadError(); err != nil {
+		return indexEntry{}, err
 	}
-	return indexEntry{}, statusErrorf(http.StatusNotFound, "article not found: %q", name)
+	err := articleNotFound("article not found: %q", name)
+	if *suggest || *disambiguators {
+		return indexEntry{}, suggestionsError{err, missingTitleSuggestions(name)}
+	}
+	return indexEntry{}, err
 }
 
-func randomArticleHash() (uint64, error) {
-	mu.Lock()
-	defer mu.Unlock()
+// titleVariants returns the forms of name that are tried against the index,
+// in order: as given, with MediaWiki's first letter capitalization and title
+// cased, using the casing rules of -lang.
+func titleVariants(name string) []string {
+	return []string{name, capitalizeTitle(name, *lang), titleCase(name, *lang)}
+}
 
-	for hash := range mu.offsets {
-		return hash, nil
+// lookupTitle looks name up in the index. It doesn't take mu unless
+// -fullScanFallback has found titles, so lookups don't wait on each other or
+// on a reload, which swaps in the new index whole once it's loaded.
+func lookupTitle(name string) (indexEntry, bool) {
+	view := acquireOffsets()
+	defer view.release()
+
+	for _, variant := range titleVariants(name) {
+		hash := cityhash.Hash64([]byte(variant))
+		if articleMeta, ok := view.offsets.lookup(hash); ok {
+			return articleMeta, true
+		}
+		if atomic.LoadInt64(&foundEntries) > 0 {
+			mu.Lock()
+			articleMeta, ok := mu.found[hash]
+			mu.Unlock()
+			if ok {
+				return articleMeta, true
+			}
+		}
 	}
-	return 0, errors.Errorf("no articles")
+	return indexEntry{}, false
 }
 
-func randomArticle() (page, error) {
-	hash, err := randomArticleHash()
+// lookupArticle finds and decodes the article with the given title.
+func lookupArticle(name string) (page, error) {
+	p, _, err := lookupArticleStats(name)
+	return p, err
+}
+
+// lookupArticleStats is lookupArticle, also returning what reading the
+// article cost.
+func lookupArticleStats(name string) (page, readStats, error) {
+	meta, err := fetchArticle(name)
 	if err != nil {
-		return page{}, err
+		return page{}, readStats{}, err
 	}
+	p, stats, err := readArticleStats(meta)
+	if err != nil {
+		return page{}, readStats{}, err
+	}
+	trending.record(p.Title, time.Now())
+	return p, stats, nil
+}
 
-	mu.Lock()
-	meta := mu.offsets[hash]
-	mu.Unlock()
-
-	return readArticle(meta)
+// lookupMeta finds the metadata of the article with the given title without
+// reading its text, for requests that don't need it.
+func lookupMeta(name string) (pageMeta, error) {
+	meta, err := fetchArticle(name)
+	if err != nil {
+		return pageMeta{}, err
+	}
+	m, err := readMeta(meta)
+	if err != nil {
+		return pageMeta{}, err
+	}
+	trending.record(m.Title, time.Now())
+	return m, nil
 }
 
 type statusError int
@@ -218,42 +858,196 @@ func run() error {
 	flag.Parse()
 	log.SetFlags(log.Flags() | log.Lshortfile)
 
-	go func() {
-		if err := loadIndex(); err != nil {
-			log.Printf("%+v\n", err)
-		}
-	}()
+	var err error
+	layout, err = parseIndexFormat(*indexFormat, *indexDelim)
+	if err != nil {
+		return err
+	}
+	if searchIndexFields, err = parseIndexFields(*indexFields); err != nil {
+		return errors.Wrap(err, "-indexFields")
+	}
+	disabledEndpoints = parseEndpointNames(*disableEndpoints)
+	authEndpointNames = parseEndpointNames(*authEndpoints)
+	if len(authEndpointNames) > 0 && *authToken == "" {
+		return errors.Errorf("-authEndpoints requires -authToken")
+	}
+	if searchIndexStore, err = parseBleveStore(*bleveStore); err != nil {
+		return errors.Wrap(err, "-bleveStore")
+	}
 
-	http.HandleFunc("/search", func(writer http.ResponseWriter, request *http.Request) {
-		q := request.URL.Query().Get("q")
-		article, err := fetchArticle(q)
-		if err != nil {
-			return
-		}
+	linkCache = newLRUCache(*linkCacheSize)
+	versionDiffCache = newLRUCache(*versionDiffCacheSize)
+	renderCache = newLRUCache(*renderCacheSize)
+	pathCache = newLRUCache(*pathCacheSize)
+	idempotencyCache = newLRUCache(*idempotencyCacheSize)
+	trending = newTrendingCounter(*trendingHalfLife, *trendingSize)
+	if *cacheSize > 0 {
+		decodedBlocks = newBlockCache(*cacheSize << 20)
+	}
+	if *suggest && !*retainTitles {
+		return errors.Errorf("-suggest requires -titles")
+	}
+	if !validKeyStyle(*jsonKeyStyle) {
+		return errors.Errorf("-jsonKeyStyle must be camel or snake, got %q", *jsonKeyStyle)
+	}
+	if !validOnMissing(*onMissing) {
+		return errors.Errorf("-onMissing must be null or error, got %q", *onMissing)
+	}
+	if *disambiguators && !*retainTitles {
+		return errors.Errorf("-disambiguators requires -titles")
+	}
+	if *gzipLevel < gzip.BestSpeed || *gzipLevel > gzip.BestCompression {
+		return errors.Errorf("-gzipLevel must be between %d and %d, got %d", gzip.BestSpeed, gzip.BestCompression, *gzipLevel)
+	}
+	if *brotliQuality < brotli.BestSpeed || *brotliQuality > brotli.BestCompression {
+		return errors.Errorf("-brotliQuality must be between %d and %d, got %d", brotli.BestSpeed, brotli.BestCompression, *brotliQuality)
+	}
+	if *decompressThreads < 1 {
+		return errors.Errorf("-decompressThreads must be at least 1, got %d", *decompressThreads)
+	}
+	if *fuzzyMaxCandidates < 1 {
+		return errors.Errorf("-fuzzyMaxCandidates must be at least 1, got %d", *fuzzyMaxCandidates)
+	}
+	if *batchConcurrency < 1 {
+		return errors.Errorf("-batchConcurrency must be at least 1, got %d", *batchConcurrency)
+	}
+	batchSlots = make(chan struct{}, *batchConcurrency)
+	if *maxOpenFiles < 0 {
+		return errors.Errorf("-maxOpenFiles must be at least 0, got %d", *maxOpenFiles)
+	}
+	openFileSlots = nil
+	if *maxOpenFiles > 0 {
+		openFileSlots = make(chan struct{}, *maxOpenFiles)
+	}
+	if *breakerThreshold < 0 {
+		return errors.Errorf("-breakerThreshold must be at least 0, got %d", *breakerThreshold)
+	}
+	if *breakerCooldown <= 0 {
+		return errors.Errorf("-breakerCooldown must be positive, got %s", *breakerCooldown)
+	}
+	if *maxBodyBytes < minBodyBytes {
+		return errors.Errorf("-maxBodyBytes must be at least %d to fit a full batch of the longest titles, got %d", minBodyBytes, *maxBodyBytes)
+	}
+	if *writeTimeout > 0 && *writeTimeout < minWriteTimeout {
+		return errors.Errorf("-writeTimeout must be at least %s to send the largest articles to slow clients, got %s", minWriteTimeout, *writeTimeout)
+	}
 
-		pg, err := readArticle(article)
-		if err != nil {
-			return
-		}
-		// //
-		// convert, err := wikitext.Convert([]byte(pg.Text))
-		// if err != nil {
-		// 	return
-		// }
-		// pg.Text = string(convert)
-		// pg.Text = string(convert)
-		marshal, err := json.Marshal(pg)
-		if err != nil {
-			return
+	if *search && *searchReadOnly {
+		return errors.Errorf("-search rebuilds the search index, which -searchReadOnly serves as it is, so only one can be set")
+	}
+	if *searchReuse && !*search {
+		return errors.Errorf("-searchReuse keeps the index -search would rebuild, so it needs -search")
+	}
+	if *searchReadOnly {
+		if err := openSearchIndex(); err != nil {
+			return err
 		}
+	}
 
-		writer.Header().Set("Access-Control-Allow-Origin", "*")
-		_, err = writer.Write(marshal)
-		if err != nil {
-			return
-		}
-	})
+	server := newServer(*randomSeed)
+	blockLengths = server.blockLength
+	if err := registerRoutes(server); err != nil {
+		return err
+	}
+	if err := server.loadSiteInfo(); err != nil {
+		log.Printf("Failed to read siteinfo, using the default namespaces: %+v", err)
+	}
+
+	beginLoad()
+	go loadAll()
 
+	if *pprofEnabled {
+		if *adminAddr != "" {
+			registerPprof(adminMux)
+		} else {
+			go servePprof()
+		}
+	}
+	if *adminAddr != "" {
+		go serveAdmin()
+	}
 	log.Printf("Listening on %s...", *httpAddr)
-	return http.ListenAndServe(*httpAddr, nil)
+	return newHTTPServer(*httpAddr, compressed(authenticated(http.DefaultServeMux))).ListenAndServe()
+}
+
+// registerRoutes registers every endpoint, failing if any of the
+// -disableEndpoints or -authEndpoints isn't one of them.
+func registerRoutes(server *Server) error {
+	route("/article", handle(nullIfMissing(handleArticle)))
+	route("/length", handle(nullIfMissing(handleLength)))
+	route("/xml", handle(nullIfMissing(handleXML)))
+	route("/raw", handle(nullIfMissing(handleRaw)))
+	route("/w/index.php", handle(handleIndexPHP))
+	route("/random", handle(server.handleRandom))
+	route("/random/quality", handle(server.handleRandomQuality))
+	adminRoute("/block", handle(server.handleBlock))
+	route("/revision", handle(nullIfMissing(handleRevision)))
+	route("/hash", handle(nullIfMissing(handleHash)))
+	route("/siteinfo", handle(server.handleSiteInfo))
+	route("/find", handle(nullIfMissing(handleFind)))
+	route("/enrich", handle(nullIfMissing(handleEnrich)))
+	route("/incategory", handle(handleInCategory))
+	route("/chunks", idempotent(handle(nullIfMissing(handleChunks))))
+	route("/paragraphs", idempotent(handle(nullIfMissing(handleParagraphs))))
+	route("/skim", idempotent(handle(nullIfMissing(handleSkim))))
+	route("/wordfreq", handle(nullIfMissing(handleWordFreq)))
+	route("/top", handle(handleTop))
+	route("/path", handle(handlePath))
+	route("/trending", handle(handleTrending))
+	route("/diff", idempotent(handle(handleDiff)))
+	route("/versiondiff", handle(nullIfMissing(handleVersionDiff)))
+	route("/media", handle(nullIfMissing(handleMedia)))
+	route("/externallinks", handle(nullIfMissing(handleExternalLinks)))
+	route("/seealso", handle(nullIfMissing(handleSeeAlso)))
+	route("/langlinks", handle(nullIfMissing(handleLangLinks)))
+	route("/url", handle(handleURL))
+	route("/tables", handle(nullIfMissing(handleTables)))
+	route("/wikidata", handle(nullIfMissing(handleWikidata)))
+	route("/shortdesc", handle(nullIfMissing(handleShortDescription)))
+	route("/coords", handle(nullIfMissing(handleCoords)))
+	route("/nearby", handle(handleNearby))
+	route("/template", handle(handleTemplate))
+	route("/usedtemplates", handle(nullIfMissing(handleUsedTemplates)))
+	route("/tokens", handle(nullIfMissing(handleTokens)))
+	route("/api/spec", handle(handleSpec))
+	route("/search/phrase", handle(handlePhraseSearch))
+	route("/search/count", handle(handleSearchCount))
+	route("/search/regex", handle(handleRegexSearch))
+	route("/similar", handle(nullIfMissing(handleSimilar)))
+	route("/suggest", handle(handleSuggestSearch))
+	route("/fulltext", handle(handleFulltext))
+	route("/export/titles", handle(handleExportTitles))
+	route("/export/blocks.csv", handle(handleExportBlocks))
+	route("/export/articles", handle(handleExportArticles))
+	route("/export/offsets.bin", handle(handleExportOffsets))
+	route("/since", handle(handleSince))
+	route("/ping", handlePing)
+	adminRoute("/healthz", handle(handleHealthz))
+	adminRoute("/healthz/deep", handle(handleDeepHealthz))
+	route("/stats", handle(handleStats))
+	route("/stats/size", handle(handleStatsSize))
+	adminRoute("/debug/cache", handle(handleCacheStats))
+	adminRoute("/debug/progress", handle(handleProgress))
+	adminRoute("/debug/duplicates", handle(handleDuplicates))
+	adminRoute("/debug/lookup-trace", handle(handleLookupTrace))
+	adminRoute("/metrics", handle(handleMetrics))
+	route("/batch/articles", handle(handleBatchArticles))
+	route("/articlesByID", handle(handleArticlesByID))
+	route("/stream/articlesByID", handle(handleStreamArticlesByID))
+	adminRoute("/admin/reload", adminOnly(handle(handleReload)))
+	adminRoute("/admin/config", adminOnly(handle(handleConfig)))
+	if *indexServerMode {
+		route("/internal/lookup", handle(handleLookup))
+	}
+
+	route("/search", handle(handleTitleSearch))
+	http.HandleFunc("/", handle(handleRoot))
+
+	if unused := unusedDisabledEndpoints(); len(unused) > 0 {
+		return errors.Errorf("-disableEndpoints: no such endpoints: %s", strings.Join(unused, ", "))
+	}
+	if unused := unusedAuthEndpoints(); len(unused) > 0 {
+		return errors.Errorf("-authEndpoints: no such endpoints: %s", strings.Join(unused, ", "))
+	}
+	return nil
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/cityhash"
+)
+
+func TestReadIndexSkipsLongLines(t *testing.T) {
+	defer func(max int) { *maxLineBytes = max }(*maxLineBytes)
+	*maxLineBytes = 1024
+
+	index := strings.Join([]string{
+		"10:1:Foo",
+		"10:2:" + strings.Repeat("x", 5000),
+		"20:3:Bar: Baz",
+		"",
+	}, "\n")
+	idx := newOffsetIndex()
+	if err := readIndex(strings.NewReader(index), idx); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		title string
+		want  indexEntry
+	}{
+		{"Foo", indexEntry{id: 1, seek: 10}},
+		{"Bar: Baz", indexEntry{id: 3, seek: 20}},
+	}
+	for _, c := range cases {
+		got, ok := idx.offsets[cityhash.Hash64([]byte(c.title))]
+		if !ok {
+			t.Errorf("%q missing from index", c.title)
+		} else if got != c.want {
+			t.Errorf("index[%q] = %+v; not %+v", c.title, got, c.want)
+		}
+	}
+	if len(idx.offsets) != len(cases) {
+		t.Errorf("expected %d entries; got %d", len(cases), len(idx.offsets))
+	}
+	if idx.offsetSize[10] != 1 {
+		t.Errorf("expected oversized line to not count towards block size; got %d", idx.offsetSize[10])
+	}
+}
+
+func TestReadIndexSkipsInvalidUTF8(t *testing.T) {
+	index := "10:1:Foo\n10:2:Bad \xff\xfe title\n20:3:Caf\xc3\xa9\n20:4:\xc3(\n"
+	idx := newOffsetIndex()
+	if err := readIndex(strings.NewReader(index), idx); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Foo", "Café"} {
+		if _, ok := idx.offsets[cityhash.Hash64([]byte(title))]; !ok {
+			t.Errorf("%q missing from index", title)
+		}
+	}
+	if len(idx.offsets) != 2 || idx.skipped != 2 {
+		t.Errorf("indexed %d entries and skipped %d; expected 2 of each", len(idx.offsets), idx.skipped)
+	}
+	if idx.offsetSize[10] != 1 || idx.offsetSize[20] != 1 {
+		t.Errorf("invalid lines counted towards block sizes: %v", idx.offsetSize)
+	}
+}
+
+func TestReadIndexLimit(t *testing.T) {
+	index := "10:1:A\n10:2:B\n20:3:C\n20:4:D\n20:5:E\n30:6:F\n"
+	cases := []struct {
+		limit, entries, end int
+	}{
+		{0, 6, 0},
+		{1, 2, 20},
+		{2, 2, 20},
+		{3, 5, 30},
+		{6, 6, 0},
+		{10, 6, 0},
+	}
+	for _, c := range cases {
+		idx := newOffsetIndex()
+		idx.limit = c.limit
+		if err := readIndex(strings.NewReader(index), idx); err != nil {
+			t.Fatal(err)
+		}
+		if len(idx.offsets) != c.entries || idx.end != c.end {
+			t.Errorf("limit %d: read %d entries ending at %d; not %d ending at %d", c.limit, len(idx.offsets), idx.end, c.entries, c.end)
+		}
+	}
+}
+
+func TestIndexLimitPlainArticles(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "A", "first"), testPage(2, "B", "second"), testPage(3, "C", "third")})
+	defer func(indexPath string, limit int) { *indexFile, *indexLimit = indexPath, limit }(*indexFile, *indexLimit)
+	*indexFile, *indexLimit = "", 2
+	if err := loadOffsets(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for title, found := range map[string]bool{"A": true, "B": true, "C": false} {
+		if _, err := lookupArticle(title); (err == nil) != found {
+			t.Errorf("lookupArticle(%q) = %v; expected found to be %t", title, err, found)
+		}
+	}
+	var seen []string
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		seen = append(seen, p.Title)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(seen, ",") != "A,B" {
+		t.Errorf("IterateArticles visited %q; expected only the indexed pages", seen)
+	}
+	s := newServer(1)
+	for i := 0; i < 10; i++ {
+		p, err := s.randomArticle(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Title == "C" {
+			t.Errorf("randomArticle returned a page past -indexLimit")
+		}
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"one", 1},
+		{" one  two\nthree\t", 3},
+		{"non\u00a0breaking\u2003em space", 4},
+		{"日本語 テキスト", 2},
+	}
+
+	for _, c := range cases {
+		if got := countWords(c.in); got != c.want {
+			t.Errorf("countWords(%q) = %d; not %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFetchArticleCaseFallback(t *testing.T) {
+	defer func(l string) { *lang = l }(*lang)
+	*lang = "en"
+	useTestDump(t, []page{
+		testPage(1, "New York", ""),
+		testPage(2, "IPhone", ""),
+		testPage(3, "École Normale", ""),
+		testPage(4, "The Lord of the Rings", ""),
+		testPage(5, "Écoute", ""),
+	})
+
+	cases := []struct {
+		in string
+		// want is the ID the title resolves to, or 0 if none of the variants
+		// are in the index.
+		want int
+	}{
+		{"New York", 1},
+		// Resolved by title casing.
+		{"new york", 1},
+		{"NEW YORK", 1},
+		{"nEW yORK", 1},
+		// Resolved by capitalizing the first letter only.
+		{"iPhone", 2},
+		{"écoute", 5},
+		{"ÉCOLE NORMALE", 3},
+		{"école normale", 3},
+		// Title casing lower cases the rest of each word and capitalizes
+		// every word, so these are only found by their exact title.
+		{"IPHONE", 0},
+		{"the lord of the rings", 0},
+		{"THE LORD OF THE RINGS", 0},
+	}
+	for _, c := range cases {
+		got, err := fetchArticle(c.in)
+		if c.want == 0 {
+			if err == nil {
+				t.Errorf("fetchArticle(%q) = %+v; expected not found", c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fetchArticle(%q): %v", c.in, err)
+		} else if got.id != c.want {
+			t.Errorf("fetchArticle(%q) found page %d; not %d", c.in, got.id, c.want)
+		}
+	}
+}
+
+func TestReadArticleMissingFile(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "bar")})
+	if err := os.Remove(*articlesFile); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/article?title=Foo", nil)
+	w := httptest.NewRecorder()
+	handle(handleArticle)(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; not %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(w.Body.String(), `{"error":"articles file unavailable`) {
+		t.Errorf("body = %s; expected articles file unavailable", w.Body)
+	}
+}
+
+func BenchmarkCityHash(b *testing.B) {
+	title := []byte("Albert Einstein")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cityhash.Hash64(title)
+	}
+}
+
+func BenchmarkFetchArticle(b *testing.B) {
+	useTestDump(b, denseBlock(1000, 12))
+	for _, c := range []struct {
+		name  string
+		title string
+	}{
+		{"Exact", "Page 500"},
+		// Only found once the first letter is capitalized, so it costs an
+		// extra variant and hash.
+		{"Normalized", "page 500"},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := fetchArticle(c.title); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadArticle(b *testing.B) {
+	block := denseBlock(10, 5000)
+	useTestDump(b, block)
+	meta, err := fetchArticle(block[0].Title)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readArticle(meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHandleArticle measures a whole /article request, from parsing the
+// query to writing the JSON.
+func BenchmarkHandleArticle(b *testing.B) {
+	useTestDump(b, denseBlock(10, 5000))
+	h := handle(handleArticle)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", "/article?title=Page+5", nil))
+		if w.Code != http.StatusOK {
+			b.Fatalf("got %d %s", w.Code, w.Body)
+		}
+	}
+}
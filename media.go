@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// commonsURL returns the upload.wikimedia.org URL of a file on Wikimedia
+// Commons. Files are stored under directories named after the first one and
+// two hex digits of the MD5 of the file name, with spaces as underscores. The
+// file isn't checked to exist.
+func commonsURL(name string) string {
+	name = strings.Replace(upperFirst(strings.TrimSpace(name)), " ", "_", -1)
+	sum := md5.Sum([]byte(name))
+	hash := hex.EncodeToString(sum[:])
+	return "https://upload.wikimedia.org/wikipedia/commons/" + hash[:1] + "/" + hash[:2] + "/" + url.PathEscape(name)
+}
+
+type mediaRef struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// mediaRefs lists the files embedded in text with their Commons URLs.
+func mediaRefs(text string) []mediaRef {
+	refs := []mediaRef{}
+	for _, name := range extractMedia(text) {
+		refs = append(refs, mediaRef{
+			Name: name,
+			URL:  commonsURL(name),
+		})
+	}
+	return refs
+}
+
+// handleMedia serves /media?title=..., listing the files an article embeds.
+func handleMedia(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, mediaRefs(p.Text))
+}
+
+// handleExternalLinks serves /externallinks?title=..., listing the URLs an
+// article links to.
+func handleExternalLinks(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, extractExternalLinks(p.Text))
+}
+
+// handleLangLinks serves /langlinks?title=..., returning the article's
+// interlanguage links as a map from language code to title. Modern dumps keep
+// these in Wikidata instead, so it's usually empty for them.
+func handleLangLinks(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, extractLangLinks(p.Text))
+}
+
+type shortDescription struct {
+	Title string `json:"title"`
+	// ShortDescription is "" if the article doesn't have one.
+	ShortDescription string `json:"shortDescription"`
+}
+
+// handleShortDescription serves /shortdesc?title=..., returning the short
+// description editors give the article, see extractShortDescription.
+func handleShortDescription(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, shortDescription{Title: p.Title, ShortDescription: p.ShortDescription})
+}
+
+type wikidataRef struct {
+	Title string `json:"title"`
+	// ID is the article's Wikidata QID, or "" if none was found.
+	ID string `json:"id"`
+}
+
+// handleWikidata serves /wikidata?title=..., returning the Wikidata QID the
+// article's wikitext names, see extractWikidataID.
+func handleWikidata(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, wikidataRef{
+		Title: p.Title,
+		ID:    extractWikidataID(p.Text),
+	})
+}
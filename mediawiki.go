@@ -0,0 +1,38 @@
+package main
+
+import "net/http"
+
+// rawCTypes are the ctype values MediaWiki's action=raw accepts.
+var rawCTypes = map[string]bool{
+	"text/x-wiki":             true,
+	"text/javascript":         true,
+	"text/css":                true,
+	"application/x-zope-edit": true,
+	"application/json":        true,
+}
+
+// handleIndexPHP serves /w/index.php?title=...&action=raw like MediaWiki does,
+// so bots and tools that fetch wikitext from a wiki can be pointed here
+// instead. action=raw returns the page's text as /raw would, and ctype=...
+// sets the Content-Type to one of rawCTypes, as MediaWiki allows for user
+// scripts and styles; any other ctype is ignored, as it is there. No other
+// action is supported, including viewing the page, and they're a 501.
+func handleIndexPHP(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	if action := q.Get("action"); action != "raw" {
+		if action == "" {
+			action = "view"
+		}
+		return statusErrorf(http.StatusNotImplemented, "action=%s isn't supported, only action=raw is", action)
+	}
+	p, err := lookupArticle(q.Get("title"))
+	if err != nil {
+		return err
+	}
+	contentType := rawContentType(p)
+	if ctype := q.Get("ctype"); rawCTypes[ctype] {
+		contentType = ctype + "; charset=utf-8"
+	}
+	serveRaw(w, r, p, p.Text, contentType)
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleIndexPHP(t *testing.T) {
+	script := testPage(2, "User:Foo/common.js", "alert(1);")
+	script.Model = "javascript"
+	useTestDump(t, []page{testPage(1, "Foo", "'''Foo''' is [[bar]]."), script})
+
+	for _, c := range []struct {
+		query, contentType, body string
+		status                   int
+	}{
+		{"title=Foo&action=raw", "text/plain; charset=utf-8", "'''Foo''' is [[bar]].", http.StatusOK},
+		{"title=Foo&action=raw&ctype=text/x-wiki", "text/x-wiki; charset=utf-8", "'''Foo''' is [[bar]].", http.StatusOK},
+		{"title=Foo&action=raw&ctype=text/html", "text/plain; charset=utf-8", "'''Foo''' is [[bar]].", http.StatusOK},
+		{"title=User:Foo/common.js&action=raw", "application/javascript; charset=utf-8", "alert(1);", http.StatusOK},
+		{"title=Missing&action=raw", "", "", http.StatusNotFound},
+		{"title=Foo&action=edit", "", "", http.StatusNotImplemented},
+		{"title=Foo", "", "", http.StatusNotImplemented},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleIndexPHP)(w, httptest.NewRequest("GET", "/w/index.php?"+c.query, nil))
+		if w.Code != c.status {
+			t.Errorf("%s: status = %d; not %d: %s", c.query, w.Code, c.status, w.Body)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("Content-Type"); got != c.contentType {
+			t.Errorf("%s: Content-Type = %q; not %q", c.query, got, c.contentType)
+		}
+		if got := w.Body.String(); got != c.body {
+			t.Errorf("%s: body = %q; not %q", c.query, got, c.body)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// metric is a value exported on /metrics in the Prometheus text format.
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func() float64
+}
+
+var metrics = []metric{
+	{
+		name: "wikigopher_index_entries",
+		help: "The number of titles in the index.",
+		typ:  "gauge",
+		value: func() float64 {
+			mu.Lock()
+			defer mu.Unlock()
+			return float64(indexLen())
+		},
+	},
+	{
+		name: "wikigopher_batch_in_flight",
+		help: "The number of batch items being processed.",
+		typ:  "gauge",
+		value: func() float64 {
+			return float64(atomic.LoadInt64(&batchInFlight))
+		},
+	},
+	{
+		name: "wikigopher_open_article_files",
+		help: "The number of handles of the articles file requests have open.",
+		typ:  "gauge",
+		value: func() float64 {
+			return float64(atomic.LoadInt64(&openArticleFiles))
+		},
+	},
+	{
+		name: "wikigopher_suggest_candidates_scanned_average",
+		help: "The average number of titles looked at to suggest titles for a missing article.",
+		typ:  "gauge",
+		value: func() float64 {
+			lookups := atomic.LoadInt64(&suggestLookups)
+			if lookups == 0 {
+				return 0
+			}
+			return float64(atomic.LoadInt64(&suggestCandidatesScanned)) / float64(lookups)
+		},
+	},
+	{
+		name: "wikigopher_breaker_state",
+		help: "The state of the circuit breaker on reads of the articles file: 0 closed, 1 half-open, 2 open.",
+		typ:  "gauge",
+		value: func() float64 {
+			return float64(currentBreakerState())
+		},
+	},
+	{
+		name: "wikigopher_breaker_opens_total",
+		help: "The number of times the circuit breaker on reads of the articles file has opened.",
+		typ:  "counter",
+		value: func() float64 {
+			decodeBreaker.Lock()
+			defer decodeBreaker.Unlock()
+			return float64(decodeBreaker.opens)
+		},
+	},
+	{
+		name:  "wikigopher_block_cache_entries",
+		help:  "The number of decompressed blocks in the block cache.",
+		typ:   "gauge",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return float64(s.Entries) }),
+	},
+	{
+		name:  "wikigopher_block_cache_bytes",
+		help:  "The size of the decompressed blocks in the block cache.",
+		typ:   "gauge",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return float64(s.Bytes) }),
+	},
+	{
+		name:  "wikigopher_block_cache_hits_total",
+		help:  "The number of block reads served from the block cache.",
+		typ:   "counter",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return float64(s.Hits) }),
+	},
+	{
+		name:  "wikigopher_block_cache_misses_total",
+		help:  "The number of block reads that had to decompress the block.",
+		typ:   "counter",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return float64(s.Misses) }),
+	},
+	{
+		name:  "wikigopher_block_cache_evictions_total",
+		help:  "The number of blocks evicted from the block cache to make room.",
+		typ:   "counter",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return float64(s.Evictions) }),
+	},
+	{
+		name:  "wikigopher_block_cache_pages_per_block",
+		help:  "The average number of pages in each cached block.",
+		typ:   "gauge",
+		value: blockCacheMetric(func(s blockCacheStats) float64 { return s.PagesPerBlock }),
+	},
+}
+
+// handleMetrics serves /metrics for Prometheus to scrape.
+func handleMetrics(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.typ, m.name, m.value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
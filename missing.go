@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+)
+
+var onMissing = flag.String("onMissing", "error", "how title lookups respond by default when the article doesn't exist: error for a 404, or null for a 200 with {\"article\":null}; requests can override it with ?onMissing=")
+
+// notFoundError marks a 404 for an article that doesn't exist, as opposed to
+// any other 404, so it can be served as null when asked for.
+type notFoundError struct {
+	error
+}
+
+// Cause lets errors.Cause find the statusError underneath.
+func (e notFoundError) Cause() error {
+	return e.error
+}
+
+// articleNotFound returns the error for looking up a title that isn't in the
+// dump.
+func articleNotFound(format string, args ...interface{}) error {
+	return notFoundError{statusErrorf(http.StatusNotFound, format, args...)}
+}
+
+// isArticleNotFound reports whether err is because an article doesn't exist.
+func isArticleNotFound(err error) bool {
+	for err != nil {
+		if _, ok := err.(notFoundError); ok {
+			return true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+	return false
+}
+
+// validOnMissing checks an -onMissing or ?onMissing= value.
+func validOnMissing(mode string) bool {
+	return mode == "error" || mode == "null"
+}
+
+// nullIfMissing wraps a handler that looks up an article by title so that,
+// with onMissing=null or -onMissing null, a missing article is a 200 with
+// {"article":null} instead of a 404. Other errors are returned as usual.
+func nullIfMissing(f func(w http.ResponseWriter, r *http.Request) error) func(w http.ResponseWriter, r *http.Request) error {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		mode := *onMissing
+		if raw := r.URL.Query().Get("onMissing"); raw != "" {
+			if !validOnMissing(raw) {
+				return statusErrorf(http.StatusBadRequest, "invalid onMissing %q, expected null or error", raw)
+			}
+			mode = raw
+		}
+		err := f(w, r)
+		if mode != "null" || !isArticleNotFound(err) {
+			return err
+		}
+		return writeJSON(w, r, struct {
+			Article *page `json:"article"`
+		}{})
+	}
+}
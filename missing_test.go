@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNullIfMissing(t *testing.T) {
+	defer func(mode string) { *onMissing = mode }(*onMissing)
+	useTestDump(t, []page{testPage(1, "Foo", "Text.")})
+
+	for _, c := range []struct {
+		flag, query string
+		code        int
+		want        string
+	}{
+		{"error", "/article?title=Missing", http.StatusNotFound, "article not found"},
+		{"error", "/article?title=Missing&onMissing=error", http.StatusNotFound, "article not found"},
+		{"error", "/article?title=Missing&onMissing=null", http.StatusOK, `{"article":null}`},
+		{"error", "/length?title=Missing&onMissing=null", http.StatusOK, `{"article":null}`},
+		{"error", "/article?title=Foo&onMissing=null", http.StatusOK, `"title":"Foo"`},
+		{"error", "/article?title=Missing&onMissing=empty", http.StatusBadRequest, "invalid onMissing"},
+		{"null", "/article?title=Missing", http.StatusOK, `{"article":null}`},
+		{"null", "/article?title=Missing&onMissing=error", http.StatusNotFound, "article not found"},
+		// Only missing articles are null, not other errors.
+		{"null", "/article?title=", http.StatusBadRequest, "title"},
+		{"null", "/article?title=Foo&rev=2", http.StatusConflict, "revision mismatch"},
+	} {
+		*onMissing = c.flag
+		h := handleArticle
+		if strings.HasPrefix(c.query, "/length") {
+			h = handleLength
+		}
+		w := httptest.NewRecorder()
+		handle(nullIfMissing(h))(w, httptest.NewRequest("GET", c.query, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("-onMissing %s %s: got %d %s; expected %d containing %s", c.flag, c.query, w.Code, w.Body, c.code, c.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var wikis = flag.String("wikis", "", "the other wikis /article?langChain=... can fall back to, as comma separated lang=URL pairs of their wikigopher servers, such as simple=http://simple:8080")
+
+// maxLangChain is the most wikis a langChain may list.
+const maxLangChain = 5
+
+var wikiClient = &http.Client{Timeout: 30 * time.Second}
+
+// wikiServers parses -wikis into a map from language code to server URL.
+func wikiServers() (map[string]string, error) {
+	servers := map[string]string{}
+	for _, pair := range strings.Split(*wikis, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid -wikis entry %q, expected lang=URL", pair)
+		}
+		servers[parts[0]] = strings.TrimSuffix(parts[1], "/")
+	}
+	return servers, nil
+}
+
+// parseLangChain splits a langChain into the wikis to try in order. Repeated
+// wikis are only tried once, and every one must be this wiki or in -wikis.
+func parseLangChain(raw string, servers map[string]string) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{}
+	for _, l := range strings.Split(raw, ",") {
+		l = strings.TrimSpace(l)
+		if l == "" || seen[l] {
+			continue
+		}
+		if _, ok := servers[l]; !ok && l != *lang {
+			return nil, statusErrorf(http.StatusBadRequest, "unknown wiki %q in langChain", l)
+		}
+		seen[l] = true
+		chain = append(chain, l)
+	}
+	if len(chain) > maxLangChain {
+		return nil, statusErrorf(http.StatusBadRequest, "langChain can list at most %d wikis, got %d", maxLangChain, len(chain))
+	}
+	return chain, nil
+}
+
+// handleLangChain serves /article?langChain=simple,en&title=..., trying each
+// wiki in turn until one has the article and responding as that wiki's
+// /article would, with the wiki in the X-Wiki header. Other wikis are asked
+// without the langChain, so a request is never passed on more than once.
+func handleLangChain(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	servers, err := wikiServers()
+	if err != nil {
+		return err
+	}
+	chain, err := parseLangChain(q.Get("langChain"), servers)
+	if err != nil {
+		return err
+	}
+	q.Del("langChain")
+	// Other wikis must 404 for a missing article so the next one is tried.
+	q.Del("onMissing")
+	title, err := validateTitle(q.Get("title"))
+	if err != nil {
+		return err
+	}
+
+	for _, l := range chain {
+		if l == *lang {
+			_, err := fetchArticle(title)
+			if code, ok := errors.Cause(err).(statusError); ok && code == http.StatusNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			u := *r.URL
+			u.RawQuery = q.Encode()
+			local := r.WithContext(r.Context())
+			local.URL = &u
+			w.Header().Set("X-Wiki", l)
+			return handleArticle(w, local)
+		}
+
+		found, err := proxyArticle(w, r, servers[l]+"/article?"+q.Encode(), l)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+	}
+	return articleNotFound("%q not found in %s", title, strings.Join(chain, ", "))
+}
+
+// proxyArticle copies the response to u to w, reporting false without
+// writing anything if the article isn't found there.
+func proxyArticle(w http.ResponseWriter, r *http.Request, u, wiki string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := wikiClient.Do(req.WithContext(r.Context()))
+	if err != nil {
+		return false, statusErrorf(http.StatusBadGateway, "querying %s wiki: %s", wiki, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, statusErrorf(http.StatusBadGateway, "%s wiki: %s", wiki, resp.Status)
+	}
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("X-Wiki", wiki)
+	_, err = io.Copy(w, resp.Body)
+	return true, err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleLangChain(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "local foo")})
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("langChain") != "" {
+			t.Errorf("peer was sent a langChain: %s", r.URL)
+		}
+		if r.URL.Query().Get("title") != "Bar" {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"Bar","text":"simple bar"}`))
+	}))
+	defer peer.Close()
+
+	defer func(l, w string) { *lang, *wikis = l, w }(*lang, *wikis)
+	*lang, *wikis = "en", "simple="+peer.URL+"/"
+
+	for _, c := range []struct {
+		query      string
+		code       int
+		wiki, want string
+	}{
+		{"title=Bar&langChain=simple,en", http.StatusOK, "simple", "simple bar"},
+		{"title=Foo&langChain=simple,en", http.StatusOK, "en", "local foo"},
+		{"title=Foo&langChain=en,simple,en", http.StatusOK, "en", "local foo"},
+		{"title=Bar&langChain=en", http.StatusNotFound, "", "not found in en"},
+		{"title=Baz&langChain=simple,en", http.StatusNotFound, "", "not found in simple, en"},
+		{"title=Foo&langChain=de,en", http.StatusBadRequest, "", `unknown wiki \"de\"`},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, httptest.NewRequest("GET", "/article?"+c.query, nil))
+		if w.Code != c.code || w.Header().Get("X-Wiki") != c.wiki || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: got %d from %q: %s; expected %d from %q containing %s", c.query, w.Code, w.Header().Get("X-Wiki"), w.Body, c.code, c.wiki, c.want)
+		}
+	}
+
+	servers := map[string]string{"a": "x", "b": "x", "c": "x", "d": "x", "e": "x", "f": "x"}
+	if _, err := parseLangChain("a,b,c,d,e,f", servers); err == nil {
+		t.Errorf("expected a chain of 6 wikis to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultNamespaces maps the canonical English namespace prefixes, and the
+// legacy Image alias, to their namespace numbers. They're used until the
+// dump's siteinfo has been read.
+var defaultNamespaces = map[string]int{
+	"Talk":           1,
+	"User":           2,
+	"User talk":      3,
+	"Wikipedia":      4,
+	"Wikipedia talk": 5,
+	"File":           6,
+	"Image":          6,
+	"File talk":      7,
+	"MediaWiki":      8,
+	"MediaWiki talk": 9,
+	"Template":       10,
+	"Template talk":  11,
+	"Help":           12,
+	"Help talk":      13,
+	"Category":       14,
+	"Category talk":  15,
+	"Portal":         100,
+	"Portal talk":    101,
+	"Draft":          118,
+	"Draft talk":     119,
+	"TimedText":      710,
+	"TimedText talk": 711,
+	"Module":         828,
+	"Module talk":    829,
+}
+
+// namespaces maps the namespace prefixes of the loaded dump to their numbers.
+var namespaces = struct {
+	sync.Mutex
+
+	m map[string]int
+}{m: defaultNamespaces}
+
+// setNamespaces replaces the namespace prefixes used to parse titles.
+func setNamespaces(m map[string]int) {
+	namespaces.Lock()
+	namespaces.m = m
+	namespaces.Unlock()
+}
+
+// namespaceForTitle returns the namespace number of a title from its prefix.
+// Titles without a known prefix are in the main namespace, 0.
+func namespaceForTitle(title string) int {
+	i := strings.IndexByte(title, ':')
+	if i < 0 {
+		return 0
+	}
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	if ns, ok := namespaces.m[title[:i]]; ok {
+		return ns
+	}
+	return 0
+}
+
+// namespacePrefixes returns the prefixes of namespace ns in the loaded dump
+// in sorted order, which for the English defaults puts File before its
+// Image alias.
+func namespacePrefixes(ns int) []string {
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	var prefixes []string
+	for prefix, n := range namespaces.m {
+		if n == ns {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// talkTitle returns the title of the talk page for title, which for the main
+// namespace is "Talk:<title>" and otherwise "<namespace> talk:<rest>" in
+// English. Talk pages, and the virtual namespaces with negative numbers,
+// don't have talk pages of their own.
+func talkTitle(title string) (string, bool) {
+	ns := namespaceForTitle(title)
+	if ns < 0 || ns%2 == 1 {
+		return "", false
+	}
+	rest := title
+	if ns != 0 {
+		rest = title[strings.IndexByte(title, ':')+1:]
+	}
+
+	namespaces.Lock()
+	defer namespaces.Unlock()
+
+	for name, n := range namespaces.m {
+		if n == ns+1 {
+			return name + ":" + rest, true
+		}
+	}
+	return "", false
+}
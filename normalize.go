@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+var lang = flag.String("lang", "en", "the language code of the wiki, used for title casing rules, by default the one in the dump's siteinfo if it has one")
+
+// titlesCaseSensitive is set for wikis whose titles can start with a lower
+// case letter, like Wiktionaries, going by their siteinfo, so
+// capitalizeTitle leaves them as they are.
+var titlesCaseSensitive bool
+
+// maxTitleBytes is the longest title MediaWiki allows.
+const maxTitleBytes = 255
+
+// validateTitle trims the whitespace around a title taken from a request and
+// returns a 400 if it's empty, longer than MediaWiki allows, not UTF-8 or
+// contains control characters, none of which can be in a real title.
+func validateTitle(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", statusErrorf(http.StatusBadRequest, "title is required")
+	}
+	if len(name) > maxTitleBytes {
+		return "", statusErrorf(http.StatusBadRequest, "title is %d bytes, longer than the limit of %d", len(name), maxTitleBytes)
+	}
+	if !utf8.ValidString(name) {
+		return "", statusErrorf(http.StatusBadRequest, "title isn't valid UTF-8")
+	}
+	if i := strings.IndexFunc(name, unicode.IsControl); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(name[i:])
+		return "", statusErrorf(http.StatusBadRequest, "title contains control character %U", r)
+	}
+	return name, nil
+}
+
+// capitalizeTitle upper cases the first letter of name using the casing rules
+// of the language lang, which is how MediaWiki canonicalizes titles. In
+// Turkish for example "istanbul" becomes "İstanbul" rather than "Istanbul".
+// On wikis with titlesCaseSensitive name is returned as it is.
+func capitalizeTitle(name, lang string) string {
+	_, size := utf8.DecodeRuneInString(name)
+	if size == 0 || titlesCaseSensitive {
+		return name
+	}
+	return cases.Upper(language.Make(lang)).String(name[:size]) + name[size:]
+}
+
+// titleCase lower cases name and then upper cases the first letter of each
+// word using the casing rules of the language lang.
+func titleCase(name, lang string) string {
+	return cases.Title(language.Make(lang)).String(name)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCapitalizeTitle(t *testing.T) {
+	cases := []struct {
+		in, lang, want string
+	}{
+		{"", "en", ""},
+		{"foo bar", "en", "Foo bar"},
+		{"istanbul", "en", "Istanbul"},
+		{"istanbul", "tr", "İstanbul"},
+		{"ıspanak", "tr", "Ispanak"},
+		{"über", "de", "Über"},
+		{"iPhone", "en", "IPhone"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.lang+"/"+c.in, func(t *testing.T) {
+			out := capitalizeTitle(c.in, c.lang)
+			if out != c.want {
+				t.Errorf("capitalizeTitle(%q, %q) = %q; not %q", c.in, c.lang, out, c.want)
+			}
+		})
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	cases := []struct {
+		in, lang, want string
+	}{
+		{"NEW YORK", "en", "New York"},
+		{"DİYARBAKIR İLİ", "tr", "Diyarbakır İli"},
+		{"IĞDIR", "tr", "Iğdır"},
+		{"IĞDIR", "en", "Iğdir"},
+		{"istanbul", "tr", "İstanbul"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.lang+"/"+c.in, func(t *testing.T) {
+			out := titleCase(c.in, c.lang)
+			if out != c.want {
+				t.Errorf("titleCase(%q, %q) = %q; not %q", c.in, c.lang, out, c.want)
+			}
+		})
+	}
+}
+
+func TestValidateTitle(t *testing.T) {
+	cases := []struct {
+		in, want string
+		valid    bool
+	}{
+		{"Foo", "Foo", true},
+		{"  Foo bar\n", "Foo bar", true},
+		{"Zürich", "Zürich", true},
+		{strings.Repeat("a", 255), strings.Repeat("a", 255), true},
+		{strings.Repeat("a", 256), "", false},
+		{"", "", false},
+		{"   ", "", false},
+		{"Foo\x00bar", "", false},
+		{"Foo\tbar", "", false},
+		{"Foo\u0085bar", "", false},
+		{"Foo\xffbar", "", false},
+	}
+
+	for _, c := range cases {
+		got, err := validateTitle(c.in)
+		if !c.valid {
+			if code, ok := errors.Cause(err).(statusError); !ok || code != http.StatusBadRequest {
+				t.Errorf("validateTitle(%q) = %q, %v; expected a 400", c.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("validateTitle(%q) = %q, %v; not %q", c.in, got, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	offsetCache         = flag.String("offsetCache", "", "the file to cache the loaded index in, so later starts can read it instead of parsing the index again, empty disables the cache")
+	offsetCacheCompress = flag.Bool("offsetCacheCompress", false, "gzip the -offsetCache when writing it, which makes it several times smaller but slower to load; either is read")
+)
+
+// offsetCacheVersion is incremented whenever the cache's format changes, so
+// caches written by older versions are rebuilt.
+const offsetCacheVersion = 1
+
+// offsetCacheChunk is the number of records gob encoded at a time.
+const offsetCacheChunk = 1 << 16
+
+// fileStamp identifies a version of a file, to tell if a cache of it is
+// stale.
+type fileStamp struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+func stampFile(path string) (fileStamp, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{Path: path, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (s fileStamp) same(o fileStamp) bool {
+	return s.Path == o.Path && s.Size == o.Size && s.ModTime.Equal(o.ModTime)
+}
+
+// offsetCacheHeader starts the cache, saying what it's a cache of.
+type offsetCacheHeader struct {
+	Version  int
+	Index    fileStamp
+	Articles fileStamp
+	Format   string
+	// Titles is set if every record has its title, as needed for -titles.
+	Titles bool
+}
+
+// offsetCacheRecord is one offsetIndex.add. Title is only set if titles
+// were retained or the record's ID is a duplicate.
+type offsetCacheRecord struct {
+	Hash     uint64
+	ID, Seek int
+	Title    string
+}
+
+// currentOffsetCacheHeader returns the header a cache of the index as
+// currently configured would have.
+func currentOffsetCacheHeader() (offsetCacheHeader, error) {
+	h := offsetCacheHeader{
+		Version: offsetCacheVersion,
+		Format:  *indexFormat + "\x00" + *indexDelim,
+		Titles:  *retainTitles,
+	}
+	var err error
+	if h.Articles, err = stampFile(*articlesFile); err != nil {
+		return offsetCacheHeader{}, err
+	}
+	if *indexFile != "" {
+		if h.Index, err = stampFile(*indexFile); err != nil {
+			return offsetCacheHeader{}, err
+		}
+	}
+	return h, nil
+}
+
+// readOffsetCache adds the index cached in -offsetCache to idx, reporting
+// false if there's no cache or it's not of the current index. idx is only
+// usable if it reports true.
+func readOffsetCache(idx *offsetIndex, want offsetCacheHeader) (bool, error) {
+	f, err := os.Open(*offsetCache)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	in, err := trackProgress(f)
+	if err != nil {
+		return false, err
+	}
+	br := bufio.NewReader(in)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return false, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	start := time.Now()
+	dec := gob.NewDecoder(r)
+	var h offsetCacheHeader
+	if err := dec.Decode(&h); err != nil {
+		return false, errors.Wrap(err, "reading offset cache header")
+	}
+	if h.Version != want.Version || h.Format != want.Format || !h.Index.same(want.Index) ||
+		!h.Articles.same(want.Articles) || (want.Titles && !h.Titles) {
+		log.Printf("Offset cache %s is stale, rebuilding it", *offsetCache)
+		return false, nil
+	}
+	for {
+		var chunk []offsetCacheRecord
+		if err := dec.Decode(&chunk); err != nil {
+			return false, errors.Wrap(err, "reading offset cache")
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		for _, rec := range chunk {
+			idx.addHash(rec.Hash, rec.Title, indexEntry{id: rec.ID, seek: rec.Seek})
+		}
+		atomic.AddInt64(&indexLinesRead, int64(len(chunk)))
+	}
+	log.Printf("Read offset cache %s in %s", *offsetCache, time.Since(start))
+	return true, nil
+}
+
+// offsetCacheWriter writes the cache as the index is loaded. It's written to
+// a temporary file that only replaces -offsetCache once it's complete.
+type offsetCacheWriter struct {
+	f     *os.File
+	buf   *bufio.Writer
+	gz    *gzip.Writer
+	enc   *gob.Encoder
+	chunk []offsetCacheRecord
+	err   error
+}
+
+func newOffsetCacheWriter(h offsetCacheHeader) (*offsetCacheWriter, error) {
+	f, err := ioutil.TempFile(filepath.Dir(*offsetCache), filepath.Base(*offsetCache)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &offsetCacheWriter{f: f, buf: bufio.NewWriter(f)}
+	var out io.Writer = w.buf
+	if *offsetCacheCompress {
+		w.gz = gzip.NewWriter(w.buf)
+		out = w.gz
+	}
+	w.enc = gob.NewEncoder(out)
+	if err := w.enc.Encode(h); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *offsetCacheWriter) add(rec offsetCacheRecord) {
+	if w.err != nil {
+		return
+	}
+	w.chunk = append(w.chunk, rec)
+	if len(w.chunk) == offsetCacheChunk {
+		w.err = w.enc.Encode(w.chunk)
+		w.chunk = w.chunk[:0]
+	}
+}
+
+// commit finishes the cache and moves it into place.
+func (w *offsetCacheWriter) commit() error {
+	err := w.err
+	if err == nil && len(w.chunk) > 0 {
+		err = w.enc.Encode(w.chunk)
+	}
+	if err == nil {
+		// An empty chunk marks the end.
+		err = w.enc.Encode([]offsetCacheRecord{})
+	}
+	if err == nil && w.gz != nil {
+		err = w.gz.Close()
+	}
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if err == nil {
+		err = w.f.Close()
+	}
+	if err != nil {
+		w.abort()
+		return err
+	}
+	if err := os.Rename(w.f.Name(), *offsetCache); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	if stat, err := os.Stat(*offsetCache); err == nil {
+		log.Printf("Wrote offset cache %s, %d bytes", *offsetCache, stat.Size())
+	}
+	return nil
+}
+
+func (w *offsetCacheWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creachadair/cityhash"
+)
+
+func TestOffsetCache(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		compress := compress
+		t.Run(map[bool]string{false: "plain", true: "gzip"}[compress], func(t *testing.T) {
+			useTestDump(t, denseBlock(50, 10))
+			oldIndex, oldCache, oldCompress := *indexFile, *offsetCache, *offsetCacheCompress
+			defer func() { *indexFile, *offsetCache, *offsetCacheCompress = oldIndex, oldCache, oldCompress }()
+			*indexFile = ""
+			*offsetCache = filepath.Join(t.TempDir(), "offsets.cache")
+			*offsetCacheCompress = compress
+
+			built, err := readOffsets(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if built.cache == nil {
+				t.Fatal("expected the cache to be rebuilt")
+			}
+			if err := built.cache.commit(); err != nil {
+				t.Fatal(err)
+			}
+			want, err := built.finish()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cached, err := readOffsets(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cached.cache != nil {
+				t.Fatal("expected the cache to be read")
+			}
+			got, err := cached.finish()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.len() != want.len() {
+				t.Fatalf("cached index has %d entries, want %d", got.len(), want.len())
+			}
+			for i := 0; i < 50; i++ {
+				hash := cityhash.Hash64([]byte(fmt.Sprintf("Page %d", i)))
+				wantEntry, _ := want.lookup(hash)
+				if gotEntry, ok := got.lookup(hash); !ok || gotEntry != wantEntry {
+					t.Errorf("Page %d: got %+v, %v, want %+v", i, gotEntry, ok, wantEntry)
+				}
+			}
+
+			// Touching the articles file makes the cache stale.
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(*articlesFile, later, later); err != nil {
+				t.Fatal(err)
+			}
+			stale, err := readOffsets(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale.cache == nil {
+				t.Fatal("expected a stale cache to be rebuilt")
+			}
+			stale.cache.abort()
+		})
+	}
+}
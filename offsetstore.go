@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var maxIndexMemory = flag.Int("maxIndexMemory", 0, "the megabytes of memory the title offsets may use before the rest of the index is built on disk, 0 keeps it all in memory")
+
+// mapEntryBytes is roughly what each entry of an in-memory offsets map costs,
+// counting the key, the value and the map's overhead.
+const mapEntryBytes = 48
+
+// offsetStore maps title hashes to where the titles are in the dump. A store
+// isn't modified once it's loaded, so it's safe for concurrent use.
+type offsetStore interface {
+	lookup(hash uint64) (indexEntry, bool)
+	len() int
+	each(fn func(hash uint64, entry indexEntry) error) error
+	// mode names how the store is kept, for /stats.
+	mode() string
+	close() error
+}
+
+// mapStore keeps the whole index in memory.
+type mapStore map[uint64]indexEntry
+
+func (s mapStore) lookup(hash uint64) (indexEntry, bool) {
+	entry, ok := s[hash]
+	return entry, ok
+}
+
+func (s mapStore) len() int     { return len(s) }
+func (s mapStore) mode() string { return "memory" }
+func (s mapStore) close() error { return nil }
+
+func (s mapStore) each(fn func(hash uint64, entry indexEntry) error) error {
+	for hash, entry := range s {
+		if err := fn(hash, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spilledStore is an index that outgrew -maxIndexMemory while loading. The
+// entries read before then are in mem and the rest on disk, with no hash in
+// both.
+type spilledStore struct {
+	mem  mapStore
+	disk *diskStore
+}
+
+func (s *spilledStore) lookup(hash uint64) (indexEntry, bool) {
+	if entry, ok := s.mem[hash]; ok {
+		return entry, true
+	}
+	entry, ok, err := s.disk.lookup(hash)
+	if err != nil {
+		log.Printf("reading on disk index: %+v", err)
+	}
+	return entry, ok
+}
+
+func (s *spilledStore) len() int     { return len(s.mem) + s.disk.count }
+func (s *spilledStore) mode() string { return "disk" }
+func (s *spilledStore) close() error { return s.disk.close() }
+
+func (s *spilledStore) each(fn func(hash uint64, entry indexEntry) error) error {
+	if err := s.mem.each(fn); err != nil {
+		return err
+	}
+	return s.disk.each(fn)
+}
+
+// diskRecordBytes is the size of an on disk index record: the title hash, the
+// page ID and the block offset as little endian 64 bit integers.
+const diskRecordBytes = 24
+
+// diskBuckets is the number of buckets records are split between by the top
+// bits of their hash while building, so each can be sorted in memory on its
+// own.
+const diskBuckets = 256
+
+func encodeRecord(buf []byte, hash uint64, entry indexEntry) {
+	binary.LittleEndian.PutUint64(buf[0:], hash)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(entry.id))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(entry.seek))
+}
+
+func decodeRecord(buf []byte) (uint64, indexEntry) {
+	return binary.LittleEndian.Uint64(buf[0:]), indexEntry{
+		id:   int(binary.LittleEndian.Uint64(buf[8:])),
+		seek: int(binary.LittleEndian.Uint64(buf[16:])),
+	}
+}
+
+// diskStoreWriter builds a diskStore, appending records to a temporary file
+// per bucket until finish sorts them.
+type diskStoreWriter struct {
+	dir     string
+	files   [diskBuckets]*os.File
+	writers [diskBuckets]*bufio.Writer
+	buf     [diskRecordBytes]byte
+}
+
+func newDiskStoreWriter() (*diskStoreWriter, error) {
+	dir, err := ioutil.TempDir("", "wikigopher-index")
+	if err != nil {
+		return nil, err
+	}
+	return &diskStoreWriter{dir: dir}, nil
+}
+
+func (w *diskStoreWriter) add(hash uint64, entry indexEntry) error {
+	b := hash >> 56
+	if w.files[b] == nil {
+		f, err := ioutil.TempFile(w.dir, "bucket")
+		if err != nil {
+			return err
+		}
+		w.files[b], w.writers[b] = f, bufio.NewWriter(f)
+	}
+	encodeRecord(w.buf[:], hash, entry)
+	_, err := w.writers[b].Write(w.buf[:])
+	return err
+}
+
+// finish sorts each bucket by hash, dropping all but the last record added
+// for a hash, and concatenates them into a single file that's searched in
+// place. Hashes in mem that are also on disk were added earlier, so they're
+// removed from mem.
+func (w *diskStoreWriter) finish(mem mapStore) (*diskStore, error) {
+	defer os.RemoveAll(w.dir)
+
+	f, err := ioutil.TempFile("", "wikigopher-index")
+	if err != nil {
+		return nil, err
+	}
+	// The file stays readable while it's open, and is cleaned up once it's
+	// closed or the process exits.
+	os.Remove(f.Name())
+
+	s := &diskStore{f: f}
+	out := bufio.NewWriter(f)
+	for b := range w.files {
+		s.starts[b] = s.count
+		if w.files[b] == nil {
+			continue
+		}
+		if err := w.writers[b].Flush(); err != nil {
+			f.Close()
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(w.files[b].Name())
+		w.files[b].Close()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		n := len(data) / diskRecordBytes
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		hashAt := func(i int) uint64 { return binary.LittleEndian.Uint64(data[i*diskRecordBytes:]) }
+		sort.SliceStable(order, func(i, j int) bool { return hashAt(order[i]) < hashAt(order[j]) })
+		for i, rec := range order {
+			if i+1 < n && hashAt(order[i+1]) == hashAt(rec) {
+				// A later record for the same hash replaces this one.
+				continue
+			}
+			delete(mem, hashAt(rec))
+			if _, err := out.Write(data[rec*diskRecordBytes : (rec+1)*diskRecordBytes]); err != nil {
+				f.Close()
+				return nil, err
+			}
+			s.count++
+		}
+	}
+	s.starts[diskBuckets] = s.count
+	if err := out.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// diskStore is a file of index records sorted by hash and searched with
+// binary search, mostly served from the OS's page cache.
+type diskStore struct {
+	f     *os.File
+	count int
+	// starts[b] is the index of the first record in bucket b.
+	starts [diskBuckets + 1]int
+}
+
+func (s *diskStore) lookup(hash uint64) (indexEntry, bool, error) {
+	b := hash >> 56
+	lo, hi := s.starts[b], s.starts[b+1]
+	var buf [diskRecordBytes]byte
+	var err error
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		if err != nil {
+			return true
+		}
+		if _, err = s.f.ReadAt(buf[:], int64(lo+i)*diskRecordBytes); err != nil {
+			return true
+		}
+		h, _ := decodeRecord(buf[:])
+		return h >= hash
+	})
+	if err != nil {
+		return indexEntry{}, false, errors.Wrap(err, "searching on disk index")
+	}
+	if i == hi {
+		return indexEntry{}, false, nil
+	}
+	if _, err := s.f.ReadAt(buf[:], int64(i)*diskRecordBytes); err != nil {
+		return indexEntry{}, false, errors.Wrap(err, "reading on disk index")
+	}
+	h, entry := decodeRecord(buf[:])
+	return entry, h == hash, nil
+}
+
+func (s *diskStore) each(fn func(hash uint64, entry indexEntry) error) error {
+	r := bufio.NewReader(io.NewSectionReader(s.f, 0, int64(s.count)*diskRecordBytes))
+	var buf [diskRecordBytes]byte
+	for i := 0; i < s.count; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return err
+		}
+		if err := fn(decodeRecord(buf[:])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *diskStore) close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/creachadair/cityhash"
+)
+
+func TestOffsetIndexSpillsToDisk(t *testing.T) {
+	defer func(m int) { *maxIndexMemory = m }(*maxIndexMemory)
+	*maxIndexMemory = 1
+
+	const n = 50000
+	idx := newOffsetIndex()
+	for i := 0; i < n; i++ {
+		idx.add(fmt.Sprintf("Title %d", i), indexEntry{id: i, seek: i / 100})
+	}
+	// Re-adding a title replaces it, whether it was first added in memory or
+	// on disk.
+	idx.add("Title 1", indexEntry{id: -1, seek: 1})
+	idx.add("Title 40000", indexEntry{id: -2, seek: 2})
+	if idx.spill == nil {
+		t.Fatalf("expected the index to spill to disk after %d entries", len(idx.offsets))
+	}
+	store, err := idx.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	if store.mode() != "disk" {
+		t.Errorf("mode = %q; not disk", store.mode())
+	}
+	if store.len() != n {
+		t.Errorf("len = %d; not %d", store.len(), n)
+	}
+	for i := 0; i < n; i++ {
+		want := indexEntry{id: i, seek: i / 100}
+		switch i {
+		case 1:
+			want = indexEntry{id: -1, seek: 1}
+		case 40000:
+			want = indexEntry{id: -2, seek: 2}
+		}
+		got, ok := store.lookup(cityhash.Hash64([]byte(fmt.Sprintf("Title %d", i))))
+		if !ok || got != want {
+			t.Fatalf("lookup(Title %d) = %+v, %v; not %+v", i, got, ok, want)
+		}
+	}
+	if _, ok := store.lookup(cityhash.Hash64([]byte("Missing"))); ok {
+		t.Errorf("found a title that was never added")
+	}
+
+	seen := 0
+	if err := store.each(func(hash uint64, entry indexEntry) error {
+		seen++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if seen != n {
+		t.Errorf("each visited %d entries; not %d", seen, n)
+	}
+}
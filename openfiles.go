@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	maxOpenFiles    = flag.Int("maxOpenFiles", 512, "the most handles of the articles file requests may have open at once, well under the usual open file limit of 1024, 0 for no limit")
+	openFileTimeout = flag.Duration("openFileTimeout", 10*time.Second, "how long a request waits for an articles file handle when -maxOpenFiles are open before failing with a 503")
+)
+
+// openFileSlots limits how many articles file handles are open at once. It's
+// recreated with the configured size by run, and nil without a limit.
+var openFileSlots chan struct{}
+
+// openArticleFiles is the number of articles file handles requests have
+// open.
+var openArticleFiles int64
+
+// articleHandle is an open handle of the articles file, counted against
+// -maxOpenFiles until it's closed.
+type articleHandle struct {
+	*os.File
+	slots chan struct{}
+	once  sync.Once
+}
+
+// openArticles opens the articles file for a request, first waiting up to
+// -openFileTimeout for a handle to be closed if -maxOpenFiles are already
+// open. Whole dump scans open their own handles, since there are only ever a
+// few of them.
+func openArticles() (*articleHandle, error) {
+	slots := openFileSlots
+	if slots != nil {
+		timer := time.NewTimer(*openFileTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			return nil, statusErrorf(http.StatusServiceUnavailable, "timed out waiting for one of the %d articles file handles", cap(slots))
+		}
+	}
+	f, err := os.Open(*articlesFile)
+	if err != nil {
+		if slots != nil {
+			<-slots
+		}
+		return nil, err
+	}
+	atomic.AddInt64(&openArticleFiles, 1)
+	return &articleHandle{File: f, slots: slots}, nil
+}
+
+// Close closes the handle and frees its slot. Only the first call does
+// anything.
+func (h *articleHandle) Close() error {
+	err := os.ErrClosed
+	h.once.Do(func() {
+		err = h.File.Close()
+		atomic.AddInt64(&openArticleFiles, -1)
+		if h.slots != nil {
+			<-h.slots
+		}
+	})
+	return err
+}
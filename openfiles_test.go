@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenArticlesLimit(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "text")})
+	defer func(slots chan struct{}, timeout time.Duration) {
+		openFileSlots, *openFileTimeout = slots, timeout
+	}(openFileSlots, *openFileTimeout)
+	openFileSlots, *openFileTimeout = make(chan struct{}, 1), 10*time.Millisecond
+
+	before := atomic.LoadInt64(&openArticleFiles)
+	f, err := openArticles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&openArticleFiles) - before; n != 1 {
+		t.Errorf("%d handles counted as open; not 1", n)
+	}
+	if _, err := openArticles(); errorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("opening past -maxOpenFiles = %v; expected a 503", err)
+	}
+	if _, err := lookupArticle("Foo"); errorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("lookupArticle past -maxOpenFiles = %v; expected a 503", err)
+	}
+
+	// Waiting requests get the handle once it's closed.
+	*openFileTimeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err := lookupArticle("Foo"); err != nil {
+		t.Errorf("lookupArticle after a handle was closed: %v", err)
+	}
+	// Closing twice doesn't free another slot.
+	f.Close()
+	if n := atomic.LoadInt64(&openArticleFiles) - before; n != 0 {
+		t.Errorf("%d handles still counted as open", n)
+	}
+	if len(openFileSlots) != 0 {
+		t.Errorf("%d slots still taken", len(openFileSlots))
+	}
+}
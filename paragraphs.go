@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type paragraph struct {
+	// Section is the title of the heading the paragraph is under, or "" in
+	// the lead.
+	Section string `json:"section"`
+	Text    string `json:"text"`
+}
+
+// splitParagraphs returns the plain text paragraphs of text, which are
+// separated by blank lines, each with the section it's in. Headings aren't
+// paragraphs. Blocks that are only list items are left out unless lists is
+// set.
+func splitParagraphs(text string, lists bool) []paragraph {
+	paragraphs := []paragraph{}
+	add := func(section, body string) {
+		for _, block := range strings.Split(plainText(body), "\n\n") {
+			block = strings.TrimSpace(block)
+			if block == "" || (!lists && isListBlock(block)) {
+				continue
+			}
+			paragraphs = append(paragraphs, paragraph{Section: section, Text: block})
+		}
+	}
+
+	sections := extractSections(text)
+	end := len(text)
+	if len(sections) > 0 {
+		end = sections[0].Offset
+	}
+	add("", text[:end])
+	for i, s := range sections {
+		start := len(text)
+		if nl := strings.IndexByte(text[s.Offset:], '\n'); nl >= 0 {
+			start = s.Offset + nl
+		}
+		end := len(text)
+		if i+1 < len(sections) {
+			end = sections[i+1].Offset
+		}
+		add(s.Title, text[start:end])
+	}
+	return paragraphs
+}
+
+// isListBlock reports whether every line of block is a list item.
+func isListBlock(block string) bool {
+	for _, line := range strings.Split(block, "\n") {
+		if line == "" || strings.IndexByte("*#:;", line[0]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// handleParagraphs serves /paragraphs?title=..., returning the plain text of
+// an article split into paragraphs, each with the title of the section it's
+// in, which makes for more meaningful chunks than /chunks' fixed sizes.
+// lists=true keeps blocks that are only list items.
+func handleParagraphs(w http.ResponseWriter, r *http.Request) error {
+	lists, _ := strconv.ParseBool(r.URL.Query().Get("lists"))
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, splitParagraphs(p.Text, lists))
+}
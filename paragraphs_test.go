@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitParagraphs(t *testing.T) {
+	text := "{{Infobox animal|name=Fox}}\n'''Foxes''' are [[mammal]]s.\n\nThey are small.\n\n" +
+		"== Habitat ==\nForests{{cn}} and\n[[grassland|fields]].\n\n{| class=\"wikitable\"\n| a\n|}\n\n" +
+		"=== Dens ===\n* Burrows\n* Hollows\n\nDens are dug.\n\n== See also ==\n* [[Wolf]]\n"
+
+	cases := []struct {
+		lists bool
+		want  []paragraph
+	}{
+		{false, []paragraph{
+			{"", "Foxes are mammals."},
+			{"", "They are small."},
+			{"Habitat", "Forests and\nfields."},
+			{"Dens", "Dens are dug."},
+		}},
+		{true, []paragraph{
+			{"", "Foxes are mammals."},
+			{"", "They are small."},
+			{"Habitat", "Forests and\nfields."},
+			{"Dens", "* Burrows\n* Hollows"},
+			{"Dens", "Dens are dug."},
+			{"See also", "* Wolf"},
+		}},
+	}
+	for _, c := range cases {
+		if got := splitParagraphs(text, c.lists); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitParagraphs(lists=%v) = %q; not %q", c.lists, got, c.want)
+		}
+	}
+	if got := splitParagraphs("", false); got == nil || len(got) != 0 {
+		t.Errorf("splitParagraphs(\"\") = %#v; expected []", got)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	behaviorSwitchRegexp = regexp.MustCompile(`__[A-Z]+__`)
+	listItemRegexp       = regexp.MustCompile(`^([*#]+)\s*(.*)$`)
+	extLinkRegexp        = regexp.MustCompile(`^\[((?:https?:)?//[^\s\]]+)(?:\s+([^\]]*))?\]`)
+)
+
+// templatePlaceholder stands in for the n'th template of the text while it's
+// split into blocks, so templates spanning several lines stay in one piece.
+// It uses characters that can't appear in XML.
+func templatePlaceholder(n int) string {
+	return "\x00" + strconv.Itoa(n) + "\x00"
+}
+
+var templatePlaceholderRegexp = regexp.MustCompile("\x00([0-9]+)\x00")
+
+// parsoidHTML renders p as a subset of the HTML MediaWiki's Parsoid produces,
+// for tools written against it. Supported are:
+//
+//   - sections, as nested <section data-mw-section-id="N"> elements with the
+//     lead as section 0, and headings with their anchors as ids
+//   - paragraphs, ” and ”' emphasis, and bulleted and numbered lists, which
+//     aren't nested
+//   - wiki links as <a rel="mw:WikiLink">, external links in brackets as
+//     <a rel="mw:ExtLink"> and categories as <link rel="mw:PageProp/Category">
+//   - templates and parser functions as empty <span typeof="mw:Transclusion">
+//     markers whose data-mw has the template's name and parameters, since
+//     templates can't be expanded from the dump
+//
+// With opts.resolveMedia, files and images are <span typeof="mw:File">
+// wrapping an <img> of the file on Commons, see commonsURL, without their
+// options or captions.
+//
+// Everything else is dropped: references, tables, files and images unless
+// they're resolved, interlanguage links, comments, behavior switches like
+// __NOTOC__ and HTML tags, although the text inside tags is kept. Bare URLs
+// aren't linked. The magic words resolveMagicWords knows are substituted
+// first, so they're text rather than transclusions.
+func parsoidHTML(p page, opts renderOptions) string {
+	text := commentRegexp.ReplaceAllString(resolveMagicWords(p.Text, p), "")
+	text = refRegexp.ReplaceAllString(text, "")
+	text = stripNested(text, "{|", "|}")
+	text, templates := replaceTemplates(text)
+	text = behaviorSwitchRegexp.ReplaceAllString(text, "")
+
+	r := &parsoidRenderer{templates: templates, opts: opts}
+	r.b.WriteString(`<!DOCTYPE html>` + "\n")
+	r.b.WriteString(`<html prefix="dc: http://purl.org/dc/terms/ mw: http://mediawiki.org/rdf/">`)
+	fmt.Fprintf(&r.b, `<head><meta charset="utf-8"/><meta property="mw:pageId" content="%d"/><meta property="mw:pageNamespace" content="%d"/><title>%s</title></head>`,
+		p.ID, p.NS, html.EscapeString(p.Title))
+	fmt.Fprintf(&r.b, `<body class="mw-content-ltr mw-parser-output" lang="%s">`, html.EscapeString(*lang))
+	r.render(text)
+	r.b.WriteString("</body></html>\n")
+	return r.b.String()
+}
+
+type parsoidRenderer struct {
+	b         strings.Builder
+	templates []string
+	opts      renderOptions
+	// levels is the heading level of each open section, with 0 for the lead.
+	levels   []int
+	sections int
+	anchors  map[string]int
+	// para is the paragraph being collected and list the type of the open
+	// list, "ul" or "ol", if there is one.
+	para []string
+	list string
+}
+
+func (r *parsoidRenderer) render(text string) {
+	r.anchors = map[string]int{}
+	r.openSection(0)
+	for _, line := range strings.Split(text, "\n") {
+		if m := headingRegexp.FindStringSubmatch(line); m != nil {
+			level := len(m[1])
+			if len(m[3]) < level {
+				level = len(m[3])
+			}
+			r.heading(level, m[2])
+			continue
+		}
+		if m := listItemRegexp.FindStringSubmatch(line); m != nil {
+			r.flushParagraph()
+			list := "ul"
+			if strings.HasSuffix(m[1], "#") {
+				list = "ol"
+			}
+			if list != r.list {
+				r.closeList()
+				r.list = list
+				r.b.WriteString("<" + list + ">")
+			}
+			r.b.WriteString("<li>" + r.inline(m[2]) + "</li>")
+			continue
+		}
+		r.closeList()
+		if strings.TrimSpace(line) == "" {
+			r.flushParagraph()
+			continue
+		}
+		if body := r.inline(line); strings.TrimSpace(htmlTagRegexp.ReplaceAllString(body, "")) == "" {
+			// A line of nothing but templates, categories and the like isn't
+			// part of a paragraph, like Parsoid doesn't wrap an infobox.
+			r.flushParagraph()
+			r.b.WriteString(strings.TrimSpace(body))
+			continue
+		}
+		r.para = append(r.para, line)
+	}
+	r.flushParagraph()
+	r.closeList()
+	for range r.levels {
+		r.b.WriteString("</section>")
+	}
+}
+
+// heading closes the sections at level or deeper, and the lead, and opens a
+// new one.
+func (r *parsoidRenderer) heading(level int, title string) {
+	r.flushParagraph()
+	r.closeList()
+	for len(r.levels) > 0 && (r.levels[len(r.levels)-1] >= level || r.levels[len(r.levels)-1] == 0) {
+		r.levels = r.levels[:len(r.levels)-1]
+		r.b.WriteString("</section>")
+	}
+	r.openSection(level)
+
+	anchor := sectionAnchor(plainText(title))
+	r.anchors[anchor]++
+	if n := r.anchors[anchor]; n > 1 {
+		anchor += "_" + strconv.Itoa(n)
+	}
+	fmt.Fprintf(&r.b, `<h%d id="%s">%s</h%d>`, level, html.EscapeString(anchor), r.inline(title), level)
+}
+
+func (r *parsoidRenderer) openSection(level int) {
+	r.levels = append(r.levels, level)
+	fmt.Fprintf(&r.b, `<section data-mw-section-id="%d">`, r.sections)
+	r.sections++
+}
+
+func (r *parsoidRenderer) flushParagraph() {
+	if len(r.para) == 0 {
+		return
+	}
+	body := r.inline(strings.Join(r.para, "\n"))
+	r.para = nil
+	r.b.WriteString("<p>" + body + "</p>")
+}
+
+func (r *parsoidRenderer) closeList() {
+	if r.list != "" {
+		r.b.WriteString("</" + r.list + ">")
+		r.list = ""
+	}
+}
+
+// inline renders the links, templates and emphasis in s, escaping the rest.
+func (r *parsoidRenderer) inline(s string) string {
+	var b strings.Builder
+	var bold, italic bool
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "'''''"):
+			bold, italic = !bold, !italic
+			if bold {
+				b.WriteString("<b><i>")
+			} else {
+				b.WriteString("</i></b>")
+			}
+			i += 5
+		case strings.HasPrefix(s[i:], "'''"):
+			toggleTag(&b, &bold, "b")
+			i += 3
+		case strings.HasPrefix(s[i:], "''"):
+			toggleTag(&b, &italic, "i")
+			i += 2
+		case strings.HasPrefix(s[i:], "[["):
+			end := matchingClose(s, i)
+			if end < 0 {
+				b.WriteString(html.EscapeString(s[i:]))
+				i = len(s)
+				continue
+			}
+			b.WriteString(r.wikiLink(s[i+2 : end]))
+			i = end + 2
+		case s[i] == '[':
+			m := extLinkRegexp.FindStringSubmatch(s[i:])
+			if m == nil {
+				b.WriteByte('[')
+				i++
+				continue
+			}
+			class := "external text"
+			if m[2] == "" {
+				class = "external autonumber"
+			}
+			fmt.Fprintf(&b, `<a rel="mw:ExtLink" class="%s" href="%s">%s</a>`, class, html.EscapeString(m[1]), r.inline(m[2]))
+			i += len(m[0])
+		case s[i] == 0:
+			m := templatePlaceholderRegexp.FindStringSubmatch(s[i:])
+			if m == nil {
+				i++
+				continue
+			}
+			n, _ := strconv.Atoi(m[1])
+			b.WriteString(r.transclusion(n))
+			i += len(m[0])
+		case s[i] == '<':
+			// HTML tags are dropped, keeping the text inside them.
+			if loc := htmlTagRegexp.FindStringIndex(s[i:]); loc != nil && loc[0] == 0 {
+				i += loc[1]
+				continue
+			}
+			b.WriteString("&lt;")
+			i++
+		default:
+			j := i + 1
+			for j < len(s) && strings.IndexByte("'[<\x00", s[j]) < 0 {
+				j++
+			}
+			// Text is escaped as is, including entities the wikitext already
+			// has, which the browser decodes.
+			b.WriteString(strings.Replace(strings.Replace(s[i:j], `"`, "&quot;", -1), ">", "&gt;", -1))
+			i = j
+		}
+	}
+	if italic {
+		b.WriteString("</i>")
+	}
+	if bold {
+		b.WriteString("</b>")
+	}
+	return b.String()
+}
+
+// toggleTag opens tag if it isn't open and closes it if it is.
+func toggleTag(b *strings.Builder, open *bool, tag string) {
+	if *open {
+		b.WriteString("</" + tag + ">")
+	} else {
+		b.WriteString("<" + tag + ">")
+	}
+	*open = !*open
+}
+
+// wikiLink renders the inside of a [[...]] link.
+func (r *parsoidRenderer) wikiLink(inner string) string {
+	target, label := inner, ""
+	if i := strings.IndexByte(inner, '|'); i >= 0 {
+		target, label = inner[:i], inner[i+1:]
+	}
+	target = strings.TrimSpace(target)
+	if i := strings.IndexByte(target, ':'); i > 0 {
+		prefix := strings.TrimSpace(target[:i])
+		switch {
+		case strings.EqualFold(prefix, "category"):
+			name := strings.TrimSpace(target[i+1:])
+			return fmt.Sprintf(`<link rel="mw:PageProp/Category" href="%s"/>`, html.EscapeString(parsoidHref("Category:"+upperFirst(name))))
+		case r.opts.resolveMedia && (strings.EqualFold(prefix, "file") || strings.EqualFold(prefix, "image")):
+			name := normalizeLinkTarget(target[i+1:])
+			if name == "" {
+				return ""
+			}
+			href := html.EscapeString(parsoidHref("File:" + name))
+			return fmt.Sprintf(`<span typeof="mw:File"><a href="%s"><img resource="%s" src="%s"/></a></span>`, href, href, html.EscapeString(commonsURL(name)))
+		case isNonProseLink(target):
+			return ""
+		}
+	}
+	target = strings.TrimPrefix(target, ":")
+	if label == "" {
+		label = target
+		if strings.HasSuffix(inner, "|") {
+			// The pipe trick: [[Foo (bar)|]] renders as "Foo".
+			if p := strings.Index(label, " ("); p > 0 {
+				label = label[:p]
+			}
+		}
+	}
+	title, fragment := target, ""
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		title, fragment = target[:i], target[i:]
+	}
+	title = normalizeLinkTarget(title)
+	return fmt.Sprintf(`<a rel="mw:WikiLink" href="%s" title="%s">%s</a>`,
+		html.EscapeString(parsoidHref(title)+strings.Replace(fragment, " ", "_", -1)), html.EscapeString(title), r.inline(label))
+}
+
+// hrefUnescaper undoes the escaping of the punctuation Parsoid leaves alone
+// in links.
+var hrefUnescaper = strings.NewReplacer("%28", "(", "%29", ")", "%2C", ",", "%3A", ":", "%27", "'", "%21", "!")
+
+// parsoidHref is the relative link Parsoid uses for a title, like
+// ./Albert_Einstein.
+func parsoidHref(title string) string {
+	return "./" + hrefUnescaper.Replace(url.PathEscape(strings.Replace(title, " ", "_", -1)))
+}
+
+type transclusionTarget struct {
+	WT   string `json:"wt"`
+	Href string `json:"href,omitempty"`
+}
+
+type transclusionParam struct {
+	WT string `json:"wt"`
+}
+
+type transclusionTemplate struct {
+	Target transclusionTarget           `json:"target"`
+	Params map[string]transclusionParam `json:"params"`
+	I      int                          `json:"i"`
+}
+
+type transclusionPart struct {
+	Template transclusionTemplate `json:"template"`
+}
+
+// transclusion renders the n'th template as an empty marker describing it.
+func (r *parsoidRenderer) transclusion(n int) string {
+	if n >= len(r.templates) {
+		return ""
+	}
+	parts := splitTemplateParams(r.templates[n])
+	name := strings.TrimSpace(parts[0])
+	tmpl := transclusionTemplate{
+		Target: transclusionTarget{WT: name},
+		Params: map[string]transclusionParam{},
+	}
+	if !strings.Contains(name, ":") {
+		tmpl.Target.Href = parsoidHref("Template:" + normalizeLinkTarget(name))
+	}
+	positional := 0
+	for _, param := range parts[1:] {
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			tmpl.Params[strings.TrimSpace(param[:i])] = transclusionParam{WT: strings.TrimSpace(param[i+1:])}
+			continue
+		}
+		positional++
+		tmpl.Params[strconv.Itoa(positional)] = transclusionParam{WT: param}
+	}
+	dataMW, _ := json.Marshal(struct {
+		Parts []transclusionPart `json:"parts"`
+	}{[]transclusionPart{{tmpl}}})
+	return fmt.Sprintf(`<span about="#mwt%d" typeof="mw:Transclusion" data-mw="%s"></span>`, n+1, html.EscapeString(string(dataMW)))
+}
+
+// replaceTemplates replaces each outermost {{...}} in s with a
+// templatePlaceholder, returning the insides of the templates in order.
+// An unterminated template is left as text.
+func replaceTemplates(s string) (string, []string) {
+	var b strings.Builder
+	var templates []string
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		end, depth := -1, 0
+		for i := start; i+1 < len(s); i++ {
+			switch s[i : i+2] {
+			case "{{":
+				depth++
+				i++
+			case "}}":
+				depth--
+				i++
+			}
+			if depth == 0 {
+				end = i - 1
+				break
+			}
+		}
+		if end < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:start])
+		b.WriteString(templatePlaceholder(len(templates)))
+		templates = append(templates, s[start+2:end])
+		s = s[end+2:]
+	}
+	return b.String(), templates
+}
+
+// splitTemplateParams splits the inside of a template on the pipes that
+// aren't in a nested template or link, so the first part is its name.
+func splitTemplateParams(inner string) []string {
+	var parts []string
+	start, depth := 0, 0
+	for i := 0; i < len(inner); i++ {
+		switch {
+		case strings.HasPrefix(inner[i:], "{{"), strings.HasPrefix(inner[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(inner[i:], "}}"), strings.HasPrefix(inner[i:], "]]"):
+			depth--
+			i++
+		case depth == 0 && inner[i] == '|':
+			parts = append(parts, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, inner[start:])
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParsoidHTML(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+		drop []string
+	}{
+		{
+			"'''Foo''' is a [[city]] in [[Bar (country)|Bar]].\n\nSecond ''para''.",
+			[]string{
+				`<section data-mw-section-id="0"><p><b>Foo</b> is a <a rel="mw:WikiLink" href="./City" title="City">city</a> in <a rel="mw:WikiLink" href="./Bar_(country)" title="Bar (country)">Bar</a>.</p><p>Second <i>para</i>.</p></section>`,
+			},
+			nil,
+		},
+		{
+			"Lead.\n== History ==\nOld.\n=== Early ===\nEarly.\n== See also ==\n* [[One]]\n* two\n# three",
+			[]string{
+				`<section data-mw-section-id="0"><p>Lead.</p></section>`,
+				`<section data-mw-section-id="1"><h2 id="History">History</h2><p>Old.</p><section data-mw-section-id="2"><h3 id="Early">Early</h3><p>Early.</p></section></section>`,
+				`<section data-mw-section-id="3"><h2 id="See_also">See also</h2><ul><li><a rel="mw:WikiLink" href="./One" title="One">One</a></li><li>two</li></ul><ol><li>three</li></ol></section>`,
+			},
+			nil,
+		},
+		{
+			"{{Infobox city\n| name = Foo\n| pop = {{formatnum:100}}\n}}\nSee {{lang|de|Foo}}.",
+			[]string{
+				`<section data-mw-section-id="0"><span about="#mwt1" typeof="mw:Transclusion" data-mw="{&#34;parts&#34;:[{&#34;template&#34;:{&#34;target&#34;:{&#34;wt&#34;:&#34;Infobox city&#34;,&#34;href&#34;:&#34;./Template:Infobox_city&#34;},&#34;params&#34;:{&#34;name&#34;:{&#34;wt&#34;:&#34;Foo&#34;},&#34;pop&#34;:{&#34;wt&#34;:&#34;{{formatnum:100}}&#34;}},&#34;i&#34;:0}}]}"></span><p>See `,
+				`&#34;params&#34;:{&#34;1&#34;:{&#34;wt&#34;:&#34;de&#34;},&#34;2&#34;:{&#34;wt&#34;:&#34;Foo&#34;}}`,
+			},
+			nil,
+		},
+		{
+			"Site [http://example.com the site] and [https://example.org].\n[[Category:Cities]]",
+			[]string{
+				`<a rel="mw:ExtLink" class="external text" href="http://example.com">the site</a>`,
+				`<a rel="mw:ExtLink" class="external autonumber" href="https://example.org"></a>`,
+				`</p><link rel="mw:PageProp/Category" href="./Category:Cities"/></section>`,
+			},
+			nil,
+		},
+		{
+			"Text<ref>Cited.</ref> <!-- hidden --> <small>kept</small>\n{|\n| cell\n|}\n[[File:Foo.jpg|thumb|A caption]]\n[[de:Foo]]\n__NOTOC__",
+			[]string{`<p>Text  kept</p>`},
+			[]string{"Cited", "hidden", "cell", "caption", "de:Foo", "NOTOC", "<small>"},
+		},
+	}
+
+	for _, c := range cases {
+		got := parsoidHTML(testPage(1, "Foo", c.text), renderOptions{})
+		for _, want := range c.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("parsoidHTML(%q) = %s; expected it to contain %s", c.text, got, want)
+			}
+		}
+		for _, drop := range c.drop {
+			if strings.Contains(got, drop) {
+				t.Errorf("parsoidHTML(%q) = %s; expected %s to be dropped", c.text, got, drop)
+			}
+		}
+	}
+}
+
+func TestHandleArticleFormat(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "'''Foo''' [[bar]]")})
+
+	for _, c := range []struct {
+		format      string
+		code        int
+		contentType string
+		want        string
+	}{
+		{"wikitext", http.StatusOK, "text/plain; charset=utf-8", "'''Foo''' [[bar]]"},
+		{"plain", http.StatusOK, "text/plain; charset=utf-8", "Foo bar"},
+		{"parsoid-html", http.StatusOK, "text/html; charset=utf-8", `<title>Foo</title>`},
+		{"pdf", http.StatusBadRequest, "application/json", "unknown format"},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Foo&format="+c.format, nil))
+		if w.Code != c.code || w.Header().Get("Content-Type") != c.contentType || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("format=%s: got %d %s %s; expected %d %s containing %s", c.format, w.Code, w.Header().Get("Content-Type"), w.Body, c.code, c.contentType, c.want)
+		}
+	}
+}
+
+func TestResolveMedia(t *testing.T) {
+	if got, want := commonsURL("example.jpg"), "https://upload.wikimedia.org/wikipedia/commons/a/a9/Example.jpg"; got != want {
+		t.Errorf("commonsURL = %s; not %s", got, want)
+	}
+
+	useTestDump(t, []page{testPage(1, "Foo", "Text\n[[File:Example.jpg|thumb|A [[caption]]]]\n[[Image:Two words.png]]")})
+	w := httptest.NewRecorder()
+	handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Foo&resolveMedia=true&format=parsoid-html", nil))
+	for _, want := range []string{
+		`<span typeof="mw:File"><a href="./File:Example.jpg"><img resource="./File:Example.jpg" src="https://upload.wikimedia.org/wikipedia/commons/a/a9/Example.jpg"/></a></span>`,
+		`src="https://upload.wikimedia.org/wikipedia/commons/`,
+		`/Two_words.png"/>`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("got %s; expected it to contain %s", w.Body, want)
+		}
+	}
+	if strings.Contains(w.Body.String(), "caption") {
+		t.Errorf("got %s; expected the caption to be dropped", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Foo&resolveMedia=true", nil))
+	var resp articleResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Media) != 2 || resp.Media[0].Name != "Example.jpg" || resp.Media[0].URL != commonsURL("Example.jpg") || resp.Media[1].Name != "Two words.png" {
+		t.Errorf("media = %+v", resp.Media)
+	}
+}
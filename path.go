@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/creachadair/cityhash"
+)
+
+var (
+	pathMaxDepth      = flag.Int("pathMaxDepth", 6, "the most links /path looks for a path between two articles within")
+	pathMaxExpansions = flag.Int("pathMaxExpansions", 100000, "the most articles /path expands the links of before giving up")
+	pathCacheSize     = flag.Int("pathCacheSize", 1000, "the number of /path results to cache")
+)
+
+// pathCache is recreated with the configured size by run.
+var pathCache = newLRUCache(*pathCacheSize)
+
+// pathKey is a pathCache key. generation is the link index's, so paths
+// through an older link graph aren't reused.
+type pathKey struct {
+	generation int
+	from, to   string
+}
+
+type linkPath struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Path   []string `json:"path"`
+	Length int      `json:"length"`
+}
+
+// shortestPath returns the shortest chain of links from one article to
+// another, as the hashes of the articles along it including both ends. It
+// runs a breadth first search from each end, forward along outgoing links
+// from the start and back along incoming links from the end, always
+// expanding whichever frontier is smaller, until they meet. It gives up with
+// nil if they haven't met within maxDepth links, and with false as well once
+// maxExpansions articles have been expanded.
+func shortestPath(outgoing, incoming map[uint64][]uint64, from, to uint64, maxDepth, maxExpansions int) ([]uint64, bool) {
+	if from == to {
+		return []uint64{from}, true
+	}
+	forward := map[uint64]uint64{from: from}
+	backward := map[uint64]uint64{to: to}
+	fwd, bwd := []uint64{from}, []uint64{to}
+	expanded := 0
+	for depth := 0; depth < maxDepth && len(fwd) > 0 && len(bwd) > 0; depth++ {
+		// Expanding the smaller side keeps both searches shallow.
+		frontier, edges, parents, other := &fwd, outgoing, forward, backward
+		if len(bwd) < len(fwd) {
+			frontier, edges, parents, other = &bwd, incoming, backward, forward
+		}
+		var next []uint64
+		for _, n := range *frontier {
+			if expanded++; expanded > maxExpansions {
+				return nil, false
+			}
+			for _, m := range edges[n] {
+				if _, ok := parents[m]; ok {
+					continue
+				}
+				parents[m] = n
+				if _, ok := other[m]; ok {
+					return joinPath(forward, backward, m), true
+				}
+				next = append(next, m)
+			}
+		}
+		*frontier = next
+	}
+	return nil, true
+}
+
+// joinPath follows the parents of meet back to the start of the forward
+// search and on to the end of the backward one.
+func joinPath(forward, backward map[uint64]uint64, meet uint64) []uint64 {
+	var path []uint64
+	for n := meet; ; n = forward[n] {
+		path = append(path, n)
+		if forward[n] == n {
+			break
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	for n := meet; backward[n] != n; {
+		n = backward[n]
+		path = append(path, n)
+	}
+	return path
+}
+
+// handlePath serves /path?from=...&to=..., returning the shortest chain of
+// wiki links from one article to the other, or a 404 if there isn't one
+// within -pathMaxDepth links or it can't be found within -pathMaxExpansions
+// articles, see shortestPath. Links to redirects aren't followed through to
+// their targets. Requires -links, and recent results are cached.
+func handlePath(w http.ResponseWriter, r *http.Request) error {
+	if !*links {
+		return statusErrorf(http.StatusServiceUnavailable, "link index disabled, start with -links")
+	}
+	q := r.URL.Query()
+	from, err := validateTitle(q.Get("from"))
+	if err != nil {
+		return err
+	}
+	to, err := validateTitle(q.Get("to"))
+	if err != nil {
+		return err
+	}
+	from, to = normalizeLinkTarget(from), normalizeLinkTarget(to)
+
+	linkIndex.Lock()
+	built, generation := linkIndex.built, linkIndex.generation
+	titles, outgoing, incoming := linkIndex.titles, linkIndex.outgoing, linkIndex.incoming
+	linkIndex.Unlock()
+	if !built {
+		return statusErrorf(http.StatusServiceUnavailable, "link index is still being built")
+	}
+
+	key := pathKey{generation, from, to}
+	if cached, ok := pathCache.get(key); ok {
+		return writePath(w, r, cached.(linkPath))
+	}
+	fromHash, toHash := cityhash.Hash64([]byte(from)), cityhash.Hash64([]byte(to))
+	for _, t := range []struct {
+		title string
+		hash  uint64
+	}{{from, fromHash}, {to, toHash}} {
+		if _, ok := titles[t.hash]; !ok {
+			return articleNotFound("%q not found", t.title)
+		}
+	}
+
+	hashes, complete := shortestPath(outgoing, incoming, fromHash, toHash, *pathMaxDepth, *pathMaxExpansions)
+	if !complete {
+		return articleNotFound("no path from %q to %q found within %d articles", from, to, *pathMaxExpansions)
+	}
+	p := linkPath{From: from, To: to}
+	if hashes != nil {
+		for _, h := range hashes {
+			p.Path = append(p.Path, titles[h])
+		}
+		p.Length = len(hashes) - 1
+	}
+	pathCache.add(key, p)
+	return writePath(w, r, p)
+}
+
+func writePath(w http.ResponseWriter, r *http.Request, p linkPath) error {
+	if p.Path == nil {
+		return articleNotFound("no path from %q to %q within %d links", p.From, p.To, *pathMaxDepth)
+	}
+	return writeJSON(w, r, p)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestHandlePath(t *testing.T) {
+	defer func(l bool, depth, expansions int) {
+		*links, *pathMaxDepth, *pathMaxExpansions = l, depth, expansions
+	}(*links, *pathMaxDepth, *pathMaxExpansions)
+	*links = true
+	useTestDump(t, []page{
+		testPage(1, "A", "[[B]] and [[e]]"),
+		testPage(2, "B", "[[C]]"),
+		testPage(3, "C", "[[D]]"),
+		testPage(4, "D", "the end"),
+		testPage(5, "E", "[[D|dee]]"),
+		testPage(6, "F", "[[F]]"),
+	})
+	if err := buildLinkIndex(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		linkIndex.Lock()
+		linkIndex.built = false
+		linkIndex.titles, linkIndex.outgoing, linkIndex.incoming = nil, nil, nil
+		linkIndex.Unlock()
+	}()
+
+	for _, c := range []struct {
+		from, to          string
+		depth, expansions int
+		status            int
+		want              []string
+	}{
+		{"A", "D", 6, 100, http.StatusOK, []string{"A", "E", "D"}},
+		{"a", "C", 6, 100, http.StatusOK, []string{"A", "B", "C"}},
+		{"B", "B", 6, 100, http.StatusOK, []string{"B"}},
+		{"D", "A", 6, 100, http.StatusNotFound, nil},
+		{"A", "F", 6, 100, http.StatusNotFound, nil},
+		{"Missing", "A", 6, 100, http.StatusNotFound, nil},
+		{"A", "D", 1, 100, http.StatusNotFound, nil},
+		{"A", "D", 6, 1, http.StatusNotFound, nil},
+		{"", "D", 6, 100, http.StatusBadRequest, nil},
+	} {
+		*pathMaxDepth, *pathMaxExpansions = c.depth, c.expansions
+		pathCache = newLRUCache(*pathCacheSize)
+		req := httptest.NewRequest("GET", "/path?from="+url.QueryEscape(c.from)+"&to="+url.QueryEscape(c.to), nil)
+		w := httptest.NewRecorder()
+		handle(handlePath)(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s to %s: status = %d; not %d: %s", c.from, c.to, w.Code, c.status, w.Body)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var got linkPath
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Path, c.want) || got.Length != len(c.want)-1 {
+			t.Errorf("%s to %s: path = %q, length %d; not %q", c.from, c.to, got.Path, got.Length, c.want)
+		}
+	}
+}
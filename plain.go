@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/html/charset"
+)
+
+// isCompressed reports whether the dump file at path is bzip2 compressed,
+// judged by its extension.
+func isCompressed(path string) bool {
+	return strings.HasSuffix(path, ".bz2")
+}
+
+// articleReader wraps a reader positioned at a block in the articles file at
+// path so that it yields XML, decompressing it unless the file has already
+// been decompressed.
+//
+// Unlike the index, blocks are decompressed with compress/bzip2 rather than
+// pbzip2. pbzip2 splits its input between goroutines by bzip2 block, 900KB
+// of XML each, but a block of 100 articles is usually only one or two of
+// them, so there's nothing to parallelize. It also reads ahead, and since r
+// runs on to the end of the file it would decompress the following blocks
+// only for them to be thrown away. compress/bzip2 only reads as far as the
+// pages findPage consumes; see BenchmarkBlockDecompress.
+func articleReader(path string, r io.Reader) io.Reader {
+	if isCompressed(path) {
+		return bzip2.NewReader(r)
+	}
+	return r
+}
+
+var encodingRegexp = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// dumpEncodings caches the declared encoding of each articles file.
+var dumpEncodings = struct {
+	sync.Mutex
+	m map[string]string
+}{m: map[string]string{}}
+
+// dumpEncoding returns the character encoding declared in the XML prolog of
+// the articles file at path, or "" if it doesn't declare one. The
+// declaration only appears at the start of the file, so blocks read from the
+// middle of it never see it.
+func dumpEncoding(path string) (string, error) {
+	dumpEncodings.Lock()
+	defer dumpEncodings.Unlock()
+
+	if enc, ok := dumpEncodings.m[path]; ok {
+		return enc, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	prolog, err := bufio.NewReader(articleReader(path, f)).Peek(1024)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	enc := ""
+	if m := encodingRegexp.FindSubmatch(prolog); m != nil && !strings.EqualFold(string(m[1]), "utf-8") {
+		enc = string(m[1])
+	}
+	dumpEncodings.m[path] = enc
+	return enc, nil
+}
+
+// utf8Reader wraps a reader positioned at a block in the articles file at
+// path so that it yields UTF-8 XML, transcoding it if the file declares
+// another encoding. Setting CharsetReader on the decoder isn't enough since
+// it only takes effect when the decoder reads the declaration itself.
+func utf8Reader(path string, r io.Reader) (io.Reader, error) {
+	r = articleReader(path, r)
+	enc, err := dumpEncoding(path)
+	if err != nil || enc == "" {
+		return r, err
+	}
+	return charset.NewReaderLabel(enc, r)
+}
+
+// indexPlainArticles builds the index for an uncompressed articles file by
+// scanning it for pages and recording the byte offset of each one. The
+// offsets in a multistream index point into the compressed file, so they
+// can't be used with a decompressed copy. Every page is its own "block" so
+// readArticle decodes exactly one page per lookup.
+func indexPlainArticles(idx *offsetIndex) error {
+	f, err := os.Open(*articlesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	in, err := trackProgress(f)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Indexing uncompressed articles file...")
+	d := xml.NewDecoder(in)
+	i := 0
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "page" {
+			continue
+		}
+		if idx.limit > 0 && i >= idx.limit {
+			idx.end = int(offset)
+			log.Printf("Stopped indexing at -indexLimit=%d pages", idx.limit)
+			return nil
+		}
+		var p page
+		if err := d.DecodeElement(&p, &start); err != nil {
+			return err
+		}
+		entry := indexEntry{
+			id:   p.ID,
+			seek: int(offset),
+		}
+
+		idx.add(p.Title, entry)
+		atomic.AddInt64(&indexLinesRead, 1)
+
+		i++
+		if i%100000 == 0 {
+			log.Printf("indexed %d pages", i)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	commentRegexp    = regexp.MustCompile(`(?s)<!--.*?-->`)
+	refRegexp        = regexp.MustCompile(`(?is)<ref[^>/]*/>|<ref[^>]*>.*?</ref>`)
+	headingRegexp    = regexp.MustCompile(`(?m)^(={1,6})\s*(.+?)\s*(={1,6})\s*$`)
+	externalRegexp   = regexp.MustCompile(`\[(?:https?:)?//[^\s\]]+(?:\s+([^\]]*))?\]`)
+	htmlTagRegexp    = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	emphasisRegexp   = regexp.MustCompile(`'{2,}`)
+	blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+)
+
+// plainText strips wikitext markup from text, leaving just the readable
+// prose. Templates, tables, references, comments, files and categories are
+// removed entirely, as are behavior switches like __NOTOC__, links are
+// replaced by their labels and headings are kept as bare lines. HTML entities
+// are decoded last, so escaped markup like &lt;ref&gt; comes out as text
+// rather than being stripped. Magic words like {{PAGENAME}} are templates to
+// it, so resolveMagicWords them first to keep them.
+func plainText(text string) string {
+	text = commentRegexp.ReplaceAllString(text, "")
+	text = behaviorSwitchRegexp.ReplaceAllString(text, "")
+	text = refRegexp.ReplaceAllString(text, "")
+	text = stripNested(text, "{{", "}}")
+	text = stripNested(text, "{|", "|}")
+	text = replaceLinks(text)
+	text = externalRegexp.ReplaceAllString(text, "$1")
+	text = headingRegexp.ReplaceAllString(text, "$2")
+	text = emphasisRegexp.ReplaceAllString(text, "")
+	text = htmlTagRegexp.ReplaceAllString(text, "")
+	text = decodeEntities(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = strings.Join(lines, "\n")
+	text = blankLinesRegexp.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+var (
+	footnoteRegexp = regexp.MustCompile(`(?is)<ref(\s[^>]*?)?(?:/>|>(.*?)</ref>)`)
+	refNameRegexp  = regexp.MustCompile(`(?i)\bname\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'/>]+))`)
+)
+
+// plainTextFootnotes is plainText with the references kept: each <ref> is
+// replaced by a [1] style marker in the text and its contents become the
+// matching footnote, numbered in the order they're first cited as Wikipedia
+// does. A named ref like <ref name="x"/> reuses the number of the ref with
+// that name wherever it's defined, and refs that are never defined are
+// dropped. Footnotes are plain text too, except that one which would be
+// empty, like a citation template, is kept as wikitext so it isn't lost.
+// The {{reflist}} the footnotes would be rendered at is removed with the
+// other templates.
+func plainTextFootnotes(text string) (string, []string) {
+	text = commentRegexp.ReplaceAllString(text, "")
+
+	defined := map[string]string{}
+	for _, m := range footnoteRegexp.FindAllStringSubmatch(text, -1) {
+		if name := refName(m[1]); name != "" {
+			if _, ok := defined[name]; !ok && strings.TrimSpace(m[2]) != "" {
+				defined[name] = m[2]
+			}
+		}
+	}
+
+	var footnotes []string
+	numbers := map[string]int{}
+	text = footnoteRegexp.ReplaceAllStringFunc(text, func(ref string) string {
+		m := footnoteRegexp.FindStringSubmatch(ref)
+		name, content := refName(m[1]), m[2]
+		if name != "" {
+			if n, ok := numbers[name]; ok {
+				return "[" + strconv.Itoa(n) + "]"
+			}
+			content = defined[name]
+		}
+		if strings.TrimSpace(content) == "" {
+			return ""
+		}
+		note := plainText(content)
+		if note == "" {
+			note = strings.TrimSpace(content)
+		}
+		footnotes = append(footnotes, note)
+		if name != "" {
+			numbers[name] = len(footnotes)
+		}
+		return "[" + strconv.Itoa(len(footnotes)) + "]"
+	})
+	return plainText(text), footnotes
+}
+
+// refName returns the name attribute from a <ref>'s attributes, or "" if it
+// doesn't have one.
+func refName(attrs string) string {
+	m := refNameRegexp.FindStringSubmatch(attrs)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(m[1] + m[2] + m[3])
+}
+
+// decodeEntities replaces named and numeric HTML entities like &amp;, &ndash;
+// and &#8212; with the characters they stand for.
+func decodeEntities(text string) string {
+	if !strings.Contains(text, "&") {
+		return text
+	}
+	return html.UnescapeString(text)
+}
+
+// stripNested removes every balanced open...close span from s, including
+// nested ones. An unterminated span is removed up to the end of s.
+func stripNested(s, open, close string) string {
+	if !strings.Contains(s, open) {
+		return s
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case depth > 0 && strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+		default:
+			if depth == 0 {
+				b.WriteByte(s[i])
+			}
+			i++
+		}
+	}
+	return b.String()
+}
+
+// nonProseNamespaces are the link prefixes whose links don't render as text
+// in the article body.
+var nonProseNamespaces = []string{"file", "image", "category", "media"}
+
+// replaceLinks replaces [[Target|Label]] links with their label, and drops
+// file, image and category links along with their captions.
+func replaceLinks(s string) string {
+	if !strings.Contains(s, "[[") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "[[")
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:start])
+		end := matchingClose(s, start)
+		if end < 0 {
+			b.WriteString(s[start:])
+			break
+		}
+		inner := s[start+2 : end]
+		s = s[end+2:]
+
+		target := inner
+		if i := strings.IndexByte(inner, '|'); i >= 0 {
+			target = inner[:i]
+		}
+		if isNonProseLink(target) {
+			continue
+		}
+		label := inner
+		if i := strings.LastIndexByte(inner, '|'); i >= 0 {
+			label = inner[i+1:]
+			if label == "" {
+				// The pipe trick: [[Foo (bar)|]] renders as "Foo".
+				label = inner[:i]
+				if p := strings.Index(label, " ("); p > 0 {
+					label = label[:p]
+				}
+			}
+		}
+		b.WriteString(replaceLinks(strings.TrimPrefix(label, ":")))
+	}
+	return b.String()
+}
+
+// matchingClose returns the index of the "]]" closing the "[[" at start,
+// accounting for nested links, or -1 if there is none.
+func matchingClose(s string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "[[":
+			depth++
+			i++
+		case "]]":
+			depth--
+			if depth == 0 {
+				return i
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+func isNonProseLink(target string) bool {
+	i := strings.IndexByte(target, ':')
+	if i < 0 {
+		return false
+	}
+	prefix := strings.TrimSpace(target[:i])
+	for _, ns := range nonProseNamespaces {
+		if strings.EqualFold(prefix, ns) {
+			return true
+		}
+	}
+	// Interlanguage links such as [[de:Titel]] are also not shown inline.
+	return isLangCode(prefix)
+}
+
+// isLangCode reports whether s looks like a wiki language code such as "de"
+// or "fiu-vro". Codes are always lower case, unlike article titles.
+func isLangCode(s string) bool {
+	if len(s) < 2 || len(s) > 12 || s[0] == '-' {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return false
+		}
+	}
+	return len(s) <= 3 || strings.Contains(s, "-") || s == "simple"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeEntities(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"no entities", "no entities"},
+		{"Tom &amp; Jerry", "Tom & Jerry"},
+		{"1990&ndash;1995", "1990–1995"},
+		{"a&nbsp;b", "a\u00a0b"},
+		{"&lt;not a tag&gt;", "<not a tag>"},
+		{"&#8212; &#x2014;", "— —"},
+		{"&#39;quoted&#39;", "'quoted'"},
+		{"AT&T &bogus;", "AT&T &bogus;"},
+	}
+
+	for _, c := range cases {
+		if got := decodeEntities(c.in); got != c.want {
+			t.Errorf("decodeEntities(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPlainTextDecodesEntitiesLast(t *testing.T) {
+	in := "Use &lt;ref&gt; tags<ref>a citation</ref> &amp; [[Link|links]]&nbsp;here."
+	want := "Use <ref> tags & links here."
+	if got := plainText(in); got != want {
+		t.Errorf("plainText(%q) = %q; not %q", in, got, want)
+	}
+}
+
+func TestPlainTextFootnotes(t *testing.T) {
+	cases := []struct {
+		in        string
+		text      string
+		footnotes []string
+	}{
+		{"No refs.", "No refs.", nil},
+		{
+			"First.<ref>A [[book]].</ref> Second.<ref name=\"x\">''Paper''.</ref> Again.<ref name=x />\n== References ==\n{{reflist}}",
+			"First.[1] Second.[2] Again.[2]\nReferences",
+			[]string{"A book.", "Paper."},
+		},
+		{
+			// A named ref can be cited before the ref that defines it.
+			"Early.<ref name='later'/> Defined.<ref name='later'>Source.</ref> Undefined.<ref name=\"missing\" />",
+			"Early.[1] Defined.[1] Undefined.",
+			[]string{"Source."},
+		},
+		{
+			"Cited.<ref>{{cite web |url=http://example.com |title=Example}}</ref>",
+			"Cited.[1]",
+			[]string{"{{cite web |url=http://example.com |title=Example}}"},
+		},
+	}
+
+	for _, c := range cases {
+		text, footnotes := plainTextFootnotes(c.in)
+		if text != c.text || !reflect.DeepEqual(footnotes, c.footnotes) {
+			t.Errorf("plainTextFootnotes(%q) = %q, %q; not %q, %q", c.in, text, footnotes, c.text, c.footnotes)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"net/http/pprof"
+)
+
+var (
+	pprofEnabled = flag.Bool("pprof", false, "whether to serve /debug/pprof on -pprofAddr")
+	pprofAddr    = flag.String("pprofAddr", "localhost:6060", "the address to serve pprof on if -adminAddr isn't set, keep it off the public listener")
+)
+
+// registerPprof registers the pprof handlers on mux.
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// servePprof serves the pprof handlers on their own listener so profiling
+// never shares the public mux.
+func servePprof() {
+	mux := http.NewServeMux()
+	registerPprof(mux)
+
+	log.Printf("Serving pprof on %s...", *pprofAddr)
+	if err := http.ListenAndServe(*pprofAddr, mux); err != nil {
+		log.Printf("pprof: %+v", err)
+	}
+}
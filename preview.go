@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPreview is the longest preview a list response can ask for, in
+// characters.
+const maxPreview = 1000
+
+// previewParam reads the preview=N parameter, the number of characters of
+// each result's text to include, or 0 for none.
+func previewParam(r *http.Request) (int, error) {
+	return intParam(r, "preview", 0, 0, maxPreview)
+}
+
+// textPreview returns the first n characters of text as plain text, with
+// runs of whitespace collapsed and "…" appended if anything was cut. Unlike
+// extractSummary it doesn't look for the lead paragraph, so it's cheaper
+// but may start with an infobox's leftovers or cut a sentence short.
+func textPreview(text string, n int) string {
+	text = strings.Join(strings.Fields(plainText(text)), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	i, count := 0, 0
+	for i = range text {
+		if count == n {
+			break
+		}
+		count++
+	}
+	return strings.TrimRight(text[:i], " ") + "…"
+}
+
+// fetchPreviews returns the previews of the articles with the given titles,
+// reading them on the batch pool. An article that can't be read gets an
+// empty preview.
+func fetchPreviews(titles []string, n int) []string {
+	previews := make([]string, len(titles))
+	runBatch(len(titles), func(i int) {
+		p, err := lookupArticle(titles[i])
+		if err != nil {
+			return
+		}
+		previews[i] = textPreview(p.Text, n)
+	})
+	return previews
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextPreview(t *testing.T) {
+	cases := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"Short", 10, "Short"},
+		{"'''Bold''' and [[link|linked]]\n\nwords", 100, "Bold and linked words"},
+		{"Exactly ten", 11, "Exactly ten"},
+		{"One two three", 4, "One…"},
+		{"Café crème", 4, "Café…"},
+		{"日本語のテキスト", 3, "日本語…"},
+	}
+	for _, c := range cases {
+		if got := textPreview(c.text, c.n); got != c.want {
+			t.Errorf("textPreview(%q, %d) = %q; not %q", c.text, c.n, got, c.want)
+		}
+	}
+}
+
+func TestFetchPreviews(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "Foo is a thing"), testPage(2, "Bar", "Bar")})
+	got := fetchPreviews([]string{"Foo", "Missing", "Bar"}, 6)
+	want := []string{"Foo is…", "", "Bar"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("fetchPreviews = %q; not %q", got, want)
+	}
+}
+
+func TestBatchPreview(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "Foo is a thing")})
+
+	req := httptest.NewRequest("POST", "/batch/articles?preview=6", strings.NewReader(`{"titles":["Foo"]}`))
+	w := httptest.NewRecorder()
+	handle(handleBatchArticles)(w, req)
+	var results []batchArticle
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Preview != "Foo is…" {
+		t.Errorf("results = %+v", results)
+	}
+}
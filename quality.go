@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+var (
+	featuredTemplates = flag.String("featuredTemplates", "Featured article", "the comma separated templates that mark a featured article, in the article itself or on its talk page")
+	goodTemplates     = flag.String("goodTemplates", "Good article,GA", "the comma separated templates that mark a good article, in the article itself or on its talk page")
+)
+
+const (
+	qualityFeatured = "featured"
+	qualityGood     = "good"
+)
+
+// templateNameRegexp matches the name of every template or parser function.
+var templateNameRegexp = regexp.MustCompile(`\{\{\s*([^|{}]+?)\s*(?:\||\}\})`)
+
+// talkStatusRegexp matches the parameters of talk page banners giving an
+// article's assessment, as in {{Article history|currentstatus=FA}} and
+// {{WikiProject Physics|class=GA}}.
+var talkStatusRegexp = regexp.MustCompile(`(?i)\|\s*(?:currentstatus|class)\s*=\s*(FA|GA)\s*(?:\||\}\})`)
+
+// templateSet parses a comma separated list of template names into a set of
+// normalized names.
+func templateSet(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		if name = normalizeTemplateName(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// normalizeTemplateName normalizes a template name the way MediaWiki does, so
+// {{featured_article}} and {{Featured article}} are the same template.
+func normalizeTemplateName(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "Template:")
+	return upperFirst(strings.Join(strings.Fields(strings.Replace(name, "_", " ", -1)), " "))
+}
+
+// detectQualityFlag returns "featured" or "good" if text uses one of the
+// -featuredTemplates or -goodTemplates, or "" if it uses neither. Featured
+// wins if it has both.
+func detectQualityFlag(text string) string {
+	featured, good := templateSet(*featuredTemplates), templateSet(*goodTemplates)
+	flag := ""
+	for _, m := range templateNameRegexp.FindAllStringSubmatch(text, -1) {
+		name := normalizeTemplateName(m[1])
+		if featured[name] {
+			return qualityFeatured
+		} else if good[name] {
+			flag = qualityGood
+		}
+	}
+	return flag
+}
+
+// detectTalkQualityFlag is detectQualityFlag for a talk page, which also
+// counts the FA and GA assessments of its banners.
+func detectTalkQualityFlag(text string) string {
+	flag := detectQualityFlag(text)
+	if flag == qualityFeatured {
+		return flag
+	}
+	for _, m := range talkStatusRegexp.FindAllStringSubmatch(text, -1) {
+		if strings.EqualFold(m[1], "FA") {
+			return qualityFeatured
+		}
+		flag = qualityGood
+	}
+	return flag
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"flag"
+	"html"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	randomSeed   = flag.Int64("randomSeed", 0, "the seed for picking random articles, by default seeded from the current time")
+	debug        = flag.Bool("debug", false, "enable debugging features, like overriding the random seed with /random?seed=N")
+	listPrefixes = flag.String("listPrefixes", "List of,Lists of", "the comma separated title prefixes of list articles, which /random?skipLists=true skips")
+
+	randomFetchTimeout = flag.Duration("randomFetchTimeout", 5*time.Second, "the longest /random?count=N waits for each article before leaving it out")
+)
+
+// maxRandomTries is the number of articles /random decodes looking for one
+// that's at least minLength bytes long.
+const maxRandomTries = 20
+
+// maxRandomCount is the most articles /random?count=N returns.
+const maxRandomCount = 50
+
+// maxQualityCandidates is the most articles /random/quality decodes to pick
+// the best from.
+const maxQualityCandidates = 20
+
+// Server holds the state of the HTTP API that belongs to one instance rather
+// than being shared by the whole process.
+type Server struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	blocks   randomBlocks
+	siteInfo *siteInfo
+}
+
+// newServer returns a Server whose random articles are picked with the given
+// seed, or a time based one if seed is 0.
+func newServer(seed int64) *Server {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Server{rng: rand.New(rand.NewSource(seed))}
+}
+
+// randomBlocks is the blocks of the index in offset order and how many pages
+// are in each, so a page can be picked uniformly with one random number no
+// matter how large the blocks are.
+type randomBlocks struct {
+	generation int
+	seeks      []int
+	// ends[i] is the number of pages in blocks 0 through i.
+	ends []int
+	// lengths[i] is the number of bytes in block i, from its offset to the
+	// next block's or the end of the indexed part of the articles file, or -1
+	// if the file's size isn't known.
+	lengths []int
+}
+
+// currentBlocks returns s.blocks, rebuilding it if the index has changed.
+// s.mu must be held.
+func (s *Server) currentBlocks() randomBlocks {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if s.blocks.seeks != nil && s.blocks.generation == mu.generation {
+		return s.blocks
+	}
+	size := -1
+	if stat, err := os.Stat(*articlesFile); err == nil {
+		size = int(stat.Size())
+		if mu.end > 0 && mu.end < size {
+			size = mu.end
+		}
+	}
+	b := randomBlocks{
+		generation: mu.generation,
+		seeks:      make([]int, 0, len(mu.offsetSize)),
+	}
+	for seek := range mu.offsetSize {
+		b.seeks = append(b.seeks, seek)
+	}
+	sort.Ints(b.seeks)
+	b.ends = make([]int, len(b.seeks))
+	b.lengths = make([]int, len(b.seeks))
+	total := 0
+	for i, seek := range b.seeks {
+		total += mu.offsetSize[seek]
+		b.ends[i] = total
+		if i+1 < len(b.seeks) {
+			b.lengths[i] = b.seeks[i+1] - seek
+		} else if size >= seek {
+			b.lengths[i] = size - seek
+		} else {
+			b.lengths[i] = -1
+		}
+	}
+	s.blocks = b
+	return b
+}
+
+// blockLength returns the number of bytes in the block at seek, or -1 if it
+// isn't a block of the index or its length isn't known. Blocks are bounded by
+// the next block's offset, so a block whose pages aren't all in the index is
+// still read in full.
+func (s *Server) blockLength(seek int) int {
+	s.mu.Lock()
+	blocks := s.currentBlocks()
+	s.mu.Unlock()
+	i := sort.SearchInts(blocks.seeks, seek)
+	if i == len(blocks.seeks) || blocks.seeks[i] != seek {
+		return -1
+	}
+	return blocks.lengths[i]
+}
+
+// randomPositions picks count distinct pages uniformly at random using rng,
+// or s.rng if it's nil, as their 0-based positions in the returned blocks.
+// Repeats are drawn again, so with no more than count pages in the index it
+// returns all of them in a random order. The same sequence of random numbers
+// always picks the same pages from the same index.
+func (s *Server) randomPositions(rng *rand.Rand, count int) (randomBlocks, []int, error) {
+	s.mu.Lock()
+	blocks := s.currentBlocks()
+	if rng == nil {
+		rng = s.rng
+	}
+	total := 0
+	if len(blocks.ends) > 0 {
+		total = blocks.ends[len(blocks.ends)-1]
+	}
+	if count > total {
+		count = total
+	}
+	positions := make([]int, 0, count)
+	seen := make(map[int]bool, count)
+	for len(positions) < count {
+		if k := rng.Intn(total); !seen[k] {
+			seen[k] = true
+			positions = append(positions, k)
+		}
+	}
+	s.mu.Unlock()
+
+	if total == 0 {
+		if err := indexLoadError(); err != nil {
+			return randomBlocks{}, nil, err
+		}
+		return randomBlocks{}, nil, errors.Errorf("no articles")
+	}
+	return blocks, positions, nil
+}
+
+// readPage returns the raw XML of the page at the 0-based position k.
+func (b randomBlocks) readPage(k int) ([]byte, error) {
+	i := sort.SearchInts(b.ends, k+1)
+	n := k + 1
+	if i > 0 {
+		n -= b.ends[i-1]
+	}
+	raw, _, err := readBlockPage(b.seeks[i], n, func(pos, id int) bool {
+		return pos == n
+	})
+	return raw, err
+}
+
+// randomPage returns the raw XML of a page picked uniformly at random using
+// rng, or s.rng if it's nil.
+func (s *Server) randomPage(rng *rand.Rand) ([]byte, error) {
+	blocks, positions, err := s.randomPositions(rng, 1)
+	if err != nil {
+		return nil, err
+	}
+	return blocks.readPage(positions[0])
+}
+
+// randomArticles returns up to count distinct articles picked uniformly at
+// random using rng, or s.rng if it's nil, read on the batch worker pool. Any
+// that skip accepts, fail to load or take longer than -randomFetchTimeout are
+// left out rather than failing the request, so fewer than count may be
+// returned.
+func (s *Server) randomArticles(rng *rand.Rand, count int, skip func(title string) bool) ([]page, error) {
+	blocks, positions, err := s.randomPositions(rng, count)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*page, len(positions))
+	runBatch(len(positions), func(i int) {
+		done := make(chan *page, 1)
+		go func() {
+			raw, err := blocks.readPage(positions[i])
+			if err != nil {
+				log.Printf("reading random article: %+v", err)
+				done <- nil
+				return
+			}
+			if skip != nil && skip(rawTitle(raw)) {
+				done <- nil
+				return
+			}
+			p, err := decodePage(raw)
+			if err != nil {
+				log.Printf("decoding random article: %+v", err)
+				done <- nil
+				return
+			}
+			done <- &p
+		}()
+		timer := time.NewTimer(*randomFetchTimeout)
+		defer timer.Stop()
+		select {
+		case results[i] = <-done:
+		case <-timer.C:
+		}
+	})
+	pages := []page{}
+	for _, p := range results {
+		if p != nil {
+			pages = append(pages, *p)
+		}
+	}
+	return pages, nil
+}
+
+// randomArticle picks an article uniformly at random using rng, or s.rng if
+// it's nil, skipping any whose title skip accepts. Titles are checked before
+// the page is decoded. It gives up with a 404 after maxRandomTries skipped
+// pages.
+func (s *Server) randomArticle(rng *rand.Rand, skip func(title string) bool) (page, error) {
+	for i := 0; i < maxRandomTries; i++ {
+		raw, err := s.randomPage(rng)
+		if err != nil {
+			return page{}, err
+		}
+		if skip != nil && skip(rawTitle(raw)) {
+			continue
+		}
+		return decodePage(raw)
+	}
+	return page{}, statusErrorf(http.StatusNotFound, "no matching article found in %d tries", maxRandomTries)
+}
+
+var titleRegexp = regexp.MustCompile(`<title>([^<]*)</title>`)
+
+// rawTitle returns the title from the raw XML of a page without decoding the
+// rest of it.
+func rawTitle(raw []byte) string {
+	m := titleRegexp.FindSubmatch(raw)
+	if m == nil {
+		return ""
+	}
+	return html.UnescapeString(string(m[1]))
+}
+
+// isListArticle reports whether title is a list article like "List of
+// lakes", going by the -listPrefixes.
+func isListArticle(title string) bool {
+	for _, prefix := range strings.Split(*listPrefixes, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(title, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomSkip returns the pages a /random request asked to skip, or nil if it
+// didn't. skipLists=true skips list articles.
+func randomSkip(r *http.Request) func(title string) bool {
+	if skipLists, _ := strconv.ParseBool(r.URL.Query().Get("skipLists")); skipLists {
+		return isListArticle
+	}
+	return nil
+}
+
+// handleRandom serves /random?minLength=N, returning a random article. If
+// minLength is set, articles are sampled until one is at least that many
+// bytes long, returning the last one after maxRandomTries. Since an
+// article's length is only known once it's been decoded, each rejected
+// sample costs a full article read, so high minimums can be slow. With
+// -debug, seed=N picks the articles with a fresh RNG seeded with N, so the
+// same request always returns the same article. skipLists=true skips list
+// articles without decoding them. count=N returns an array of N distinct
+// random articles instead, see randomArticles.
+func (s *Server) handleRandom(w http.ResponseWriter, r *http.Request) error {
+	minLength, err := intParam(r, "minLength", 0, 0, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	count, err := intParam(r, "count", 0, 1, maxRandomCount)
+	if err != nil {
+		return err
+	}
+	if count > 0 && minLength > 0 {
+		return statusErrorf(http.StatusBadRequest, "minLength can't be combined with count")
+	}
+	var rng *rand.Rand
+	if raw := r.URL.Query().Get("seed"); raw != "" {
+		if !*debug {
+			return statusErrorf(http.StatusForbidden, "seed is only allowed with -debug")
+		}
+		seed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return statusErrorf(http.StatusBadRequest, "invalid seed %q", raw)
+		}
+		rng = rand.New(rand.NewSource(seed))
+	}
+
+	skip := randomSkip(r)
+	if count > 0 {
+		pages, err := s.randomArticles(rng, count, skip)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, r, pages)
+	}
+	var p page
+	for i := 0; i < maxRandomTries; i++ {
+		p, err = s.randomArticle(rng, skip)
+		if err != nil {
+			return err
+		}
+		if p.Length >= minLength {
+			break
+		}
+	}
+	return writeJSON(w, r, p)
+}
+
+// stubRegexp matches stub templates like {{stub}} and {{physics-stub}}.
+var stubRegexp = regexp.MustCompile(`(?i)\{\{[^{}|]*stub\s*[|}]`)
+
+// qualityScore is a rough guess at how interesting p is to read, favouring
+// long, well linked articles with an infobox, and featured and good articles
+// above all. Anything that isn't a main namespace article, or is marked as a
+// stub, scores below every article that is. It's a heuristic, not a real
+// quality ranking.
+func qualityScore(p page) float64 {
+	score := math.Log1p(float64(p.Length)) + math.Log1p(float64(len(extractLinks(p.Text))))
+	if infoboxRegexp.MatchString(p.Text) {
+		score += 2
+	}
+	switch p.QualityFlag {
+	case qualityFeatured:
+		score += 10
+	case qualityGood:
+		score += 5
+	}
+	if p.PageType != pageTypeArticle || namespaceForTitle(p.Title) != 0 || stubRegexp.MatchString(p.Text) {
+		score -= 100
+	}
+	return score
+}
+
+// handleRandomQuality serves /random/quality?candidates=N, returning the best
+// of N random articles by qualityScore, which is a quick way to find
+// something worth reading. Every candidate is decoded, so N is capped at
+// maxQualityCandidates. skipLists=true skips list articles as with /random.
+func (s *Server) handleRandomQuality(w http.ResponseWriter, r *http.Request) error {
+	candidates, err := intParam(r, "candidates", 5, 1, maxQualityCandidates)
+	if err != nil {
+		return err
+	}
+	skip := randomSkip(r)
+	var best page
+	bestScore := math.Inf(-1)
+	for i := 0; i < candidates; i++ {
+		p, err := s.randomArticle(nil, skip)
+		if err != nil {
+			return err
+		}
+		if score := qualityScore(p); score > bestScore {
+			best, bestScore = p, score
+		}
+	}
+	return writeJSON(w, r, best)
+}
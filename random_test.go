@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRandomArticleSeeded(t *testing.T) {
+	var blocks [][]page
+	for b := 0; b < 4; b++ {
+		var block []page
+		for i := 0; i <= b; i++ {
+			id := len(blocks)*10 + i + 1
+			block = append(block, testPage(id, fmt.Sprintf("Page %d", id), "text"))
+		}
+		blocks = append(blocks, block)
+	}
+	useTestDump(t, blocks...)
+
+	sequence := func(seed int64) []string {
+		s := newServer(seed)
+		var titles []string
+		for i := 0; i < 50; i++ {
+			p, err := s.randomArticle(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles = append(titles, p.Title)
+		}
+		return titles
+	}
+
+	a, b := sequence(42), sequence(42)
+	seen := map[string]bool{}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed gave different articles at %d: %q and %q", i, a[i], b[i])
+		}
+		seen[a[i]] = true
+	}
+	if len(seen) != 10 {
+		t.Errorf("50 random articles only covered %d of the 10 pages: %q", len(seen), a)
+	}
+}
+
+func TestQualityScore(t *testing.T) {
+	long := strings.Repeat("Lorem ipsum dolor sit amet. ", 100)
+	ranked := []page{
+		{Title: "Good", PageType: pageTypeArticle, Length: len(long) + 100, Text: long + "{{Infobox thing|name=x}} [[A]] [[B]] [[C]]"},
+		{Title: "Plain", PageType: pageTypeArticle, Length: len(long), Text: long},
+		{Title: "Short", PageType: pageTypeArticle, Length: 10, Text: "Short text"},
+	}
+	penalized := []page{
+		{Title: "Stub", PageType: pageTypeArticle, Length: len(long), Text: long + "{{Physics-stub}}"},
+		{Title: "Template:Foo", PageType: pageTypeArticle, Length: len(long), Text: long},
+		{Title: "Dab", PageType: pageTypeDisambiguation, Length: 10, Text: "{{dab}}"},
+	}
+	for i := 1; i < len(ranked); i++ {
+		if a, b := qualityScore(ranked[i-1]), qualityScore(ranked[i]); a <= b {
+			t.Errorf("%s scored %v, which isn't above %s's %v", ranked[i-1].Title, a, ranked[i].Title, b)
+		}
+	}
+	worst := ranked[len(ranked)-1]
+	for _, p := range penalized {
+		if a, b := qualityScore(worst), qualityScore(p); a <= b {
+			t.Errorf("%s scored %v, which isn't above %s's %v", worst.Title, a, p.Title, b)
+		}
+	}
+}
+
+func TestRandomArticleSkipLists(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "List of lakes", "lakes"),
+		testPage(2, "Lake", "a lake"),
+		testPage(3, "Lists of rivers", "rivers"),
+	})
+	s := newServer(1)
+	for i := 0; i < 20; i++ {
+		p, err := s.randomArticle(nil, isListArticle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Title != "Lake" {
+			t.Fatalf("randomArticle returned %q; expected list articles to be skipped", p.Title)
+		}
+	}
+
+	if _, err := s.randomArticle(nil, func(string) bool { return true }); err == nil {
+		t.Errorf("expected an error when every article is skipped")
+	}
+}
+
+func TestIsListArticle(t *testing.T) {
+	defer func(p string) { *listPrefixes = p }(*listPrefixes)
+	cases := []struct {
+		prefixes, title string
+		want            bool
+	}{
+		{"List of,Lists of", "List of lakes", true},
+		{"List of,Lists of", "Lists of rivers", true},
+		{"List of,Lists of", "Listening", false},
+		{"List of,Lists of", "Lake", false},
+		{"Liste der, Liste von", "Liste von Seen", true},
+		{"", "List of lakes", false},
+	}
+	for _, c := range cases {
+		*listPrefixes = c.prefixes
+		if got := isListArticle(c.title); got != c.want {
+			t.Errorf("isListArticle(%q) with %q = %v; not %v", c.title, c.prefixes, got, c.want)
+		}
+	}
+}
+
+func TestBlockLength(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "A", "first"), testPage(2, "B", "second")},
+		[]page{testPage(3, "C", "third")},
+		[]page{testPage(4, "D", "fourth")},
+	)
+	s := newServer(1)
+	seeks := blockSeeks()
+	stat, err := os.Stat(*articlesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := seeks[0]
+	for i, seek := range seeks {
+		n := s.blockLength(seek)
+		if i+1 < len(seeks) && n != seeks[i+1]-seek {
+			t.Errorf("blockLength(%d) = %d; not %d", seek, n, seeks[i+1]-seek)
+		}
+		total += n
+	}
+	if total != int(stat.Size()) {
+		t.Errorf("blocks end at %d; not the file size %d", total, stat.Size())
+	}
+	if n := s.blockLength(seeks[0] + 1); n != -1 {
+		t.Errorf("blockLength of a seek that isn't a block = %d; not -1", n)
+	}
+
+	// Bounded reads stop at the end of their block.
+	defer func(old func(int) int) { blockLengths = old }(blockLengths)
+	blockLengths = s.blockLength
+	if _, _, err := readBlockPage(seeks[0], 10, func(n, id int) bool { return id == 3 }); err == nil {
+		t.Errorf("found page 3 in the first block")
+	}
+	for _, title := range []string{"A", "B", "C", "D"} {
+		if _, err := lookupArticle(title); err != nil {
+			t.Errorf("lookupArticle(%q) with bounded blocks: %v", title, err)
+		}
+	}
+}
+
+func TestHandleRandomCount(t *testing.T) {
+	var block []page
+	for id := 1; id <= 8; id++ {
+		block = append(block, testPage(id, fmt.Sprintf("Page %d", id), "text"))
+	}
+	useTestDump(t, block[:3], block[3:])
+	s := newServer(7)
+
+	cases := []struct {
+		query string
+		code  int
+		want  int
+	}{
+		{"count=5", http.StatusOK, 5},
+		{"count=1", http.StatusOK, 1},
+		// Only as many as there are pages.
+		{"count=20", http.StatusOK, 8},
+		{"count=0", http.StatusBadRequest, 0},
+		{"count=51", http.StatusBadRequest, 0},
+		{"count=5&minLength=10", http.StatusBadRequest, 0},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/random?"+c.query, nil)
+		w := httptest.NewRecorder()
+		handle(s.handleRandom)(w, req)
+		if w.Code != c.code {
+			t.Errorf("%s: status = %d; not %d: %s", c.query, w.Code, c.code, w.Body)
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		var pages []page
+		if err := json.Unmarshal(w.Body.Bytes(), &pages); err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for _, p := range pages {
+			if seen[p.Title] {
+				t.Errorf("%s: %q returned twice", c.query, p.Title)
+			}
+			seen[p.Title] = true
+		}
+		if len(pages) != c.want {
+			t.Errorf("%s: got %d articles; not %d", c.query, len(pages), c.want)
+		}
+	}
+}
+
+func TestRandomArticlesSkipped(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "List of lakes", "lakes"),
+		testPage(2, "Lake", "a lake"),
+		testPage(3, "River", "a river"),
+	})
+	s := newServer(1)
+	pages, err := s.randomArticles(nil, 3, isListArticle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d articles; expected the list article to be left out: %+v", len(pages), pages)
+	}
+	for _, p := range pages {
+		if p.Title == "List of lakes" {
+			t.Errorf("list article wasn't skipped")
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/creachadair/cityhash"
+)
+
+var redirects = flag.Bool("redirects", false, "whether or not to build the reverse redirect index for /article?includeAliases=true, requires decoding every article")
+
+// redirectIndex holds the titles of the redirects to each page, keyed by the
+// hash of the page's title. It is only populated when running with
+// -redirects since building it requires decoding every article in the dump.
+var redirectIndex = struct {
+	sync.Mutex
+
+	built   bool
+	aliases map[uint64][]string
+}{}
+
+// redirectKeywords are the magic words that start a redirect in the larger
+// wikis' languages, besides English's REDIRECT, which works on every wiki.
+var redirectKeywords = []string{
+	"REDIRECT", "WEITERLEITUNG", "REDIRECTION", "REDIRECCIÓN", "RINVIA",
+	"DOORVERWIJZING", "PATRZ", "REDIRECIONAMENTO", "ПЕРЕНАПРАВЛЕНИЕ",
+	"YÖNLENDİRME", "重定向", "転送", "넘겨주기",
+}
+
+// redirectTextRegexp matches a redirect at the start of a page's text, like
+// "#REDIRECT [[Target]]" or "#weiterleitung: [[Ziel]]".
+var redirectTextRegexp = regexp.MustCompile(`(?i)^\s*#\s*(?:` + strings.Join(redirectKeywords, "|") + `)\s*:?\s*\[\[([^\[\]|]+)`)
+
+// redirectTarget returns the title a redirect points to, the section of it
+// after any # as written, or "" if it's to the whole page, and whether p is a
+// redirect at all. The dump's <redirect> element is used if it has one, and
+// otherwise the redirect in the text, for dumps that leave the element out.
+func redirectTarget(p page) (target, section string, ok bool) {
+	if len(p.Redirect) > 0 && p.Redirect[0].Title != "" {
+		target = p.Redirect[0].Title
+	} else if m := redirectTextRegexp.FindStringSubmatch(p.Text); m != nil {
+		target = m[1]
+	} else {
+		return "", "", false
+	}
+	if i := strings.Index(target, "#"); i >= 0 {
+		target, section = target[:i], strings.TrimSpace(target[i+1:])
+	}
+	return normalizeLinkTarget(target), section, true
+}
+
+// followRedirect returns the page the redirect p points to, and the section
+// of it, if any. Only one redirect is followed, as on the wiki, and p itself
+// is returned if it isn't a redirect or its target isn't in the dump.
+func followRedirect(p page) (page, string, error) {
+	target, section, ok := redirectTarget(p)
+	if !ok || target == "" || target == p.Title {
+		return p, "", nil
+	}
+	t, err := lookupArticle(target)
+	if isArticleNotFound(err) {
+		return p, "", nil
+	} else if err != nil {
+		return page{}, "", err
+	}
+	return t, section, nil
+}
+
+func buildRedirectIndex() error {
+	log.Printf("Building redirect index...")
+	aliases := map[uint64][]string{}
+	n := 0
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		target, _, ok := redirectTarget(p)
+		if !ok || target == "" || target == p.Title {
+			return nil
+		}
+		hash := cityhash.Hash64([]byte(target))
+		aliases[hash] = append(aliases[hash], p.Title)
+		n++
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, titles := range aliases {
+		sort.Strings(titles)
+	}
+
+	redirectIndex.Lock()
+	redirectIndex.built = true
+	redirectIndex.aliases = aliases
+	redirectIndex.Unlock()
+
+	log.Printf("Done building redirect index! %d redirects", n)
+	return nil
+}
+
+// articleAliases returns the titles that redirect to title, sorted, or false
+// if the redirect index hasn't been built.
+func articleAliases(title string) ([]string, bool) {
+	redirectIndex.Lock()
+	defer redirectIndex.Unlock()
+
+	if !redirectIndex.built {
+		return nil, false
+	}
+	aliases := redirectIndex.aliases[cityhash.Hash64([]byte(title))]
+	return append([]string{}, aliases...), true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"time"
+)
+
+var regexSearchTimeout = flag.Duration("regexSearchTimeout", 10*time.Second, "the longest /search/regex may scan titles for before returning what it's found")
+
+const (
+	// maxRegexPattern is the longest pattern /search/regex accepts, and
+	// maxRegexInsts the most instructions it may compile to, which bounds
+	// how long matching each title takes.
+	maxRegexPattern = 1000
+	maxRegexInsts   = 10000
+	// maxRegexResults is the most titles one search may return.
+	maxRegexResults = 10000
+	// regexCheckEvery is the number of titles matched between checks of
+	// the deadline.
+	regexCheckEvery = 4096
+)
+
+// compileTitlePattern compiles a /search/regex pattern, rejecting any that
+// are too long or compile to too large a program. Go's regexps run in linear
+// time so there's no catastrophic backtracking, but repetitions like
+// (a{100}){100} still make every match slow.
+func compileTitlePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, statusErrorf(http.StatusBadRequest, "pattern parameter is required")
+	}
+	if len(pattern) > maxRegexPattern {
+		return nil, statusErrorf(http.StatusBadRequest, "pattern can be at most %d bytes, got %d", maxRegexPattern, len(pattern))
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, statusErrorf(http.StatusBadRequest, "invalid pattern: %s", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, statusErrorf(http.StatusBadRequest, "invalid pattern: %s", err)
+	}
+	if len(prog.Inst) > maxRegexInsts {
+		return nil, statusErrorf(http.StatusBadRequest, "pattern is too complex, it compiles to %d instructions and at most %d are allowed", len(prog.Inst), maxRegexInsts)
+	}
+	return regexp.Compile(pattern)
+}
+
+// regexSummary ends a /search/regex response. TimedOut is set if the scan
+// stopped at -regexSearchTimeout before checking every title, and
+// Truncated if it stopped at the limit.
+type regexSummary struct {
+	Count     int  `json:"count"`
+	Truncated bool `json:"truncated,omitempty"`
+	TimedOut  bool `json:"timedOut,omitempty"`
+}
+
+// handleRegexSearch serves /search/regex?pattern=^List of&limit=N, streaming
+// the titles matching a Go regexp as NDJSON in index order, followed by a
+// summary line. Every title is scanned, so a search stops after limit
+// matches or -regexSearchTimeout, whichever comes first. Only available with
+// -titles.
+func handleRegexSearch(w http.ResponseWriter, r *http.Request) error {
+	if !*retainTitles {
+		return statusErrorf(http.StatusServiceUnavailable, "titles aren't retained, start with -titles")
+	}
+	re, err := compileTitlePattern(r.URL.Query().Get("pattern"))
+	if err != nil {
+		return err
+	}
+	limit, err := intParam(r, "limit", 100, 1, maxRegexResults)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	titles := mu.titles
+	mu.Unlock()
+
+	deadline := time.Now().Add(*regexSearchTimeout)
+	ctx := r.Context()
+	nw := newNDJSONWriter(w)
+	var summary regexSummary
+	for i, t := range titles {
+		if i%regexCheckEvery == regexCheckEvery-1 {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if *regexSearchTimeout > 0 && time.Now().After(deadline) {
+				summary.TimedOut = true
+				break
+			}
+		}
+		if !re.MatchString(t.title) {
+			continue
+		}
+		if summary.Count == limit {
+			summary.Truncated = true
+			break
+		}
+		if err := nw.encode(exportedTitle{Title: t.title, ID: t.id}); err != nil {
+			return err
+		}
+		summary.Count++
+	}
+	if err := nw.encode(summary); err != nil {
+		return err
+	}
+	return nw.flush()
+}
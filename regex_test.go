@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleRegexSearch(t *testing.T) {
+	defer func(old bool) { *retainTitles = old }(*retainTitles)
+	*retainTitles = true
+	useTestDump(t, []page{
+		testPage(1, "List of lakes", ""),
+		testPage(2, "Lake", ""),
+		testPage(3, "List of rivers", ""),
+		testPage(4, "Lists of lists", ""),
+	})
+
+	cases := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"pattern=^List of&limit=10", http.StatusOK, `{"title":"List of lakes","id":1}` + "\n" + `{"title":"List of rivers","id":3}` + "\n" + `{"count":2}` + "\n"},
+		{"pattern=^List&limit=1", http.StatusOK, `{"title":"List of lakes","id":1}` + "\n" + `{"count":1,"truncated":true}` + "\n"},
+		{"pattern=(?i)LAKE$", http.StatusOK, `{"title":"Lake","id":2}` + "\n" + `{"count":1}` + "\n"},
+		{"pattern=", http.StatusBadRequest, "pattern parameter is required"},
+		{"pattern=(", http.StatusBadRequest, "invalid pattern"},
+		{"pattern=((a{100}){100}){100}", http.StatusBadRequest, "invalid pattern"},
+		{"pattern=" + strings.Repeat("a{1000}", 11), http.StatusBadRequest, "too complex"},
+		{"pattern=a&limit=0", http.StatusBadRequest, "limit"},
+	}
+	for _, c := range cases {
+		q, err := url.ParseQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handle(handleRegexSearch)(w, httptest.NewRequest("GET", "/search/regex?"+q.Encode(), nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: got %d %s; expected %d %s", c.query, w.Code, w.Body, c.code, c.want)
+		}
+	}
+}
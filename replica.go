@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	indexServer     = flag.String("indexServer", "", "the URL of an index server to look titles up with instead of loading the index locally")
+	indexServerMode = flag.Bool("indexServerMode", false, "serve index lookups to frontends on /internal/lookup")
+)
+
+var indexServerClient = &http.Client{Timeout: 10 * time.Second}
+
+// remoteEntry is an index entry as sent by the index server. BlockSize is the
+// number of pages in the entry's block, which readArticle needs to know how
+// far to search.
+type remoteEntry struct {
+	ID        int `json:"id"`
+	Seek      int `json:"seek"`
+	BlockSize int `json:"blockSize"`
+}
+
+// handleLookup serves /internal/lookup?title=... on an index server.
+func handleLookup(w http.ResponseWriter, r *http.Request) error {
+	name, err := validateTitle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	meta, err := fetchLocalArticle(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	size := mu.offsetSize[meta.seek]
+	mu.Unlock()
+
+	return writeJSON(w, r, remoteEntry{
+		ID:        meta.id,
+		Seek:      meta.seek,
+		BlockSize: size,
+	})
+}
+
+// remoteLookup looks name up on the -indexServer. The size of the entry's
+// block is recorded in mu.offsetSize so readArticle can use it; that's one
+// int per block read, which is far smaller than the full index.
+func remoteLookup(name string) (indexEntry, error) {
+	u := strings.TrimSuffix(*indexServer, "/") + "/internal/lookup?title=" + url.QueryEscape(name)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	if *authToken != "" {
+		// The index server is expected to share the frontends' token.
+		req.Header.Set("Authorization", "Bearer "+*authToken)
+	}
+	resp, err := indexServerClient.Do(req)
+	if err != nil {
+		return indexEntry{}, errors.Wrap(err, "querying index server")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error       string   `json:"error"`
+			Suggestions []string `json:"suggestions"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			body.Error = resp.Status
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			err := articleNotFound("%s", body.Error)
+			if len(body.Suggestions) > 0 {
+				return indexEntry{}, suggestionsError{err, body.Suggestions}
+			}
+			return indexEntry{}, err
+		}
+		return indexEntry{}, statusErrorf(http.StatusBadGateway, "index server: %s", body.Error)
+	}
+
+	var entry remoteEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+		return indexEntry{}, errors.Wrap(err, "decoding index server response")
+	}
+	mu.Lock()
+	if mu.offsetSize[entry.Seek] != entry.BlockSize {
+		mu.offsetSize[entry.Seek] = entry.BlockSize
+		mu.generation++
+	}
+	mu.Unlock()
+	return indexEntry{id: entry.ID, seek: entry.Seek}, nil
+}
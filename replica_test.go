@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRemoteLookup(t *testing.T) {
+	block := denseBlock(3, 100)
+	useTestDump(t, block)
+	server := httptest.NewServer(handle(handleLookup))
+	defer server.Close()
+
+	defer func(old string) { *indexServer = old }(*indexServer)
+	*indexServer = server.URL + "/"
+
+	meta, err := fetchArticle(block[2].Title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := readArticle(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != block[2].Title {
+		t.Errorf("read %q; not %q", p.Title, block[2].Title)
+	}
+
+	_, err = fetchArticle("Missing")
+	if code, ok := errors.Cause(err).(statusError); !ok || code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing article; got %v", err)
+	}
+}
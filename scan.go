@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// blockSeeks returns the distinct block offsets in the index in ascending
+// order.
+func blockSeeks() []int {
+	mu.Lock()
+	seeks := make([]int, 0, len(mu.offsetSize))
+	for seek := range mu.offsetSize {
+		seeks = append(seeks, seek)
+	}
+	mu.Unlock()
+
+	sort.Ints(seeks)
+	return seeks
+}
+
+// dumpEnd returns where the indexed part of the articles file ends, given
+// its size: the first block left out of an index cut short by -indexLimit,
+// or else the end of the file.
+func dumpEnd(size int) int {
+	mu.Lock()
+	defer mu.Unlock()
+	if mu.end > 0 && mu.end < size {
+		return mu.end
+	}
+	return size
+}
+
+// IterateArticles decodes every page in the articles dump, starting with the
+// block at or after the offset from, and calls fn with each one and the
+// offset of the block it's in. Blocks are read in offset order and each is
+// decoded up to the start of the next, so pages that are missing from the
+// index are still visited. A scan that's interrupted can be resumed by
+// passing the offset of the last block fn saw, which revisits that block. It
+// stops early with ctx's error once ctx is done, or with fn's error. This
+// must only be called once loadIndex has finished.
+func IterateArticles(ctx context.Context, from int, fn func(seek int, p page) error) error {
+	f, err := os.Open(*articlesFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	seeks := blockSeeks()
+	first := sort.SearchInts(seeks, from)
+	for i := first; i < len(seeks); i++ {
+		seek := seeks[i]
+		end := int64(dumpEnd(int(stat.Size())))
+		if i+1 < len(seeks) {
+			end = int64(seeks[i+1])
+		}
+		block := io.NewSectionReader(f, int64(seek), end-int64(seek))
+		if err := decodeBlock(block, func(p page) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(seek, p)
+		}); err != nil {
+			return errors.Wrapf(err, "decoding block at %d", seek)
+		}
+		if (i+1-first)%10000 == 0 {
+			log.Printf("scanned %d/%d blocks", i+1-first, len(seeks)-first)
+		}
+	}
+	return nil
+}
+
+// decodeBlock decompresses a single multistream block and calls fn with every
+// page in it. Each page's raw XML goes through decodePage, so its derived
+// fields are the same as when it's read on its own.
+func decodeBlock(r io.Reader, fn func(p page) error) error {
+	r, err := utf8Reader(*articlesFile, r)
+	if err != nil {
+		return err
+	}
+	rec := &recordingReader{r: r}
+	s := &pageScanner{d: xml.NewDecoder(rec), rec: rec}
+	for {
+		start, _, ok, err := s.next()
+		if err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+		if err := s.d.Skip(); err != nil {
+			return err
+		}
+		p, err := decodePage(rec.slice(start, s.d.InputOffset()))
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestIterateArticlesDecodesLikeReads(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "A", "Some <b>bold</b> words."),
+		testPage(2, "B", "{{short description|A letter}}\nMore words here."),
+	})
+	err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		entry, err := fetchArticle(p.Title)
+		if err != nil {
+			return err
+		}
+		read, err := readArticle(entry)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(p, read) {
+			t.Errorf("iterated %+v; read %+v", p, read)
+		}
+		if p.WordCount == 0 || p.Length != len(p.Text) {
+			t.Errorf("iterated %s without its derived fields: %+v", p.Title, p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIterateArticles(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "A", ""), testPage(2, "B", "")},
+		[]page{testPage(3, "C", "")},
+		[]page{testPage(4, "D", ""), testPage(5, "E", "")},
+	)
+	seeks := blockSeeks()
+
+	iterate := func(ctx context.Context, from int, limit int) ([]string, error) {
+		var titles []string
+		err := IterateArticles(ctx, from, func(seek int, p page) error {
+			titles = append(titles, p.Title)
+			if len(titles) == limit {
+				return errStopped
+			}
+			return nil
+		})
+		return titles, err
+	}
+
+	cases := []struct {
+		name  string
+		from  int
+		limit int
+		want  []string
+	}{
+		{"all", 0, 0, []string{"A", "B", "C", "D", "E"}},
+		{"resumed at a block", seeks[1], 0, []string{"C", "D", "E"}},
+		{"resumed between blocks", seeks[1] + 1, 0, []string{"D", "E"}},
+		{"past the end", seeks[2] + 1, 0, nil},
+		{"stopped", 0, 3, []string{"A", "B", "C"}},
+	}
+	for _, c := range cases {
+		got, err := iterate(context.Background(), c.from, c.limit)
+		if err != nil && errors.Cause(err) != errStopped {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: visited %q; not %q", c.name, got, c.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var titles []string
+	err := IterateArticles(ctx, 0, func(seek int, p page) error {
+		titles = append(titles, p.Title)
+		cancel()
+		return nil
+	})
+	if errors.Cause(err) != context.Canceled || len(titles) != 1 {
+		t.Errorf("after cancelling visited %q with %v; expected 1 page and context.Canceled", titles, err)
+	}
+}
@@ -0,0 +1,797 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/store/boltdb"
+	"github.com/blevesearch/bleve/index/upsidedown"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/creachadair/cityhash"
+	"github.com/pkg/errors"
+)
+
+var (
+	indexBatchSize = flag.Int("indexBatchSize", 1000, "the number of articles in each batch added to the search index")
+	indexWorkers   = flag.Int("indexWorkers", runtime.NumCPU(), "the number of goroutines building search index batches")
+	searchReadOnly = flag.Bool("searchReadOnly", false, "serve full text search from the existing -searchIndex, built offline with -search, instead of rebuilding it")
+	searchReuse    = flag.Bool("searchReuse", false, "with -search, keep the -searchIndex built by an earlier start if it's of the same dump and -indexFields, instead of rebuilding it")
+	indexFields    = flag.String("indexFields", "title,text", "the comma separated fields of each article added to the search index: title, and optionally text, or text:store to also store the text in the index")
+	bleveStore     = flag.String("bleveStore", boltdb.Name, "how the search index is stored: boltdb, or scorch for a much smaller index that's faster to build, or any other bleve kv store compiled in")
+)
+
+// searchStore is how the search index is built, as passed to bleve.NewUsing.
+type searchStore struct {
+	indexType, kvStore string
+	kvConfig           map[string]interface{}
+}
+
+// searchIndexStore is the parsed -bleveStore, set by run.
+var searchIndexStore = searchStore{indexType: upsidedown.Name, kvStore: boltdb.Name}
+
+// parseBleveStore parses -bleveStore, which names either an index type other
+// than bleve's default upside_down, like scorch, which keeps its own segments,
+// or a kv store for upside_down to keep its rows in. Either must be compiled
+// in.
+func parseBleveStore(name string) (searchStore, error) {
+	if name != upsidedown.Name && registry.IndexTypeConstructorByName(name) != nil {
+		// Index types like scorch ignore the kv store, but bleve requires
+		// one.
+		return searchStore{indexType: name, kvStore: name}, nil
+	}
+	if registry.KVStoreConstructorByName(name) == nil {
+		types, _ := registry.IndexTypesAndInstances()
+		stores, _ := registry.KVStoreTypesAndInstances()
+		var compiled []string
+		for _, t := range types {
+			if t != upsidedown.Name {
+				compiled = append(compiled, t)
+			}
+		}
+		compiled = append(compiled, stores...)
+		sort.Strings(compiled)
+		return searchStore{}, errors.Errorf("unknown store %q, expected one of %s", name, strings.Join(compiled, ", "))
+	}
+	s := searchStore{indexType: upsidedown.Name, kvStore: name}
+	if name == "moss" {
+		// moss only keeps its data in memory unless it has a store on disk
+		// below it.
+		s.kvConfig = map[string]interface{}{"mossLowerLevelStoreName": "mossStore"}
+	}
+	return s, nil
+}
+
+// newSearchIndex creates a search index at path in the -bleveStore.
+func newSearchIndex(path string) (bleve.Index, error) {
+	s := searchIndexStore
+	return bleve.NewUsing(path, searchMapping(), s.indexType, s.kvStore, s.kvConfig)
+}
+
+// searchFields is the parsed -indexFields. Titles are always indexed and
+// stored, since hits are returned by title.
+type searchFields struct {
+	// text is whether article text is indexed, and storeText whether it's
+	// stored as well.
+	text, storeText bool
+}
+
+// searchIndexFields is the parsed -indexFields, set by run.
+var searchIndexFields = searchFields{text: true}
+
+// parseIndexFields parses -indexFields such as "title,text:store".
+func parseIndexFields(raw string) (searchFields, error) {
+	var f searchFields
+	title := false
+	for _, field := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(field) {
+		case "title", "title:store":
+			title = true
+		case "text":
+			f.text = true
+		case "text:store":
+			f.text, f.storeText = true, true
+		case "":
+		default:
+			return searchFields{}, errors.Errorf("unknown field %q, expected title, text or text:store", field)
+		}
+	}
+	if !title {
+		return searchFields{}, errors.Errorf("the title must be indexed")
+	}
+	return f, nil
+}
+
+// errStopped stops the article scan once indexing has failed.
+var errStopped = errors.New("stopped")
+
+// searchDoc is the document indexed into bleve for each article. Documents
+// are keyed by the cityhash of the title, same as the offsets index.
+type searchDoc struct {
+	Title string  `json:"title"`
+	Text  string  `json:"text"`
+	NS    float64 `json:"ns"`
+}
+
+// searchMapping maps the -indexFields of each searchDoc. Anything else is
+// left out of the index rather than mapped dynamically.
+func searchMapping() mapping.IndexMapping {
+	title := bleve.NewTextFieldMapping()
+	title.Store = true
+	title.IncludeTermVectors = !searchIndexFields.text
+
+	ns := bleve.NewNumericFieldMapping()
+	ns.Store = false
+
+	doc := bleve.NewDocumentMapping()
+	doc.Dynamic = false
+	doc.AddFieldMappingsAt("title", title)
+	doc.AddFieldMappingsAt("ns", ns)
+	if searchIndexFields.text {
+		text := bleve.NewTextFieldMapping()
+		text.Store = searchIndexFields.storeText
+		text.IncludeTermVectors = true
+		doc.AddFieldMappingsAt("text", text)
+	}
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = doc
+	return m
+}
+
+func searchDocID(title string) string {
+	return strconv.FormatUint(cityhash.Hash64([]byte(title)), 10)
+}
+
+// indexArticles adds the title and text of every article in the dump to idx.
+// The dump is scanned on one goroutine and -indexWorkers goroutines map the
+// articles into batches, which are then submitted one at a time since the
+// index only applies one batch at a time anyway. Articles end up in
+// different batches from run to run, which doesn't matter since each one is
+// its own document. It's only needed with text in -indexFields, since
+// titleIndexer indexes the titles as the offsets are read.
+func indexArticles(idx bleve.Index) error {
+	workers := *indexWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	log.Printf("Building search index with %d workers...", workers)
+	pages := make(chan page, workers)
+	batches := make(chan *bleve.Batch, workers)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var indexErr error
+	fail := func(err error) {
+		stopOnce.Do(func() {
+			indexErr = err
+			close(stop)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := idx.NewBatch()
+			for p := range pages {
+				doc := searchDoc{Title: p.Title, NS: float64(p.NS)}
+				if searchIndexFields.text {
+					doc.Text = p.Text
+				}
+				if err := batch.Index(searchDocID(p.Title), doc); err != nil {
+					fail(err)
+					return
+				}
+				if batch.Size() < *indexBatchSize {
+					continue
+				}
+				select {
+				case batches <- batch:
+				case <-stop:
+					return
+				}
+				batch = idx.NewBatch()
+			}
+			if batch.Size() > 0 {
+				select {
+				case batches <- batch:
+				case <-stop:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+			select {
+			case pages <- p:
+				return nil
+			case <-stop:
+				return errStopped
+			}
+		})
+		close(pages)
+		if err != nil && errors.Cause(err) != errStopped {
+			fail(err)
+		}
+		wg.Wait()
+		close(batches)
+	}()
+
+	n := 0
+	start, lastLog := time.Now(), time.Now()
+	for batch := range batches {
+		select {
+		case <-stop:
+			// Drain the remaining batches so the workers can exit.
+			continue
+		default:
+		}
+		if err := idx.Batch(batch); err != nil {
+			fail(err)
+			continue
+		}
+		n += batch.Size()
+		if time.Since(lastLog) >= 10*time.Second {
+			log.Printf("indexed %d articles, %.0f/s", n, float64(n)/time.Since(start).Seconds())
+			lastLog = time.Now()
+		}
+	}
+	select {
+	case <-stop:
+		return indexErr
+	default:
+	}
+	log.Printf("Done building search index! %d articles in %s", n, time.Since(start))
+	return nil
+}
+
+// titleIndexer adds the title and namespace of every line of the offsets
+// index to a search index as it's read, so titles are indexed without
+// reading the dump. Documents have the same IDs as indexArticles', so its
+// pass over the text for -indexFields with text replaces them. Each full
+// batch is added on another goroutine while the next is filled.
+type titleIndexer struct {
+	idx     bleve.Index
+	batch   *bleve.Batch
+	batches chan *bleve.Batch
+	done    chan error
+	err     error
+	n       int
+}
+
+func newTitleIndexer(idx bleve.Index) *titleIndexer {
+	t := &titleIndexer{
+		idx:     idx,
+		batch:   idx.NewBatch(),
+		batches: make(chan *bleve.Batch, 1),
+		done:    make(chan error, 1),
+	}
+	go func() {
+		var err error
+		for batch := range t.batches {
+			// Keep draining after an error so add never blocks.
+			if err == nil {
+				err = idx.Batch(batch)
+			}
+		}
+		t.done <- err
+	}()
+	return t
+}
+
+// add indexes title, whose cityhash is hash.
+func (t *titleIndexer) add(hash uint64, title string) {
+	if t.err != nil {
+		return
+	}
+	doc := searchDoc{Title: title, NS: float64(namespaceForTitle(title))}
+	if t.err = t.batch.Index(strconv.FormatUint(hash, 10), doc); t.err != nil || t.batch.Size() < *indexBatchSize {
+		return
+	}
+	t.n += t.batch.Size()
+	t.batches <- t.batch
+	t.batch = t.idx.NewBatch()
+}
+
+// finish adds the last batch and waits for every batch to be added,
+// returning the first error. It must be called once the index is read,
+// whether or not reading it failed.
+func (t *titleIndexer) finish() error {
+	if t.err == nil && t.batch.Size() > 0 {
+		t.n += t.batch.Size()
+		t.batches <- t.batch
+	}
+	close(t.batches)
+	err := <-t.done
+	if t.err != nil {
+		return t.err
+	}
+	if err == nil {
+		log.Printf("Indexed %d titles", t.n)
+	}
+	return err
+}
+
+// searchBuiltKey is the key of the internal value a finished search index
+// keeps its searchBuild under.
+var searchBuiltKey = []byte("wikigopher:built")
+
+// searchBuild is what a search index was built from, to tell whether
+// -searchReuse can keep it.
+type searchBuild struct {
+	Articles, Index fileStamp
+	Text, StoreText bool
+	Store           string
+}
+
+// currentSearchBuild returns the searchBuild of an index built now, encoded
+// as it's kept in the index.
+func currentSearchBuild() ([]byte, error) {
+	h, err := currentOffsetCacheHeader()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(searchBuild{
+		Articles:  h.Articles,
+		Index:     h.Index,
+		Text:      searchIndexFields.text,
+		StoreText: searchIndexFields.storeText,
+		Store:     *bleveStore,
+	})
+}
+
+// reuseSearchIndex serves the search index being served, or else the one at
+// -searchIndex, if it was built from build, reporting false if it wasn't or
+// there's none. Only indexes indexArticles finished are marked with their
+// build, so one that was interrupted is always rebuilt.
+func reuseSearchIndex(build []byte) (bool, error) {
+	searchMu.Lock()
+	defer searchMu.Unlock()
+	if index != nil {
+		built, err := index.GetInternal(searchBuiltKey)
+		return err == nil && bytes.Equal(built, build), err
+	}
+
+	idx, err := bleve.Open(*searchIndexFile)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "opening search index %s", *searchIndexFile)
+	}
+	built, err := idx.GetInternal(searchBuiltKey)
+	if err != nil || !bytes.Equal(built, build) {
+		idx.Close()
+		if err == nil {
+			log.Printf("Search index %s is of another dump or -indexFields, rebuilding it", *searchIndexFile)
+		}
+		return false, err
+	}
+	log.Printf("Reusing search index %s", *searchIndexFile)
+	index = idx
+	return true, nil
+}
+
+// openSearchIndex opens the existing -searchIndex read only for
+// -searchReadOnly. It fails if there's no index there or it wasn't built by
+// wikigopher, since searches against it would fail or find nothing. The
+// fields searched are whichever the index was built with, not
+// -indexFields.
+func openSearchIndex() error {
+	idx, err := bleve.OpenUsing(*searchIndexFile, map[string]interface{}{"read_only": true})
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		return errors.Errorf("-searchReadOnly: no search index at %s, build one with -search first", *searchIndexFile)
+	} else if err != nil {
+		return errors.Wrapf(err, "-searchReadOnly: opening search index %s", *searchIndexFile)
+	}
+	m, ok := idx.Mapping().(*mapping.IndexMappingImpl)
+	if !ok || m.DefaultMapping == nil || m.DefaultMapping.Properties["title"] == nil {
+		idx.Close()
+		return errors.Errorf("-searchReadOnly: %s isn't a wikigopher search index, rebuild it with -search", *searchIndexFile)
+	}
+
+	searchMu.Lock()
+	defer searchMu.Unlock()
+	if index != nil {
+		index.Close()
+	}
+	index = idx
+	return nil
+}
+
+type hitLocation struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+type searchHit struct {
+	Title     string        `json:"title"`
+	Score     float64       `json:"score"`
+	Locations []hitLocation `json:"locations,omitempty"`
+	// Preview is the start of the article's text, with preview=N.
+	Preview string `json:"preview,omitempty"`
+}
+
+// searchFilter restricts full text search results.
+type searchFilter struct {
+	// ns is the namespace results must be in, or nil for any namespace.
+	ns *int
+	// minScore is the lowest relevance score a result may have.
+	minScore float64
+}
+
+// parseSearchFilter reads a searchFilter from the ns and minScore query
+// parameters. By default results are from every namespace with any score.
+func parseSearchFilter(r *http.Request) (searchFilter, error) {
+	var f searchFilter
+	q := r.URL.Query()
+	if raw := q.Get("ns"); raw != "" {
+		ns, err := strconv.Atoi(raw)
+		if err != nil || ns < -2 {
+			return searchFilter{}, statusErrorf(http.StatusBadRequest, "invalid ns %q", raw)
+		}
+		f.ns = &ns
+	}
+	if raw := q.Get("minScore"); raw != "" {
+		score, err := strconv.ParseFloat(raw, 64)
+		if err != nil || score < 0 {
+			return searchFilter{}, statusErrorf(http.StatusBadRequest, "invalid minScore %q", raw)
+		}
+		f.minScore = score
+	}
+	return f, nil
+}
+
+// apply restricts q to the filter's namespace.
+func (f searchFilter) apply(q query.Query) query.Query {
+	if f.ns == nil {
+		return q
+	}
+	ns := float64(*f.ns)
+	inclusive := true
+	nsQuery := bleve.NewNumericRangeInclusiveQuery(&ns, &ns, &inclusive, &inclusive)
+	nsQuery.SetField("ns")
+	return bleve.NewConjunctionQuery(q, nsQuery)
+}
+
+// phraseField returns the field phrases are searched in: the text, or the
+// title if idx was built without the text.
+func phraseField(idx bleve.Index) string {
+	if m, ok := idx.Mapping().(*mapping.IndexMappingImpl); ok && m.DefaultMapping != nil && m.DefaultMapping.Properties["text"] == nil {
+		return "title"
+	}
+	return "text"
+}
+
+// phraseQuery returns the query for the articles in filter's namespace
+// containing phrase, see phraseSearch.
+func phraseQuery(idx bleve.Index, phrase string, filter searchFilter) query.Query {
+	q := bleve.NewMatchPhraseQuery(phrase)
+	q.SetField(phraseField(idx))
+	return filter.apply(q)
+}
+
+type searchCount struct {
+	Total  uint64  `json:"total"`
+	TookMs float64 `json:"tookMs"`
+}
+
+// countPhrase returns how many articles phraseSearch would find for phrase
+// with no limit, without fetching or ranking any of them.
+func countPhrase(idx bleve.Index, phrase string, filter searchFilter) (searchCount, error) {
+	res, err := idx.Search(bleve.NewSearchRequestOptions(phraseQuery(idx, phrase, filter), 0, 0, false))
+	if err != nil {
+		return searchCount{}, err
+	}
+	return searchCount{Total: res.Total, TookMs: float64(res.Took) / float64(time.Millisecond)}, nil
+}
+
+// phraseSearch finds the articles whose text contains phrase as consecutive
+// terms, ordered by relevance. Locations are the byte offsets of the matched
+// terms in the article text. Results below the filter's minimum score are
+// dropped after ranking, so fewer than limit results may be returned. If the
+// index only has titles, phrase is searched for in them instead.
+func phraseSearch(idx bleve.Index, phrase string, limit int, filter searchFilter) ([]searchHit, error) {
+	field := phraseField(idx)
+	req := bleve.NewSearchRequestOptions(phraseQuery(idx, phrase, filter), limit, 0, false)
+	req.Fields = []string{"title"}
+	req.IncludeLocations = true
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []searchHit{}
+	for _, h := range res.Hits {
+		if h.Score < filter.minScore {
+			continue
+		}
+		title, _ := h.Fields["title"].(string)
+		hit := searchHit{
+			Title: title,
+			Score: h.Score,
+		}
+		for _, locs := range h.Locations[field] {
+			for _, loc := range locs {
+				hit.Locations = append(hit.Locations, hitLocation{Start: loc.Start, End: loc.End})
+			}
+		}
+		sort.Slice(hit.Locations, func(i, j int) bool {
+			return hit.Locations[i].Start < hit.Locations[j].Start
+		})
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// titleQuery returns the query for the titles that q may be the start of, or
+// a misspelling of: each of its words must be in the title, spelled the same
+// or up to two edits away depending on the word's length, and the last word
+// may also be the start of one, so partial titles match as they're typed.
+// Exact words score higher than misspelled ones. It's nil if q has no
+// words.
+func titleQuery(idx bleve.Index, q string) query.Query {
+	analyzer := fieldAnalyzer(idx, "title")
+	if analyzer == nil {
+		return nil
+	}
+	tokens := analyzer.Analyze([]byte(q))
+	if len(tokens) == 0 {
+		return nil
+	}
+	words := bleve.NewConjunctionQuery()
+	for i, token := range tokens {
+		term := string(token.Term)
+		exact := bleve.NewTermQuery(term)
+		exact.SetField("title")
+		exact.SetBoost(2)
+		fuzzy := bleve.NewFuzzyQuery(term)
+		fuzzy.SetField("title")
+		switch n := utf8.RuneCountInString(term); {
+		case n <= 2:
+			fuzzy.SetFuzziness(0)
+		case n <= 5:
+			fuzzy.SetFuzziness(1)
+		default:
+			fuzzy.SetFuzziness(2)
+		}
+		word := bleve.NewDisjunctionQuery(exact, fuzzy)
+		if i == len(tokens)-1 {
+			prefix := bleve.NewPrefixQuery(term)
+			prefix.SetField("title")
+			word.AddQuery(prefix)
+		}
+		words.AddQuery(word)
+	}
+	return words
+}
+
+// suggestSearch returns up to limit titles in idx that q may be the start
+// or a misspelling of, best first, see titleQuery.
+func suggestSearch(idx bleve.Index, q string, limit int) ([]string, error) {
+	titles := []string{}
+	tq := titleQuery(idx, q)
+	if tq == nil {
+		return titles, nil
+	}
+	req := bleve.NewSearchRequestOptions(tq, limit, 0, false)
+	req.Fields = []string{"title"}
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range res.Hits {
+		if title, _ := h.Fields["title"].(string); title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return titles, nil
+}
+
+type titleSuggestion struct {
+	Title string `json:"title"`
+	ID    int    `json:"id"`
+}
+
+// handleSuggestSearch serves /suggest?q=...&limit=N, returning the articles
+// whose titles q is the start or a misspelling of, best first, for
+// autocomplete and typo tolerant title search. If q is a title, as it is,
+// it's the only suggestion, looked up in the offsets index without querying
+// the search index, or the -fullScanFallback or -suggest a miss would cost
+// /article.
+func handleSuggestSearch(w http.ResponseWriter, r *http.Request) error {
+	q, err := phraseParam(r)
+	if err != nil {
+		return err
+	}
+	limit, err := intParam(r, "limit", 10, 1, 100)
+	if err != nil {
+		return err
+	}
+
+	if entry, ok := lookupTitle(q); ok {
+		return writeJSON(w, r, []titleSuggestion{{Title: q, ID: entry.id}})
+	}
+
+	searchMu.RLock()
+	if index == nil {
+		searchMu.RUnlock()
+		return statusErrorf(http.StatusServiceUnavailable, "search index is still being built")
+	}
+	titles, err := suggestSearch(index, q, limit)
+	searchMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	suggestions := []titleSuggestion{}
+	for _, title := range titles {
+		entry, ok := lookupTitle(title)
+		if !ok {
+			// Not found means the search index is older than the offsets
+			// index.
+			continue
+		}
+		suggestions = append(suggestions, titleSuggestion{Title: title, ID: entry.id})
+	}
+	return writeJSON(w, r, suggestions)
+}
+
+// handleTitleSearch serves /search?q=..., returning the article titled q. An
+// empty q is a 400 rather than a lookup of the empty title. format=plain or
+// format=html renders the text in one of the formats, keeping the rest of
+// the page, and followRedirect=true returns the article a redirect points to
+// instead, as /article does.
+func handleTitleSearch(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+	q := params.Get("q")
+	if strings.TrimSpace(q) == "" {
+		return statusErrorf(http.StatusBadRequest, "query parameter q is required")
+	}
+	var format textFormat
+	name := params.Get("format")
+	if name != "" {
+		var err error
+		if format, err = lookupFormat(name); err != nil {
+			return err
+		}
+	}
+	article, err := fetchArticle(q)
+	if err != nil {
+		return err
+	}
+	pg, err := readArticle(article)
+	if err != nil {
+		return err
+	}
+	result := titleSearchResult{page: pg}
+	if follow, _ := strconv.ParseBool(params.Get("followRedirect")); follow {
+		if result.page, result.RedirectSection, err = followRedirect(pg); err != nil {
+			return err
+		}
+		if result.Title != pg.Title {
+			result.RedirectedFrom = pg.Title
+		}
+	}
+	if name != "" {
+		resolveMedia, _ := strconv.ParseBool(params.Get("resolveMedia"))
+		result.Text = renderFormat(result.page, name, format, renderOptions{resolveMedia: resolveMedia})
+		result.RenderedAs = name
+	}
+	return writeJSON(w, r, result)
+}
+
+// titleSearchResult is the article /search found, which is just the page
+// unless it was rendered or a redirect was followed.
+type titleSearchResult struct {
+	page
+	// RenderedAs is the format the text was rendered in, if not the wikitext.
+	// The page's own Format is still the dump's, like text/x-wiki.
+	RenderedAs string `json:"renderedFormat,omitempty"`
+	// RedirectedFrom is the title of the redirect followed to the article,
+	// and RedirectSection the section of the article it points to.
+	RedirectedFrom  string `json:"redirectedFrom,omitempty"`
+	RedirectSection string `json:"redirectSection,omitempty"`
+}
+
+// phraseParam returns the phrase a full text search is for, or an error if
+// there's no search index to search.
+func phraseParam(r *http.Request) (string, error) {
+	if !*search && !*searchReadOnly {
+		return "", statusErrorf(http.StatusServiceUnavailable, "search index disabled, start with -search")
+	}
+	phrase := strings.Trim(strings.TrimSpace(r.URL.Query().Get("q")), `"`)
+	if phrase == "" {
+		return "", statusErrorf(http.StatusBadRequest, "q parameter is required")
+	}
+	return phrase, nil
+}
+
+// handleSearchCount serves /search/count?q="exact words"&ns=0, returning how
+// many articles /search/phrase would find with no limit, which is much
+// cheaper than the search itself since no hit is ranked or fetched. It's
+// bleve's total for the matched set. minScore is rejected, since scores are
+// only known once hits are ranked.
+func handleSearchCount(w http.ResponseWriter, r *http.Request) error {
+	phrase, err := phraseParam(r)
+	if err != nil {
+		return err
+	}
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		return err
+	}
+	if r.URL.Query().Get("minScore") != "" {
+		return statusErrorf(http.StatusBadRequest, "minScore can't be counted without ranking the hits, use /search/phrase")
+	}
+
+	searchMu.RLock()
+	if index == nil {
+		searchMu.RUnlock()
+		return statusErrorf(http.StatusServiceUnavailable, "search index is still being built")
+	}
+	count, err := countPhrase(index, phrase, filter)
+	searchMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, count)
+}
+
+// handlePhraseSearch serves /search/phrase?q="exact words"&limit=N&ns=0&minScore=0.5. Unlike
+// /search, which looks up a single article by title, this is a full text
+// search that only matches articles containing the words of q next to each
+// other and in order. preview=N adds the first N characters of each
+// article's text, which means reading every hit.
+func handlePhraseSearch(w http.ResponseWriter, r *http.Request) error {
+	phrase, err := phraseParam(r)
+	if err != nil {
+		return err
+	}
+	limit, err := intParam(r, "limit", 20, 1, 100)
+	if err != nil {
+		return err
+	}
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		return err
+	}
+	preview, err := previewParam(r)
+	if err != nil {
+		return err
+	}
+
+	searchMu.RLock()
+	if index == nil {
+		searchMu.RUnlock()
+		return statusErrorf(http.StatusServiceUnavailable, "search index is still being built")
+	}
+	hits, err := phraseSearch(index, phrase, limit, filter)
+	searchMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if preview > 0 {
+		titles := make([]string, len(hits))
+		for i, hit := range hits {
+			titles[i] = hit.Title
+		}
+		for i, p := range fetchPreviews(titles, preview) {
+			hits[i].Preview = p
+		}
+	}
+	return writeJSON(w, r, hits)
+}
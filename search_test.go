@@ -0,0 +1,793 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+func testSearchIndex(t *testing.T, docs ...searchDoc) bleve.Index {
+	t.Helper()
+
+	idx, err := bleve.NewMemOnly(searchMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	for _, doc := range docs {
+		if err := idx.Index(searchDocID(doc.Title), doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func TestPhraseSearch(t *testing.T) {
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Exact", Text: "The quick brown fox jumps over the lazy dog."},
+		searchDoc{Title: "Repeated", Text: "A quick brown fox. Another quick brown fox. Yet another quick brown fox sleeps in a field near the river bank."},
+		searchDoc{Title: "Scrambled", Text: "The brown quick fox, a fox that is quick and brown."},
+		searchDoc{Title: "Unrelated", Text: "Nothing to see here."},
+	)
+
+	hits, err := phraseSearch(idx, "quick brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, hit := range hits {
+		titles = append(titles, hit.Title)
+	}
+	if len(titles) != 2 {
+		t.Fatalf("expected only the two articles containing the phrase; got %q", titles)
+	}
+	for _, hit := range hits {
+		if hit.Title == "Scrambled" || hit.Title == "Unrelated" {
+			t.Errorf("%q doesn't contain the phrase; got %q", hit.Title, titles)
+		}
+	}
+	if hits[0].Title != "Repeated" {
+		t.Errorf("expected the article repeating the phrase to rank first; got %q", titles)
+	}
+
+	exact := hits[1]
+	if exact.Title == "Repeated" {
+		exact = hits[0]
+	}
+	want := []hitLocation{{4, 9}, {10, 15}, {16, 19}}
+	if len(exact.Locations) != len(want) {
+		t.Fatalf("locations = %+v; not %+v", exact.Locations, want)
+	}
+	for i := range want {
+		if exact.Locations[i] != want[i] {
+			t.Errorf("locations = %+v; not %+v", exact.Locations, want)
+		}
+	}
+}
+
+func TestPhraseSearchFilters(t *testing.T) {
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Article", Text: "The quick brown fox.", NS: 0},
+		searchDoc{Title: "Talk:Article", Text: "Is the quick brown fox quick brown fox enough?", NS: 1},
+		searchDoc{Title: "Long", Text: "A quick brown fox in a very long article with lots of other words that dilute the relevance of the match quite a bit.", NS: 0},
+	)
+
+	titles := func(hits []searchHit) []string {
+		titles := []string{}
+		for _, hit := range hits {
+			titles = append(titles, hit.Title)
+		}
+		return titles
+	}
+
+	ns := 0
+	hits, err := phraseSearch(idx, "quick brown fox", 10, searchFilter{ns: &ns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(hits); len(got) != 2 || got[0] != "Article" || got[1] != "Long" {
+		t.Errorf("ns=0 results = %q; not %q", got, []string{"Article", "Long"})
+	}
+
+	ns = 1
+	hits, err = phraseSearch(idx, "quick brown fox", 10, searchFilter{ns: &ns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(hits); len(got) != 1 || got[0] != "Talk:Article" {
+		t.Errorf("ns=1 results = %q; not %q", got, []string{"Talk:Article"})
+	}
+
+	all, err := phraseSearch(idx, "quick brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 results; got %q", titles(all))
+	}
+	threshold := (all[1].Score + all[2].Score) / 2
+	hits, err = phraseSearch(idx, "quick brown fox", 10, searchFilter{minScore: threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(hits); len(got) != 2 || got[0] != all[0].Title || got[1] != all[1].Title {
+		t.Errorf("minScore=%f results = %q; not the top 2 of %q", threshold, got, titles(all))
+	}
+	for _, hit := range hits {
+		if hit.Score < threshold {
+			t.Errorf("%q has score %f below the minimum %f", hit.Title, hit.Score, threshold)
+		}
+	}
+}
+
+func TestHandleSearchCount(t *testing.T) {
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Article", Text: "The quick brown fox.", NS: 0},
+		searchDoc{Title: "Talk:Article", Text: "Is the quick brown fox enough?", NS: 1},
+		searchDoc{Title: "Long", Text: "A quick brown fox in a long article.", NS: 0},
+		searchDoc{Title: "Scrambled", Text: "The brown quick fox.", NS: 0},
+	)
+	defer func(s bool) { *search = s }(*search)
+	*search = true
+	searchMu.Lock()
+	old := index
+	index = idx
+	searchMu.Unlock()
+	defer func() {
+		searchMu.Lock()
+		index = old
+		searchMu.Unlock()
+	}()
+
+	cases := []struct {
+		query string
+		code  int
+		total uint64
+	}{
+		{`q="quick brown fox"`, http.StatusOK, 3},
+		{`q=quick brown fox&ns=0`, http.StatusOK, 2},
+		{`q=quick brown fox&ns=1`, http.StatusOK, 1},
+		{`q=purple fox`, http.StatusOK, 0},
+		{`q=quick brown fox&minScore=0.5`, http.StatusBadRequest, 0},
+		{`q=`, http.StatusBadRequest, 0},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handle(handleSearchCount)(w, httptest.NewRequest("GET", "/search/count?"+strings.ReplaceAll(c.query, " ", "+"), nil))
+		if w.Code != c.code {
+			t.Errorf("%s: status = %d; not %d: %s", c.query, w.Code, c.code, w.Body)
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		var count searchCount
+		if err := json.Unmarshal(w.Body.Bytes(), &count); err != nil {
+			t.Fatal(err)
+		}
+		if count.Total != c.total || count.TookMs < 0 {
+			t.Errorf("%s: count = %+v; expected total %d", c.query, count, c.total)
+		}
+	}
+}
+
+func TestIndexArticles(t *testing.T) {
+	defer func(size, workers int) { *indexBatchSize, *indexWorkers = size, workers }(*indexBatchSize, *indexWorkers)
+	*indexBatchSize, *indexWorkers = 3, 4
+
+	var blocks [][]page
+	for b := 0; b < 5; b++ {
+		var block []page
+		for i := 0; i < 4; i++ {
+			id := b*4 + i + 1
+			block = append(block, testPage(id, fmt.Sprintf("Page %d", id), fmt.Sprintf("article number%d text", id)))
+		}
+		blocks = append(blocks, block)
+	}
+	useTestDump(t, blocks...)
+
+	idx := testSearchIndex(t)
+	if err := indexArticles(idx); err != nil {
+		t.Fatal(err)
+	}
+	count, err := idx.DocCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Errorf("indexed %d articles; not 20", count)
+	}
+	hits, err := phraseSearch(idx, "number17 text", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Page 17" {
+		t.Errorf("phraseSearch = %+v; expected Page 17", hits)
+	}
+}
+
+func TestOpenSearchIndex(t *testing.T) {
+	defer func(path string) { *searchIndexFile = path }(*searchIndexFile)
+	dir := t.TempDir()
+	defer func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}()
+
+	*searchIndexFile = filepath.Join(dir, "missing.bleve")
+	if err := openSearchIndex(); err == nil || !strings.Contains(err.Error(), "no search index") {
+		t.Errorf("openSearchIndex() = %v; expected a missing index error", err)
+	}
+
+	*searchIndexFile = filepath.Join(dir, "other.bleve")
+	other, err := bleve.New(*searchIndexFile, bleve.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+	if err := openSearchIndex(); err == nil || !strings.Contains(err.Error(), "isn't a wikigopher search index") {
+		t.Errorf("openSearchIndex() = %v; expected an incompatible index error", err)
+	}
+
+	*searchIndexFile = filepath.Join(dir, "index.bleve")
+	built, err := bleve.New(*searchIndexFile, searchMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := built.Index(searchDocID("Fox"), searchDoc{Title: "Fox", Text: "The quick brown fox."}); err != nil {
+		t.Fatal(err)
+	}
+	built.Close()
+	if err := openSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := phraseSearch(index, "brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Fox" {
+		t.Errorf("phraseSearch = %+v; expected Fox", hits)
+	}
+	if err := index.Index(searchDocID("Dog"), searchDoc{Title: "Dog"}); err == nil {
+		t.Error("expected indexing into a read only index to fail")
+	}
+}
+
+func TestSwapSearchIndex(t *testing.T) {
+	defer func(path string) { *searchIndexFile = path }(*searchIndexFile)
+	defer func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}()
+	dir := t.TempDir()
+	*searchIndexFile = filepath.Join(dir, "index.bleve")
+
+	build := func(path, title string) bleve.Index {
+		idx, err := newSearchIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Index(searchDocID(title), searchDoc{Title: title, Text: "The quick brown fox."}); err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+	for _, title := range []string{"Old", "New"} {
+		loading := *searchIndexFile + ".loading"
+		if err := swapSearchIndex(build(loading, title), loading); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(loading); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after the swap: %v", loading, err)
+		}
+	}
+	hits, err := phraseSearch(index, "brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "New" {
+		t.Errorf("phraseSearch = %+v; expected only New", hits)
+	}
+
+	// A swap that fails part way leaves nothing to serve rather than an
+	// index whose files have moved.
+	missing := filepath.Join(dir, "missing")
+	failed := build(filepath.Join(dir, "failed.bleve"), "Failed")
+	if err := swapSearchIndex(failed, missing); err == nil {
+		t.Error("expected swapping in an index from a missing path to fail")
+	}
+	if index != nil {
+		t.Errorf("index = %v after a failed swap; expected nil", index)
+	}
+}
+
+func TestParseIndexFields(t *testing.T) {
+	cases := []struct {
+		in   string
+		want searchFields
+		err  bool
+	}{
+		{"title,text", searchFields{text: true}, false},
+		{"title", searchFields{}, false},
+		{" title , text:store ", searchFields{text: true, storeText: true}, false},
+		{"text", searchFields{}, true},
+		{"title,body", searchFields{}, true},
+	}
+	for _, c := range cases {
+		got, err := parseIndexFields(c.in)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("parseIndexFields(%q) = %+v, %v; not %+v, error %v", c.in, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestParseBleveStore(t *testing.T) {
+	cases := []struct {
+		in                 string
+		indexType, kvStore string
+		err                bool
+	}{
+		{"boltdb", "upside_down", "boltdb", false},
+		{"scorch", "scorch", "scorch", false},
+		{"gtreap", "upside_down", "gtreap", false},
+		{"upside_down", "", "", true},
+		{"rocksdb", "", "", true},
+	}
+	for _, c := range cases {
+		got, err := parseBleveStore(c.in)
+		if (err != nil) != c.err || got.indexType != c.indexType || got.kvStore != c.kvStore {
+			t.Errorf("parseBleveStore(%q) = %+v, %v; not %s/%s, error %v", c.in, got, err, c.indexType, c.kvStore, c.err)
+		}
+	}
+}
+
+func TestScorchSearchIndex(t *testing.T) {
+	defer func(path string, s searchStore) { *searchIndexFile, searchIndexStore = path, s }(*searchIndexFile, searchIndexStore)
+	defer func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}()
+	var err error
+	if searchIndexStore, err = parseBleveStore("scorch"); err != nil {
+		t.Fatal(err)
+	}
+	*searchIndexFile = filepath.Join(t.TempDir(), "index.bleve")
+	built, err := newSearchIndex(*searchIndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := built.Index(searchDocID("Fox"), searchDoc{Title: "Fox", Text: "The quick brown fox."}); err != nil {
+		t.Fatal(err)
+	}
+	built.Close()
+
+	if err := openSearchIndex(); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := phraseSearch(index, "brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Fox" {
+		t.Errorf("phraseSearch = %+v; expected Fox", hits)
+	}
+}
+
+// TestScorchLoadIndex goes through loadIndex's build and swap, since scorch
+// opens its segment files by path and so breaks if it's moved while open.
+func TestScorchLoadIndex(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Fox", "The quick brown fox.")})
+	defer func(path, indexPath string, enabled bool, s searchStore) {
+		*searchIndexFile, *indexFile, *search, searchIndexStore = path, indexPath, enabled, s
+	}(*searchIndexFile, *indexFile, *search, searchIndexStore)
+	defer func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}()
+	var err error
+	if searchIndexStore, err = parseBleveStore("scorch"); err != nil {
+		t.Fatal(err)
+	}
+	*searchIndexFile, *indexFile, *search = filepath.Join(t.TempDir(), "index.bleve"), "", true
+
+	// Reloading swaps out an index that's already being served.
+	for i := 0; i < 2; i++ {
+		if err := loadIndex(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		title := fmt.Sprintf("Dog %d", i)
+		if err := index.Index(searchDocID(title), searchDoc{Title: title, Text: fmt.Sprintf("The lazy dog%d.", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct{ phrase, title string }{{"brown fox", "Fox"}, {"lazy dog19", "Dog 19"}} {
+		hits, err := phraseSearch(index, c.phrase, 10, searchFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != 1 || hits[0].Title != c.title {
+			t.Errorf("phraseSearch(%q) = %+v; expected %s", c.phrase, hits, c.title)
+		}
+	}
+}
+
+func TestTitleOnlySearchIndex(t *testing.T) {
+	defer func(f searchFields) { searchIndexFields = f }(searchIndexFields)
+	searchIndexFields = searchFields{}
+
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Quick brown fox", Text: "A fox."},
+		searchDoc{Title: "Dog", Text: "The quick brown fox jumps over the lazy dog."},
+	)
+	hits, err := phraseSearch(idx, "quick brown fox", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Title != "Quick brown fox" {
+		t.Fatalf("phraseSearch = %+v; expected only the title match", hits)
+	}
+	if want := []hitLocation{{0, 5}, {6, 11}, {12, 15}}; fmt.Sprint(hits[0].Locations) != fmt.Sprint(want) {
+		t.Errorf("locations = %v; not %v", hits[0].Locations, want)
+	}
+	if hits, err := phraseSearch(idx, "lazy dog", 10, searchFilter{}); err != nil || len(hits) != 0 {
+		t.Errorf("phraseSearch(lazy dog) = %+v, %v; expected the text not to be indexed", hits, err)
+	}
+}
+
+// TestLoadTitleSearchIndex builds a title only search index from an index
+// file listing a title the dump doesn't have, which is only indexed if the
+// titles come from the index lines.
+func TestLoadTitleSearchIndex(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Fox", "text"), testPage(2, "Talk:Red fox", "talk")})
+	defer func(path, indexPath string, enabled bool, f searchFields) {
+		*searchIndexFile, *indexFile, *search, searchIndexFields = path, indexPath, enabled, f
+	}(*searchIndexFile, *indexFile, *search, searchIndexFields)
+	defer func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}()
+	entry, _ := lookupTitle("Fox")
+	dir := t.TempDir()
+	lines := fmt.Sprintf("%d:1:Fox\n%[1]d:2:Talk:Red fox\n%[1]d:3:Index only fox\n", entry.seek)
+	*indexFile = filepath.Join(dir, "index.txt")
+	if err := ioutil.WriteFile(*indexFile, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	*searchIndexFile, *search, searchIndexFields = filepath.Join(dir, "index.bleve"), true, searchFields{}
+
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := index.DocCount(); err != nil || n != 3 {
+		t.Errorf("index has %d documents, %v; expected every index line's title", n, err)
+	}
+	talk := 1
+	for _, c := range []struct {
+		filter searchFilter
+		want   string
+	}{
+		{searchFilter{}, "Fox,Index only fox,Talk:Red fox"},
+		{searchFilter{ns: &talk}, "Talk:Red fox"},
+	} {
+		hits, err := phraseSearch(index, "fox", 10, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, h := range hits {
+			titles = append(titles, h.Title)
+		}
+		sort.Strings(titles)
+		if got := strings.Join(titles, ","); got != c.want {
+			t.Errorf("phraseSearch(fox, %+v) = %s; not %s", c.filter, got, c.want)
+		}
+	}
+}
+
+func TestLoadIndexWithoutSearch(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "text")})
+	defer func(path, indexPath string, enabled bool) {
+		*searchIndexFile, *indexFile, *search = path, indexPath, enabled
+	}(*searchIndexFile, *indexFile, *search)
+	dir := t.TempDir()
+	*searchIndexFile, *indexFile, *search = filepath.Join(dir, "index.bleve"), "", false
+
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lookupArticle("Foo"); err != nil {
+		t.Errorf("lookupArticle after loading: %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("loading without -search created %s", f.Name())
+	}
+
+	req := httptest.NewRequest("GET", "/search/phrase?q=text", nil)
+	w := httptest.NewRecorder()
+	handle(handlePhraseSearch)(w, req)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "-search") {
+		t.Errorf("status = %d: %s; expected a 503 saying search is disabled", w.Code, w.Body)
+	}
+}
+
+func TestLoadIndexReusesSearchIndex(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "text")})
+	defer func(path, indexPath string, enabled, reuse bool) {
+		*searchIndexFile, *indexFile, *search, *searchReuse = path, indexPath, enabled, reuse
+	}(*searchIndexFile, *indexFile, *search, *searchReuse)
+	*searchIndexFile, *indexFile = filepath.Join(t.TempDir(), "index.bleve"), ""
+	*search, *searchReuse = true, true
+	closeIndex := func() {
+		searchMu.Lock()
+		if index != nil {
+			index.Close()
+			index = nil
+		}
+		searchMu.Unlock()
+	}
+	defer closeIndex()
+	count := func() uint64 {
+		n, err := index.DocCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	// A document the dump doesn't have tells a reused index from a rebuilt
+	// one.
+	if err := index.Index(searchDocID("Marker"), searchDoc{Title: "Marker"}); err != nil {
+		t.Fatal(err)
+	}
+	closeIndex()
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("reopened index has %d documents; expected it to be reused", n)
+	}
+	served := index
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if index != served {
+		t.Error("reloading replaced the served index of the same dump")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(*articlesFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("index of a changed dump has %d documents; expected it to be rebuilt", n)
+	}
+
+	*searchReuse = false
+	if err := index.Index(searchDocID("Marker"), searchDoc{Title: "Marker"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("index has %d documents; expected it to be rebuilt without -searchReuse", n)
+	}
+}
+
+func TestTitleSearchFormat(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Fox", "The '''red''' [[fox]]."),
+		testPage(2, "Red fox", "#REDIRECT [[Fox]]"),
+	})
+	cases := []struct {
+		query, title, text, format, redirectedFrom string
+		code                                       int
+	}{
+		{"q=Fox", "Fox", "The '''red''' [[fox]].", "", "", http.StatusOK},
+		{"q=Fox&format=wikitext", "Fox", "The '''red''' [[fox]].", "wikitext", "", http.StatusOK},
+		{"q=Fox&format=plain", "Fox", "The red fox.", "plain", "", http.StatusOK},
+		{"q=Fox&format=html", "Fox", "<b>red</b>", "html", "", http.StatusOK},
+		{"q=Red+fox&followRedirect=true", "Fox", "The '''red''' [[fox]].", "", "Red fox", http.StatusOK},
+		{"q=Red+fox&format=plain&followRedirect=true", "Fox", "The red fox.", "plain", "Red fox", http.StatusOK},
+		{"q=Fox&format=pdf", "", "", "", "", http.StatusBadRequest},
+		{"q=Missing&format=pdf", "", "", "", "", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handle(handleTitleSearch)(w, httptest.NewRequest("GET", "/search?"+c.query, nil))
+		if w.Code != c.code {
+			t.Errorf("%s: status = %d; not %d: %s", c.query, w.Code, c.code, w.Body)
+			continue
+		}
+		if c.code != http.StatusOK {
+			continue
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q; expected handle to set it", c.query, got)
+		}
+		var got titleSearchResult
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != c.title || !strings.Contains(got.Text, c.text) || got.RenderedAs != c.format || got.Format != "text/x-wiki" || got.RedirectedFrom != c.redirectedFrom {
+			t.Errorf("%s: got %+v", c.query, got)
+		}
+	}
+}
+
+func TestEmptyTitleQuery(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "text")})
+	cases := []struct {
+		url     string
+		handler func(w http.ResponseWriter, r *http.Request) error
+		want    string
+	}{
+		{"/search", handleTitleSearch, "query parameter q is required"},
+		{"/search?q=%20%20", handleTitleSearch, "query parameter q is required"},
+		{"/article?title=", handleArticle, "title is required"},
+		{"/article?title=%09", handleArticle, "title is required"},
+		{"/length", handleLength, "title is required"},
+		{"/revision?title=+", handleRevision, "title is required"},
+		{"/seealso", handleSeeAlso, "title is required"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handle(nullIfMissing(c.handler))(w, httptest.NewRequest("GET", c.url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d; not %d", c.url, w.Code, http.StatusBadRequest)
+		}
+		if want := `{"error":"` + c.want; !strings.HasPrefix(w.Body.String(), want) {
+			t.Errorf("%s: body = %s; expected it to start with %s", c.url, w.Body, want)
+		}
+	}
+}
+
+func TestSuggestSearch(t *testing.T) {
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Quantum mechanics"},
+		searchDoc{Title: "Quantum field theory"},
+		searchDoc{Title: "Classical mechanics"},
+		searchDoc{Title: "Albert Einstein"},
+		searchDoc{Title: "Einstein ring"},
+		searchDoc{Title: "Bread"},
+		searchDoc{Title: "Brad Pitt"},
+	)
+
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"quantm mechanics", []string{"Quantum mechanics"}},
+		{"quantum mech", []string{"Quantum mechanics"}},
+		{"quantum", []string{"Quantum field theory", "Quantum mechanics"}},
+		{"albert einstien", []string{"Albert Einstein"}},
+		{"mechanics", []string{"Classical mechanics", "Quantum mechanics"}},
+		{"einstien", []string{"Albert Einstein", "Einstein ring"}},
+		{"brad", []string{"Brad Pitt", "Bread"}},
+		{"zebra", []string{}},
+		{"   ", []string{}},
+	}
+	for _, c := range cases {
+		got, err := suggestSearch(idx, c.q, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("suggestSearch(%q) = %q, want %q", c.q, got, c.want)
+		}
+	}
+
+	got, err := suggestSearch(idx, "bread", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Bread", "Brad Pitt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("suggestSearch(bread) = %q, want the exact spelling first, %q", got, want)
+	}
+	got, err = suggestSearch(idx, "quantum", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("limit 1 returned %q", got)
+	}
+}
+
+func TestHandleSuggestSearch(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Quantum mechanics", "text"),
+		testPage(2, "Quantum field theory", "text"),
+	})
+	defer func(s bool) { *search = s }(*search)
+	*search = true
+	searchMu.Lock()
+	old := index
+	index = nil
+	searchMu.Unlock()
+	defer func() {
+		searchMu.Lock()
+		index = old
+		searchMu.Unlock()
+	}()
+	get := func(query string) (int, string) {
+		w := httptest.NewRecorder()
+		handle(handleSuggestSearch)(w, httptest.NewRequest("GET", "/suggest?"+query, nil))
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	exact := `[{"title":"Quantum mechanics","id":1}]`
+
+	// Exact titles don't need the search index.
+	if code, body := get("q=Quantum+mechanics"); code != http.StatusOK || body != exact {
+		t.Errorf("exact title before the index is built = %d: %s; not %s", code, body, exact)
+	}
+	if code, _ := get("q=quantm"); code != http.StatusServiceUnavailable {
+		t.Errorf("misspelling before the index is built = %d; expected a 503", code)
+	}
+
+	searchMu.Lock()
+	index = testSearchIndex(t,
+		searchDoc{Title: "Quantum mechanics"},
+		searchDoc{Title: "Quantum field theory"},
+		// In the search index but no longer in the dump.
+		searchDoc{Title: "Quantum gone"},
+	)
+	searchMu.Unlock()
+	if code, body := get("q=Quantum+mechanics&limit=10"); code != http.StatusOK || body != exact {
+		t.Errorf("exact title = %d: %s; expected only it, %s", code, body, exact)
+	}
+	if code, body := get("q=quantm+mech"); code != http.StatusOK || body != exact {
+		t.Errorf("misspelling = %d: %s; expected the search index's %s", code, body, exact)
+	}
+	code, body := get("q=quantum")
+	var got []titleSuggestion
+	if err := json.Unmarshal([]byte(body), &got); code != http.StatusOK || err != nil {
+		t.Fatalf("prefix = %d: %s", code, body)
+	}
+	if len(got) != 2 {
+		t.Errorf("prefix = %s; expected the two titles in the dump", body)
+	}
+}
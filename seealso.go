@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+)
+
+var seeAlsoSections = flag.String("seeAlsoSections", "See also,Related articles,Siehe auch,Voir aussi,Véase también,Vedi anche,Zie ook,Veja também", "the comma separated titles of the \"See also\" section in the wiki's languages, matched case insensitively, for /seealso")
+
+// extractSeeAlso returns the normalized targets of the links in the first
+// section of text titled one of the -seeAlsoSections, including any
+// subsections, or an empty list if it has none.
+func extractSeeAlso(text string) []string {
+	names := map[string]bool{}
+	for _, name := range strings.Split(*seeAlsoSections, ",") {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			names[strings.ToLower(name)] = true
+		}
+	}
+	sections := extractSections(text)
+	for i, s := range sections {
+		if !names[strings.ToLower(strings.Join(strings.Fields(s.Title), " "))] {
+			continue
+		}
+		end := len(text)
+		for _, next := range sections[i+1:] {
+			if next.Level <= s.Level {
+				end = next.Offset
+				break
+			}
+		}
+		if links := extractLinks(text[s.Offset:end]); links != nil {
+			return links
+		}
+		break
+	}
+	return []string{}
+}
+
+// handleSeeAlso serves /seealso?title=..., listing the articles linked from
+// its "See also" section, which editors curate as the most closely related.
+func handleSeeAlso(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, extractSeeAlso(p.Text))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractSeeAlso(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			"section",
+			"Lead [[Ignored]].\n== History ==\n[[Past]]\n== See also ==\n* [[Foo]]\n* [[bar_baz|Bar]]\n* [[Foo#History]]\n== References ==\n[[Cited]]\n",
+			[]string{"Foo", "Bar baz"},
+		},
+		{
+			"subsections and last section",
+			"== See Also ==\n* [[A]]\n=== Lists ===\n* [[List of A]]\n[[Category:Things]]",
+			[]string{"A", "List of A"},
+		},
+		{"localized", "== Siehe auch ==\n* [[Ziel]]\n== Einzelnachweise ==\n", []string{"Ziel"}},
+		{"spacing", "==See  also==\n* [[A]]", []string{"A"}},
+		{"no links", "== See also ==\n{{Portal|Physics}}\n== Notes ==\n[[B]]", []string{}},
+		{"absent", "Lead [[A]].\n== History ==\n[[B]]", []string{}},
+	}
+	for _, c := range cases {
+		if got := extractSeeAlso(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: extractSeeAlso = %q; not %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/blevesearch/bleve"
+	"github.com/pkg/errors"
+)
+
+// maxSimilarTerms is the number of an article's most distinctive terms
+// /similar searches for.
+const maxSimilarTerms = 25
+
+type weightedTerm struct {
+	term   string
+	weight float64
+}
+
+// distinctiveTerms returns up to maxSimilarTerms of the terms of text, as
+// field is analyzed in idx, weighted by TF-IDF: how often each is in text
+// times the log of how rare it is among idx's documents. Terms no other
+// document could have, since at most one has them, are left out.
+func distinctiveTerms(idx bleve.Index, field, text string) ([]weightedTerm, error) {
+	m := idx.Mapping()
+	analyzer := m.AnalyzerNamed(m.AnalyzerNameForPath(field))
+	if analyzer == nil {
+		return nil, errors.Errorf("no analyzer for %s", field)
+	}
+	tf := map[string]int{}
+	for _, token := range analyzer.Analyze([]byte(text)) {
+		tf[string(token.Term)]++
+	}
+
+	i, _, err := idx.Advanced()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := i.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	docs, err := reader.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []weightedTerm
+	for term, n := range tf {
+		tfr, err := reader.TermFieldReader([]byte(term), field, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		df := tfr.Count()
+		tfr.Close()
+		if df < 2 {
+			continue
+		}
+		if weight := float64(n) * math.Log(float64(docs)/float64(df)); weight > 0 {
+			terms = append(terms, weightedTerm{term, weight})
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		return terms[i].term < terms[j].term
+	})
+	if len(terms) > maxSimilarTerms {
+		terms = terms[:maxSimilarTerms]
+	}
+	return terms, nil
+}
+
+// similarArticles returns up to limit articles in filter's namespace whose
+// text is most like that of the article title, whose text is text, ranked by
+// relevance. It's a "more like this" search: bleve's TF-IDF scoring of the
+// article's distinctiveTerms, each boosted by its weight, with the article
+// itself left out. If the index only has titles, they're compared instead.
+func similarArticles(idx bleve.Index, title, text string, limit int, filter searchFilter) ([]searchHit, error) {
+	field := phraseField(idx)
+	if field == "title" {
+		text = title
+	}
+	terms, err := distinctiveTerms(idx, field, text)
+	if err != nil {
+		return nil, err
+	}
+	hits := []searchHit{}
+	if len(terms) == 0 {
+		return hits, nil
+	}
+
+	should := bleve.NewDisjunctionQuery()
+	for _, t := range terms {
+		q := bleve.NewTermQuery(t.term)
+		q.SetField(field)
+		q.SetBoost(t.weight)
+		should.AddQuery(q)
+	}
+	q := bleve.NewBooleanQuery()
+	q.AddShould(should)
+	q.AddMustNot(bleve.NewDocIDQuery([]string{searchDocID(title)}))
+	req := bleve.NewSearchRequestOptions(filter.apply(q), limit, 0, false)
+	req.Fields = []string{"title"}
+	res, err := idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range res.Hits {
+		if h.Score < filter.minScore {
+			continue
+		}
+		title, _ := h.Fields["title"].(string)
+		hits = append(hits, searchHit{Title: title, Score: h.Score})
+	}
+	return hits, nil
+}
+
+// handleSimilar serves /similar?title=...&limit=10&ns=0&minScore=0.5, returning
+// the articles whose text is most like the article's, see similarArticles.
+// It's a content based counterpart to the link based /seealso.
+func handleSimilar(w http.ResponseWriter, r *http.Request) error {
+	if !*search && !*searchReadOnly {
+		return statusErrorf(http.StatusServiceUnavailable, "search index disabled, start with -search")
+	}
+	limit, err := intParam(r, "limit", 10, 1, 100)
+	if err != nil {
+		return err
+	}
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		return err
+	}
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+
+	searchMu.RLock()
+	if index == nil {
+		searchMu.RUnlock()
+		return statusErrorf(http.StatusServiceUnavailable, "search index is still being built")
+	}
+	hits, err := similarArticles(index, p.Title, p.Text, limit, filter)
+	searchMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, hits)
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestSimilarArticles(t *testing.T) {
+	fox := "The red fox is a fox found across the northern hemisphere. Foxes hunt rodents."
+	idx := testSearchIndex(t,
+		searchDoc{Title: "Red fox", Text: fox, NS: 0},
+		searchDoc{Title: "Arctic fox", Text: "The arctic fox is a small fox of the northern hemisphere that hunts rodents.", NS: 0},
+		searchDoc{Title: "Talk:Arctic fox", Text: "Is the arctic fox a fox of the northern hemisphere?", NS: 1},
+		searchDoc{Title: "Fennec", Text: "The fennec is a fox of the Sahara.", NS: 0},
+		searchDoc{Title: "Bread", Text: "Bread is baked from flour and water.", NS: 0},
+		searchDoc{Title: "Cheese", Text: "Cheese is made from milk.", NS: 0},
+		searchDoc{Title: "Rice", Text: "Rice is a grain grown in water.", NS: 0},
+	)
+
+	hits, err := similarArticles(idx, "Red fox", fox, 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, hit := range hits {
+		titles = append(titles, hit.Title)
+		if hit.Title == "Red fox" || hit.Title == "Bread" || hit.Title == "Cheese" || hit.Title == "Rice" {
+			t.Errorf("%q isn't similar to Red fox; got %q", hit.Title, titles)
+		}
+	}
+	if len(hits) == 0 || hits[0].Title != "Arctic fox" {
+		t.Fatalf("expected Arctic fox, sharing the most terms, to rank first; got %q", titles)
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score > hits[i-1].Score {
+			t.Errorf("hits aren't ranked by score: %+v", hits)
+		}
+	}
+
+	ns := 0
+	hits, err = similarArticles(idx, "Red fox", fox, 10, searchFilter{ns: &ns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hit := range hits {
+		if hit.Title == "Talk:Arctic fox" {
+			t.Errorf("ns=0 returned %q", hit.Title)
+		}
+	}
+
+	hits, err = similarArticles(idx, "Bread", "Nothing shared zzz.", 10, searchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 0 {
+		t.Errorf("expected no similar articles without shared terms; got %+v", hits)
+	}
+}
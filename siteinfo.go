@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type siteNamespace struct {
+	Key  int    `xml:"key,attr" json:"key"`
+	Case string `xml:"case,attr" json:"case"`
+	// Name is the namespace's prefix, which is empty for the main namespace.
+	Name string `xml:",chardata" json:"name"`
+}
+
+// siteInfo is the <siteinfo> header at the start of a dump describing the
+// wiki it came from.
+type siteInfo struct {
+	SiteName   string          `xml:"sitename" json:"siteName"`
+	DBName     string          `xml:"dbname" json:"dbName"`
+	Base       string          `xml:"base" json:"base"`
+	Generator  string          `xml:"generator" json:"generator"`
+	Case       string          `xml:"case" json:"case"`
+	Namespaces []siteNamespace `xml:"namespaces>namespace" json:"namespaces"`
+}
+
+// namespaceMap returns the namespace prefixes of the wiki mapped to their
+// numbers.
+func (info *siteInfo) namespaceMap() map[string]int {
+	m := map[string]int{}
+	for _, ns := range info.Namespaces {
+		if ns.Name != "" {
+			m[ns.Name] = ns.Key
+		}
+	}
+	return m
+}
+
+// projectSuffixes are the endings of the database names of the Wikimedia
+// projects that have a wiki per language, like dewiki and frwiktionary.
+var projectSuffixes = []string{
+	"wiktionary", "wikibooks", "wikinews", "wikiquote", "wikisource",
+	"wikiversity", "wikivoyage", "wiki",
+}
+
+// language returns the language code of the wiki, going by its database name,
+// like dewiki or zh_min_nanwiki, or failing that the subdomain of its base
+// URL, like de.wikipedia.org, or "" if neither looks like a language.
+// Wikis that aren't per language, like commonswiki, have none.
+func (info *siteInfo) language() string {
+	for _, suffix := range projectSuffixes {
+		if strings.HasSuffix(info.DBName, suffix) {
+			code := strings.Replace(strings.TrimSuffix(info.DBName, suffix), "_", "-", -1)
+			if isLangCode(code) {
+				return code
+			}
+			break
+		}
+	}
+	if u, err := url.Parse(info.Base); err == nil {
+		if i := strings.Index(u.Hostname(), "."); i > 0 && isLangCode(u.Hostname()[:i]) {
+			return u.Hostname()[:i]
+		}
+	}
+	return ""
+}
+
+// flagSet reports whether the flag name was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// readSiteInfo decodes the <siteinfo> header from the start of the articles
+// file. In a multistream dump it's in the first stream, ahead of the first
+// block of pages.
+func readSiteInfo() (*siteInfo, error) {
+	f, err := os.Open(*articlesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := utf8Reader(*articlesFile, f)
+	if err != nil {
+		return nil, err
+	}
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, errors.Errorf("no siteinfo in %s", *articlesFile)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "reading siteinfo")
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "mediawiki":
+				continue
+			case "siteinfo":
+				var info siteInfo
+				if err := d.DecodeElement(&info, &t); err != nil {
+					return nil, errors.Wrap(err, "decoding siteinfo")
+				}
+				return &info, nil
+			default:
+				return nil, errors.Errorf("no siteinfo in %s, found <%s> first", *articlesFile, t.Name.Local)
+			}
+		}
+	}
+}
+
+// loadSiteInfo reads the dump's siteinfo and uses its namespaces to parse
+// titles, and its base URL for canonical URLs, from then on. Dumps without
+// namespaces keep the English defaults. Unless -lang was given, it's set to
+// the wiki's language, see siteInfo.language, which the casing of titles
+// and the fallback host of canonical URLs go by, and the wiki's case setting
+// decides whether the first letter of titles is capitalized. It must be
+// called before any requests are served.
+func (s *Server) loadSiteInfo() error {
+	info, err := readSiteInfo()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.siteInfo = info
+	s.mu.Unlock()
+
+	if code := info.language(); code != "" && !flagSet("lang") {
+		if code != *lang {
+			log.Printf("Using -lang=%s from the dump's siteinfo", code)
+		}
+		*lang = code
+	}
+	titlesCaseSensitive = info.Case == "case-sensitive"
+	setWikiBase(info.Base)
+	if len(info.Namespaces) > 0 {
+		setNamespaces(info.namespaceMap())
+	}
+	return nil
+}
+
+// handleSiteInfo serves /siteinfo, returning the dump's site name, base URL
+// and namespaces.
+func (s *Server) handleSiteInfo(w http.ResponseWriter, r *http.Request) error {
+	s.mu.Lock()
+	info := s.siteInfo
+	s.mu.Unlock()
+
+	if info == nil {
+		return statusErrorf(http.StatusServiceUnavailable, "siteinfo unavailable")
+	}
+	return writeJSON(w, r, info)
+}
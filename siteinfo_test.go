@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSiteInfo = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/">
+  <siteinfo>
+    <sitename>Wikipedia</sitename>
+    <dbname>dewiki</dbname>
+    <base>https://de.wikipedia.org/wiki/Wikipedia:Hauptseite</base>
+    <generator>MediaWiki 1.41.0</generator>
+    <case>first-letter</case>
+    <namespaces>
+      <namespace key="-2" case="first-letter">Medium</namespace>
+      <namespace key="0" case="first-letter" />
+      <namespace key="1" case="first-letter">Diskussion</namespace>
+      <namespace key="10" case="first-letter">Vorlage</namespace>
+      <namespace key="11" case="first-letter">Vorlage Diskussion</namespace>
+    </namespaces>
+  </siteinfo>
+</mediawiki>
+`
+
+func TestSiteInfo(t *testing.T) {
+	installTestDump(t, []byte(testSiteInfo), newOffsetIndex())
+	defer setNamespaces(defaultNamespaces)
+	defer func(l string) { *lang = l }(*lang)
+
+	s := newServer(1)
+	w := httptest.NewRecorder()
+	handle(s.handleSiteInfo)(w, httptest.NewRequest("GET", "/siteinfo", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status before loading = %d; not %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	if err := s.loadSiteInfo(); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handle(s.handleSiteInfo)(w, httptest.NewRequest("GET", "/siteinfo", nil))
+	var info siteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.DBName != "dewiki" || info.Base != "https://de.wikipedia.org/wiki/Wikipedia:Hauptseite" || len(info.Namespaces) != 5 {
+		t.Errorf("siteinfo = %+v", info)
+	}
+	if ns := info.Namespaces[2]; ns.Key != 1 || ns.Name != "Diskussion" || ns.Case != "first-letter" {
+		t.Errorf("namespace 1 = %+v", ns)
+	}
+	if *lang != "de" {
+		t.Errorf("-lang = %q after loading a German siteinfo; not de", *lang)
+	}
+	if got := titleVariants("ärger"); got[1] != "Ärger" {
+		t.Errorf("titleVariants(ärger) = %q; expected Ärger", got)
+	}
+
+	nsCases := []struct {
+		in   string
+		want int
+	}{
+		{"Foo", 0},
+		{"Vorlage:Foo", 10},
+		{"Medium:Foo.jpg", -2},
+		{"Template:Foo", 0},
+	}
+	for _, c := range nsCases {
+		if got := namespaceForTitle(c.in); got != c.want {
+			t.Errorf("namespaceForTitle(%q) = %d; not %d", c.in, got, c.want)
+		}
+	}
+	talkCases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"Foo", "Diskussion:Foo", true},
+		{"Vorlage:Foo", "Vorlage Diskussion:Foo", true},
+		{"Diskussion:Foo", "", false},
+		{"Medium:Foo.jpg", "", false},
+	}
+	for _, c := range talkCases {
+		if got, ok := talkTitle(c.in); got != c.want || ok != c.ok {
+			t.Errorf("talkTitle(%q) = %q, %v; not %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestSiteInfoLanguage(t *testing.T) {
+	for _, c := range []struct {
+		dbName, base, want string
+	}{
+		{"dewiki", "https://de.wikipedia.org/wiki/Wikipedia:Hauptseite", "de"},
+		{"zh_min_nanwiki", "", "zh-min-nan"},
+		{"simplewiki", "", "simple"},
+		{"frwiktionary", "https://fr.wiktionary.org/wiki/Wiktionnaire:Page_d%E2%80%99accueil", "fr"},
+		{"", "https://ja.wikipedia.org/wiki/Main", "ja"},
+		{"commonswiki", "https://commons.wikimedia.org/wiki/Main_Page", ""},
+		{"", "", ""},
+	} {
+		info := siteInfo{DBName: c.dbName, Base: c.base}
+		if got := info.language(); got != c.want {
+			t.Errorf("language of %q, %q = %q; not %q", c.dbName, c.base, got, c.want)
+		}
+	}
+}
+
+func TestSiteInfoCaseSensitive(t *testing.T) {
+	installTestDump(t, []byte(strings.Replace(testSiteInfo, "<case>first-letter</case>", "<case>case-sensitive</case>", 1)), newOffsetIndex())
+	defer setNamespaces(defaultNamespaces)
+	defer func(l string) { *lang = l }(*lang)
+	defer func() { titlesCaseSensitive = false }()
+
+	if err := newServer(1).loadSiteInfo(); err != nil {
+		t.Fatal(err)
+	}
+	if got := capitalizeTitle("iPod", *lang); got != "iPod" {
+		t.Errorf("capitalizeTitle(iPod) = %q on a case sensitive wiki", got)
+	}
+}
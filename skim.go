@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var skimIgnoreSections = flag.String("skimIgnoreSections", "References,Notes,Citations,Sources,Bibliography,Further reading,External links,See also", "the comma separated titles of the sections /skim leaves out, matched case insensitively, such as references and navigation")
+
+type skimSection struct {
+	// Heading is the section's title, or "" for the lead.
+	Heading       string `json:"heading"`
+	FirstSentence string `json:"firstSentence"`
+}
+
+// sentenceAbbreviations are words that end in a period without ending the
+// sentence, lowercased and without the period.
+var sentenceAbbreviations = wordSet("mr mrs ms dr st jr sr prof gen col lt vs etc e.g i.e c ca approx no fig")
+
+// firstSentence returns the first sentence of text, which ends at a ".", "!"
+// or "?" followed by a space and anything but a lowercase letter, unless the
+// "." follows an abbreviation or an initial. It's all of text if no sentence
+// ends before then.
+func firstSentence(text string) string {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		if i+1 < len(text) && !isSpace(text[i+1]) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(strings.TrimLeft(text[i+1:], " \t\n")); unicode.IsLower(next) {
+			continue
+		}
+		if c == '.' {
+			word := text[:i]
+			if j := strings.LastIndexAny(word, " \t\n("); j >= 0 {
+				word = word[j+1:]
+			}
+			if utf8.RuneCountInString(word) == 1 || sentenceAbbreviations[strings.ToLower(word)] {
+				continue
+			}
+		}
+		return text[:i+1]
+	}
+	return text
+}
+
+// skimArticle returns the lead and each top-level section of text that isn't
+// one of ignore, given lowercased, with the first sentence of its prose,
+// subsections included. A section without any prose has an empty
+// FirstSentence, and the lead is only included if it has prose.
+func skimArticle(text string, ignore map[string]bool) []skimSection {
+	skim := []skimSection{}
+	first := func(body string) string {
+		if paragraphs := splitParagraphs(body, false); len(paragraphs) > 0 {
+			return firstSentence(paragraphs[0].Text)
+		}
+		return ""
+	}
+
+	sections := extractSections(text)
+	top := 0
+	for _, s := range sections {
+		if top == 0 || s.Level < top {
+			top = s.Level
+		}
+	}
+	var tops []section
+	for _, s := range sections {
+		if s.Level == top {
+			tops = append(tops, s)
+		}
+	}
+	lead := text
+	if len(tops) > 0 {
+		lead = text[:tops[0].Offset]
+	}
+	if sentence := first(lead); sentence != "" {
+		skim = append(skim, skimSection{FirstSentence: sentence})
+	}
+	for i, s := range tops {
+		if ignore[strings.ToLower(strings.Join(strings.Fields(s.Title), " "))] {
+			continue
+		}
+		end := len(text)
+		if i+1 < len(tops) {
+			end = tops[i+1].Offset
+		}
+		// Start after the heading's line, which splitParagraphs would
+		// otherwise tag its prose with.
+		start := end
+		if nl := strings.IndexByte(text[s.Offset:end], '\n'); nl >= 0 {
+			start = s.Offset + nl
+		}
+		skim = append(skim, skimSection{Heading: s.Title, FirstSentence: first(text[start:end])})
+	}
+	return skim
+}
+
+// handleSkim serves /skim?title=..., outlining an article as the first
+// sentence of its lead and of each top-level section, for skimming. The
+// -skimIgnoreSections are left out.
+func handleSkim(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	ignore := map[string]bool{}
+	for _, name := range strings.Split(*skimIgnoreSections, ",") {
+		if name = strings.Join(strings.Fields(name), " "); name != "" {
+			ignore[strings.ToLower(name)] = true
+		}
+	}
+	return writeJSON(w, r, skimArticle(p.Text, ignore))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFirstSentence(t *testing.T) {
+	cases := []struct {
+		text, want string
+	}{
+		{"Foxes are mammals. They eat mice.", "Foxes are mammals."},
+		{"Is it a fox? Yes.", "Is it a fox?"},
+		{"No sentence end", "No sentence end"},
+		{"J. R. R. Tolkien wrote books. Many.", "J. R. R. Tolkien wrote books."},
+		{"Dr. Smith studies foxes. Often.", "Dr. Smith studies foxes."},
+		{"Version 2.5 is out. Now.", "Version 2.5 is out."},
+		{"It was c. 1900 when it began. Then.", "It was c. 1900 when it began."},
+		{"Foxes etc. are small. Yes.", "Foxes etc. are small."},
+		{"It ends.", "It ends."},
+	}
+	for _, c := range cases {
+		if got := firstSentence(c.text); got != c.want {
+			t.Errorf("firstSentence(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestSkimArticle(t *testing.T) {
+	ignore := map[string]bool{"references": true, "external links": true}
+	cases := []struct {
+		name, text string
+		want       []skimSection
+	}{
+		{
+			"sections",
+			"'''Foxes''' are mammals. They are small.\n\n== Habitat ==\nFoxes live in forests. Some live in cities.\n\n== Diet ==\nFoxes eat mice.\n",
+			[]skimSection{
+				{Heading: "", FirstSentence: "Foxes are mammals."},
+				{Heading: "Habitat", FirstSentence: "Foxes live in forests."},
+				{Heading: "Diet", FirstSentence: "Foxes eat mice."},
+			},
+		},
+		{
+			"subsections",
+			"== Biology ==\n=== Diet ===\nFoxes eat mice. And birds.\n=== Size ===\nFoxes are small.\n",
+			[]skimSection{{Heading: "Biology", FirstSentence: "Foxes eat mice."}},
+		},
+		{
+			"ignored",
+			"Foxes.\n\n== Habitat ==\nForests.\n\n== References ==\nA book.\n\n==External  Links==\n* [http://example.com Example]\n",
+			[]skimSection{
+				{Heading: "", FirstSentence: "Foxes."},
+				{Heading: "Habitat", FirstSentence: "Forests."},
+			},
+		},
+		{
+			"no prose",
+			"== See also ==\n* [[Wolf]]\n",
+			[]skimSection{{Heading: "See also", FirstSentence: ""}},
+		},
+		{"empty", "", []skimSection{}},
+	}
+	for _, c := range cases {
+		if got := skimArticle(c.text, ignore); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: skimArticle = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
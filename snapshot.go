@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+// offsetsView is a loaded offsetStore, published so titles can be looked up
+// in it without taking mu. It's replaced as a whole when the index is
+// reloaded, so a lookup sees either the old index or the new one, never one
+// that's half loaded.
+type offsetsView struct {
+	offsets offsetStore
+	// refs counts the lookups using offsets, plus one until the view is
+	// retired. offsets is closed once it drops to 0, and the view can't be
+	// acquired after that.
+	refs int64
+}
+
+// currentView holds the current *offsetsView. It's only replaced with mu
+// held, so under mu it's consistent with the rest of the index.
+var currentView atomic.Value
+
+// emptyView is the view before an index has been loaded.
+var emptyView = &offsetsView{offsets: mapStore{}, refs: 1}
+
+func loadView() *offsetsView {
+	if v, ok := currentView.Load().(*offsetsView); ok {
+		return v
+	}
+	return emptyView
+}
+
+// currentOffsets returns the current store. mu must be held for as long as
+// it's used, which keeps it from being replaced and closed; without mu, use
+// acquireOffsets.
+func currentOffsets() offsetStore {
+	return loadView().offsets
+}
+
+// setOffsets publishes offsets as the current store, returning the view it
+// replaced, which must be released to retire it. mu must be held.
+func setOffsets(offsets offsetStore) *offsetsView {
+	old := loadView()
+	currentView.Store(&offsetsView{offsets: offsets, refs: 1})
+	return old
+}
+
+// acquireOffsets returns the current view for lookups and snapshots without
+// holding mu, which must be released once they're done. Its store stays open
+// until then even if the index is reloaded meanwhile.
+func acquireOffsets() *offsetsView {
+	for {
+		v := loadView()
+		for {
+			n := atomic.LoadInt64(&v.refs)
+			if n == 0 {
+				// Retired and closed since it was loaded, so the
+				// current view is a newer one.
+				break
+			}
+			if atomic.CompareAndSwapInt64(&v.refs, n, n+1) {
+				return v
+			}
+		}
+	}
+}
+
+// release releases a view from acquireOffsets or retires a replaced one,
+// closing its store if nothing else is using it.
+func (v *offsetsView) release() {
+	if atomic.AddInt64(&v.refs, -1) != 0 {
+		return
+	}
+	if err := v.offsets.close(); err != nil {
+		log.Printf("closing the previous index: %+v", err)
+	}
+}
+
+// indexSnapshot is a consistent view of the index that can be iterated
+// without holding mu, so iterating every entry doesn't block lookups. The
+// store of a loaded index is never modified, and the snapshot holds a
+// reference to its view like a lookup does, so it stays valid across a
+// reload. Release it with release once done.
+type indexSnapshot struct {
+	view *offsetsView
+	// found is a copy of mu.found.
+	found      mapStore
+	titles     []titleRecord
+	generation int
+}
+
+// snapshotIndex returns a snapshot of the current index. It only holds mu
+// long enough to copy the few entries found since the index was loaded.
+func snapshotIndex() *indexSnapshot {
+	mu.Lock()
+	defer mu.Unlock()
+
+	found := make(mapStore, len(mu.found))
+	for hash, entry := range mu.found {
+		found[hash] = entry
+	}
+	return &indexSnapshot{
+		view:       acquireOffsets(),
+		found:      found,
+		titles:     mu.titles,
+		generation: mu.generation,
+	}
+}
+
+// each calls fn with every entry in the snapshot.
+func (s *indexSnapshot) each(fn func(hash uint64, entry indexEntry) error) error {
+	if err := s.view.offsets.each(fn); err != nil {
+		return err
+	}
+	return s.found.each(fn)
+}
+
+func (s *indexSnapshot) len() int {
+	return s.view.offsets.len() + len(s.found)
+}
+
+// release lets the snapshot's store be closed once the index is replaced.
+func (s *indexSnapshot) release() {
+	s.view.release()
+}
+
+// indexLen returns the number of entries in the index. mu must be held.
+func indexLen() int {
+	return currentOffsets().len() + len(mu.found)
+}
+
+// foundEntries is len(mu.found), so lookups can tell there's nothing in it
+// without taking mu.
+var foundEntries int64
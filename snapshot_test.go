@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeRecorder is a store that records when it's closed.
+type closeRecorder struct {
+	mapStore
+	closed int32
+}
+
+func (s *closeRecorder) close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	return nil
+}
+
+func TestSnapshotIndex(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", ""), testPage(2, "Bar", "")})
+	mu.Lock()
+	mu.found[42] = indexEntry{id: 3}
+	mu.Unlock()
+
+	snapshot := snapshotIndex()
+	mu.Lock()
+	mu.found[43] = indexEntry{id: 4}
+	mu.Unlock()
+	var ids []int
+	if err := snapshot.each(func(hash uint64, entry indexEntry) error {
+		ids = append(ids, entry.id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || snapshot.len() != 3 {
+		t.Errorf("snapshot has ids %v, len %d; expected the 3 entries from when it was taken", ids, snapshot.len())
+	}
+	snapshot.release()
+
+	// A replaced store is closed once the snapshots of it are released.
+	store := &closeRecorder{mapStore: mapStore{1: indexEntry{id: 1}}}
+	mu.Lock()
+	oldOffsets := setOffsets(store).offsets
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		setOffsets(oldOffsets)
+		mu.Unlock()
+	}()
+	snapshot = snapshotIndex()
+	view := acquireOffsets()
+	mu.Lock()
+	replaced := setOffsets(mapStore{})
+	mu.Unlock()
+	replaced.release()
+	if atomic.LoadInt32(&store.closed) != 0 {
+		t.Fatal("store closed while a snapshot of it is in use")
+	}
+	snapshot.release()
+	if atomic.LoadInt32(&store.closed) != 0 {
+		t.Fatal("store closed while a lookup is using it")
+	}
+	view.release()
+	if atomic.LoadInt32(&store.closed) == 0 {
+		t.Fatal("store wasn't closed once its snapshot and lookup were released")
+	}
+}
+
+// BenchmarkLookupDuringIteration measures title lookups while another
+// goroutine keeps iterating over every entry in the index, as the stats
+// sampling does. Before snapshots the iteration held mu throughout.
+func BenchmarkLookupDuringIteration(b *testing.B) {
+	var block []page
+	for i := 0; i < 100000; i++ {
+		block = append(block, testPage(i+1, fmt.Sprintf("Page %d", i), ""))
+	}
+	useTestDump(b, block)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			snapshot := snapshotIndex()
+			snapshot.each(func(hash uint64, entry indexEntry) error { return nil })
+			snapshot.release()
+		}
+	}()
+
+	var worst time.Duration
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		if _, err := fetchArticle(fmt.Sprintf("Page %d", i%len(block))); err != nil {
+			b.Fatal(err)
+		}
+		if d := time.Since(start); d > worst {
+			worst = d
+		}
+	}
+	b.StopTimer()
+	// The slowest lookup is what waiting behind an iteration would show up
+	// in.
+	b.ReportMetric(float64(worst.Nanoseconds()), "max-ns/op")
+	close(stop)
+	<-done
+}
+
+// TestLookupDuringReload looks every title up while the index is reloaded
+// over and over, so a lookup that saw a half loaded index would miss.
+func TestLookupDuringReload(t *testing.T) {
+	const n = 1000
+	var block []page
+	for i := 0; i < n; i++ {
+		block = append(block, testPage(i+1, fmt.Sprintf("Page %d", i), ""))
+	}
+	useTestDump(t, block)
+	defer func(path string) { *indexFile = path }(*indexFile)
+	*indexFile = ""
+
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; ; i += 4 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				title := fmt.Sprintf("Page %d", i%n)
+				if _, ok := lookupTitle(title); !ok {
+					errs <- fmt.Errorf("%q not found during a reload", title)
+					return
+				}
+			}
+		}(g)
+	}
+	for i := 0; i < 5; i++ {
+		if err := loadOffsets(nil); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// version is the version of the HTTP API.
+const version = "1.0.0"
+
+type specObject map[string]interface{}
+
+// schemaFor builds a JSON schema for values of type t as encoding/json would
+// marshal them, so the spec can't drift from the struct tags.
+func schemaFor(t reflect.Type) specObject {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return specObject{"type": "string"}
+	case reflect.Bool:
+		return specObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return specObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return specObject{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return specObject{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return specObject{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		props := specObject{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag, ok := f.Tag.Lookup("json"); ok {
+				if tag == "-" {
+					continue
+				}
+				if parts := strings.Split(tag, ","); parts[0] != "" {
+					name = parts[0]
+				}
+			}
+			props[name] = schemaFor(f.Type)
+		}
+		return specObject{"type": "object", "properties": props}
+	}
+	return specObject{}
+}
+
+func specParam(name, description string, required bool, typ string) specObject {
+	return specObject{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"required":    required,
+		"schema":      specObject{"type": typ},
+	}
+}
+
+func specGet(summary string, response interface{}, params ...specObject) specObject {
+	if params == nil {
+		params = []specObject{}
+	}
+	errorResponse := specObject{
+		"description": "error",
+		"content": specObject{
+			"application/json": specObject{"schema": specObject{"$ref": "#/components/schemas/error"}},
+		},
+	}
+	return specObject{
+		"get": specObject{
+			"summary":    summary,
+			"parameters": params,
+			"responses": specObject{
+				"200": specObject{
+					"description": "success",
+					"content": specObject{
+						"application/json": specObject{"schema": schemaFor(reflect.TypeOf(response))},
+					},
+				},
+				"default": errorResponse,
+			},
+		},
+	}
+}
+
+// apiSpec returns the OpenAPI 3 document describing the HTTP API.
+func apiSpec() specObject {
+	title := specParam("title", "the article title", true, "string")
+	return specObject{
+		"openapi": "3.0.0",
+		"info": specObject{
+			"title":   "wikigopher",
+			"version": version,
+		},
+		"paths": specObject{
+			"/article": specGet("Fetch an article", page{},
+				title,
+				specParam("rev", "fail with 409 unless the dump has this revision ID", false, "string"),
+				specParam("clean", "return the text as plain text with markup removed and entities decoded", false, "boolean"),
+				specParam("fields", "a comma separated list of the fields to return, default all", false, "string"),
+				specParam("includeTalk", "also return the article's talk page, or null, as talk, and check its banners for the qualityFlag", false, "boolean"),
+				specParam("langChain", "the comma separated wikis to try in order, the one that had the article is returned in the X-Wiki header", false, "string"),
+				specParam("resolve", "with options, return the articles a disambiguation page lists instead of the page", false, "string"),
+				specParam("anchors", "also return a map of section titles to their URL fragments as anchors, and mark the headings in the text with them", false, "boolean"),
+				specParam("format", "return just the text, rendered as wikitext, plain, parsoid-html or html, instead of JSON", false, "string"),
+				specParam("onMissing", "with null, return 200 and {\"article\":null} instead of a 404 if the article doesn't exist", false, "string"),
+				specParam("footnotes", "return the text as plain text with [1] style markers for its references, and the references as footnotes", false, "boolean"),
+				specParam("tables", "json adds the article's wiki tables parsed into rows of cells as tables", false, "string"),
+				specParam("includeAgeRank", "also return a rough guess at the article's age from its page ID as estimatedAgeRank, near 0 for the oldest to 1 for the newest", false, "boolean"),
+				specParam("followRedirect", "return the article a redirect points to instead, with redirectedFrom and any redirectSection", false, "boolean"),
+				specParam("includeAliases", "also return the titles that redirect to the article as aliases, requires -redirects", false, "boolean"),
+				specParam("resolveMedia", "also return the files the article embeds and their Commons URLs as media, and render them as images in parsoid-html", false, "boolean")),
+			"/random": specGet("Fetch a random article", page{},
+				specParam("minLength", "keep sampling, up to 20 articles, until one is at least this many bytes long", false, "integer"),
+				specParam("count", "return an array of this many distinct random articles instead, 1-50", false, "integer"),
+				specParam("skipLists", "skip list articles", false, "boolean")),
+			"/random/quality": specGet("Fetch the best of a few random articles, preferring long, linked, non-stub articles", page{},
+				specParam("candidates", "the number of random articles to pick from, 1-20", false, "integer"),
+				specParam("skipLists", "skip list articles", false, "boolean")),
+			"/revision": specGet("Fetch the metadata of an article's revision without its text", revisionInfo{},
+				title),
+			"/tokens": specGet("Split an article's wikitext into shallow tokens with their byte offsets", []wikiToken{},
+				specParam("title", "the article title", true, "string")),
+			"/tables": specGet("Parse an article's wiki tables into rows of cells", []wikiTable{},
+				specParam("title", "the article title", true, "string")),
+			"/url": specGet("Get the URL of an article on the live wiki", articleURL{},
+				specParam("title", "the article title", true, "string")),
+			"/langlinks": specGet("Map language codes to the article's title on that wiki, from interlanguage links in older dumps", map[string]string{},
+				specParam("title", "the article title", true, "string")),
+			"/seealso": specGet("List the articles linked from an article's See also section", []string{},
+				specParam("title", "the article title", true, "string")),
+			"/usedtemplates": specGet("List the templates an article uses", []string{},
+				specParam("title", "the article title", true, "string")),
+			"/template": specGet("Fetch the wikitext defining a template", templateDefinition{},
+				specParam("name", "the template's name, with or without the Template: prefix", true, "string")),
+			"/hash": specGet("Fetch the hash of an article's text, for detecting changes across dumps", articleHash{},
+				title),
+			"/search": specGet("Fetch an article by its exact title", titleSearchResult{},
+				specParam("q", "the article title", true, "string"),
+				specParam("format", "render the text in one of the formats, such as plain or html", false, "string"),
+				specParam("followRedirect", "return the article a redirect points to instead", false, "boolean"),
+				specParam("resolveMedia", "render files as images in html", false, "boolean")),
+			"/search/phrase": specGet("Full text search for an exact phrase", []searchHit{},
+				specParam("q", "the phrase, optionally in double quotes", true, "string"),
+				specParam("limit", "the maximum number of results, 1-100", false, "integer"),
+				specParam("ns", "only return articles in this namespace", false, "integer"),
+				specParam("minScore", "drop results with a lower relevance score", false, "number"),
+				specParam("preview", "include the first N characters of each article's plain text, up to 1000", false, "integer")),
+			"/search/count": specGet("Count the articles a full text search for an exact phrase would find", searchCount{},
+				specParam("q", "the phrase, optionally in double quotes", true, "string"),
+				specParam("ns", "only count articles in this namespace", false, "integer")),
+			"/similar": specGet("Find the articles whose text is most like an article's", []searchHit{},
+				title,
+				specParam("limit", "the maximum number of results, 1-100", false, "integer"),
+				specParam("ns", "only return articles in this namespace", false, "integer"),
+				specParam("minScore", "drop results with a lower relevance score", false, "number")),
+			"/fulltext": specGet("Full text search for any of the words of a query, a page of ranked hits at a time", []fulltextHit{},
+				specParam("q", "the words to search for", true, "string"),
+				specParam("page", "the 1-based page of hits, default 1", false, "integer"),
+				specParam("size", "the number of hits per page, 1-100", false, "integer"),
+				specParam("ns", "only return articles in this namespace", false, "integer"),
+				specParam("minScore", "drop results with a lower relevance score", false, "number")),
+			"/suggest": specGet("Suggest the titles a partial or misspelled title may be, for autocomplete", []titleSuggestion{},
+				specParam("q", "the partial or misspelled title", true, "string"),
+				specParam("limit", "the maximum number of suggestions, 1-100", false, "integer")),
+			"/search/regex": specGet("Stream the titles matching a regular expression as NDJSON, requires -titles", exportedTitle{},
+				specParam("pattern", "the Go regular expression titles must match", true, "string"),
+				specParam("limit", "the maximum number of titles, 1-10000", false, "integer")),
+			"/export/articles": specGet("Stream every article in the dump in one of the formats as NDJSON", exportedArticle{},
+				specParam("transform", "the format to render the articles in, plain by default", false, "string"),
+				specParam("ns", "only export articles in this namespace", false, "integer"),
+				specParam("cursor", "the cursor of the last article received, to resume after it", false, "string")),
+			"/incategory": specGet("List the titles in a category", categoryPage{},
+				specParam("category", "the category name, with or without the Category: prefix", true, "string"),
+				specParam("limit", "the maximum number of titles, 1-500", false, "integer"),
+				specParam("cursor", "the next value from the previous page", false, "string")),
+			"/wordfreq": specGet("Count the most common words in an article's plain text", wordFrequencies{},
+				title,
+				specParam("top", "the number of words to return, 1-1000", false, "integer"),
+				specParam("stopwords", "with en, leave out common English words", false, "string")),
+			"/chunks": specGet("Split an article's plain text into overlapping chunks", []textChunk{},
+				title,
+				specParam("size", "the maximum chunk size in bytes", false, "integer"),
+				specParam("overlap", "the overlap between chunks in bytes", false, "integer")),
+			"/paragraphs": specGet("Split an article's plain text into paragraphs, each with the section it's in", []paragraph{},
+				title,
+				specParam("lists", "keep blocks that are only list items", false, "boolean")),
+			"/skim": specGet("Outline an article as the first sentence of its lead and each top-level section", []skimSection{},
+				title),
+			"/path": specGet("Find the shortest chain of links from one article to another, requires -links", linkPath{},
+				specParam("from", "the title of the article to start from", true, "string"),
+				specParam("to", "the title of the article to end at", true, "string")),
+			"/top": specGet("List the most linked to articles", []linkCount{},
+				specParam("limit", "the number of articles to return", false, "integer")),
+			"/siteinfo":   specGet("Describe the wiki the dump is from, including its namespaces", siteInfo{}),
+			"/stats":      specGet("Describe the loaded dump, with a sampled article size histogram if enabled", stats{}),
+			"/stats/size": specGet("Report the size of the articles file and an estimate of its size decompressed", dumpSize{}),
+			"/trending": specGet("List the most requested articles, weighted towards recent requests", []trendingTitle{},
+				specParam("limit", "the number of articles to return, 1-100", false, "integer")),
+			"/find": specGet("Find where a term appears in an article's plain text, ignoring case", []findMatch{},
+				specParam("title", "the article title", true, "string"),
+				specParam("q", "the text to find", true, "string"),
+				specParam("limit", "the number of matches to return, 1-100", false, "integer")),
+			"/enrich": specGet("Get an article's summary, categories, links and infobox in one call", enrichment{},
+				specParam("title", "the article title", true, "string"),
+				specParam("summary", "include the summary, defaults to true", false, "boolean"),
+				specParam("categories", "include the categories, defaults to true", false, "boolean"),
+				specParam("links", "include the links, defaults to true", false, "boolean"),
+				specParam("infobox", "include the infobox parameters, defaults to true", false, "boolean")),
+			"/shortdesc": specGet("Get the one line description editors give an article with {{Short description}}", shortDescription{},
+				specParam("title", "the article title", true, "string")),
+			"/wikidata": specGet("Get the Wikidata QID an article's wikitext refers to, best effort since dumps don't include page properties", wikidataRef{},
+				specParam("title", "the article title", true, "string")),
+			"/coords": specGet("Get the coordinates of a geotagged article from its {{coord}} template, or a 204 if it has none", coordinates{},
+				specParam("title", "the article title", true, "string")),
+			"/nearby": specGet("List the geotagged articles near a point, closest first, requires -geo", []nearbyArticle{},
+				specParam("lat", "the latitude of the point", true, "number"),
+				specParam("lon", "the longitude of the point", true, "number"),
+				specParam("radius", "the distance to search within, like 500m or 50km, defaults to 10km", false, "string"),
+				specParam("limit", "the maximum number of articles, 1-500, defaults to 20", false, "integer")),
+			"/diff": specGet("Compare the outgoing links of two articles", linkDiff{},
+				specParam("a", "the first article title", true, "string"),
+				specParam("b", "the second article title", true, "string")),
+		},
+		"components": specObject{
+			"schemas": specObject{
+				"page": schemaFor(reflect.TypeOf(page{})),
+				"error": schemaFor(reflect.TypeOf(struct {
+					Error string `json:"error"`
+				}{})),
+			},
+		},
+	}
+}
+
+// handleSpec serves /api/spec, leaving out the -disableEndpoints.
+func handleSpec(w http.ResponseWriter, r *http.Request) error {
+	spec := apiSpec()
+	paths := spec["paths"].(specObject)
+	for path := range paths {
+		if endpointDisabled(path) {
+			delete(paths, path)
+		}
+	}
+	return writeJSON(w, r, spec)
+}
+
+var homeArticle = flag.String("homeArticle", "", "the article to redirect / to, by default / lists the endpoints")
+
+type rootIndex struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// handleRoot serves /, either redirecting to the -homeArticle or listing the
+// registered endpoints. Every other unknown path is a 404.
+func handleRoot(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != "/" {
+		return statusErrorf(http.StatusNotFound, "no such endpoint: %s", r.URL.Path)
+	}
+	if *homeArticle != "" {
+		http.Redirect(w, r, "/article?title="+url.QueryEscape(*homeArticle), http.StatusFound)
+		return nil
+	}
+	endpoints := append([]string(nil), routes...)
+	sort.Strings(endpoints)
+	return writeJSON(w, r, rootIndex{
+		Service:   "wikigopher",
+		Version:   version,
+		Endpoints: endpoints,
+	})
+}
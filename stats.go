@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var statsSample = flag.Int("statsSample", 0, "the number of random articles to decode for the /stats size histogram, 0 disables it")
+
+// sizeBucket is a histogram bucket of article text sizes in bytes. Max is
+// exclusive and 0 for the last, unbounded bucket.
+type sizeBucket struct {
+	Label    string  `json:"label"`
+	Min      int     `json:"min"`
+	Max      int     `json:"max,omitempty"`
+	Count    int     `json:"count"`
+	Fraction float64 `json:"fraction"`
+}
+
+func newSizeBuckets() []sizeBucket {
+	return []sizeBucket{
+		{Label: "<1KB", Min: 0, Max: 1 << 10},
+		{Label: "1-10KB", Min: 1 << 10, Max: 10 << 10},
+		{Label: "10-100KB", Min: 10 << 10, Max: 100 << 10},
+		{Label: ">100KB", Min: 100 << 10},
+	}
+}
+
+// sizeHistogram is an estimate of the distribution of article sizes from a
+// random sample of articles, since measuring every article means decoding
+// the whole dump.
+type sizeHistogram struct {
+	Sampled int          `json:"sampled"`
+	Buckets []sizeBucket `json:"buckets"`
+}
+
+var statsState = struct {
+	sync.Mutex
+
+	histogram *sizeHistogram
+	// ratio is the compression ratio measured by measureCompressionRatio,
+	// or nil if it hasn't been.
+	ratio *compressionRatio
+}{}
+
+// sampleEntries picks up to n entries uniformly at random from the index with
+// reservoir sampling, since map iteration order isn't uniformly random.
+func sampleEntries(rng *rand.Rand, n int) ([]indexEntry, error) {
+	snapshot := snapshotIndex()
+	defer snapshot.release()
+
+	sample := make([]indexEntry, 0, n)
+	i := 0
+	err := snapshot.each(func(hash uint64, entry indexEntry) error {
+		if len(sample) < n {
+			sample = append(sample, entry)
+		} else if j := rng.Intn(i + 1); j < n {
+			sample[j] = entry
+		}
+		i++
+		return nil
+	})
+	return sample, err
+}
+
+func buildSizeHistogram() error {
+	log.Printf("Sampling %d articles for the size histogram...", *statsSample)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	h := &sizeHistogram{Buckets: newSizeBuckets()}
+	sample, err := sampleEntries(rng, *statsSample)
+	if err != nil {
+		return err
+	}
+	for _, entry := range sample {
+		p, err := readArticle(entry)
+		if err != nil {
+			return err
+		}
+		for i := range h.Buckets {
+			if b := &h.Buckets[i]; p.Length >= b.Min && (b.Max == 0 || p.Length < b.Max) {
+				b.Count++
+				break
+			}
+		}
+		h.Sampled++
+	}
+	for i := range h.Buckets {
+		if h.Sampled > 0 {
+			h.Buckets[i].Fraction = float64(h.Buckets[i].Count) / float64(h.Sampled)
+		}
+	}
+
+	statsState.Lock()
+	statsState.histogram = h
+	statsState.Unlock()
+
+	log.Printf("Done sampling article sizes!")
+	return nil
+}
+
+// compressionRatio is how much one block of the articles file grew when it
+// was decompressed.
+type compressionRatio struct {
+	seek                          int
+	compressedBytes, decodedBytes int64
+}
+
+// measureCompressionRatio decompresses the block in the middle of the dump,
+// which is less likely than the first to be unusually small or large, and
+// keeps how much it grew for /stats/size.
+func measureCompressionRatio() error {
+	seeks := blockSeeks()
+	if len(seeks) == 0 {
+		return errors.Errorf("no blocks in the index")
+	}
+	stat, err := os.Stat(*articlesFile)
+	if err != nil {
+		return err
+	}
+	i := len(seeks) / 2
+	end := dumpEnd(int(stat.Size()))
+	if i+1 < len(seeks) {
+		end = seeks[i+1]
+	}
+	ratio := &compressionRatio{seek: seeks[i], compressedBytes: int64(end - seeks[i])}
+	in, f, err := seekBlock(ratio.seek, int(ratio.compressedBytes))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if ratio.decodedBytes, err = io.Copy(ioutil.Discard, articleReader(*articlesFile, in)); err != nil {
+		return errors.Wrapf(err, "decompressing block %d to measure the compression ratio", ratio.seek)
+	}
+	if ratio.compressedBytes <= 0 || ratio.decodedBytes <= 0 {
+		return errors.Errorf("block %d is empty, can't measure the compression ratio", ratio.seek)
+	}
+
+	statsState.Lock()
+	statsState.ratio = ratio
+	statsState.Unlock()
+	return nil
+}
+
+type dumpSize struct {
+	CompressedBytes int64 `json:"compressedBytes"`
+	// EstimatedUncompressedBytes is CompressedBytes times the
+	// EstimatedCompressionRatio, an estimate from a single block rather than
+	// a measurement. Both are left out until the ratio has been measured.
+	EstimatedUncompressedBytes int64   `json:"estimatedUncompressedBytes,omitempty"`
+	EstimatedCompressionRatio  float64 `json:"estimatedCompressionRatio,omitempty"`
+	// SampledBlock is the offset of the block the ratio was measured from.
+	SampledBlock int `json:"sampledBlock,omitempty"`
+}
+
+// handleStatsSize serves /stats/size, the size of the articles file and an
+// estimate of how big it is decompressed, from how much one block grew when
+// it was decompressed after the index loaded.
+func handleStatsSize(w http.ResponseWriter, r *http.Request) error {
+	stat, err := os.Stat(*articlesFile)
+	if err != nil {
+		return articlesUnavailable(err)
+	}
+	s := dumpSize{CompressedBytes: stat.Size()}
+	statsState.Lock()
+	ratio := statsState.ratio
+	statsState.Unlock()
+	if ratio != nil {
+		s.EstimatedCompressionRatio = float64(ratio.decodedBytes) / float64(ratio.compressedBytes)
+		s.EstimatedUncompressedBytes = int64(float64(s.CompressedBytes) * s.EstimatedCompressionRatio)
+		s.SampledBlock = ratio.seek
+	}
+	return writeJSON(w, r, s)
+}
+
+type stats struct {
+	Entries int `json:"entries"`
+	Blocks  int `json:"blocks"`
+	// IndexMode is "memory", or "disk" if the index outgrew -maxIndexMemory
+	// and was partly built on disk.
+	IndexMode string `json:"indexMode"`
+	// SkippedIndexLines is the number of index lines left out for being too
+	// long or having titles that aren't valid UTF-8. It's 0 if the index
+	// was read from the -offsetCache.
+	SkippedIndexLines int `json:"skippedIndexLines"`
+	// SizeHistogram is only present with -statsSample and is estimated from
+	// a sample of articles rather than counted exactly.
+	SizeHistogram *sizeHistogram `json:"sizeHistogram,omitempty"`
+}
+
+// handleStats serves /stats, describing the loaded dump.
+func handleStats(w http.ResponseWriter, r *http.Request) error {
+	mu.Lock()
+	s := stats{
+		Entries:   indexLen(),
+		Blocks:    len(mu.offsetSize),
+		IndexMode: currentOffsets().mode(),
+
+		SkippedIndexLines: mu.skippedLines,
+	}
+	mu.Unlock()
+
+	statsState.Lock()
+	s.SizeHistogram = statsState.histogram
+	statsState.Unlock()
+
+	return writeJSON(w, r, s)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHandleStatsSize(t *testing.T) {
+	useTestDump(t,
+		[]page{testPage(1, "A", "aaa")},
+		[]page{testPage(2, "B", "bbb"), testPage(3, "C", "ccc")},
+		[]page{testPage(4, "D", "ddd")},
+	)
+	defer func(ratio *compressionRatio) { statsState.ratio = ratio }(statsState.ratio)
+	statsState.ratio = nil
+	stat, err := os.Stat(*articlesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() dumpSize {
+		w := httptest.NewRecorder()
+		handle(handleStatsSize)(w, httptest.NewRequest("GET", "/stats/size", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var s dumpSize
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if s := get(); s != (dumpSize{CompressedBytes: stat.Size()}) {
+		t.Errorf("before measuring, got %+v; expected only the compressed size %d", s, stat.Size())
+	}
+
+	if err := measureCompressionRatio(); err != nil {
+		t.Fatal(err)
+	}
+	// The test dump isn't compressed, so it doesn't grow.
+	want := dumpSize{
+		CompressedBytes:            stat.Size(),
+		EstimatedUncompressedBytes: stat.Size(),
+		EstimatedCompressionRatio:  1,
+		SampledBlock:               blockSeeks()[1],
+	}
+	if s := get(); s != want {
+		t.Errorf("got %+v; not %+v", s, want)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+var (
+	suggest        = flag.Bool("suggest", false, "whether to suggest similar titles when an article isn't found, requires -titles")
+	disambiguators = flag.Bool("disambiguators", false, "whether to suggest the titles with or without a parenthetical disambiguator, like Mercury (planet) for Mercury, when an article isn't found, requires -titles")
+
+	fuzzyMaxCandidates = flag.Int("fuzzyMaxCandidates", 5000, "the most titles sharing a prefix with a missing title that are looked at for suggestions, "+
+		"lower is faster on a miss but may leave out the best suggestions for short or common prefixes")
+)
+
+// suggestLookups and suggestCandidatesScanned count the misses suggestions
+// were looked for and the candidate titles looked at for them.
+var suggestLookups, suggestCandidatesScanned int64
+
+const (
+	// maxSuggestions is the most titles suggested for a missing article.
+	maxSuggestions = 3
+	// suggestPrefixLen is the number of leading characters candidates must
+	// share with the missing title, which keeps the number of edit distances
+	// computed per miss small.
+	suggestPrefixLen = 3
+	// maxDisambiguated is the most titles with a disambiguator suggested for
+	// a missing article. It's more than maxSuggestions since a base title
+	// like "Mercury" can have many equally good ones.
+	maxDisambiguated = 10
+)
+
+type suggestEntry struct {
+	key   string
+	title string
+	// length is the number of runes in key.
+	length int
+}
+
+// suggestIndex is every retained title sorted by its suggestKey, so that the
+// titles sharing a prefix are contiguous.
+var suggestIndex = struct {
+	sync.Mutex
+
+	entries []suggestEntry
+}{}
+
+// suggestKey normalizes a title for comparison, so that suggestions are
+// found regardless of case or underscores.
+func suggestKey(title string) string {
+	return strings.ToLower(strings.Replace(title, "_", " ", -1))
+}
+
+func buildSuggestIndex() {
+	log.Printf("Building suggestion index...")
+	mu.Lock()
+	titles := mu.titles
+	mu.Unlock()
+
+	entries := make([]suggestEntry, len(titles))
+	for i, t := range titles {
+		key := suggestKey(t.title)
+		entries[i] = suggestEntry{key: key, title: t.title, length: utf8.RuneCountInString(key)}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	suggestIndex.Lock()
+	suggestIndex.entries = entries
+	suggestIndex.Unlock()
+	log.Printf("Done building suggestion index! %d titles", len(entries))
+}
+
+// suggestTitles returns up to n titles closest to name by edit distance,
+// closest first, among the titles that start with the same few characters.
+// Misspellings in the first characters of a title aren't found. At most
+// -fuzzyMaxCandidates titles are looked at, titles whose length is too
+// different to be close are skipped without computing the distance, and it
+// stops early once n titles within one edit have been found.
+func suggestTitles(name string, n int) []string {
+	key := suggestKey(name)
+	prefix := key
+	if runes := []rune(key); len(runes) > suggestPrefixLen {
+		prefix = string(runes[:suggestPrefixLen])
+	}
+
+	suggestIndex.Lock()
+	entries := suggestIndex.entries
+	suggestIndex.Unlock()
+
+	type candidate struct {
+		title    string
+		distance int
+	}
+	var candidates []candidate
+	length := utf8.RuneCountInString(key)
+	maxDistance := length/3 + 1
+	start := sort.Search(len(entries), func(i int) bool {
+		return entries[i].key >= prefix
+	})
+	nearby := 0
+	i := start
+	for ; i < len(entries) && i-start < *fuzzyMaxCandidates && nearby < n && strings.HasPrefix(entries[i].key, prefix); i++ {
+		// The distance is at least the difference in length.
+		if diff := entries[i].length - length; diff > maxDistance || -diff > maxDistance {
+			continue
+		}
+		if d := editDistance(key, entries[i].key); d <= maxDistance {
+			candidates = append(candidates, candidate{entries[i].title, d})
+			if d <= 1 {
+				nearby++
+			}
+		}
+	}
+	atomic.AddInt64(&suggestLookups, 1)
+	atomic.AddInt64(&suggestCandidatesScanned, int64(i-start))
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	suggestions := []string{}
+	for _, c := range candidates {
+		if len(suggestions) == n {
+			break
+		}
+		suggestions = append(suggestions, c.title)
+	}
+	return suggestions
+}
+
+// missingTitleSuggestions returns the titles to suggest for the missing
+// article name: those that differ from it by a disambiguator with
+// -disambiguators and then those spelled similarly with -suggest.
+func missingTitleSuggestions(name string) []string {
+	suggestions := []string{}
+	if *disambiguators {
+		suggestions = append(suggestions, disambiguatedTitles(name, maxDisambiguated)...)
+	}
+	if *suggest {
+		for _, title := range suggestTitles(name, maxSuggestions) {
+			if !containsString(suggestions, title) {
+				suggestions = append(suggestions, title)
+			}
+		}
+	}
+	return suggestions
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDisambiguator splits a title like "Mercury (planet)" into its base
+// title and the disambiguator in parentheses. ok is false if title doesn't
+// end with one.
+func splitDisambiguator(title string) (base, disambiguator string, ok bool) {
+	if !strings.HasSuffix(title, ")") {
+		return "", "", false
+	}
+	i := strings.LastIndex(title, " (")
+	if i <= 0 || i+2 >= len(title)-1 {
+		return "", "", false
+	}
+	return strings.TrimSpace(title[:i]), title[i+2 : len(title)-1], true
+}
+
+// disambiguatedTitles returns up to n titles that are name with a different
+// disambiguator or none at all: "Mercury (element)" finds "Mercury" and
+// "Mercury (planet)", and "Mercury" finds "Mercury (planet)". The base title
+// comes first if it's in the index, then the rest in title order.
+func disambiguatedTitles(name string, n int) []string {
+	base, _, ok := splitDisambiguator(name)
+	if !ok {
+		base = name
+	}
+	suggestIndex.Lock()
+	entries := suggestIndex.entries
+	suggestIndex.Unlock()
+
+	var titles []string
+	key := suggestKey(base)
+	start := sort.Search(len(entries), func(i int) bool {
+		return entries[i].key >= key
+	})
+	if ok && start < len(entries) && entries[start].key == key && n > 0 {
+		titles = append(titles, entries[start].title)
+	}
+
+	prefix := key + " ("
+	self := suggestKey(name)
+	start = sort.Search(len(entries), func(i int) bool {
+		return entries[i].key >= prefix
+	})
+	for i := start; i < len(entries) && len(titles) < n && strings.HasPrefix(entries[i].key, prefix); i++ {
+		if _, _, ok := splitDisambiguator(entries[i].title); ok && entries[i].key != self {
+			titles = append(titles, entries[i].title)
+		}
+	}
+	return titles
+}
+
+// editDistance returns the Levenshtein distance between a and b in runes.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggestionsError is a not found error with titles the client may have
+// meant, which handle includes in the response.
+type suggestionsError struct {
+	error
+	suggestions []string
+}
+
+// Cause lets errors.Cause find the statusError underneath.
+func (e suggestionsError) Cause() error {
+	return e.error
+}
+
+// suggestionsOf returns the suggestions attached to err, if any.
+func suggestionsOf(err error) []string {
+	for err != nil {
+		if e, ok := err.(suggestionsError); ok {
+			return e.suggestions
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = cause.Cause()
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSuggestTitles(t *testing.T) {
+	defer func(titles, suggestions bool) { *retainTitles, *suggest = titles, suggestions }(*retainTitles, *suggest)
+	*retainTitles, *suggest = true, true
+	useTestDump(t, []page{
+		testPage(1, "Albert Einstein", ""),
+		testPage(2, "Albert Einstein College", ""),
+		testPage(3, "Alberta", ""),
+		testPage(4, "Albert Camus", ""),
+		testPage(5, "Zebra", ""),
+	})
+	buildSuggestIndex()
+	defer func() { suggestIndex.entries = nil }()
+
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"Albert Einstien", []string{"Albert Einstein"}},
+		{"albert_einstein", []string{"Albert Einstein"}},
+		{"Albert Camus!", []string{"Albert Camus"}},
+		{"Zebar", []string{"Zebra"}},
+		{"Ebra", []string{}},
+		{"Something else", []string{}},
+	}
+	for _, c := range cases {
+		if got := suggestTitles(c.in, maxSuggestions); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("suggestTitles(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+
+	// With a cap of one only the first title with the prefix, Albert Camus,
+	// is looked at.
+	maxCandidates := *fuzzyMaxCandidates
+	*fuzzyMaxCandidates = 1
+	lookups, scanned := suggestLookups, suggestCandidatesScanned
+	if got := suggestTitles("Albert Einstien", maxSuggestions); len(got) != 0 {
+		t.Errorf("suggestTitles with -fuzzyMaxCandidates=1 = %q; expected none", got)
+	}
+	if got := suggestTitles("Albert Camus!", maxSuggestions); !reflect.DeepEqual(got, []string{"Albert Camus"}) {
+		t.Errorf("suggestTitles with -fuzzyMaxCandidates=1 = %q; not Albert Camus", got)
+	}
+	if suggestLookups-lookups != 2 || suggestCandidatesScanned-scanned != 2 {
+		t.Errorf("counted %d lookups scanning %d candidates; not 2 and 2", suggestLookups-lookups, suggestCandidatesScanned-scanned)
+	}
+	*fuzzyMaxCandidates = maxCandidates
+
+	req := httptest.NewRequest("GET", "/article?title=Albert+Einstien", nil)
+	w := httptest.NewRecorder()
+	handle(handleArticle)(w, req)
+	var body struct {
+		Error       string   `json:"error"`
+		Suggestions []string `json:"suggestions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || !reflect.DeepEqual(body.Suggestions, []string{"Albert Einstein"}) {
+		t.Errorf("got %d %s; expected a 404 suggesting Albert Einstein", w.Code, w.Body)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"einstein", "einstien", 2},
+		{"zürich", "zurich", 1},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("editDistance(%q, %q) = %d; not %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDisambiguatedTitles(t *testing.T) {
+	defer func(titles, disambiguate bool) { *retainTitles, *disambiguators = titles, disambiguate }(*retainTitles, *disambiguators)
+	*retainTitles, *disambiguators = true, true
+	useTestDump(t, []page{
+		testPage(1, "Mercury", ""),
+		testPage(2, "Mercury (planet)", ""),
+		testPage(3, "Mercury (element)", ""),
+		testPage(4, "Mercury Records", ""),
+		testPage(5, "Venus (planet)", ""),
+	})
+	buildSuggestIndex()
+	defer func() { suggestIndex.entries = nil }()
+
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"Mercury", []string{"Mercury (element)", "Mercury (planet)"}},
+		{"Mercury (god)", []string{"Mercury", "Mercury (element)", "Mercury (planet)"}},
+		{"mercury (planet)", []string{"Mercury", "Mercury (element)"}},
+		{"Venus", []string{"Venus (planet)"}},
+		{"Venus (mythology)", []string{"Venus (planet)"}},
+		{"Mars", nil},
+	}
+	for _, c := range cases {
+		if got := disambiguatedTitles(c.in, maxDisambiguated); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("disambiguatedTitles(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+
+	// Exact matches are still served as they are.
+	w := httptest.NewRecorder()
+	handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Mercury", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"Mercury"`) {
+		t.Errorf("got %d %s; expected Mercury", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handle(handleArticle)(w, httptest.NewRequest("GET", "/article?title=Venus", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"suggestions":["Venus (planet)"]`) {
+		t.Errorf("got %d %s; expected a 404 suggesting Venus (planet)", w.Code, w.Body)
+	}
+}
+
+func TestSplitDisambiguator(t *testing.T) {
+	cases := []struct {
+		in                  string
+		base, disambiguator string
+		ok                  bool
+	}{
+		{"Mercury (planet)", "Mercury", "planet", true},
+		{"Cars (2006 film) (soundtrack)", "Cars (2006 film)", "soundtrack", true},
+		{"Mercury", "", "", false},
+		{"(planet)", "", "", false},
+		{"Mercury ()", "", "", false},
+		{"Air Force (US) One", "", "", false},
+	}
+	for _, c := range cases {
+		base, disambiguator, ok := splitDisambiguator(c.in)
+		if base != c.base || disambiguator != c.disambiguator || ok != c.ok {
+			t.Errorf("splitDisambiguator(%q) = %q, %q, %v; not %q, %q, %v", c.in, base, disambiguator, ok, c.base, c.disambiguator, c.ok)
+		}
+	}
+}
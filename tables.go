@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// wikiTable is a {| ... |} table parsed into rows of cells.
+type wikiTable struct {
+	Caption string        `json:"caption,omitempty"`
+	Rows    [][]tableCell `json:"rows"`
+	// Offset is the byte offset of the table's {| line in the text.
+	Offset int `json:"offset"`
+}
+
+// tableCell is one cell of a wikiTable. Spans are only reported, the cells
+// they cover aren't filled in.
+type tableCell struct {
+	// Text is the cell's content as plain text.
+	Text    string `json:"text"`
+	Header  bool   `json:"header,omitempty"`
+	RowSpan int    `json:"rowspan,omitempty"`
+	ColSpan int    `json:"colspan,omitempty"`
+}
+
+var spanRegexp = regexp.MustCompile(`(?i)\b(rowspan|colspan)\s*=\s*["']?\s*(\d+)`)
+
+// tableParser is a table being parsed, along with the raw wikitext of its
+// current cell.
+type tableParser struct {
+	table   wikiTable
+	row     []tableCell
+	cell    *tableCell
+	raw     string
+	caption bool
+}
+
+// finishCell converts the raw text of the current cell, or caption, to plain
+// text.
+func (t *tableParser) finishCell() {
+	text := strings.TrimSpace(plainText(t.raw))
+	if t.caption {
+		t.table.Caption = text
+	} else if t.cell != nil {
+		t.cell.Text = text
+		t.row = append(t.row, *t.cell)
+	}
+	t.cell, t.raw, t.caption = nil, "", false
+}
+
+func (t *tableParser) finishRow() {
+	t.finishCell()
+	if len(t.row) > 0 {
+		t.table.Rows = append(t.table.Rows, t.row)
+	}
+	t.row = nil
+}
+
+// addCells starts a cell for each of the cells on a line, which are
+// separated by || or, in header lines, !!.
+func (t *tableParser) addCells(line string, header bool) {
+	cells := splitOutsideMarkup(line, "||")
+	if header {
+		cells = nil
+		for _, c := range splitOutsideMarkup(line, "||") {
+			cells = append(cells, splitOutsideMarkup(c, "!!")...)
+		}
+	}
+	for _, c := range cells {
+		t.finishCell()
+		cell := tableCell{Header: header}
+		// A single | separates the cell's attributes from its content.
+		if parts := splitOutsideMarkup(c, "|"); len(parts) > 1 {
+			for _, m := range spanRegexp.FindAllStringSubmatch(parts[0], -1) {
+				if n, err := strconv.Atoi(m[2]); err == nil && n > 1 {
+					if strings.EqualFold(m[1], "rowspan") {
+						cell.RowSpan = n
+					} else {
+						cell.ColSpan = n
+					}
+				}
+			}
+			c = strings.Join(parts[1:], "|")
+		}
+		t.cell, t.raw = &cell, c
+	}
+}
+
+// splitOutsideMarkup splits s at each sep that isn't inside a link or
+// template, so the pipes of [[Foo|Bar]] and {{Foo|bar}} don't split cells.
+func splitOutsideMarkup(s, sep string) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "[[") || strings.HasPrefix(s[i:], "{{"):
+			depth++
+			i += 2
+		case depth > 0 && (strings.HasPrefix(s[i:], "]]") || strings.HasPrefix(s[i:], "}}")):
+			depth--
+			i += 2
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			// A lone | mustn't match half of a ||.
+			if sep == "|" && strings.HasPrefix(s[i:], "||") {
+				i += 2
+				continue
+			}
+			parts = append(parts, s[last:i])
+			i += len(sep)
+			last = i
+		default:
+			i++
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// extractTables parses the wiki tables in text, in the order they start.
+// Nested tables are returned as tables of their own and left out of the cell
+// they're in. It's meant for simple tables: rowspan and colspan are reported
+// on their cells but not expanded into the grid, and rows or cells produced
+// by templates aren't seen at all.
+func extractTables(text string) []wikiTable {
+	tables := []wikiTable{}
+	var stack []*tableParser
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		start := offset
+		offset += len(line)
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "{|"):
+			stack = append(stack, &tableParser{table: wikiTable{Rows: [][]tableCell{}, Offset: start}})
+			continue
+		case len(stack) == 0:
+			continue
+		}
+		t := stack[len(stack)-1]
+		switch {
+		case strings.HasPrefix(line, "|}"):
+			t.finishRow()
+			tables = append(tables, t.table)
+			stack = stack[:len(stack)-1]
+		case strings.HasPrefix(line, "|+"):
+			t.finishCell()
+			t.caption, t.raw = true, line[2:]
+		case strings.HasPrefix(line, "|-"):
+			t.finishRow()
+		case strings.HasPrefix(line, "!"):
+			t.addCells(line[1:], true)
+		case strings.HasPrefix(line, "|"):
+			t.addCells(line[1:], false)
+		case t.cell != nil || t.caption:
+			t.raw += "\n" + line
+		}
+	}
+	// Unclosed tables run to the end of the text.
+	for i := len(stack) - 1; i >= 0; i-- {
+		stack[i].finishRow()
+		tables = append(tables, stack[i].table)
+	}
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].Offset < tables[j].Offset })
+	return tables
+}
+
+// handleTables serves /tables?title=..., returning the article's wiki tables
+// as rows of cells, see extractTables.
+func handleTables(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, extractTables(p.Text))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExtractTables(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		want []wikiTable
+	}{
+		{
+			"simple",
+			"Lead\n{| class=\"wikitable\"\n|+ Planets\n! Name !! Moons\n|-\n| [[Earth]] || 1\n|-\n| [[Mars|The red planet]] || 2\n|}\nAfter",
+			[]wikiTable{{
+				Caption: "Planets",
+				Offset:  5,
+				Rows: [][]tableCell{
+					{{Text: "Name", Header: true}, {Text: "Moons", Header: true}},
+					{{Text: "Earth"}, {Text: "1"}},
+					{{Text: "The red planet"}, {Text: "2"}},
+				},
+			}},
+		},
+		{
+			"cells on their own lines",
+			"{|\n|-\n! scope=\"row\" | Year\n| 2001\n| '''bold''' {{ref|x}}\n|-\n|}",
+			[]wikiTable{{
+				Rows: [][]tableCell{{{Text: "Year", Header: true}, {Text: "2001"}, {Text: "bold"}}},
+			}},
+		},
+		{
+			"spans",
+			"{|\n| rowspan=\"2\" | A || colspan=3 | B\n|}",
+			[]wikiTable{{
+				Rows: [][]tableCell{{{Text: "A", RowSpan: 2}, {Text: "B", ColSpan: 3}}},
+			}},
+		},
+		{
+			"multi-line cell",
+			"{|\n| First line\nsecond line\n|}",
+			[]wikiTable{{
+				Rows: [][]tableCell{{{Text: "First line\nsecond line"}}},
+			}},
+		},
+		{
+			"nested",
+			"{|\n| Outer\n{|\n| Inner\n|}\n| After\n|}",
+			[]wikiTable{
+				{Rows: [][]tableCell{{{Text: "Outer"}, {Text: "After"}}}},
+				{Offset: 11, Rows: [][]tableCell{{{Text: "Inner"}}}},
+			},
+		},
+		{
+			"unclosed",
+			"{|\n| A",
+			[]wikiTable{{Rows: [][]tableCell{{{Text: "A"}}}}},
+		},
+		{"none", "No tables here.", []wikiTable{}},
+	}
+	for _, c := range cases {
+		if got := extractTables(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: extractTables = %+v; not %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHandleArticleTables(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "{|\n| A || B\n|}")})
+
+	req := httptest.NewRequest("GET", "/article?title=Foo&tables=json", nil)
+	w := httptest.NewRecorder()
+	handle(handleArticle)(w, req)
+	var got struct {
+		Tables []wikiTable `json:"tables"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want := []wikiTable{{Rows: [][]tableCell{{{Text: "A"}, {Text: "B"}}}}}
+	if !reflect.DeepEqual(got.Tables, want) {
+		t.Errorf("tables = %+v; not %+v", got.Tables, want)
+	}
+
+	req = httptest.NewRequest("GET", "/article?title=Foo&tables=html", nil)
+	w = httptest.NewRecorder()
+	handle(handleArticle)(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("tables=html: status = %d; not %d", w.Code, http.StatusBadRequest)
+	}
+}
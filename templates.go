@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"log"
+	"net/http"
 	"path"
 	"strconv"
 	"strings"
@@ -188,7 +189,7 @@ func (p page) templateHandler(name string, attrs []wikitext.Attribute) (interfac
 		mu.Lock()
 		defer mu.Unlock()
 
-		return len(mu.offsets), nil
+		return indexLen(), nil
 
 	} else if strings.HasPrefix(name, "#") {
 		parts := strings.SplitN(name, ":", 2)
@@ -223,3 +224,75 @@ func (p page) templateHandler(name string, attrs []wikitext.Attribute) (interfac
 
 	return nil, errors.Errorf("unknown template: %q, args: %v", name, attrs)
 }
+
+// templateNamespace is the namespace number of templates.
+const templateNamespace = 10
+
+// templateTitle returns the title of the template page for name, which may
+// be given with or without the Template: prefix, in any case, and with
+// underscores for spaces. Dumps in other languages use their own prefix,
+// such as Vorlage:.
+func templateTitle(name string) (string, error) {
+	name = strings.TrimSpace(strings.Replace(name, "_", " ", -1))
+	if name == "" {
+		return "", statusErrorf(http.StatusBadRequest, "name is required")
+	}
+	name, err := validateTitle(name)
+	if err != nil {
+		return "", err
+	}
+	prefixes := namespacePrefixes(templateNamespace)
+	if len(prefixes) == 0 {
+		return "", statusErrorf(http.StatusNotFound, "the dump has no template namespace")
+	}
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		for _, prefix := range prefixes {
+			if strings.EqualFold(strings.TrimSpace(name[:i]), prefix) {
+				name = strings.TrimSpace(name[i+1:])
+				break
+			}
+		}
+	}
+	if name == "" {
+		return "", statusErrorf(http.StatusBadRequest, "name is required")
+	}
+	return prefixes[0] + ":" + upperFirst(name), nil
+}
+
+type templateDefinition struct {
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	RevisionID string `json:"revisionID"`
+	Text       string `json:"text"`
+}
+
+// handleTemplate serves /template?name=Infobox_person, returning the
+// wikitext of the Template: page defining a template, for tools expanding
+// templates themselves. It's a 404 if the template isn't in the dump.
+func handleTemplate(w http.ResponseWriter, r *http.Request) error {
+	name := r.URL.Query().Get("name")
+	title, err := templateTitle(name)
+	if err != nil {
+		return err
+	}
+	p, err := lookupArticle(title)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, templateDefinition{
+		Name:       p.Title[strings.IndexByte(p.Title, ':')+1:],
+		Title:      p.Title,
+		RevisionID: p.RevisionID,
+		Text:       p.Text,
+	})
+}
+
+// handleUsedTemplates serves /usedtemplates?title=..., listing the templates
+// an article uses, see extractTemplates.
+func handleUsedTemplates(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, extractTemplates(p.Text))
+}
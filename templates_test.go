@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleTemplate(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Template:Infobox person", "{{Infobox|name={{{name}}}}}"),
+		testPage(2, "Infobox person", "An article"),
+	})
+
+	for _, c := range []struct {
+		name string
+		code int
+		want string
+	}{
+		{"Infobox_person", http.StatusOK, `"text":"{{Infobox|name={{{name}}}}}"`},
+		{"infobox person", http.StatusOK, `"title":"Template:Infobox person"`},
+		{"Template:Infobox person", http.StatusOK, `"name":"Infobox person"`},
+		{"template: Infobox_person", http.StatusOK, `"name":"Infobox person"`},
+		{"Missing", http.StatusNotFound, "not found"},
+		{"Template:", http.StatusBadRequest, "name is required"},
+		{"", http.StatusBadRequest, "name is required"},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleTemplate)(w, httptest.NewRequest("GET", "/template?name="+url.QueryEscape(c.name), nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("name=%q: got %d %s; expected %d containing %s", c.name, w.Code, w.Body, c.code, c.want)
+		}
+	}
+
+	defer setNamespaces(defaultNamespaces)
+	setNamespaces(map[string]int{"Vorlage": 10})
+	if got, err := templateTitle("vorlage:Foo"); err != nil || got != "Vorlage:Foo" {
+		t.Errorf("templateTitle with a German dump = %q, %v; not Vorlage:Foo", got, err)
+	}
+}
+
+func TestHandleUsedTemplates(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "{{Infobox|name={{nowrap|Foo}}}} {{#if:x|y}}")})
+
+	w := httptest.NewRecorder()
+	handle(handleUsedTemplates)(w, httptest.NewRequest("GET", "/usedtemplates?title=Foo", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `["Infobox","Nowrap"]` {
+		t.Errorf("got %d %s; expected 200 [\"Infobox\",\"Nowrap\"]", w.Code, w.Body)
+	}
+}
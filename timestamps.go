@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var timestamps = flag.Bool("timestamps", false, "whether or not to build the revision timestamp index for /since, requires decoding every article")
+
+type timestampEntry struct {
+	time  time.Time
+	title string
+}
+
+// tsIndex holds the revision timestamp of every article sorted oldest first.
+// It is only populated when running with -timestamps since building it
+// requires decoding every article in the dump, and it keeps every title in
+// memory.
+var tsIndex = struct {
+	sync.Mutex
+
+	built   bool
+	entries []timestampEntry
+}{}
+
+func buildTimestampIndex() error {
+	log.Printf("Building timestamp index...")
+	var entries []timestampEntry
+	if err := IterateArticles(context.Background(), 0, func(seek int, p page) error {
+		t, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, timestampEntry{time: t, title: p.Title})
+		return nil
+	}); err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time.Before(entries[j].time)
+	})
+
+	tsIndex.Lock()
+	tsIndex.built = true
+	tsIndex.entries = entries
+	tsIndex.Unlock()
+
+	log.Printf("Done building timestamp index! %d articles", len(entries))
+	return nil
+}
+
+type modifiedTitle struct {
+	Title     string `json:"title"`
+	Timestamp string `json:"timestamp"`
+}
+
+// handleSince serves /since?timestamp=..., streaming the titles of the
+// articles whose revision is newer than timestamp as NDJSON, oldest first.
+func handleSince(w http.ResponseWriter, r *http.Request) error {
+	if !*timestamps {
+		return statusErrorf(http.StatusServiceUnavailable, "timestamp index disabled, start with -timestamps")
+	}
+	raw := r.URL.Query().Get("timestamp")
+	since, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return statusErrorf(http.StatusBadRequest, "invalid timestamp %q, expected RFC 3339", raw)
+	}
+
+	tsIndex.Lock()
+	built, entries := tsIndex.built, tsIndex.entries
+	tsIndex.Unlock()
+	if !built {
+		return statusErrorf(http.StatusServiceUnavailable, "timestamp index is still being built")
+	}
+
+	// entries is replaced rather than modified, so it's safe to read without
+	// the lock.
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].time.After(since)
+	})
+	nw := newNDJSONWriter(w)
+	for _, e := range entries[i:] {
+		if err := nw.encode(modifiedTitle{
+			Title:     e.title,
+			Timestamp: e.time.UTC().Format(time.RFC3339),
+		}); err != nil {
+			return err
+		}
+	}
+	return nw.flush()
+}
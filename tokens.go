@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The types of wikitext tokens.
+const (
+	tokenText      = "text"
+	tokenLink      = "link"
+	tokenExtLink   = "extlink"
+	tokenTemplate  = "template"
+	tokenParameter = "parameter"
+	tokenHeading   = "heading"
+	tokenList      = "list"
+	tokenBold      = "bold"
+	tokenItalic    = "italic"
+	tokenTag       = "tag"
+	tokenComment   = "comment"
+)
+
+// wikiToken is a piece of wikitext. Start and End are the byte offsets of the
+// token in the text, so text[Start:End] is its source.
+type wikiToken struct {
+	Type  string `json:"type"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	// Text is a text token's text, a link's label, a heading's title or a
+	// list item's markers.
+	Text string `json:"text,omitempty"`
+	// Target is the title a link goes to or the URL of an external link.
+	Target string `json:"target,omitempty"`
+	// Name is a template's or parameter's name, or an HTML tag's.
+	Name string `json:"name,omitempty"`
+	// Level is a heading's level, 2 for == Heading ==.
+	Level int `json:"level,omitempty"`
+}
+
+var (
+	headingLineRegexp = regexp.MustCompile(`^(={1,6})\s*(.+?)\s*(={1,6})\s*$`)
+	tagNameRegexp     = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9]*)`)
+)
+
+// tokenizeWikitext splits text into tokens in a single pass. It's a shallow
+// tokenizer, not a parser: headings, links and templates are single tokens
+// whose insides aren't tokenized, bold and italic tokens are the ” and ”'
+// that toggle them rather than the text they cover, and anything it doesn't
+// recognize is text. Every byte of text is in exactly one token.
+func tokenizeWikitext(text string) []wikiToken {
+	tokens := []wikiToken{}
+	add := func(t wikiToken) {
+		if t.Type == tokenText && len(tokens) > 0 && tokens[len(tokens)-1].Type == tokenText {
+			// Runs of text are merged.
+			last := &tokens[len(tokens)-1]
+			last.End, last.Text = t.End, last.Text+t.Text
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	lineStart := true
+	for i := 0; i < len(text); {
+		if lineStart {
+			lineStart = false
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += i
+			}
+			if m := headingLineRegexp.FindStringSubmatch(text[i:end]); m != nil && len(m[1]) == len(m[3]) {
+				add(wikiToken{Type: tokenHeading, Start: i, End: end, Text: m[2], Level: len(m[1])})
+				i = end
+				continue
+			}
+			if n := len(text[i:end]) - len(strings.TrimLeft(text[i:end], "*#:;")); n > 0 {
+				add(wikiToken{Type: tokenList, Start: i, End: i + n, Text: text[i : i+n]})
+				i += n
+				continue
+			}
+		}
+
+		s := text[i:]
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s[4:], "-->")
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += 7
+			}
+			add(wikiToken{Type: tokenComment, Start: i, End: i + end})
+			i += end
+			continue
+		case strings.HasPrefix(s, "{{{"):
+			if end := strings.Index(s[3:], "}}}"); end >= 0 {
+				name := strings.SplitN(s[3:3+end], "|", 2)[0]
+				add(wikiToken{Type: tokenParameter, Start: i, End: i + end + 6, Name: strings.TrimSpace(name)})
+				i += end + 6
+				continue
+			}
+		case strings.HasPrefix(s, "{{"):
+			if end := matchingBraces(s, 0); end >= 0 {
+				name := splitTemplateParams(s[2:end])[0]
+				add(wikiToken{Type: tokenTemplate, Start: i, End: i + end + 2, Name: strings.TrimSpace(name)})
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(s, "[["):
+			if end := matchingClose(s, 0); end >= 0 {
+				inner := s[2:end]
+				target, label := inner, ""
+				if j := strings.IndexByte(inner, '|'); j >= 0 {
+					target, label = inner[:j], inner[j+1:]
+				}
+				target = normalizeLinkTarget(target)
+				if label == "" {
+					label = target
+				}
+				add(wikiToken{Type: tokenLink, Start: i, End: i + end + 2, Text: label, Target: target})
+				i += end + 2
+				continue
+			}
+		case s[0] == '[':
+			if m := extLinkRegexp.FindStringSubmatch(s); m != nil {
+				add(wikiToken{Type: tokenExtLink, Start: i, End: i + len(m[0]), Text: m[2], Target: m[1]})
+				i += len(m[0])
+				continue
+			}
+		case strings.HasPrefix(s, "'''''"):
+			add(wikiToken{Type: tokenBold, Start: i, End: i + 3})
+			add(wikiToken{Type: tokenItalic, Start: i + 3, End: i + 5})
+			i += 5
+			continue
+		case strings.HasPrefix(s, "'''"):
+			add(wikiToken{Type: tokenBold, Start: i, End: i + 3})
+			i += 3
+			continue
+		case strings.HasPrefix(s, "''"):
+			add(wikiToken{Type: tokenItalic, Start: i, End: i + 2})
+			i += 2
+			continue
+		case s[0] == '<':
+			if loc := htmlTagRegexp.FindStringIndex(s); loc != nil && loc[0] == 0 {
+				m := tagNameRegexp.FindStringSubmatch(s)
+				add(wikiToken{Type: tokenTag, Start: i, End: i + loc[1], Name: strings.ToLower(m[1])})
+				i += loc[1]
+				continue
+			}
+		}
+
+		// Text runs to the end of the line or the next character that could
+		// start markup.
+		j := i
+		for j < len(text) {
+			if text[j] == '\n' {
+				j++
+				lineStart = true
+				break
+			}
+			if j > i && strings.IndexByte("<{['", text[j]) >= 0 {
+				break
+			}
+			j++
+		}
+		add(wikiToken{Type: tokenText, Start: i, End: j, Text: text[i:j]})
+		i = j
+	}
+	return tokens
+}
+
+// matchingBraces returns the index of the "}}" closing the "{{" at start,
+// accounting for nested templates, or -1 if there is none.
+func matchingBraces(s string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "{{":
+			depth++
+			i++
+		case "}}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// handleTokens serves /tokens?title=..., returning the article's wikitext as
+// tokens, see tokenizeWikitext, for clients that render it themselves.
+func handleTokens(w http.ResponseWriter, r *http.Request) error {
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, tokenizeWikitext(p.Text))
+}
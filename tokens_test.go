@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeWikitext(t *testing.T) {
+	text := "'''Foo''' is a [[bar (baz)|bar]].<ref>[https://example.com Example]</ref>\n" +
+		"== History ==\n" +
+		"* {{Infobox|name={{PAGENAME}}}} {{{1|x}}}\n" +
+		"<!-- hidden -->''italic'' a < b\n\n" +
+		"'''''both'''''"
+	got := tokenizeWikitext(text)
+	want := []wikiToken{
+		{Type: tokenBold, Start: 0, End: 3},
+		{Type: tokenText, Start: 3, End: 6, Text: "Foo"},
+		{Type: tokenBold, Start: 6, End: 9},
+		{Type: tokenText, Start: 9, End: 15, Text: " is a "},
+		{Type: tokenLink, Start: 15, End: 32, Text: "bar", Target: "Bar (baz)"},
+		{Type: tokenText, Start: 32, End: 33, Text: "."},
+		{Type: tokenTag, Start: 33, End: 38, Name: "ref"},
+		{Type: tokenExtLink, Start: 38, End: 67, Text: "Example", Target: "https://example.com"},
+		{Type: tokenTag, Start: 67, End: 73, Name: "ref"},
+		{Type: tokenText, Start: 73, End: 74, Text: "\n"},
+		{Type: tokenHeading, Start: 74, End: 87, Text: "History", Level: 2},
+		{Type: tokenText, Start: 87, End: 88, Text: "\n"},
+		{Type: tokenList, Start: 88, End: 89, Text: "*"},
+		{Type: tokenText, Start: 89, End: 90, Text: " "},
+		{Type: tokenTemplate, Start: 90, End: 119, Name: "Infobox"},
+		{Type: tokenText, Start: 119, End: 120, Text: " "},
+		{Type: tokenParameter, Start: 120, End: 129, Name: "1"},
+		{Type: tokenText, Start: 129, End: 130, Text: "\n"},
+		{Type: tokenComment, Start: 130, End: 145},
+		{Type: tokenItalic, Start: 145, End: 147},
+		{Type: tokenText, Start: 147, End: 153, Text: "italic"},
+		{Type: tokenItalic, Start: 153, End: 155},
+		{Type: tokenText, Start: 155, End: 163, Text: " a < b\n\n"},
+		{Type: tokenBold, Start: 163, End: 166},
+		{Type: tokenItalic, Start: 166, End: 168},
+		{Type: tokenText, Start: 168, End: 172, Text: "both"},
+		{Type: tokenBold, Start: 172, End: 175},
+		{Type: tokenItalic, Start: 175, End: 177},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokenizeWikitext =\n%+v\nnot\n%+v", got, want)
+	}
+}
+
+func TestTokenizeWikitextCoversText(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"plain",
+		"[[unterminated {{also <!-- and",
+		"=Not a heading==\n== Heading ==",
+		"\n\n* a\n** b\n#: c",
+		"[not a link] {{a|{{b}}|[[c]]}}}",
+	} {
+		end := 0
+		for _, tok := range tokenizeWikitext(text) {
+			if tok.Start != end || tok.End <= tok.Start {
+				t.Errorf("%q: token %+v doesn't follow on from %d", text, tok, end)
+			}
+			end = tok.End
+		}
+		if end != len(text) {
+			t.Errorf("%q: tokens end at %d; not %d", text, end, len(text))
+		}
+	}
+}
+
+func TestHandleTokens(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Foo", "See [[Bar]].")})
+
+	w := httptest.NewRecorder()
+	handle(handleTokens)(w, httptest.NewRequest("GET", "/tokens?title=Foo", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if want := `{"type":"link","start":4,"end":11,"text":"Bar","target":"Bar"}`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected response to contain %s; got %s", want, w.Body)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	trendingHalfLife = flag.Duration("trendingHalfLife", time.Hour, "how long it takes a request to count half as much towards /trending")
+	trendingSize     = flag.Int("trendingSize", 10000, "the maximum number of titles tracked for /trending")
+)
+
+// trending is recreated with the configured settings by run.
+var trending = newTrendingCounter(*trendingHalfLife, *trendingSize)
+
+type trendingTitle struct {
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+type decayedScore struct {
+	score float64
+	at    time.Time
+}
+
+// trendingCounter counts requests per title with exponential decay, so old
+// requests fade out instead of falling off a fixed window. At most size
+// titles are tracked; once full the lowest scoring ones are evicted. It is
+// safe for concurrent use.
+type trendingCounter struct {
+	mu       sync.Mutex
+	halfLife time.Duration
+	size     int
+	scores   map[string]*decayedScore
+}
+
+func newTrendingCounter(halfLife time.Duration, size int) *trendingCounter {
+	return &trendingCounter{
+		halfLife: halfLife,
+		size:     size,
+		scores:   map[string]*decayedScore{},
+	}
+}
+
+// decay returns s's score as of now.
+func (c *trendingCounter) decay(s *decayedScore, now time.Time) float64 {
+	elapsed := now.Sub(s.at)
+	if elapsed <= 0 || c.halfLife <= 0 {
+		return s.score
+	}
+	return s.score * math.Exp2(-float64(elapsed)/float64(c.halfLife))
+}
+
+func (c *trendingCounter) record(title string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.scores[title]; ok {
+		s.score = c.decay(s, now) + 1
+		s.at = now
+		return
+	}
+	if c.size > 0 && len(c.scores) >= c.size {
+		c.evict(now)
+	}
+	c.scores[title] = &decayedScore{score: 1, at: now}
+}
+
+// evict drops the lowest scoring tenth of the tracked titles so that evicting
+// isn't needed on every new title once the counter is full.
+func (c *trendingCounter) evict(now time.Time) {
+	ranked := c.ranked(now)
+	keep := c.size - c.size/10 - 1
+	if keep < 0 {
+		keep = 0
+	}
+	for _, t := range ranked[keep:] {
+		delete(c.scores, t.Title)
+	}
+}
+
+// ranked returns every tracked title ordered by descending score. c.mu must
+// be held.
+func (c *trendingCounter) ranked(now time.Time) []trendingTitle {
+	ranked := make([]trendingTitle, 0, len(c.scores))
+	for title, s := range c.scores {
+		ranked = append(ranked, trendingTitle{Title: title, Score: c.decay(s, now)})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Title < ranked[j].Title
+	})
+	return ranked
+}
+
+// top returns the n highest scoring titles.
+func (c *trendingCounter) top(n int, now time.Time) []trendingTitle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ranked := c.ranked(now)
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// handleTrending serves /trending?limit=N, returning the most requested
+// articles, weighted towards recent requests.
+func handleTrending(w http.ResponseWriter, r *http.Request) error {
+	limit, err := intParam(r, "limit", 20, 1, 100)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, trending.top(limit, time.Now()))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTrendingCounter(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	c := newTrendingCounter(time.Hour, 100)
+
+	for i := 0; i < 4; i++ {
+		c.record("Old", now)
+	}
+	later := now.Add(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		c.record("New", later)
+	}
+
+	got := c.top(10, later)
+	if len(got) != 2 || got[0].Title != "New" || got[1].Title != "Old" {
+		t.Fatalf("top = %+v; expected New then Old", got)
+	}
+	if got[1].Score != 1 {
+		t.Errorf("score of Old after two half-lives = %v; not 1", got[1].Score)
+	}
+	if got := c.top(1, later); len(got) != 1 {
+		t.Errorf("top(1) returned %d titles", len(got))
+	}
+}
+
+func TestTrendingCounterEvicts(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	c := newTrendingCounter(time.Hour, 10)
+
+	for i := 0; i < 5; i++ {
+		c.record("Popular", now)
+	}
+	for i := 0; i < 50; i++ {
+		c.record(fmt.Sprintf("Page %d", i), now)
+	}
+
+	if len(c.scores) > 10 {
+		t.Errorf("tracking %d titles; expected at most 10", len(c.scores))
+	}
+	if got := c.top(1, now); got[0].Title != "Popular" {
+		t.Errorf("top = %+v; expected Popular to survive eviction", got)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/creachadair/cityhash"
+	"github.com/pkg/errors"
+)
+
+var (
+	articles2            = flag.String("articles2", "", "a second articles dump, such as an older one, to compare articles against on /versiondiff")
+	index2               = flag.String("index2", "", "the multistream index of -articles2")
+	versionDiffCacheSize = flag.Int("versionDiffCacheSize", 100, "the number of /versiondiff diffs to cache")
+)
+
+// versionDiffCache is recreated with the configured size by run.
+var versionDiffCache = newLRUCache(*versionDiffCacheSize)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffEdits is the most line edits diffLines looks for before giving up
+// and replacing the changed lines wholesale, which bounds its time and
+// memory on texts that have little in common.
+const maxDiffEdits = 2000
+
+// secondDump holds the index of the -articles2 dump, which is loaded after
+// the main index when it's set.
+var secondDump = struct {
+	sync.Mutex
+
+	loaded     bool
+	generation int
+	offsets    offsetStore
+	offsetSize map[int]int
+}{}
+
+func loadSecondDump() error {
+	if *index2 == "" {
+		return errors.Errorf("-articles2 requires -index2")
+	}
+	log.Printf("Reading the index of %s...", *articles2)
+	idx := newOffsetIndex()
+	idx.untracked = true
+	if err := readIndexFile(*index2, idx); err != nil {
+		return err
+	}
+	offsets, err := idx.finish()
+	if err != nil {
+		return err
+	}
+
+	secondDump.Lock()
+	old := secondDump.offsets
+	secondDump.loaded = true
+	secondDump.generation++
+	secondDump.offsets = offsets
+	secondDump.offsetSize = idx.offsetSize
+	secondDump.Unlock()
+	if old != nil {
+		old.close()
+	}
+	log.Printf("Done reading the index of %s! %d entries", *articles2, offsets.len())
+	return nil
+}
+
+// secondDumpArticle reads the article title from the -articles2 dump,
+// returning nil if it isn't in it.
+func secondDumpArticle(title string) (*page, indexEntry, error) {
+	secondDump.Lock()
+	if !secondDump.loaded {
+		secondDump.Unlock()
+		return nil, indexEntry{}, statusErrorf(http.StatusServiceUnavailable, "the -articles2 index is still loading")
+	}
+	var meta indexEntry
+	found := false
+	for _, variant := range titleVariants(title) {
+		if meta, found = secondDump.offsets.lookup(cityhash.Hash64([]byte(variant))); found {
+			break
+		}
+	}
+	maxTries := secondDump.offsetSize[meta.seek] + *findPageMargin
+	secondDump.Unlock()
+	if !found {
+		return nil, indexEntry{}, nil
+	}
+
+	f, err := os.Open(*articles2)
+	if err != nil {
+		return nil, indexEntry{}, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(meta.seek), io.SeekStart); err != nil {
+		return nil, indexEntry{}, err
+	}
+	r, err := utf8Reader(*articles2, f)
+	if err != nil {
+		return nil, indexEntry{}, err
+	}
+	raw, _, err := findPage(r, func(n, id int) bool {
+		return id == meta.id
+	}, maxTries)
+	if err != nil {
+		return nil, indexEntry{}, err
+	}
+	p, err := decodePage(raw)
+	if err != nil {
+		return nil, indexEntry{}, err
+	}
+	return &p, meta, nil
+}
+
+// diffOp is a line of a diff: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits text into lines, without a final empty line for a
+// trailing newline.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the edits turning a into b, using Myers' algorithm on the
+// lines between their common prefix and suffix.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d][k+d] is the furthest x reached on diagonal k after d edits.
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		if d > maxDiffEdits {
+			ops := make([]diffOp, 0, n+m)
+			for _, line := range a {
+				ops = append(ops, diffOp{'-', line})
+			}
+			for _, line := range b {
+				ops = append(ops, diffOp{'+', line})
+			}
+			return ops
+		}
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				done = true
+			}
+		}
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[off-d:off+d+1])
+		trace = append(trace, snapshot)
+		if done {
+			break
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff formats ops as the hunks of a unified diff, with diffContext
+// lines of context around each change. It's empty if nothing changed.
+func unifiedDiff(ops []diffOp) string {
+	// aLines[i] and bLines[i] are the lines of a and b before ops[i].
+	aLines, bLines := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.kind != '+' {
+			aLines[i+1]++
+		}
+		if op.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// The hunk runs until there are more than twice the context lines
+		// without a change.
+		end, unchanged := i, 0
+		for ; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		if unchanged > diffContext {
+			end -= unchanged - diffContext
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(aLines[start], aLines[end]), hunkRange(bLines[start], bLines[end]))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the lines from start to end of a hunk header.
+func hunkRange(start, end int) string {
+	switch end - start {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, end-start)
+}
+
+type versionDiffKey struct {
+	a, b       indexEntry
+	aGen, bGen int
+}
+
+// handleVersionDiff serves /versiondiff?title=..., returning a unified diff
+// from the article's text in the -articles2 dump to its text in the main
+// one, or nothing if it's the same. Diffs are computed when they're asked for
+// and cached. It's a 404 saying which dump has the article if only one does.
+func handleVersionDiff(w http.ResponseWriter, r *http.Request) error {
+	if *articles2 == "" {
+		return statusErrorf(http.StatusServiceUnavailable, "version diffs disabled, start with -articles2 and -index2")
+	}
+	title, err := validateTitle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	old, oldMeta, err := secondDumpArticle(title)
+	if err != nil {
+		return articlesUnavailable(err)
+	}
+	meta, err := fetchArticle(title)
+	if isArticleNotFound(err) {
+		if old == nil {
+			return articleNotFound("%q is in neither dump", title)
+		}
+		return articleNotFound("%q is only in %s", title, *articles2)
+	} else if err != nil {
+		return err
+	}
+	if old == nil {
+		return articleNotFound("%q is only in %s", title, *articlesFile)
+	}
+
+	mu.Lock()
+	gen := mu.generation
+	mu.Unlock()
+	secondDump.Lock()
+	key := versionDiffKey{a: oldMeta, b: meta, aGen: secondDump.generation, bGen: gen}
+	secondDump.Unlock()
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	if diff, ok := versionDiffCache.get(key); ok {
+		_, err := io.WriteString(w, diff.(string))
+		return err
+	}
+	p, err := readArticle(meta)
+	if err != nil {
+		return err
+	}
+	diff := ""
+	if hunks := unifiedDiff(diffLines(splitLines(old.Text), splitLines(p.Text))); hunks != "" {
+		diff = fmt.Sprintf("--- a/%s\t%s\n+++ b/%s\t%s\n%s", old.Title, old.Timestamp, p.Title, p.Timestamp, hunks)
+	}
+	versionDiffCache.add(key, diff)
+	_, err = io.WriteString(w, diff)
+	return err
+}
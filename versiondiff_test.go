@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\nc", "a\nb\nc", ""},
+		{"a\nb\nc", "a\nx\nc", "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"", "a\nb", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"a\nb", "", "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"1\n2\n3\n4\n5\n6\n7\n8", "1\n2\n3\n4\n5\n6\n7\n8\n9", "@@ -6,3 +6,4 @@\n 6\n 7\n 8\n+9\n"},
+		// Changes more than twice the context apart are separate hunks.
+		{
+			"a\n1\n2\n3\n4\n5\n6\n7\nb",
+			"A\n1\n2\n3\n4\n5\n6\n7\nB",
+			"@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-b\n+B\n",
+		},
+		// Closer changes share a hunk.
+		{
+			"a\n1\n2\n3\nb",
+			"A\n1\n2\n3\nB",
+			"@@ -1,5 +1,5 @@\n-a\n+A\n 1\n 2\n 3\n-b\n+B\n",
+		},
+	}
+	for _, c := range cases {
+		if got := unifiedDiff(diffLines(splitLines(c.a), splitLines(c.b))); got != c.want {
+			t.Errorf("unifiedDiff(%q, %q) = %q; not %q", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	a := splitLines("a\nb\nc\nd\ne\nf")
+	b := splitLines("a\nc\nd\nx\ne\nf\ng")
+	var got []string
+	for _, op := range diffLines(a, b) {
+		got = append(got, string(op.kind)+op.line)
+	}
+	want := " a -b  c  d +x  e  f +g"
+	if strings.Join(got, " ") != want {
+		t.Errorf("diffLines = %q; not %q", strings.Join(got, " "), want)
+	}
+}
+
+// useSecondDump writes pages as an uncompressed -articles2 dump with a
+// matching -index2 and loads it, restoring the previous ones when the test
+// finishes.
+func useSecondDump(t *testing.T, pages ...page) {
+	t.Helper()
+
+	var buf, index bytes.Buffer
+	buf.WriteString("<mediawiki>\n")
+	seek := buf.Len()
+	for _, p := range pages {
+		body, err := xml.MarshalIndent(p, "  ", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(body)
+		buf.WriteString("\n")
+		fmt.Fprintf(&index, "%d:%d:%s\n", seek, p.ID, p.Title)
+	}
+	buf.WriteString("</mediawiki>\n")
+	dir := t.TempDir()
+	articles, idx := filepath.Join(dir, "old.xml"), filepath.Join(dir, "old-index.txt")
+	if err := ioutil.WriteFile(articles, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(idx, index.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldArticles, oldIndex, oldCache := *articles2, *index2, versionDiffCache
+	secondDump.Lock()
+	oldLoaded, oldOffsets, oldOffsetSize := secondDump.loaded, secondDump.offsets, secondDump.offsetSize
+	secondDump.Unlock()
+	*articles2, *index2, versionDiffCache = articles, idx, newLRUCache(10)
+	if err := loadSecondDump(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		*articles2, *index2, versionDiffCache = oldArticles, oldIndex, oldCache
+		secondDump.Lock()
+		secondDump.loaded, secondDump.offsets, secondDump.offsetSize = oldLoaded, oldOffsets, oldOffsetSize
+		secondDump.generation++
+		secondDump.Unlock()
+	})
+}
+
+func TestHandleVersionDiff(t *testing.T) {
+	useTestDump(t, []page{
+		testPage(1, "Foo", "one\ntwo\nthree\n"),
+		testPage(2, "Same", "unchanged"),
+		testPage(3, "New", "new"),
+	})
+	useSecondDump(t,
+		testPage(1, "Foo", "one\n2\nthree\n"),
+		testPage(2, "Same", "unchanged"),
+		testPage(4, "Gone", "gone"),
+	)
+
+	cases := []struct {
+		title string
+		code  int
+		want  string
+	}{
+		{"Foo", http.StatusOK, "--- a/Foo\t2022-01-01T00:00:00Z\n+++ b/Foo\t2022-01-01T00:00:00Z\n@@ -1,3 +1,3 @@\n one\n-2\n+two\n three\n"},
+		{"foo", http.StatusOK, "--- a/Foo"},
+		{"Same", http.StatusOK, ""},
+		{"New", http.StatusNotFound, "only in " + *articlesFile},
+		{"Gone", http.StatusNotFound, "only in " + *articles2},
+		{"Missing", http.StatusNotFound, "neither dump"},
+	}
+	for _, c := range cases {
+		// The second request of each is served from the cache.
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("GET", "/versiondiff?title="+c.title, nil)
+			w := httptest.NewRecorder()
+			handle(handleVersionDiff)(w, req)
+			if w.Code != c.code {
+				t.Errorf("%s: status = %d; not %d: %s", c.title, w.Code, c.code, w.Body)
+			}
+			if got := w.Body.String(); !strings.Contains(got, c.want) || (c.want == "" && got != "") {
+				t.Errorf("%s: body = %q; expected %q", c.title, got, c.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxWordFreqTop is the most words /wordfreq returns.
+const maxWordFreqTop = 1000
+
+// stopwordLists are the lists /wordfreq?stopwords=... can leave out, by
+// language.
+var stopwordLists = map[string]map[string]bool{
+	"en": wordSet("a about above after again against all am an and any are as at be because been before being below " +
+		"between both but by can could did do does doing down during each few for from further had has have having " +
+		"he her here hers herself him himself his how i if in into is it its itself just me more most my myself no " +
+		"nor not now of off on once only or other our ours ourselves out over own same she should so some such than " +
+		"that the their theirs them themselves then there these they this those through to too under until up very " +
+		"was we were what when where which while who whom why will with would you your yours yourself yourselves"),
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// splitWords returns the words of text, lowercased. A word is a run of
+// letters, combining marks and digits, and an apostrophe between two letters,
+// as in "don't", is part of the word; everything else separates words.
+func splitWords(text string) []string {
+	var words []string
+	runes := []rune(text)
+	start := -1
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r)
+	}
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) {
+			r := runes[i]
+			if isWord(r) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if (r == '\'' || r == '’') && start >= 0 && i+1 < len(runes) && unicode.IsLetter(runes[i-1]) && unicode.IsLetter(runes[i+1]) {
+				continue
+			}
+		}
+		if start >= 0 {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = -1
+		}
+	}
+	return words
+}
+
+type wordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+type wordFrequencies struct {
+	Title string `json:"title"`
+	// TotalWords and UniqueWords count every word left after removing
+	// stopwords, not just the top ones.
+	TotalWords  int         `json:"totalWords"`
+	UniqueWords int         `json:"uniqueWords"`
+	Words       []wordCount `json:"words"`
+}
+
+// topWords returns the top n of words by count, most common first and
+// then alphabetically, leaving out any in stopwords, along with the number
+// of words and distinct words counted.
+func topWords(words []string, stopwords map[string]bool, n int) ([]wordCount, int, int) {
+	counts := map[string]int{}
+	total := 0
+	for _, w := range words {
+		if stopwords[w] {
+			continue
+		}
+		counts[w]++
+		total++
+	}
+	top := make([]wordCount, 0, len(counts))
+	for w, c := range counts {
+		top = append(top, wordCount{w, c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Word < top[j].Word
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top, total, len(counts)
+}
+
+// handleWordFreq serves /wordfreq?title=...&top=N, returning the N most
+// common words of an article's plain text with their counts, see splitWords
+// for what counts as a word. stopwords=en leaves out common English words
+// like "the" and "of".
+func handleWordFreq(w http.ResponseWriter, r *http.Request) error {
+	top, err := intParam(r, "top", 50, 1, maxWordFreqTop)
+	if err != nil {
+		return err
+	}
+	var stopwords map[string]bool
+	if lang := r.URL.Query().Get("stopwords"); lang != "" {
+		var ok bool
+		if stopwords, ok = stopwordLists[lang]; !ok {
+			return statusErrorf(http.StatusBadRequest, "no stopword list for %q, expected en", lang)
+		}
+	}
+	p, err := lookupArticle(r.URL.Query().Get("title"))
+	if err != nil {
+		return err
+	}
+	words, total, unique := topWords(splitWords(plainText(p.Text)), stopwords, top)
+	return writeJSON(w, r, wordFrequencies{
+		Title:       p.Title,
+		TotalWords:  total,
+		UniqueWords: unique,
+		Words:       words,
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []string
+	}{
+		{"The cat sat.", []string{"the", "cat", "sat"}},
+		{"don't 'quote' rock-n-roll", []string{"don't", "quote", "rock", "n", "roll"}},
+		{"Born 1879 in Ulm", []string{"born", "1879", "in", "ulm"}},
+		{"Café Ποσειδῶν 東京", []string{"café", "ποσειδῶν", "東京"}},
+		{" ... ", nil},
+	} {
+		if got := splitWords(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitWords(%q) = %q; not %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestHandleWordFreq(t *testing.T) {
+	useTestDump(t, []page{testPage(1, "Cats", "The cat and the '''dog'''. The [[cat]] sat.")})
+
+	for _, c := range []struct {
+		query         string
+		status        int
+		total, unique int
+		want          []wordCount
+	}{
+		{"title=Cats", http.StatusOK, 8, 5, []wordCount{{"the", 3}, {"cat", 2}, {"and", 1}, {"dog", 1}, {"sat", 1}}},
+		{"title=Cats&top=2", http.StatusOK, 8, 5, []wordCount{{"the", 3}, {"cat", 2}}},
+		{"title=Cats&stopwords=en", http.StatusOK, 4, 3, []wordCount{{"cat", 2}, {"dog", 1}, {"sat", 1}}},
+		{"title=Cats&stopwords=xx", http.StatusBadRequest, 0, 0, nil},
+		{"title=Cats&top=1001", http.StatusBadRequest, 0, 0, nil},
+	} {
+		w := httptest.NewRecorder()
+		handle(handleWordFreq)(w, httptest.NewRequest("GET", "/wordfreq?"+c.query, nil))
+		if w.Code != c.status {
+			t.Errorf("%s: status = %d; not %d: %s", c.query, w.Code, c.status, w.Body)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var got wordFrequencies
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.TotalWords != c.total || got.UniqueWords != c.unique || !reflect.DeepEqual(got.Words, c.want) {
+			t.Errorf("%s: got %+v; expected %d words, %d unique, top %+v", c.query, got, c.total, c.unique, c.want)
+		}
+	}
+}